@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// At startup the manager looks for ssh processes forwarding ports that it
+// did not start, e.g. run by hand or left behind by an instance that was
+// killed, and offers to adopt them into the list. It cannot read their
+// output, so their log only has what the manager itself finds; stopping
+// one kills it, and starting or restarting it runs a new ssh with the same
+// host and forwards.
+
+// adoptWatchInterval is how often an adopted process is checked for, as
+// it is not the manager's child to wait for.
+const adoptWatchInterval = time.Second
+
+// process is a running program and its arguments.
+type process struct {
+	pid  int
+	args []string
+}
+
+// isSSHBinary reports whether the program path is ssh.
+func isSSHBinary(path string) bool {
+	name := strings.ToLower(filepath.Base(strings.ReplaceAll(path, `\`, "/")))
+	return name == "ssh" || name == "ssh.exe"
+}
+
+// sshFlagsWithArg are ssh's options that take an argument, see ssh(1).
+const sshFlagsWithArg = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// adoptable is an ssh process found forwarding ports.
+type adoptable struct {
+	pid     int
+	spec    tunnelSpec
+	dropped []string // options a restart of it won't have, e.g. -J
+}
+
+// parseSSHProcess reads the forwards, host, user and identity file of an
+// ssh command line. It reports false when it forwards nothing the manager
+// can show, e.g. a plain login session.
+func parseSSHProcess(args []string) (adoptable, bool) {
+	var a adoptable
+	var forwards []forwardSpec
+	user, port := "", ""
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			// The host; anything after it is a remote command
+			a.spec.Host = arg
+			if user != "" && !strings.Contains(arg, "@") {
+				a.spec.Host = user + "@" + arg
+			}
+			if i+1 < len(args) {
+				a.dropped = append(a.dropped, "remote command")
+			}
+			break
+		}
+		// Options without arguments can be grouped, as in -fNT
+		for j := 1; j < len(arg); j++ {
+			flag := arg[j]
+			if !strings.ContainsRune(sshFlagsWithArg, rune(flag)) {
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			switch flag {
+			case 'L', 'R', 'D':
+				if f, err := parseForward("-" + string(flag) + " " + stripBindAddress(flag, value)); err == nil {
+					forwards = append(forwards, f)
+				} else {
+					a.dropped = append(a.dropped, "-"+string(flag)+" "+value)
+				}
+			case 'l':
+				user = value
+			case 'p':
+				port = value
+			case 'i':
+				a.spec.IdentityFile = value
+			default:
+				a.dropped = append(a.dropped, "-"+string(flag)+" "+value)
+			}
+			break
+		}
+	}
+	if a.spec.Host == "" || len(forwards) == 0 {
+		return a, false
+	}
+	if port != "" && port != "22" {
+		a.dropped = append(a.dropped, "-p "+port)
+	}
+	first := forwards[0]
+	a.spec.Type, a.spec.LocalPort, a.spec.RemotePort, a.spec.RemoteHost = first.Type, first.LocalPort, first.RemotePort, first.RemoteHost
+	a.spec.Forwards = forwards[1:]
+	a.spec.Tag = adoptedTag(a.spec)
+	return a, true
+}
+
+// stripBindAddress drops the bind address parseForward doesn't take from
+// a forward, e.g. 127.0.0.1:8080:web:80, and a remote forward's
+// destination when it is this machine.
+func stripBindAddress(flag byte, value string) string {
+	parts := strings.Split(value, ":")
+	switch {
+	case flag == 'D' && len(parts) == 2:
+		return parts[1]
+	case flag == 'L' && len(parts) == 4:
+		return strings.Join(parts[1:], ":")
+	case flag == 'R' && len(parts) == 4:
+		parts = parts[1:]
+	}
+	if flag == 'R' && len(parts) == 3 && (parts[1] == "localhost" || parts[1] == "127.0.0.1") {
+		return parts[0] + ":" + parts[2]
+	}
+	return value
+}
+
+// adoptedTag names an adopted tunnel after its host and local port.
+func adoptedTag(spec tunnelSpec) string {
+	host := spec.Host
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	host, _, _ = strings.Cut(host, ".")
+	return host + "-" + spec.LocalPort
+}
+
+type adoptableMsg struct {
+	found []adoptable
+	err   error
+}
+
+// findAdoptableCmd lists the ssh processes forwarding ports, leaving out
+// known ones: the headless tunnels and the pids in known.
+func findAdoptableCmd(known []int) tea.Cmd {
+	return func() tea.Msg {
+		procs, err := listSSHProcesses()
+		if err != nil {
+			return adoptableMsg{err: err}
+		}
+		if headless, err := loadHeadlessTunnels(); err == nil {
+			for _, h := range headless {
+				known = append(known, h.PID)
+			}
+		}
+		var found []adoptable
+		for _, p := range procs {
+			if slices.Contains(known, p.pid) {
+				continue
+			}
+			if a, ok := parseSSHProcess(p.args); ok {
+				a.pid = p.pid
+				found = append(found, a)
+			}
+		}
+		return adoptableMsg{found: found}
+	}
+}
+
+// knownPIDs are the processes of the tunnels in the list.
+func (m model) knownPIDs() []int {
+	var pids []int
+	for _, t := range m.tunnels {
+		if t.cmd != nil && t.cmd.Process != nil {
+			pids = append(pids, t.cmd.Process.Pid)
+		}
+		if t.adoptedPID != 0 {
+			pids = append(pids, t.adoptedPID)
+		}
+	}
+	return pids
+}
+
+// offerAdoption asks in the status bar whether to adopt what was found.
+func (m model) offerAdoption(msg adoptableMsg) model {
+	if msg.err != nil {
+		slog.Warn("cannot list ssh processes", "err", msg.err)
+		return m
+	}
+	if len(msg.found) == 0 {
+		return m
+	}
+	known := m.knownPIDs()
+	m.adoptable = slices.DeleteFunc(msg.found, func(a adoptable) bool { return slices.Contains(known, a.pid) })
+	if len(m.adoptable) == 0 {
+		return m
+	}
+	tags := make([]string, len(m.adoptable))
+	for i, a := range m.adoptable {
+		tags[i] = fmt.Sprintf("%s (%s)", a.spec.Host, a.spec.ports())
+	}
+	slog.Info("found ssh tunnels started elsewhere", "count", len(tags))
+	m.adoptPending = true
+	m.adoptReturnStatus = m.statusMessage
+	m.statusMessage = fmt.Sprintf("Found %d ssh tunnel(s) not started here: %s • y adopt • any other key ignores them", len(tags), strings.Join(tags, ", "))
+	return m
+}
+
+func (m model) handleAdoptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "y" || msg.String() == "Y" {
+		if !m.admin() {
+			// Left for an admin: the processes run as the owner
+			m.statusMessage = m.refusal("adopt tunnels") + " • an admin can press y to adopt them"
+			return m, nil
+		}
+		m.adoptPending = false
+		var cmds []tea.Cmd
+		for _, a := range m.adoptable {
+			cmds = append(cmds, m.adopt(a)...)
+		}
+		m.statusMessage = fmt.Sprintf("Adopted %d tunnel(s)", len(m.adoptable))
+		m.adoptable = nil
+		m.updateTunnelList()
+		return m, tea.Batch(cmds...)
+	}
+	m.adoptPending = false
+	m.adoptable = nil
+	m.statusMessage = m.adoptReturnStatus
+	return m, nil
+}
+
+// adopt adds the ssh process a to the list as an active tunnel.
+func (m *model) adopt(a adoptable) []tea.Cmd {
+	spec := a.spec
+	t := &tunnel{
+		id:         m.nextTunnelID,
+		logs:       newLogRing(m.cfg.logLines()),
+		tag:        spec.Tag,
+		host:       spec.Host,
+		localPort:  spec.LocalPort,
+		remotePort: spec.RemotePort,
+		remoteHost: spec.RemoteHost,
+		tunnelType: spec.Type,
+		identity:   spec.IdentityFile,
+		forwards:   make([]forwardStatus, len(spec.Forwards)),
+		endpoint:   resolveSSHEndpoint(spec.Host),
+		adoptedPID: a.pid,
+		active:     true,
+		startedAt:  time.Now(),
+		createdAt:  time.Now(),
+	}
+	for i, f := range spec.Forwards {
+		t.forwards[i].forwardSpec = f
+	}
+	m.nextTunnelID++
+	m.tunnels = append(m.tunnels, t)
+	slog.Info("tunnel adopted", append(t.logAttrs(), "pid", a.pid)...)
+	t.appendLog(fmt.Sprintf("Adopted ssh process %d, started outside the manager", a.pid))
+	t.appendLog("Its output goes elsewhere; only the manager's own checks are logged here")
+	if len(a.dropped) > 0 {
+		t.appendLog("Starting it again from here leaves out: " + strings.Join(a.dropped, ", "))
+	}
+
+	cmds := []tea.Cmd{detectProtocolCmd(t.id, t.localPort), watchAdoptedCmd(t.id, a.pid)}
+	for i, f := range t.forwards {
+		cmds = append(cmds, detectForwardCmd(t.id, i+1, f.LocalPort))
+	}
+	return cmds
+}
+
+type adoptedExitMsg struct {
+	tunnelID int
+	pid      int
+}
+
+// watchAdoptedCmd reports when the adopted process pid is gone.
+func watchAdoptedCmd(tunnelID, pid int) tea.Cmd {
+	return func() tea.Msg {
+		for processAlive(pid) {
+			time.Sleep(adoptWatchInterval)
+		}
+		return adoptedExitMsg{tunnelID: tunnelID, pid: pid}
+	}
+}
+
+// adoptedExited marks the tunnel down, or starts it again when it was
+// being restarted, as tunnelExitMsg does for the manager's own processes.
+func (m model) adoptedExited(msg adoptedExitMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || t.adoptedPID != msg.pid {
+		return m, nil
+	}
+	if t.restarting {
+		t.restarting = false
+		m.pendingStarts = append(m.pendingStarts, t.id)
+		if m.view == viewMain {
+			return m.startNext()
+		}
+		return m, nil
+	}
+	if !t.active {
+		return m, nil
+	}
+	slog.Warn("adopted ssh exited", append(t.logAttrs(), "pid", msg.pid)...)
+	t.appendLog(fmt.Sprintf("ssh process %d exited, tunnel is down", msg.pid))
+	t.stop()
+	m.markFailed(t, fmt.Sprintf("ssh process %d exited", msg.pid))
+	m.updateTunnelList()
+	return m, m.notify(t.tag+" is down", fmt.Sprintf("ssh to %s exited", t.host))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The wizard's advanced options turn on agent forwarding (ssh -A) and X11
+// forwarding (-X, or -Y trusted) for a tunnel. ssh forwards both into
+// sessions only, and a tunnel's ssh -N opens none, so they apply to the
+// sessions that log in the way the tunnel does: the shell key (O) and,
+// with shared connections, ssh -S through the tunnel's master, e.g. for git
+// on the host to use the keys in the local ssh-agent.
+
+const (
+	x11Untrusted = "untrusted" // -X, restricted by the X11 SECURITY extension
+	x11Trusted   = "trusted"   // -Y
+)
+
+// advancedOptions are the toggles of the step; x11 is "" for the agent.
+var advancedOptions = []struct{ label, hint, x11 string }{
+	{"Agent forwarding (-A)", "Sessions on the host use the keys in the local ssh-agent, e.g. for git; anyone with root there can use them too", ""},
+	{"X11 forwarding (-X)", "X programs started on the host show here, restricted by the X11 SECURITY extension", x11Untrusted},
+	{"Trusted X11 forwarding (-Y)", "The same without the restrictions, for programs that fail under them", x11Trusted},
+}
+
+func checkX11(mode string) error {
+	switch mode {
+	case "", x11Untrusted, x11Trusted:
+		return nil
+	}
+	return fmt.Errorf("x11 must be %s or %s, got %q", x11Untrusted, x11Trusted, mode)
+}
+
+// forwardingArgs are ssh's options for the spec's agent and X11
+// forwarding.
+func (s tunnelSpec) forwardingArgs() []string {
+	var args []string
+	if s.ForwardAgent {
+		args = append(args, "-A")
+	}
+	switch s.X11 {
+	case x11Untrusted:
+		args = append(args, "-X")
+	case x11Trusted:
+		args = append(args, "-Y")
+	}
+	return args
+}
+
+// forwarding shows the spec's agent and X11 forwarding; "" for neither.
+func (s tunnelSpec) forwarding() string {
+	var parts []string
+	if s.ForwardAgent {
+		parts = append(parts, "agent")
+	}
+	if s.X11 != "" {
+		parts = append(parts, "X11 ("+s.X11+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkForwarding refuses agent and X11 forwarding that the policy's ssh
+// options turn off: -A and -X would win over them.
+func (p policy) checkForwarding(spec tunnelSpec) error {
+	off := func(option string) bool {
+		for key, value := range p.SSHOptions {
+			if strings.EqualFold(key, option) && strings.EqualFold(value, "no") {
+				return true
+			}
+		}
+		return false
+	}
+	if spec.ForwardAgent && off("ForwardAgent") {
+		return fmt.Errorf("blocked by policy: agent forwarding is turned off")
+	}
+	if spec.X11 != "" && off("ForwardX11") {
+		return fmt.Errorf("blocked by policy: X11 forwarding is turned off")
+	}
+	return nil
+}
+
+// toAdvancedStep asks for the advanced options after the ciphers, for the
+// ssh binary only, and goes on to the auto close.
+func (m *model) toAdvancedStep() {
+	if m.tempBackend != "" || m.cfg.SSHTransport == nativeBackend {
+		m.toCloseSteps()
+		return
+	}
+	m.step = stepAdvanced
+	m.advancedIndex = 0
+	m.setInput("")
+	m.err = nil
+}
+
+func (m model) handleAdvancedKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.view = viewMain
+	case "up", "k":
+		if m.advancedIndex > 0 {
+			m.advancedIndex--
+		}
+	case "down", "j":
+		if m.advancedIndex < len(advancedOptions)-1 {
+			m.advancedIndex++
+		}
+	case " ", "x":
+		m.err = nil
+		if mode := advancedOptions[m.advancedIndex].x11; mode == "" {
+			m.tempAgent = !m.tempAgent
+		} else {
+			m.tempX11 = toggleX11(m.tempX11, mode)
+		}
+	case "enter":
+		if err := m.policy.checkForwarding(m.tempSpec()); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.toCloseSteps()
+	}
+	return m, nil
+}
+
+// toggleX11 turns mode on, replacing the other one, or off.
+func toggleX11(current, mode string) string {
+	if current == mode {
+		return ""
+	}
+	return mode
+}
+
+func (m model) renderAdvancedStep() string {
+	content := lipgloss.NewStyle().Bold(true).Render("Advanced options:") + "\n\n"
+	for i, o := range advancedOptions {
+		on := m.tempAgent
+		if o.x11 != "" {
+			on = m.tempX11 == o.x11
+		}
+		box := "[ ] "
+		if on {
+			box = "[x] "
+		}
+		if i == m.advancedIndex {
+			content += selectedStyle.Render("  ▶  " + box + o.label)
+		} else {
+			content += "     " + box + o.label
+		}
+		content += "\n"
+	}
+	content += "\n" + subtleStyle.Render(advancedOptions[m.advancedIndex].hint)
+	content += "\n" + subtleStyle.Render("ssh forwards them into sessions only: the shell key (O), and ssh -S through a shared master")
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	return content + "\n\n" + subtleStyle.Render("Space toggles • ↑/↓ to move • Enter to continue • Esc to cancel")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging points slog's default logger at the --log-file, or discards
+// everything when there is none: the TUI owns the terminal, so nothing may
+// go to stderr. This log is about the manager's own decisions; ssh output
+// stays in each tunnel's log panel.
+func setupLogging(path, level string) (func(), error) {
+	if path == "" {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		return func() {}, nil
+	}
+
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: lvl})))
+	slog.Info("starting", "version", Version, "pid", os.Getpid())
+	return func() { f.Close() }, nil
+}
+
+// logAttrs are the attributes identifying a tunnel in the app log.
+func (t *tunnel) logAttrs() []any {
+	return []any{"tunnel", t.id, "tag", t.tag, "host", t.host}
+}
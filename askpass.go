@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Password, passphrase and host key prompts. ssh runs without a terminal, so the
+// manager points it at its own binary as the SSH_ASKPASS program (OpenSSH
+// 8.4 or later). Started that way, the binary hands ssh's prompt to the
+// manager over a unix socket in a private temporary directory and prints
+// what the user typed into the TUI. The native client asks the prompter
+// directly.
+
+const (
+	askpassSocketEnv = "SSH_TUNNEL_MANAGER_ASKPASS"
+	askpassTunnelEnv = "SSH_TUNNEL_MANAGER_TUNNEL"
+)
+
+type askpassRequest struct {
+	Tunnel int    `json:"tunnel"`
+	Prompt string `json:"prompt"`
+}
+
+type askpassResponse struct {
+	Answer string `json:"answer"`
+	OK     bool   `json:"ok"`
+}
+
+// runAskpass is the SSH_ASKPASS side: ssh runs it with the prompt as its
+// argument and reads the answer from stdout.
+func runAskpass(prompt string) error {
+	conn, err := net.Dial("unix", os.Getenv(askpassSocketEnv))
+	if err != nil {
+		return fmt.Errorf("cannot reach the manager: %v", err)
+	}
+	defer conn.Close()
+	id, _ := strconv.Atoi(os.Getenv(askpassTunnelEnv))
+	if err := json.NewEncoder(conn).Encode(askpassRequest{Tunnel: id, Prompt: prompt}); err != nil {
+		return err
+	}
+	var resp askpassResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New("cancelled")
+	}
+	fmt.Println(resp.Answer)
+	return nil
+}
+
+// authPrompt is a question from a tunnel's ssh waiting for the user.
+type authPrompt struct {
+	id       int
+	tunnelID int
+	text     string
+	echo     bool             // a yes/no question rather than a secret
+	hostKey  *hostKeyQuestion // set when asked to trust an unknown host
+	reply    chan authReply
+}
+
+// hostKeyQuestion asks whether to trust a host whose key is not in
+// known_hosts. It is answered "yes" to trust the key and save it, or
+// "once" to trust it for this tunnel only.
+type hostKeyQuestion struct {
+	host        string
+	fingerprint string // e.g. ED25519 SHA256:...
+	once        bool   // "once" is possible, which only the native client can do
+}
+
+// sshHostKeyPromptRe matches ssh's question about an unknown host key.
+var sshHostKeyPromptRe = regexp.MustCompile(`authenticity of host '([^']+)'[^\n]*\n(\S+) key fingerprint is (\S+)\.`)
+
+// parseSSHPrompt reads what ssh passes its askpass program.
+func parseSSHPrompt(text string) authPrompt {
+	p := authPrompt{text: strings.TrimSpace(text), echo: strings.Contains(text, "(yes/no")}
+	if m := sshHostKeyPromptRe.FindStringSubmatch(text); m != nil {
+		p.hostKey = &hostKeyQuestion{host: m[1], fingerprint: m[2] + " " + m[3]}
+	}
+	return p
+}
+
+type authReply struct {
+	answer string
+	ok     bool
+}
+
+type authPromptMsg struct{ prompt authPrompt }
+
+// authPromptGoneMsg withdraws a prompt whose asker went away, e.g. because
+// the tunnel was stopped.
+type authPromptGoneMsg struct{ id int }
+
+// prompter passes prompts from ssh processes and native clients to the
+// program.
+type prompter struct {
+	mu      sync.Mutex
+	program *tea.Program
+	nextID  int
+
+	dir      string
+	listener net.Listener
+}
+
+// attach starts taking prompts for p. Without the socket, ssh falls back
+// to failing as it would without the manager.
+func (pr *prompter) attach(p *tea.Program) {
+	pr.mu.Lock()
+	pr.program = p
+	pr.mu.Unlock()
+
+	dir, err := os.MkdirTemp("", "ssh-tunnel-manager-")
+	if err != nil {
+		slog.Warn("password prompts unavailable", "err", err)
+		return
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "askpass.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		slog.Warn("password prompts unavailable", "err", err)
+		return
+	}
+	pr.dir, pr.listener = dir, l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go pr.handle(conn)
+		}
+	}()
+}
+
+func (pr *prompter) Close() {
+	if pr.listener != nil {
+		pr.listener.Close()
+		os.RemoveAll(pr.dir)
+	}
+}
+
+// env makes a tunnel's ssh ask the manager for passwords and passphrases.
+func (pr *prompter) env(tunnelID int) []string {
+	if pr.listener == nil {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		"SSH_ASKPASS=" + exe,
+		"SSH_ASKPASS_REQUIRE=force",
+		askpassSocketEnv + "=" + pr.listener.Addr().String(),
+		askpassTunnelEnv + "=" + strconv.Itoa(tunnelID),
+	}
+}
+
+func (pr *prompter) handle(conn net.Conn) {
+	defer conn.Close()
+	var req askpassRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	// The helper sends nothing more, so a read only returns once it is
+	// gone, e.g. killed along with its ssh
+	gone := make(chan struct{})
+	go func() {
+		conn.Read(make([]byte, 1))
+		close(gone)
+	}()
+	answer, ok := pr.ask(req.Tunnel, parseSSHPrompt(req.Prompt), gone)
+	json.NewEncoder(conn).Encode(askpassResponse{Answer: answer, OK: ok})
+}
+
+// ask shows prompt for the tunnel and waits for the answer, or until
+// cancel is closed.
+func (pr *prompter) ask(tunnelID int, prompt authPrompt, cancel <-chan struct{}) (string, bool) {
+	pr.mu.Lock()
+	p := pr.program
+	pr.nextID++
+	id := pr.nextID
+	pr.mu.Unlock()
+	if p == nil {
+		return "", false
+	}
+
+	reply := make(chan authReply, 1)
+	prompt.id, prompt.tunnelID, prompt.reply = id, tunnelID, reply
+	p.Send(authPromptMsg{prompt})
+	select {
+	case r := <-reply:
+		return r.answer, r.ok
+	case <-cancel:
+		p.Send(authPromptGoneMsg{id: id})
+		return "", false
+	}
+}
+
+// showPrompt queues a prompt, opening the prompt view over whatever is
+// on screen.
+func (m *model) showPrompt(p authPrompt) {
+	m.prompts = append(m.prompts, p)
+	if t := m.tunnelByID(p.tunnelID); t != nil && p.hostKey != nil {
+		t.appendLog(fmt.Sprintf("Unknown host key for %s: %s", p.hostKey.host, p.hostKey.fingerprint))
+	} else if t != nil {
+		t.appendLog("Waiting for an answer: " + p.text)
+	}
+	if m.view != viewAuthPrompt {
+		m.promptReturn = m.view
+		m.view = viewAuthPrompt
+		m.promptInput = ""
+	}
+}
+
+// dropPrompt removes the prompt with id, answering it if it is still
+// waiting.
+func (m *model) dropPrompt(id int, reply authReply) {
+	for i, p := range m.prompts {
+		if p.id == id {
+			p.reply <- reply
+			m.prompts = append(m.prompts[:i], m.prompts[i+1:]...)
+			if i == 0 {
+				m.promptInput = ""
+			}
+			break
+		}
+	}
+	if len(m.prompts) == 0 && m.view == viewAuthPrompt {
+		m.view = m.promptReturn
+	}
+}
+
+// deniedPrompt says why the user who typed last may not answer p, which
+// only the tunnel's owner and admins may, or "" when they may.
+func (m model) deniedPrompt(p authPrompt) string {
+	if t := m.tunnelByID(p.tunnelID); t != nil {
+		return m.deniedChange(t)
+	}
+	if !m.admin() {
+		return m.refusal("answer prompts")
+	}
+	return ""
+}
+
+func (m model) handleAuthPromptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.prompts) == 0 {
+		m.view = m.promptReturn
+		return m, nil
+	}
+	p := m.prompts[0]
+	if reason := m.deniedPrompt(p); reason != "" {
+		m.statusMessage = reason
+		return m, nil
+	}
+	if p.hostKey != nil {
+		return m.handleHostKeyKey(p, msg)
+	}
+	switch msg.String() {
+	case "enter":
+		m.dropPrompt(p.id, authReply{answer: m.promptInput, ok: true})
+	case "esc":
+		if t := m.tunnelByID(p.tunnelID); t != nil {
+			t.appendLog("Prompt cancelled")
+		}
+		m.dropPrompt(p.id, authReply{})
+	case "backspace":
+		if r := []rune(m.promptInput); len(r) > 0 {
+			m.promptInput = string(r[:len(r)-1])
+		}
+	case "ctrl+u":
+		m.promptInput = ""
+	case " ":
+		m.promptInput += " "
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.promptInput += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+func (m model) handleHostKeyKey(p authPrompt, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(p.tunnelID)
+	switch msg.String() {
+	case "y", "Y":
+		if t != nil {
+			t.appendLog("Host key accepted and saved to known_hosts")
+		}
+		m.dropPrompt(p.id, authReply{answer: "yes", ok: true})
+	case "o", "O":
+		if p.hostKey.once {
+			if t != nil {
+				t.appendLog("Host key accepted for this tunnel only")
+			}
+			m.dropPrompt(p.id, authReply{answer: "once", ok: true})
+		}
+	case "n", "N", "esc":
+		if t != nil {
+			t.appendLog("Host key rejected")
+		}
+		m.dropPrompt(p.id, authReply{})
+	}
+	return m, nil
+}
+
+func (m model) renderHostKeyPrompt(p authPrompt) string {
+	title := "🔐 Unknown host key"
+	if t := m.tunnelByID(p.tunnelID); t != nil {
+		title += " for " + t.tag
+	}
+	content := lipgloss.NewStyle().Bold(true).Render(title) + "\n\n"
+	content += "Host:        " + selectedStyle.Render(p.hostKey.host) + "\n"
+	content += "Fingerprint: " + highlightStyle.Render(p.hostKey.fingerprint) + "\n\n"
+	content += subtleStyle.Render("This host is not in known_hosts. Compare the fingerprint with one\nfrom its admin before trusting it; accepting a wrong key lets\nsomeone in between read the tunnel's traffic.")
+	if len(m.prompts) > 1 {
+		content += "\n\n" + subtleStyle.Render(fmt.Sprintf("%d more prompt(s) waiting", len(m.prompts)-1))
+	}
+	keys := successStyle.Render("y") + subtleStyle.Render(" accept and save • ")
+	if p.hostKey.once {
+		keys += successStyle.Render("o") + subtleStyle.Render(" accept once • ")
+	}
+	keys += errorStyle.Render("n/Esc") + subtleStyle.Render(" reject")
+	content += "\n\n" + keys
+
+	modal := panelStyle.Width(70).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
+
+func (m model) renderAuthPrompt() string {
+	if len(m.prompts) == 0 {
+		return ""
+	}
+	p := m.prompts[0]
+	if p.hostKey != nil {
+		return m.renderHostKeyPrompt(p)
+	}
+	title := "🔑 Authentication"
+	if t := m.tunnelByID(p.tunnelID); t != nil {
+		title += " for " + t.tag
+	}
+	content := lipgloss.NewStyle().Bold(true).Render(title) + "\n\n"
+	content += p.text + "\n\n"
+	if p.echo {
+		content += m.promptInput + "█"
+	} else {
+		content += strings.Repeat("•", len([]rune(m.promptInput))) + "█"
+	}
+	if len(m.prompts) > 1 {
+		content += "\n\n" + subtleStyle.Render(fmt.Sprintf("%d more prompt(s) waiting", len(m.prompts)-1))
+	}
+	content += "\n\n" + subtleStyle.Render("Enter: send • Esc: cancel (the login fails)")
+
+	modal := panelStyle.Width(70).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Auto close stops a tunnel after a set number of minutes, or once it has
+// carried no traffic for a set number, so temporary access to production
+// does not linger. The detail panel counts down to it. Traffic is counted
+// on the tunnel's local port: the built-in client counts what it forwards,
+// and for the rest the manager relays the port, as it does for local TLS.
+// Nothing is counted for remote forwards, and a health check's own
+// connections would keep a tunnel busy, so neither takes the idle close.
+
+// closeTickInterval is how often the counters are read and the deadlines
+// checked.
+const closeTickInterval = 15 * time.Second
+
+type closeTickMsg struct{}
+
+func closeTickCmd() tea.Cmd {
+	return tea.Tick(closeTickInterval, func(time.Time) tea.Msg { return closeTickMsg{} })
+}
+
+func (s tunnelSpec) checkClose() error {
+	if s.CloseAfter < 0 || s.CloseIdle < 0 {
+		return fmt.Errorf("close_after and close_idle are minutes and cannot be negative")
+	}
+	if s.CloseIdle > 0 && s.Type == "remote" {
+		return fmt.Errorf("close_idle needs a local forward or SOCKS proxy: the traffic of remote forwards is not counted")
+	}
+	if s.CloseIdle > 0 && s.HealthCheck != "" {
+		return fmt.Errorf("close_idle cannot be combined with a health check, whose connections would keep the tunnel busy")
+	}
+	return nil
+}
+
+// relaysTraffic reports whether the manager relays spec's local port to
+// count its traffic. The built-in client counts it itself.
+func (m model) relaysTraffic(spec tunnelSpec) bool {
+	native := spec.Backend == nativeBackend || (spec.Backend == "" && m.cfg.SSHTransport == nativeBackend)
+	return spec.CloseIdle > 0 && spec.TLSMode == "" && !native
+}
+
+// armClose starts the countdowns of a tunnel that was just started.
+func (t *tunnel) armClose() {
+	t.closeAt = time.Time{}
+	if t.closeAfter > 0 {
+		t.closeAt = time.Now().Add(time.Duration(t.closeAfter) * time.Minute)
+	}
+	t.idleSince, t.idleBytes = time.Now(), 0
+}
+
+// trafficBytes is what the tunnel has carried both ways, if it is counted.
+func (t *tunnel) trafficBytes() (uint64, bool) {
+	switch {
+	case t.lazy != nil:
+		return t.lazy.bytes.Load(), true
+	case t.native != nil:
+		return t.native.bytesIn.Load() + t.native.bytesOut.Load(), true
+	case t.tlsProxy != nil:
+		return t.tlsProxy.bytes.Load(), true
+	}
+	return 0, false
+}
+
+// sampleTraffic reads the traffic counters, noting when they last moved.
+func (t *tunnel) sampleTraffic(now time.Time) {
+	if n, ok := t.trafficBytes(); ok && n != t.idleBytes {
+		t.idleBytes, t.idleSince = n, now
+	}
+}
+
+// closeDue says why the tunnel is to be closed at now, "" if it is not.
+func (t *tunnel) closeDue(now time.Time) string {
+	if !t.active || t.restarting {
+		return ""
+	}
+	if !t.closeAt.IsZero() && !now.Before(t.closeAt) {
+		return fmt.Sprintf("Closed after %s, as set", fmtUptime(time.Duration(t.closeAfter)*time.Minute))
+	}
+	if t.closeIdle > 0 && now.Sub(t.idleSince) >= time.Duration(t.closeIdle)*time.Minute {
+		return fmt.Sprintf("Closed after %s without traffic", fmtUptime(time.Duration(t.closeIdle)*time.Minute))
+	}
+	return ""
+}
+
+// closeCountdown is the detail panel's line for the tunnel's auto close,
+// "" when it has none.
+func (t *tunnel) closeCountdown() string {
+	var parts []string
+	if !t.closeAt.IsZero() && t.active {
+		parts = append(parts, "in "+fmtUptime(time.Until(t.closeAt)))
+	} else if t.closeAfter > 0 {
+		parts = append(parts, fmt.Sprintf("%dm after starting", t.closeAfter))
+	}
+	if t.closeIdle > 0 && t.active {
+		parts = append(parts, fmt.Sprintf("after %dm idle (idle %s)", t.closeIdle, fmtUptime(time.Since(t.idleSince))))
+	} else if t.closeIdle > 0 {
+		parts = append(parts, fmt.Sprintf("after %dm idle", t.closeIdle))
+	}
+	return strings.Join(parts, ", or ")
+}
+
+// closeExpired stops the tunnels whose time is up and puts idle on-demand
+// ones to sleep, then ticks again.
+func (m model) closeExpired(now time.Time) (tea.Model, tea.Cmd) {
+	cmds := []tea.Cmd{closeTickCmd()}
+	closed := false
+	for _, t := range m.tunnels {
+		t.sampleTraffic(now)
+		reason := t.closeDue(now)
+		if reason == "" {
+			continue
+		}
+		slog.Info("tunnel closed automatically", append(t.logAttrs(), "reason", reason)...)
+		t.stop()
+		m.retire(t, reason)
+		t.appendLog(reason)
+		m.statusMessage = fmt.Sprintf("%s: %s", t.tag, strings.ToLower(reason[:1])+reason[1:])
+		cmds = append(cmds, m.notify(t.tag+" closed", reason))
+		closed = true
+	}
+	if sleeping := m.sleepIdle(now); len(sleeping) > 0 {
+		cmds = append(cmds, sleeping...)
+		closed = true
+	}
+	if closed {
+		m.updateTunnelList()
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// toCloseSteps asks for the auto close at the end of the wizard. Remote
+// forwards are not asked about the idle close.
+func (m *model) toCloseSteps() {
+	m.step = stepCloseAfter
+	m.setInput(minutesInput(m.tempCloseAfter))
+	m.err = nil
+}
+
+func minutesInput(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func (m model) handleCloseStep() (tea.Model, tea.Cmd) {
+	minutes := 0
+	if s := strings.TrimSpace(m.input.Value()); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			m.err = fmt.Errorf("expected a number of minutes, got %q", s)
+			return m, nil
+		}
+		minutes = n
+	}
+	m.err = nil
+	if m.step == stepCloseAfter {
+		m.tempCloseAfter = minutes
+		if m.tempType == "remote" {
+			m.tempCloseIdle = 0
+			m.toLazyStep()
+			return m, nil
+		}
+		m.step = stepCloseIdle
+		m.setInput(minutesInput(m.tempCloseIdle))
+		return m, nil
+	}
+	spec := m.tempSpec()
+	spec.CloseIdle = minutes
+	if err := spec.checkClose(); err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.tempCloseIdle = minutes
+	m.toLazyStep()
+	return m, nil
+}
+
+func (m model) renderCloseStep() string {
+	content := "Close the tunnel after how many minutes?\n\n"
+	hint := "For temporary access that must not linger • Empty to keep it open"
+	if m.step == stepCloseIdle {
+		content = "Close the tunnel after how many minutes without traffic?\n\n"
+		hint = "Counted on the local port • Empty to keep it open while idle"
+	}
+	content += m.inputView()
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	return content + "\n\n" + subtleStyle.Render(hint)
+}
+
+// closeSetting shows the spec's auto close for the review.
+func closeSetting(minutes int, idle bool) string {
+	if minutes == 0 {
+		return "never"
+	}
+	if idle {
+		return fmt.Sprintf("after %dm idle", minutes)
+	}
+	return fmt.Sprintf("after %dm", minutes)
+}
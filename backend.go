@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// tunnelBackend builds the process that carries a tunnel. The manager owns
+// everything around it (process group, log capture, TLS, smoke tests), so
+// a backend only has to forward 127.0.0.1:forwardPort to the spec's remote
+// port, stay in the foreground, and log to stdout or stderr.
+type tunnelBackend interface {
+	Name() string
+	Command(spec tunnelSpec, forwardPort string, pre precheckMsg, pol policy) *exec.Cmd
+}
+
+// sshBackend is the built-in backend: a plain ssh -N -L.
+type sshBackend struct{}
+
+func (sshBackend) Name() string { return "ssh" }
+
+func (sshBackend) Command(spec tunnelSpec, forwardPort string, pre precheckMsg, pol policy) *exec.Cmd {
+	args := append([]string{"-N"}, sshForwardArgs(spec, forwardPort)...)
+	if spec.Type == "remote" {
+		// Without ExitOnForwardFailure ssh stays up when the remote side
+		// refuses to bind, and the tunnel would look healthy
+		args = append(args, "-o", "ExitOnForwardFailure=yes")
+	}
+	if spec.Verbose {
+		args = append(args, "-v")
+	}
+	args = append(args, sshConnectArgs(spec.Proxy, pre, pol)...)
+	if spec.Keepalive != nil {
+		args = append(args, spec.Keepalive.sshArgs()...)
+	}
+	if spec.TCP != nil {
+		args = append(args, spec.TCP.sshArgs()...)
+	}
+	args = append(args, spec.linkArgs()...)
+	args = append(args, spec.forwardingArgs()...)
+	if spec.IdentityFile != "" {
+		args = append(args, "-i", identityPath(spec.IdentityFile), "-o", "IdentitiesOnly=yes")
+	}
+	args = append(args, "--", spec.Host)
+	return exec.Command("ssh", args...)
+}
+
+// sshForwardArgs are the -L, -R and -D options for spec's forwards, its
+// own on forwardPort first.
+func sshForwardArgs(spec tunnelSpec, forwardPort string) []string {
+	args := []string{"-L", forwardPort + ":" + destination(spec.RemoteHost, spec.RemotePort)}
+	if spec.Type == "remote" {
+		args = []string{"-R", fmt.Sprintf("%s:localhost:%s", spec.RemotePort, forwardPort)}
+	} else if spec.Type == "socks" {
+		args = []string{"-D", forwardPort}
+	}
+	for _, f := range spec.Forwards {
+		switch f.Type {
+		case "remote":
+			args = append(args, "-R", fmt.Sprintf("%s:localhost:%s", f.RemotePort, f.LocalPort))
+		case "socks":
+			args = append(args, "-D", f.LocalPort)
+		default:
+			args = append(args, "-L", f.LocalPort+":"+destination(f.RemoteHost, f.RemotePort))
+		}
+	}
+	return args
+}
+
+// backendConfig declares an external backend in config.json.
+type backendConfig struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+}
+
+// execBackend runs a user-supplied command, e.g. kubectl port-forward, aws
+// ssm start-session or cloudflared access tcp. {host}, {remote_port} and
+// {local_port} in its arguments are replaced, and the same values are set
+// as TUNNEL_HOST, TUNNEL_REMOTE_PORT and TUNNEL_LOCAL_PORT.
+type execBackend struct {
+	name    string
+	command []string
+}
+
+func (b execBackend) Name() string { return b.name }
+
+func (b execBackend) Command(spec tunnelSpec, forwardPort string, pre precheckMsg, pol policy) *exec.Cmd {
+	r := strings.NewReplacer("{host}", spec.Host, "{remote_port}", spec.RemotePort, "{local_port}", forwardPort)
+	args := make([]string, len(b.command))
+	for i, arg := range b.command {
+		args[i] = r.Replace(arg)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"TUNNEL_HOST="+spec.Host,
+		"TUNNEL_REMOTE_PORT="+spec.RemotePort,
+		"TUNNEL_LOCAL_PORT="+forwardPort,
+	)
+	return cmd
+}
+
+// backendsFromConfig maps backend names to backends, with ssh under the
+// empty name so specs without a backend keep working.
+func backendsFromConfig(cfg config) map[string]tunnelBackend {
+	backends := map[string]tunnelBackend{"": sshBackend{}, kubectlBackend: kubectlPortForward{}, teleportBackend: tshPortForward{}}
+	for _, b := range cfg.Backends {
+		backends[b.Name] = execBackend{name: b.Name, command: b.Command}
+	}
+	return backends
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Tunnels in front of web dashboards can be marked with web: true in
+// their profile, tunnels file or template; b opens them in the default
+// browser. web_url sets the scheme and path, with {local_port} for the
+// port, e.g. https://localhost:{local_port}/grafana/; it defaults to
+// http://localhost:<port>/, or https for local TLS or a TLS service. b
+// also works on unmarked tunnels found to serve HTTP. Over SSH there is no
+// browser to open, so the URL is copied instead.
+
+// webURL is where b takes the browser for t.
+func (t *tunnel) webURL() string {
+	if t.webLink != "" {
+		return strings.ReplaceAll(t.webLink, "{local_port}", t.localPort)
+	}
+	scheme := "http"
+	if t.tlsMode == "wrap" || t.protocol == "tls" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%s/", scheme, t.localPort)
+}
+
+// checkWebURL validates a web_url setting.
+func checkWebURL(s string) error {
+	u, err := url.Parse(strings.ReplaceAll(s, "{local_port}", "8080"))
+	if err != nil {
+		return fmt.Errorf("web_url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("web_url %q must be an http or https URL", s)
+	}
+	return nil
+}
+
+type browserMsg struct {
+	url string
+	err error
+}
+
+// openBrowserCmd opens url in the default browser.
+func openBrowserCmd(url string) tea.Cmd {
+	return func() tea.Msg {
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", url)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		default:
+			cmd = exec.Command("xdg-open", url)
+		}
+		// The opener may hand over to a browser that keeps running, so
+		// only its start is waited for
+		if err := cmd.Start(); err != nil {
+			return browserMsg{url: url, err: err}
+		}
+		go cmd.Wait()
+		return browserMsg{url: url}
+	}
+}
+
+// openWeb opens t in the browser, or copies its URL over SSH.
+func (m model) openWeb(t *tunnel) (tea.Model, tea.Cmd) {
+	switch {
+	case t.tunnelType != "":
+		m.statusMessage = fmt.Sprintf("%s is not a local forward; there is no page to open", t.tag)
+		return m, nil
+	case !t.web && t.protocol != "http" && t.tlsMode != "wrap":
+		m.statusMessage = fmt.Sprintf("%s does not serve HTTP; set web: true in its profile to open it anyway", t.tag)
+		return m, nil
+	case !t.active:
+		m.statusMessage = fmt.Sprintf("Tunnel %s is down", t.tag)
+		return m, nil
+	case os.Getenv("SSH_TTY") != "":
+		return m, copyCmd(m.termOut, t.webURL(), t.webURL())
+	}
+	m.statusMessage = "Opening " + t.webURL() + "..."
+	return m, openBrowserCmd(t.webURL())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Bulk actions act on every tunnel at once, e.g. after switching networks
+// or VPNs, when every connection has to be set up again: a, then s to
+// start the stopped ones, x to stop all or r to restart all.
+
+const bulkPrompt = "All tunnels: s start • x stop • r restart • Esc cancel"
+
+func (m model) handleBulkKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.bulkPending = false
+	switch msg.String() {
+	case "s":
+		return m.startAll()
+	case "x":
+		m.stopAll()
+	case "r":
+		return m.restartAll()
+	default:
+		m.statusMessage = m.bulkReturnStatus
+	}
+	return m, nil
+}
+
+// startAll starts every stopped tunnel again.
+func (m model) startAll() (tea.Model, tea.Cmd) {
+	m.pendingStarts, m.pendingProfiles = nil, nil
+	for _, t := range m.tunnels {
+		// A reconnecting demo tunnel is down but still holds its port
+		if !t.active && t.demo == nil && !t.restarting {
+			m.pendingStarts = append(m.pendingStarts, t.id)
+		}
+	}
+	slog.Info("starting all tunnels", "count", len(m.pendingStarts))
+	m.statusMessage = fmt.Sprintf("Starting %d stopped tunnel(s)", len(m.pendingStarts))
+	return m.startNext()
+}
+
+func (m *model) stopAll() {
+	stopped := 0
+	for _, t := range m.tunnels {
+		if !t.active && t.demo == nil && !t.restarting {
+			continue
+		}
+		t.restarting = false
+		t.stop()
+		t.appendLog(fmt.Sprintf("Stopped along with all tunnels, press %s to start it again", m.keys.StartStop.Help().Key))
+		stopped++
+	}
+	m.pendingStarts, m.pendingProfiles = nil, nil
+	slog.Info("all tunnels stopped", "count", stopped)
+	m.updateTunnelList()
+	m.statusMessage = fmt.Sprintf("Stopped %d tunnel(s)", stopped)
+}
+
+// restartAll kills every tunnel and starts them all again.
+func (m model) restartAll() (tea.Model, tea.Cmd) {
+	return m.restartTunnels(m.tunnels, "along with all tunnels")
+}
+
+// restartTunnels kills the tunnels and starts them again, noting why in
+// their logs. Those with a process wait in restarting until it has exited
+// and freed their port.
+func (m model) restartTunnels(ts []*tunnel, why string) (tea.Model, tea.Cmd) {
+	m.pendingStarts, m.pendingProfiles = nil, nil
+	waiting := 0
+	for _, t := range ts {
+		t.appendLog("Manually restarted " + why)
+		running := t.hasProcess()
+		t.stop()
+		if running {
+			t.restarting = true
+			waiting++
+		} else {
+			m.pendingStarts = append(m.pendingStarts, t.id)
+		}
+	}
+	slog.Info("restarting tunnels", "count", len(ts), "why", why)
+	m.updateTunnelList()
+	m.statusMessage = fmt.Sprintf("Restarting %d tunnel(s)", len(ts))
+	if len(m.pendingStarts) == 0 {
+		return m, nil
+	}
+	return m.startNext()
+}
+
+// startNext starts the next tunnel queued by a bulk action, a group or a
+// restart. They go one at a time, since each takes the connecting screen;
+// the next follows once the last is up, or is skipped with Esc when it
+// fails. Profiles of a group's members that are not in the list come last.
+func (m model) startNext() (tea.Model, tea.Cmd) {
+	for len(m.pendingStarts) > 0 {
+		id := m.pendingStarts[0]
+		m.pendingStarts = m.pendingStarts[1:]
+		idx := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.id == id })
+		if idx < 0 || m.tunnels[idx].active {
+			continue
+		}
+		next, cmd := m.resumeTunnel(idx)
+		if nm, ok := next.(model); ok && nm.view == viewMain && !nm.tunnels[idx].active {
+			// Could not even try, e.g. its port is taken; the status bar
+			// says why
+			m = nm
+			continue
+		}
+		return next, cmd
+	}
+	for len(m.pendingProfiles) > 0 {
+		p := m.pendingProfiles[0]
+		m.pendingProfiles = m.pendingProfiles[1:]
+		next, cmd := m.startProfile(p)
+		if nm, ok := next.(model); ok && nm.view == viewMain {
+			m = nm
+			continue
+		}
+		return next, cmd
+	}
+	return m, nil
+}
+
+// queued reports whether startNext has tunnels left to start.
+func (m model) queued() bool {
+	return len(m.pendingStarts) > 0 || len(m.pendingProfiles) > 0
+}
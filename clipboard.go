@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
+)
+
+// clipboardMsg reports a copy to the clipboard. what names what was
+// copied, for the status bar; terminal is set when it went through OSC 52,
+// which the terminal may ignore without telling.
+type clipboardMsg struct {
+	what     string
+	terminal bool
+}
+
+// address is where clients reach the tunnel, ready to paste into psql, a
+// browser or a proxy setting.
+func (t *tunnel) address() string {
+	addr := "localhost:" + t.localPort
+	switch {
+	case t.tunnelType == "socks":
+		return "socks5h://" + addr
+	case t.protocol == "http":
+		return "http://" + addr
+	case t.tlsMode == "wrap":
+		return "https://" + addr
+	}
+	return addr
+}
+
+// commandLine is the command that sets up the same forwards by hand, e.g.
+// ssh -N -L 5433:localhost:5432 db-1. TLS and smoke tests are the
+// manager's own and are left out.
+func (m model) commandLine(t *tunnel) (string, error) {
+	return m.specCommandLine(t.spec())
+}
+
+// specCommandLine is commandLine for a tunnel that has not started yet.
+func (m model) specCommandLine(spec tunnelSpec) (string, error) {
+	cmd, err := specCmd(m.backends, m.cfg, m.policy, spec)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// specCmd is the process that carries spec, forwarding its local port
+// directly, with the configured keepalive, compression and ciphers.
+func specCmd(backends map[string]tunnelBackend, cfg config, pol policy, spec tunnelSpec) (*exec.Cmd, error) {
+	backend := backends[spec.Backend]
+	if usesSSH(spec.Backend) {
+		backend = sshBackend{}
+	}
+	if backend == nil {
+		return nil, fmt.Errorf("backend %q is not configured", spec.Backend)
+	}
+	return backend.Command(cfg.withDefaults(spec), spec.LocalPort, precheckMsg{}, pol), nil
+}
+
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9@%_+=:,./-]+$`)
+
+func shellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// copyCmd puts text on the clipboard. Over SSH, or with no clipboard tool
+// installed, it asks the terminal to do it with an OSC 52 sequence
+// instead, which most terminals (and tmux) understand; out is where the
+// program's output goes, so it reaches the right terminal under attach.
+func copyCmd(out io.Writer, what, text string) tea.Cmd {
+	return func() tea.Msg {
+		if os.Getenv("SSH_TTY") == "" && !clipboard.Unsupported {
+			if err := clipboard.WriteAll(text); err == nil {
+				return clipboardMsg{what: what}
+			}
+		}
+		termenv.NewOutput(out).Copy(text)
+		return clipboardMsg{what: what, terminal: true}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The tunnels that ended are kept, newest first, in closed.json in the
+// config directory: those deleted, closed automatically, or that went down
+// because their process exited or their ssh master went away. Each keeps
+// when it was set up and when it ended, how long it was up and why it
+// ended. The history screen (H) lists them, and Enter sets the selected
+// one up again. Like history.json it is the app's own file, so a damaged
+// one is ignored.
+
+const (
+	maxClosed    = 50
+	closedShown  = 8
+	closedFile   = "closed.json"
+	closedLayout = "Jan 2 15:04"
+
+	deletedReason = "Deleted"
+)
+
+type closedTunnel struct {
+	Spec    tunnelSpec    `json:"spec"`
+	Created time.Time     `json:"created"`
+	Ended   time.Time     `json:"ended"`
+	Up      time.Duration `json:"up"`
+	Reason  string        `json:"reason"`
+}
+
+type closedTunnels struct {
+	Tunnels []closedTunnel `json:"tunnels"`
+}
+
+func closedPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, closedFile), nil
+}
+
+func loadClosed() []closedTunnel {
+	path, err := closedPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c closedTunnels
+	if err := json.Unmarshal(data, &c); err != nil {
+		slog.Warn("ignoring unreadable closed tunnels", "path", path, "err", err)
+		return nil
+	}
+	return c.Tunnels
+}
+
+func saveClosed(tunnels []closedTunnel) error {
+	path, err := closedPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(closedTunnels{Tunnels: tunnels}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), historyWrite)
+}
+
+// retire records why the stopped tunnel t ended. A tunnel is recorded once
+// per start, so deleting one that went down keeps the reason it went down.
+func (m *model) retire(t *tunnel, reason string) {
+	if t.retired {
+		return
+	}
+	t.retired = true
+	c := closedTunnel{Spec: t.spec(), Created: t.createdAt, Ended: time.Now(), Up: t.totalUptime(), Reason: reason}
+	m.closed = append([]closedTunnel{c}, m.closed[:min(len(m.closed), maxClosed-1)]...)
+	if m.demo {
+		return
+	}
+	if err := saveClosed(m.closed); err != nil {
+		slog.Warn("cannot save closed tunnels", "err", err)
+	}
+}
+
+func (m model) openClosed() model {
+	m.closedIndex, m.closedScroll = 0, 0
+	m.view = viewHistory
+	return m
+}
+
+func (m model) handleClosedKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.view = viewMain
+	case "up", "k":
+		if m.closedIndex > 0 {
+			m.closedIndex--
+		}
+		m.closedScroll = min(m.closedScroll, m.closedIndex)
+	case "down", "j":
+		if m.closedIndex < len(m.closed)-1 {
+			m.closedIndex++
+		}
+		if m.closedIndex >= m.closedScroll+closedShown {
+			m.closedScroll = m.closedIndex - closedShown + 1
+		}
+	case "enter":
+		if m.closedIndex < len(m.closed) {
+			return m.recreate(m.closed[m.closedIndex])
+		}
+	}
+	return m, nil
+}
+
+// recreate sets the closed tunnel c up again. One that is still in the
+// list, stopped, is started in place rather than listed twice.
+func (m model) recreate(c closedTunnel) (tea.Model, tea.Cmd) {
+	slog.Info("tunnel recreated", "tag", c.Spec.Tag, "host", c.Spec.Host)
+	i := slices.IndexFunc(m.tunnels, func(t *tunnel) bool {
+		return !t.active && t.demo == nil && sameSetup(t.spec(), c.Spec)
+	})
+	if reason := m.deniedStart(i); reason != "" {
+		m.statusMessage = reason
+		return m, nil
+	}
+	if i >= 0 {
+		return m.resumeTunnel(i)
+	}
+	m.tempResume = 0
+	return m.startProfile(c.Spec)
+}
+
+// describe is the closed tunnel's second line in the history, e.g.
+// "Oct 15 09:02 – Oct 15 11:15, up 2h13m • ssh exited (exit status 255)".
+func (c closedTunnel) describe() string {
+	when := c.Ended.Format(closedLayout)
+	if !c.Created.IsZero() {
+		when = c.Created.Format(closedLayout) + " – " + when
+	}
+	up := "never up"
+	if c.Up > 0 {
+		up = "up " + fmtUptime(c.Up)
+	}
+	return fmt.Sprintf("%s, %s • %s", when, up, c.Reason)
+}
+
+func (m model) renderClosed() string {
+	content := lipgloss.NewStyle().Bold(true).Render("History") + "\n\n"
+
+	if len(m.closed) == 0 {
+		content += subtleStyle.Render("No closed tunnels yet. Deleted tunnels and those that go down are kept here.")
+	}
+	end := min(m.closedScroll+closedShown, len(m.closed))
+	for i := m.closedScroll; i < end; i++ {
+		c := m.closed[i]
+		line := fmt.Sprintf("%-20s %s  %s", c.Spec.Tag, c.Spec.Host, c.Spec.ports())
+		if i == m.closedIndex {
+			content += selectedStyle.Render("  ▶  " + line)
+		} else {
+			content += "     " + line
+		}
+		content += "\n     " + subtleStyle.Render(c.describe())
+		if i < end-1 {
+			content += "\n"
+		}
+	}
+	if len(m.closed) > closedShown {
+		content += "\n\n" + subtleStyle.Render(fmt.Sprintf("%d of %d", m.closedIndex+1, len(m.closed)))
+	}
+	content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to set it up again • Esc to close")
+
+	modal := panelStyle.Width(90).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
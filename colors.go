@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// A color label tells tunnels apart at a glance, e.g. red for production
+// and green for dev: the wizard asks for one after the tag, and the list
+// draws a bar of it next to the tunnel and its tag in it, as does the
+// detail panel's header. The colors are the same in every theme, so red
+// means the same thing everywhere.
+
+// labelNames are the colors a tunnel can be labelled with, in the order
+// the wizard lists them.
+var labelNames = []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "gray"}
+
+var labelColors = map[string]lipgloss.Color{
+	"red":    "#E06C75",
+	"orange": "#D19A66",
+	"yellow": "#E5C07B",
+	"green":  "#98C379",
+	"cyan":   "#56B6C2",
+	"blue":   "#61AFEF",
+	"purple": "#C678DD",
+	"gray":   "#7F848E",
+}
+
+// checkColor validates a color label, "" for none.
+func checkColor(name string) error {
+	if name != "" && !slices.Contains(labelNames, name) {
+		return fmt.Errorf("unknown color %q, expected one of %s", name, strings.Join(labelNames, ", "))
+	}
+	return nil
+}
+
+// labelStyle is the tunnel's color, the zero style for none.
+func (t tunnel) labelStyle() lipgloss.Style {
+	if t.color == "" {
+		return lipgloss.NewStyle()
+	}
+	return lipgloss.NewStyle().Foreground(labelColors[t.color])
+}
+
+// gutter is the two columns left of a list entry: a bar in the tunnel's
+// color, blank for none.
+func (t tunnel) gutter() string {
+	if t.color == "" {
+		return "  "
+	}
+	return t.labelStyle().Render("▌") + " "
+}
+
+func (m model) renderColorStep() string {
+	content := "Color label for this tunnel:\n\n" + m.inputView()
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	swatches := make([]string, len(labelNames))
+	for i, name := range labelNames {
+		swatches[i] = lipgloss.NewStyle().Foreground(labelColors[name]).Render("▌" + name)
+	}
+	return content + "\n\n" + strings.Join(swatches, " ") +
+		"\n\n" + subtleStyle.Render("Tab completes • Empty for none • Esc to cancel")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+)
+
+const appName = "ssh-tunnel-manager"
+
+// config holds the user's global settings, read from config.json in the
+// platform config directory (e.g. ~/.config/ssh-tunnel-manager on Linux).
+// Every field is optional; a missing file means defaults everywhere.
+type config struct {
+	// Proxy is the default upstream proxy offered for new tunnels,
+	// e.g. "socks5://127.0.0.1:1080" or "http://proxy.corp:3128".
+	Proxy string `json:"proxy,omitempty"`
+
+	// MDNS announces each tunnel that comes up healthy as a DNS-SD service
+	// named after its tag, e.g. pg-prod._postgresql._tcp.local.
+	MDNS bool `json:"mdns,omitempty"`
+
+	// LandingPage is a local address (e.g. "127.0.0.1:8700") on which to
+	// serve a page listing active tunnels. Empty disables it.
+	LandingPage string `json:"landing_page,omitempty"`
+
+	// WebUI is a local address on which to serve the web UI and its JSON
+	// control API. Requests must carry WebUIToken, or when that is empty a
+	// token generated once and stored next to this file as webui-token.
+	WebUI      string `json:"web_ui,omitempty"`
+	WebUIToken string `json:"web_ui_token,omitempty"`
+
+	// SSHUI is an address on which the daemon serves the TUI over SSH, to
+	// the keys in SSHUIAuthorizedKeys (~/.ssh/authorized_keys when empty).
+	// See sshui.go.
+	SSHUI               string `json:"ssh_ui,omitempty"`
+	SSHUIAuthorizedKeys string `json:"ssh_ui_authorized_keys,omitempty"`
+
+	// ProfilesURL is the team's shared profile bundle, fetched by import
+	// and by the profile list's update action.
+	ProfilesURL string `json:"profiles_url,omitempty"`
+
+	// HostProviders are external inventories (Ansible, NetBox, a CMDB...)
+	// whose hosts are added to the picker after those from ~/.ssh/config.
+	HostProviders []hostProviderConfig `json:"host_providers,omitempty"`
+
+	// Templates are presets for common services, offered after the host
+	// in the wizard next to the built-in ones (see templates.go).
+	Templates []tunnelTemplate `json:"templates,omitempty"`
+
+	// Backends are external commands that can carry a tunnel instead of
+	// ssh, such as kubectl port-forward or cloudflared (see backend.go).
+	Backends []backendConfig `json:"backends,omitempty"`
+
+	// SSHTransport is how tunnels without a backend connect: "exec" runs
+	// the ssh binary (the default), "native" uses the built-in client.
+	SSHTransport string `json:"ssh_transport,omitempty"`
+
+	// Multiplex carries the tunnels to a host over one master connection
+	// that the manager runs, instead of an ssh per tunnel (see mux.go).
+	Multiplex bool `json:"multiplex,omitempty"`
+
+	// HealthInterval is the time between health checks (default 30s).
+	HealthInterval string `json:"health_interval,omitempty"`
+
+	// LazyIdle is how long an on-demand tunnel stays connected without
+	// connections (default 5m, see lazy.go).
+	LazyIdle string `json:"lazy_idle,omitempty"`
+
+	// Keepalive is the default for tunnels that don't set their own
+	// (every 30s, dropped after 3 unanswered). The settings screen (o)
+	// edits it.
+	Keepalive *keepalive `json:"keepalive,omitempty"`
+
+	// TCP is the socket tuning for tunnels that don't set their own (see
+	// tcptune.go).
+	TCP *tcpTuning `json:"tcp,omitempty"`
+
+	// Compression and Ciphers are the defaults for tunnels that don't set
+	// their own, for slow links (see link.go).
+	Compression bool   `json:"compression,omitempty"`
+	Ciphers     string `json:"ciphers,omitempty"`
+
+	// Groups names sets of saved profiles, by tag, that are started and
+	// stopped together (see groups.go).
+	Groups map[string][]string `json:"groups,omitempty"`
+
+	// Schedules start and stop saved profiles at set times (see
+	// schedule.go).
+	Schedules []scheduleConfig `json:"schedules,omitempty"`
+
+	// Notifications shows a desktop notification when a tunnel goes down,
+	// fails to reconnect or reconnects (see notify.go).
+	Notifications bool `json:"notifications,omitempty"`
+
+	// Theme picks the colors: dark (default), light or high-contrast.
+	// Colors overrides single colors of it, by name (see theme.go).
+	Theme  string            `json:"theme,omitempty"`
+	Colors map[string]string `json:"colors,omitempty"`
+
+	// Keys changes the main screen's key bindings, by action name (see
+	// keys.go).
+	Keys map[string][]string `json:"keys,omitempty"`
+
+	// LogMemoryMB caps the memory all tunnel logs may hold together, in
+	// MiB (default 8). Past it the noisiest tunnels lose their oldest
+	// lines, which go to the --log-file when there is one.
+	LogMemoryMB int `json:"log_memory_mb,omitempty"`
+
+	// LogLines is how many lines each tunnel's log keeps (default 10000,
+	// see logring.go).
+	LogLines int `json:"log_lines,omitempty"`
+
+	// RefreshInterval is no longer used: the UI redraws when log lines
+	// arrive instead of polling. It is still accepted so older configs
+	// load.
+	RefreshInterval string `json:"refresh_interval,omitempty"`
+}
+
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+func loadConfig() (config, error) {
+	var cfg config
+
+	path, err := configPath()
+	if err != nil {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := decodeJSONFile(path, data, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Proxy != "" {
+		if _, err := parseProxy(cfg.Proxy); err != nil {
+			return cfg, fmt.Errorf("%s: proxy: %w", path, err)
+		}
+	}
+	for i, p := range cfg.HostProviders {
+		if p.Name == "" || len(p.Command) == 0 {
+			return cfg, fmt.Errorf("%s: host_providers[%d] needs a name and a command", path, i)
+		}
+	}
+	for i, t := range cfg.Templates {
+		if err := t.check(); err != nil {
+			return cfg, fmt.Errorf("%s: templates[%d]: %w", path, i, err)
+		}
+	}
+	if cfg.HealthInterval != "" {
+		if _, err := time.ParseDuration(cfg.HealthInterval); err != nil {
+			return cfg, fmt.Errorf("%s: health_interval: %w", path, err)
+		}
+	}
+	if cfg.LazyIdle != "" {
+		if _, err := time.ParseDuration(cfg.LazyIdle); err != nil {
+			return cfg, fmt.Errorf("%s: lazy_idle: %w", path, err)
+		}
+	}
+	if cfg.Keepalive != nil {
+		if err := cfg.Keepalive.check(); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if cfg.TCP != nil {
+		if err := cfg.TCP.check(); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if cfg.Ciphers != "" {
+		ciphers, err := parseCiphers(cfg.Ciphers)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: ciphers: %w", path, err)
+		}
+		cfg.Ciphers = ciphers
+	}
+	if err := cfg.checkGroups(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, s := range cfg.Schedules {
+		if err := s.check(); err != nil {
+			return cfg, fmt.Errorf("%s: schedules[%d]: %w", path, i, err)
+		}
+		if slices.ContainsFunc(cfg.Schedules[:i], func(o scheduleConfig) bool { return o.Profile == s.Profile }) {
+			return cfg, fmt.Errorf("%s: schedules[%d]: %s has a schedule already", path, i, s.Profile)
+		}
+	}
+	if _, err := cfg.theme(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := newKeyMap(cfg.Keys); err != nil {
+		return cfg, fmt.Errorf("%s: keys: %w", path, err)
+	}
+	if cfg.LogMemoryMB < 0 {
+		return cfg, fmt.Errorf("%s: log_memory_mb must not be negative", path)
+	}
+	if cfg.LogLines < 0 {
+		return cfg, fmt.Errorf("%s: log_lines must not be negative", path)
+	}
+	switch cfg.SSHTransport {
+	case "", "exec", nativeBackend:
+	default:
+		return cfg, fmt.Errorf("%s: ssh_transport must be exec or native, got %q", path, cfg.SSHTransport)
+	}
+	if cfg.Multiplex && runtime.GOOS == "windows" {
+		return cfg, fmt.Errorf("%s: multiplex: %w", path, errMuxUnsupported)
+	}
+	seen := map[string]bool{"ssh": true, nativeBackend: true, kubectlBackend: true, teleportBackend: true}
+	for i, b := range cfg.Backends {
+		if b.Name == "" || len(b.Command) == 0 {
+			return cfg, fmt.Errorf("%s: backends[%d] needs a name and a command", path, i)
+		}
+		if seen[b.Name] {
+			return cfg, fmt.Errorf("%s: backends[%d]: name %q is already taken", path, i, b.Name)
+		}
+		seen[b.Name] = true
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the config back, for settings changed in the UI.
+func saveConfig(cfg config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
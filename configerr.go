@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeJSONFile decodes one of our JSON files (config, policy, profiles)
+// strictly, and turns the decoder's errors into something a user can act
+// on: file:line:col, the offending key, and a did-you-mean for typos.
+func decodeJSONFile(path string, data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := lineCol(data, syntaxErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %v", path, line, col, syntaxErr)
+	case errors.As(err, &typeErr):
+		line, col := lineCol(data, typeErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %q must be %s, not %s", path, line, col, typeErr.Field, describeKind(typeErr.Type), typeErr.Value)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%s: unexpected end of file", path)
+	}
+
+	if key, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		key = strings.Trim(key, `"`)
+		return fmt.Errorf("%s:%s %s", path, keyPosition(data, key), unknownKey(key, v))
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// decodeYAML is decodeJSONFile for YAML documents, such as shared profile
+// bundles. yaml.v3 already reports lines, so only unknown keys need help.
+func decodeYAML(source string, data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(v)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for i, msg := range typeErr.Errors {
+			if m := yamlUnknownField.FindStringSubmatch(msg); m != nil {
+				typeErr.Errors[i] = fmt.Sprintf("line %s: %s", m[1], unknownKey(m[2], v))
+			}
+		}
+		return fmt.Errorf("%s: %s", source, strings.Join(typeErr.Errors, "; "))
+	}
+	return fmt.Errorf("%s: %w", source, err)
+}
+
+var yamlUnknownField = regexp.MustCompile(`^line (\d+): field (\S+) not found in type`)
+
+func unknownKey(key string, v any) string {
+	msg := fmt.Sprintf("unknown key %q", key)
+	if suggestion := closestKey(key, knownKeys(reflect.TypeOf(v))); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return msg
+}
+
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// keyPosition finds where key is used as an object key, since the JSON
+// decoder doesn't report an offset for unknown fields.
+func keyPosition(data []byte, key string) string {
+	re := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:`)
+	loc := re.FindIndex(data)
+	if loc == nil {
+		return ""
+	}
+	line, col := lineCol(data, int64(loc[0]))
+	return fmt.Sprintf("%d:%d:", line, col)
+}
+
+// knownKeys collects the JSON names of every field reachable from t, so a
+// typo in a nested object still gets a suggestion.
+func knownKeys(t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		keys = append(keys, name)
+		keys = append(keys, knownKeys(f.Type)...)
+	}
+	return keys
+}
+
+func closestKey(key string, candidates []string) string {
+	best, bestDist := "", len(key)/2+1
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.Kind().String()
+}
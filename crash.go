@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crashState mirrors what a crash report needs, outside the model: a
+// panic can happen on any goroutine, and by then the model is gone.
+var crashState struct {
+	sync.Mutex
+	program *tea.Program
+	tunnels []crashTunnel
+	report  string // path of the report once one has been written
+}
+
+type crashTunnel struct {
+	spec tunnelSpec
+	cmd  *exec.Cmd
+}
+
+// recordTunnels is called whenever the tunnel list changes.
+func recordTunnels(tunnels []*tunnel) {
+	snapshot := make([]crashTunnel, 0, len(tunnels))
+	for i := range tunnels {
+		if t := tunnels[i]; t.active && t.mux != nil && t.mux.master != nil {
+			// Killing the master takes its forwards along
+			snapshot = append(snapshot, crashTunnel{spec: t.spec(), cmd: t.mux.master.cmd})
+		} else if t.active {
+			snapshot = append(snapshot, crashTunnel{spec: t.spec(), cmd: t.cmd})
+		}
+	}
+	crashState.Lock()
+	crashState.tunnels = snapshot
+	crashState.Unlock()
+}
+
+// recoverPanic is deferred at the top of the manager's own goroutines. It
+// handles the crash and stops the program, which restores the terminal.
+func recoverPanic(where string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	handleCrash(where, r, debug.Stack())
+
+	crashState.Lock()
+	p := crashState.program
+	crashState.Unlock()
+	if p == nil {
+		os.Exit(2)
+	}
+	p.Kill()
+}
+
+// handleCrash terminates every ssh child (they run in their own process
+// groups and would otherwise outlive the manager) and writes a crash
+// report. Only the first crash is reported.
+func handleCrash(where string, r any, stack []byte) {
+	crashState.Lock()
+	defer crashState.Unlock()
+	if crashState.report != "" {
+		return
+	}
+
+	slog.Error("panic", "where", where, "panic", r, "stack", string(stack))
+
+	for _, t := range crashState.tunnels {
+		if t.cmd != nil {
+			killProcessTree(t.cmd)
+		}
+	}
+
+	path, err := writeCrashReport(where, r, stack, crashState.tunnels)
+	if err != nil {
+		path = "(could not write crash report: " + err.Error() + ")"
+	}
+	crashState.report = path
+}
+
+func writeCrashReport(where string, r any, stack []byte, tunnels []crashTunnel) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "crashes")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	path := filepath.Join(dir, "crash-"+now.Format("20060102-150405")+".txt")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "%s %s crashed at %s\n", appName, Version, now.Format(time.RFC3339))
+	fmt.Fprintf(f, "in: %s\npanic: %v\n\n", where, r)
+
+	fmt.Fprintf(f, "%d active tunnel(s), all terminated:\n", len(tunnels))
+	specs := make([]tunnelSpec, len(tunnels))
+	for i, t := range tunnels {
+		specs[i] = t.spec.sanitized()
+		pid := 0
+		if t.cmd != nil && t.cmd.Process != nil {
+			pid = t.cmd.Process.Pid
+		}
+		fmt.Fprintf(f, "  %s  %s  %s → %s  pid %d\n", specs[i].Tag, specs[i].Host, specs[i].LocalPort, specs[i].RemotePort, pid)
+	}
+	data, _ := json.MarshalIndent(profileBundle{Profiles: specs}, "", "  ")
+	fmt.Fprintf(f, "\nSpecs:\n%s\n\nStack:\n%s", data, stack)
+	return path, nil
+}
+
+// sanitized drops what may hold credentials before a spec leaves the
+// machine in a bug report: proxy passwords, preparation commands and
+// hooks.
+func (s tunnelSpec) sanitized() tunnelSpec {
+	if u, err := url.Parse(s.Proxy); err == nil && u.User != nil {
+		s.Proxy = u.Redacted()
+	}
+	if s.Prep != "" {
+		s.Prep = "(redacted)"
+	}
+	if s.OnConnect != "" {
+		s.OnConnect = "(redacted)"
+	}
+	if s.OnDisconnect != "" {
+		s.OnDisconnect = "(redacted)"
+	}
+	return s
+}
+
+// crashReport is the path of the report written for this run, if any.
+func crashReport() string {
+	crashState.Lock()
+	defer crashState.Unlock()
+	return crashState.report
+}
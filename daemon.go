@@ -0,0 +1,549 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// Daemon mode runs the TUI in a background process that owns the tunnels
+// and serves it over a unix socket in the config directory, and over SSH
+// when ssh_ui is set (see sshui.go). attach connects the terminal to it,
+// like tmux: closing the terminal or detaching leaves the tunnels up, and
+// the next attach shows the same state and logs. Several terminals can be
+// attached at once, each a view of the same screen, sized to fit the
+// smallest of them.
+//
+// The client sends framed messages (a type byte, a big-endian uint16
+// length, the payload); the daemon answers with the raw terminal output.
+
+const (
+	frameHello  = 'h' // width, height (uint16 each), color profile, dark background
+	frameInput  = 'i' // keyboard and mouse bytes
+	frameResize = 'r' // width, height (uint16 each)
+
+	daemonStartWait = 5 * time.Second
+
+	// attachScreen puts a newly attached terminal into the state the
+	// renderer set up when the program started, before any client was
+	// listening: alternate screen, hidden cursor, bracketed paste.
+	attachScreen = "\x1b[?1049h\x1b[?25l\x1b[?2004h\x1b[H\x1b[2J"
+	// detachScreen undoes attachScreen on the client's terminal.
+	detachScreen = "\x1b[?2004l\x1b[?25h\x1b[?1049l"
+)
+
+// daemonSocketPath is the shared daemon's socket when the policy names
+// one, else the user's own.
+func daemonSocketPath() (string, error) {
+	pol, err := loadPolicy()
+	if err != nil {
+		return "", err
+	}
+	if pol.SharedDaemon != "" {
+		return pol.SharedDaemon, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+// daemonRunning reports whether a daemon answers on the socket.
+func daemonRunning(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// daemonServer is the daemon's end of the socket. It stands in for the
+// program's terminal: input blocks while nobody is attached and output is
+// dropped.
+type daemonServer struct {
+	listener net.Listener
+	input    *daemonInput
+	typing   sync.Mutex      // one client's input at a time
+	users    map[string]role // shared_daemon's users, see users.go
+	colors   sync.Once       // see setColors
+
+	mu      sync.Mutex
+	clients map[daemonClient][2]int     // attached terminals and their sizes
+	who     map[daemonClient]daemonUser // who each is, on a shared daemon
+	last    daemonClient                // the one that typed last, which q d detaches
+	program *tea.Program
+
+	sshUI *sshUI // the SSH UI, when ssh_ui is set
+}
+
+// daemonClient is an attached terminal: a connection to the socket, or a
+// session of the SSH UI (see sshui.go).
+type daemonClient interface {
+	io.Writer
+	Close() error
+}
+
+// listenDaemon claims the socket, refusing if another daemon answers on it.
+// A shared daemon's socket is open to every user, who are then let in by
+// pol.
+func listenDaemon(pol policy) (*daemonServer, error) {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	if daemonRunning(path) {
+		return nil, fmt.Errorf("a daemon is already running on %s", path)
+	}
+	dirMode, mode := os.FileMode(0o700), os.FileMode(0o600)
+	if pol.SharedDaemon != "" {
+		dirMode, mode = 0o755, 0o666
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return nil, err
+	}
+	os.Remove(path) // left behind by a daemon that was killed
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	d := &daemonServer{
+		listener: l,
+		input:    newDaemonInput(),
+		clients:  make(map[daemonClient][2]int),
+		who:      make(map[daemonClient]daemonUser),
+	}
+	if pol.SharedDaemon != "" {
+		d.users = pol.users
+	}
+	return d, nil
+}
+
+// programOptions wires the program's terminal to the attached clients.
+func (d *daemonServer) programOptions() []tea.ProgramOption {
+	return []tea.ProgramOption{tea.WithAltScreen(), tea.WithInput(d.input), tea.WithOutput(d)}
+}
+
+// serve accepts clients for p until the listener is closed.
+func (d *daemonServer) serve(p *tea.Program) {
+	d.mu.Lock()
+	d.program = p
+	d.mu.Unlock()
+	go func() {
+		for {
+			conn, err := d.listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.handle(conn)
+		}
+	}()
+	if d.sshUI != nil {
+		d.sshUI.serve(d)
+	}
+}
+
+func (d *daemonServer) handle(conn net.Conn) {
+	typ, payload, err := readFrame(conn)
+	if err != nil || typ != frameHello || len(payload) < 6 {
+		// daemonRunning probes the socket without saying hello
+		conn.Close()
+		return
+	}
+	if d.users != nil {
+		user, err := d.identify(conn)
+		if err != nil {
+			slog.Warn("client refused", "err", err)
+			fmt.Fprintf(conn, "Refused: %v\r\n", err)
+			conn.Close()
+			return
+		}
+		slog.Info("user attaching", "user", user.name, "role", user.role)
+		d.mu.Lock()
+		d.who[conn] = user
+		d.mu.Unlock()
+	}
+	d.setColors(termenv.Profile(payload[4]), payload[5] == 1)
+	d.attach(conn, int(binary.BigEndian.Uint16(payload)), int(binary.BigEndian.Uint16(payload[2:])))
+
+	for {
+		typ, payload, err := readFrame(conn)
+		if err != nil {
+			break
+		}
+		switch typ {
+		case frameInput:
+			d.type_(conn, payload)
+		case frameResize:
+			if len(payload) >= 4 {
+				d.setSize(conn, int(binary.BigEndian.Uint16(payload)), int(binary.BigEndian.Uint16(payload[2:])))
+			}
+		}
+	}
+	d.drop(conn)
+}
+
+// setColors draws the screen in the colors of the first client to attach.
+// The screen is drawn once for every client, so the ones attaching later
+// see it in the same colors rather than changing them for everyone.
+func (d *daemonServer) setColors(profile termenv.Profile, dark bool) {
+	d.colors.Do(func() {
+		lipgloss.SetColorProfile(profile)
+		lipgloss.SetHasDarkBackground(dark)
+	})
+}
+
+// attach adds a client of w by h, and shows it the screen.
+func (d *daemonServer) attach(c daemonClient, w, h int) {
+	io.WriteString(c, attachScreen)
+	d.mu.Lock()
+	d.clients[c] = [2]int{w, h}
+	d.last = c
+	attached := len(d.clients)
+	d.mu.Unlock()
+	slog.Info("client attached", "width", w, "height", h, "attached", attached)
+	// A size message makes the renderer repaint the whole screen, which
+	// the new client needs even when the size stays the same
+	d.resize()
+}
+
+// type_ passes what c typed on to the program. On a shared daemon, the
+// keys are preceded by who typed them, and all of them reach the program
+// before anyone else's do.
+func (d *daemonServer) type_(c daemonClient, input []byte) {
+	d.typing.Lock()
+	defer d.typing.Unlock()
+	d.mu.Lock()
+	d.last = c
+	user, known := d.who[c]
+	shared, p := d.users != nil, d.program
+	d.mu.Unlock()
+	if !known {
+		// Over SSH, with the owner's keys
+		user = ownerUser()
+	}
+	if shared {
+		p.Send(daemonInputMsg{user})
+	}
+	d.input.write(input)
+}
+
+// setSize notes that c's terminal is now w by h.
+func (d *daemonServer) setSize(c daemonClient, w, h int) {
+	d.mu.Lock()
+	d.clients[c] = [2]int{w, h}
+	d.mu.Unlock()
+	d.resize()
+}
+
+// resize sizes the program to fit every attached terminal.
+func (d *daemonServer) resize() {
+	d.mu.Lock()
+	w, h := 0, 0
+	for _, size := range d.clients {
+		if w == 0 || size[0] < w {
+			w = size[0]
+		}
+		if h == 0 || size[1] < h {
+			h = size[1]
+		}
+	}
+	p := d.program
+	d.mu.Unlock()
+	if w > 0 && h > 0 {
+		p.Send(tea.WindowSizeMsg{Width: w, Height: h})
+	}
+}
+
+// drop forgets conn, resizing for the terminals still attached.
+func (d *daemonServer) drop(conn daemonClient) {
+	d.mu.Lock()
+	conn.Close()
+	_, ok := d.clients[conn]
+	delete(d.clients, conn)
+	delete(d.who, conn)
+	if d.last == conn {
+		d.last = nil
+	}
+	remaining := len(d.clients)
+	d.mu.Unlock()
+	if ok {
+		slog.Info("client detached", "attached", remaining)
+		// Not waited for: detach runs in Update and Write in the renderer,
+		// which the program's event loop may be waiting on
+		go d.resize()
+	}
+}
+
+// detach disconnects the client that typed last, leaving the tunnels
+// running and the other clients attached.
+func (d *daemonServer) detach() {
+	d.mu.Lock()
+	conn := d.last
+	d.mu.Unlock()
+	if conn != nil {
+		d.drop(conn)
+	}
+}
+
+// Write sends program output to every attached client.
+func (d *daemonServer) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	conns := make([]daemonClient, 0, len(d.clients))
+	for conn := range d.clients {
+		conns = append(conns, conn)
+	}
+	d.mu.Unlock()
+	for _, conn := range conns {
+		if dl, ok := conn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+			dl.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		}
+		if _, err := conn.Write(b); err != nil {
+			d.drop(conn)
+		}
+	}
+	return len(b), nil
+}
+
+// Close stops accepting clients and disconnects the attached ones.
+func (d *daemonServer) Close() {
+	d.listener.Close()
+	d.mu.Lock()
+	conns := make([]daemonClient, 0, len(d.clients))
+	for conn := range d.clients {
+		conns = append(conns, conn)
+	}
+	d.mu.Unlock()
+	for _, conn := range conns {
+		d.drop(conn)
+	}
+	if d.sshUI != nil {
+		d.sshUI.Close()
+	}
+	d.input.Close()
+}
+
+// daemonInput is the program's input: what the clients type, a chunk at a
+// time. Unlike a pipe, write returns only once the program is back for
+// more, which it is after handing on every key read from the chunk.
+type daemonInput struct {
+	chunks  chan []byte
+	done    chan struct{} // the last chunk is all read
+	closed  chan struct{}
+	once    sync.Once
+	pending []byte // read by the program only
+	reading bool
+}
+
+func newDaemonInput() *daemonInput {
+	return &daemonInput{chunks: make(chan []byte), done: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (in *daemonInput) Read(b []byte) (int, error) {
+	if len(in.pending) == 0 {
+		if in.reading {
+			in.reading = false
+			select {
+			case in.done <- struct{}{}:
+			case <-in.closed:
+				return 0, io.EOF
+			}
+		}
+		select {
+		case in.pending = <-in.chunks:
+			in.reading = true
+		case <-in.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, in.pending)
+	in.pending = in.pending[n:]
+	return n, nil
+}
+
+// write hands b to the program and waits for it to be read.
+func (in *daemonInput) write(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	select {
+	case in.chunks <- b:
+	case <-in.closed:
+		return
+	}
+	select {
+	case <-in.done:
+	case <-in.closed:
+	}
+}
+
+// Close ends the input, as closing the terminal would.
+func (in *daemonInput) Close() error {
+	in.once.Do(func() { close(in.closed) })
+	return nil
+}
+
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	if len(payload) > 0xffff {
+		payload = payload[:0xffff]
+	}
+	buf := make([]byte, 3+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(payload)))
+	copy(buf[3:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[1:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+func sizeFrame(w, h int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b, uint16(w))
+	binary.BigEndian.PutUint16(b[2:], uint16(h))
+	return b
+}
+
+// startDaemon runs "daemon" in the background with args, sending its
+// stderr to daemon.log, and waits for the socket to answer.
+func startDaemon(path string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	logPath := filepath.Join(filepath.Dir(path), "daemon.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, append([]string{"daemon"}, args...)...)
+	detachProcess(cmd)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	deadline := time.Now().Add(daemonStartWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			logs, _ := tailFile(logPath, 4096)
+			return fmt.Errorf("daemon exited (%s):\n%s", cmd.ProcessState, logs)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if daemonRunning(path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("daemon did not answer on %s within %s, see %s", path, daemonStartWait, logPath)
+}
+
+// runAttach connects the terminal to the daemon, starting one first if
+// none is running. Any arguments are passed to a daemon it starts.
+func runAttach(args []string) error {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return err
+	}
+	if !daemonRunning(path) {
+		if err := startDaemon(path, args); err != nil {
+			return err
+		}
+	} else if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "A daemon is already running; ignoring the given options.")
+	}
+
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) {
+		return errors.New("attach needs a terminal")
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w, h, err := term.GetSize(out)
+	if err != nil || w == 0 {
+		w, h = 80, 24
+	}
+	dark := byte(0)
+	if lipgloss.HasDarkBackground() {
+		dark = 1
+	}
+	hello := append(sizeFrame(w, h), byte(lipgloss.ColorProfile()), dark)
+	if err := writeFrame(conn, frameHello, hello); err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	go watchTerminalSize(out, stop, func(w, h int) {
+		writeFrame(conn, frameResize, sizeFrame(w, h))
+	})
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			if writeFrame(conn, frameInput, buf[:n]) != nil {
+				return
+			}
+		}
+	}()
+
+	io.Copy(os.Stdout, conn)
+	close(stop)
+	io.WriteString(os.Stdout, detachScreen)
+	term.Restore(in, state)
+
+	if daemonRunning(path) {
+		fmt.Println("Detached; tunnels keep running. Run attach to reconnect.")
+	} else {
+		fmt.Println("Daemon exited.")
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// The dashboard replaces the tunnel list and the logs with one table of
+// every tunnel, for keeping an eye on the whole fleet: tag, host, ports,
+// status, uptime and traffic. v switches between the two. The table
+// follows the list's sort mode and filter, without the group sections,
+// and the list's keys act on its selected tunnel.
+
+// dashboardColumn is a column of the dashboard and its share of the width,
+// in percent.
+type dashboardColumn struct {
+	title string
+	share int
+	sort  sortMode // the mode that sorts by it, sortCreated for none
+}
+
+var dashboardColumns = []dashboardColumn{
+	{"Tag", 16, sortTag},
+	{"Host", 17, sortHost},
+	{"Local", 9, sortCreated},
+	{"Remote", 17, sortCreated},
+	{"Status", 12, sortStatus},
+	{"Uptime", 15, sortUptime},
+	{"RX/TX", 14, sortCreated},
+}
+
+func (m *model) toggleDashboard() {
+	m.dashboard = !m.dashboard
+	if !m.dashboard {
+		m.syncSelection()
+		return
+	}
+	m.selectedPanel = 0
+	order := m.dashboardOrder()
+	if len(order) > 0 && !slices.Contains(order, m.selectedTunnel) {
+		m.selectedGroup, m.selectedTunnel = "", order[0]
+	}
+	m.dashboardTop = 0
+	m.moveDashboard(0)
+}
+
+// dashboardOrder is the tunnels in the table, as indexes into m.tunnels.
+func (m model) dashboardOrder() []int {
+	var order []int
+	for i, t := range m.tunnels {
+		if t.matches(m.listFilter) {
+			order = append(order, i)
+		}
+	}
+	m.sortTunnels(order)
+	return order
+}
+
+// dashboardTableTop is how far below the panel's top border the table's
+// first row is: the padding, the title, a blank line and the headings.
+const dashboardTableTop = 5
+
+// dashboardHeight is how many tunnels the table shows at once.
+func (m model) dashboardHeight() int {
+	// The padding, the title and the headings, two lines each
+	return max(m.height-8-6, 1)
+}
+
+// clickDashboard selects the tunnel on the table's row-th visible row.
+func (m *model) clickDashboard(row int) {
+	order := m.dashboardOrder()
+	top := min(m.dashboardTop, max(len(order)-m.dashboardHeight(), 0))
+	if row < m.dashboardHeight() && top+row < len(order) {
+		m.selectedGroup, m.selectedTunnel = "", order[top+row]
+		m.logScroll = 0
+	}
+}
+
+// moveDashboard selects the tunnel n rows down the table, or up when n is
+// negative, scrolling to keep it in view.
+func (m *model) moveDashboard(n int) {
+	order := m.dashboardOrder()
+	if len(order) == 0 {
+		return
+	}
+	row := max(min(slices.Index(order, m.selectedTunnel)+n, len(order)-1), 0)
+	m.selectedGroup, m.selectedTunnel = "", order[row]
+	m.logScroll = 0
+	if row < m.dashboardTop {
+		m.dashboardTop = row
+	}
+	if h := m.dashboardHeight(); row >= m.dashboardTop+h {
+		m.dashboardTop = row - h + 1
+	}
+}
+
+// trafficLabel is what the tunnel carried, down and up when the two are
+// counted apart: only the traffic the manager relays is counted.
+func (t *tunnel) trafficLabel() string {
+	if t.native != nil {
+		return fmt.Sprintf("↓ %s ↑ %s", fmtBytes(t.native.bytesIn.Load()), fmtBytes(t.native.bytesOut.Load()))
+	}
+	if n, ok := t.trafficBytes(); ok {
+		return "⇅ " + fmtBytes(n)
+	}
+	return "–"
+}
+
+// statusLabel names the state the status dot shows.
+func (t tunnel) statusLabel() string {
+	switch {
+	case t.degraded():
+		return "degraded"
+	case t.sleeping:
+		return "idle"
+	case t.active:
+		return "up"
+	case t.scheduled():
+		return "scheduled"
+	case t.failed:
+		return "failed"
+	case t.restarting:
+		return "restarting"
+	}
+	return "down"
+}
+
+func (m model) renderDashboard(width, height int) string {
+	style := selectedPanelStyle.Width(width).Height(height)
+	title := titleStyle.Render(m.listTitle("DASHBOARD")) + "\n\n"
+	order := m.dashboardOrder()
+	if len(order) == 0 {
+		empty := "No tunnels active\n\nPress 'n' to create one"
+		if len(m.tunnels) > 0 {
+			empty = "No tunnel matches the filter"
+		}
+		return style.Render(title + subtleStyle.Render(empty))
+	}
+
+	// Each cell is padded by a column on both sides
+	inner := width - 4 - 2*len(dashboardColumns)
+	cols := make([]table.Column, len(dashboardColumns))
+	for i, c := range dashboardColumns {
+		cols[i] = table.Column{Title: c.title, Width: inner * c.share / 100}
+		if c.sort != sortCreated && c.sort == m.listSort {
+			cols[i].Title += " ▾"
+		}
+	}
+
+	h := m.dashboardHeight()
+	top := min(m.dashboardTop, max(len(order)-h, 0))
+	var rows []table.Row
+	cursor := 0
+	keys := m.keys.quickKeys()
+	for row, i := range order[top:min(top+h, len(order))] {
+		t := m.tunnels[i]
+		if i == m.selectedTunnel {
+			cursor = row
+		}
+		tag := t.tag
+		if t.marked {
+			tag = "✓ " + tag
+		}
+		if n := top + row; n < len(keys) {
+			tag = keyLabel(keys[n:n+1]) + " " + tag
+		}
+		local, remote := t.localPort, remoteEnd(t.remoteHost, t.remotePort)
+		switch t.tunnelType {
+		case "remote":
+			remote += " (-R)"
+		case "socks":
+			remote = "SOCKS"
+		}
+		if len(t.forwards) > 0 {
+			local += fmt.Sprintf(" +%d", len(t.forwards))
+		}
+		rows = append(rows, table.Row{tag, t.host, local, remote, t.statusDot() + " " + t.statusLabel(), t.uptimeLabel(), t.trafficLabel()})
+	}
+
+	styles := table.DefaultStyles()
+	styles.Header = tableHeaderStyle
+	styles.Selected = selectedStyle
+	tbl := table.New(
+		table.WithColumns(cols),
+		table.WithRows(rows),
+		table.WithHeight(h+2),
+		table.WithWidth(width-4),
+		table.WithFocused(true),
+		table.WithStyles(styles),
+	)
+	tbl.SetCursor(cursor)
+	return style.Render(title + tbl.View())
+}
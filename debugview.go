@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const maxRecentMsgs = 15
+
+// recentMsg is a message type the model processed, with repeats folded
+// into a count so ticks don't push everything else out.
+type recentMsg struct {
+	name  string
+	count int
+	at    time.Time
+}
+
+func (m *model) noteMsg(msg any) {
+	name := fmt.Sprintf("%T", msg)
+	if n := len(m.recentMsgs); n > 0 && m.recentMsgs[n-1].name == name {
+		m.recentMsgs[n-1].count++
+		m.recentMsgs[n-1].at = time.Now()
+		return
+	}
+	m.recentMsgs = append(m.recentMsgs, recentMsg{name: name, count: 1, at: time.Now()})
+	if len(m.recentMsgs) > maxRecentMsgs {
+		m.recentMsgs = m.recentMsgs[1:]
+	}
+}
+
+// renderDebug dumps live internal state, opened with ctrl+d.
+func (m model) renderDebug() string {
+	var b strings.Builder
+	b.WriteString(highlightStyle.Render("Debug") + "\n\n")
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(&b, "Goroutines: %d   Heap: %.1f MiB   GCs: %d\n", runtime.NumGoroutine(), float64(mem.HeapAlloc)/(1<<20), mem.NumGC)
+	fmt.Fprintf(&b, "View: %d   Step: %d   Panel: %d   Selected: %d/%d   Next id: %d\n",
+		m.view, m.step, m.selectedPanel, m.selectedTunnel, len(m.tunnels), m.nextTunnelID)
+
+	var pending []string
+	if m.discovering {
+		pending = append(pending, "port discovery")
+	}
+	if m.fetchingProfiles {
+		pending = append(pending, "profile fetch")
+	}
+	if m.view == viewNewTunnel && m.step == stepConnecting && m.err == nil {
+		pending = append(pending, "connect: "+m.connectStage)
+	}
+	if len(pending) == 0 {
+		pending = append(pending, "none")
+	}
+	b.WriteString("In flight: " + strings.Join(pending, ", ") + "\n")
+	fmt.Fprintf(&b, "Log memory: %s of %s\n\n", fmtBytes(uint64(m.logMemoryUsed())), fmtBytes(uint64(m.logMemoryLimit())))
+
+	b.WriteString(selectedStyle.Render("Tunnels") + "\n")
+	if len(m.tunnels) == 0 {
+		b.WriteString(subtleStyle.Render("  (none)") + "\n")
+	}
+	for _, t := range m.tunnels {
+		pid, state := 0, "running"
+		if t.cmd != nil && t.cmd.Process != nil {
+			pid = t.cmd.Process.Pid
+		}
+		if !t.active {
+			state = "stopped"
+		}
+		fmt.Fprintf(&b, "  #%d %-18s %-7s pid %-7d logs %-3d %s\n", t.id, t.tag, state, pid, t.logs.len(), fmtBytes(uint64(t.logBytes)))
+	}
+
+	b.WriteString("\n" + selectedStyle.Render("Recent messages") + "\n")
+	for i := len(m.recentMsgs) - 1; i >= 0; i-- {
+		r := m.recentMsgs[i]
+		line := fmt.Sprintf("  %s  %s", r.at.Format("15:04:05"), r.name)
+		if r.count > 1 {
+			line += fmt.Sprintf(" ×%d", r.count)
+		}
+		b.WriteString(subtleStyle.Render(line) + "\n")
+	}
+
+	b.WriteString("\n" + subtleStyle.Render("e to export a diagnostic bundle • Esc or ctrl+d to close"))
+
+	modal := panelStyle.Width(90).Render(b.String())
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
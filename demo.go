@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// With --demo the manager runs without ssh. Tunnels are served by local
+// stand-ins for the remote service, so port checks, protocol detection,
+// smoke tests and local TLS behave as usual, and their logs, drops and
+// reconnects are simulated. Good for screenshots, UI work and CI.
+
+const demoTickInterval = 1500 * time.Millisecond
+
+var demoHosts = []string{
+	"bastion",
+	"staging-web staging-web.internal",
+	"db-primary db-primary.internal",
+	"cache-1",
+	"git.internal",
+}
+
+var demoSpecs = []tunnelSpec{
+	{Tag: "staging-web", Host: "staging-web", LocalPort: "18080", RemotePort: "80", SmokeTest: "http /"},
+	{Tag: "pg-prod", Host: "db-primary", LocalPort: "15432", RemotePort: "5432", SmokeTest: "tcp"},
+	{Tag: "redis-cache", Host: "cache-1", LocalPort: "16379", RemotePort: "6379"},
+	{Tag: "git-mirror", Host: "git.internal", LocalPort: "12222", RemotePort: "22", SmokeTest: "banner ^SSH-"},
+}
+
+var demoLogLines = []string{
+	"debug1: Connection to port %s forwarding to localhost port %s requested.",
+	"debug1: channel %d: new [direct-tcpip]",
+	"debug1: channel %d: free: direct-tcpip: listening port %s for localhost port %s, connect from 127.0.0.1",
+	"debug1: client_input_global_request: rtype keepalive@openssh.com want_reply 1",
+}
+
+// demoService stands in for the remote end of a demo tunnel.
+type demoService struct {
+	ln       net.Listener
+	protocol string
+	down     int // ticks left until a dropped tunnel reconnects
+	attempt  int
+	forwards []*demoService // stand-ins for the tunnel's additional forwards
+}
+
+func startDemoService(port, protocol string) (*demoService, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		return nil, err
+	}
+	s := &demoService{ln: ln, protocol: protocol}
+	go s.serve()
+	return s, nil
+}
+
+func demoProtocol(remotePort string) string {
+	switch remotePort {
+	case "22":
+		return "ssh"
+	case "3306":
+		return "mysql"
+	case "5432":
+		return "pg"
+	case "6379":
+		return "redis"
+	}
+	return "http"
+}
+
+func (s *demoService) Close() {
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for _, f := range s.forwards {
+		f.Close()
+	}
+}
+
+func (s *demoService) serve() {
+	defer recoverPanic("demo service")
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.answer(conn)
+	}
+}
+
+// answer speaks just enough of the protocol to satisfy detectProtocol and
+// the smoke tests.
+func (s *demoService) answer(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	switch s.protocol {
+	case "ssh":
+		io.WriteString(conn, "SSH-2.0-OpenSSH_9.6 demo\r\n")
+	case "mysql":
+		conn.Write([]byte{0x0a, 0, 0, 0, 0x0a, '8', '.', '0', '.', '3', '6', 0})
+	case "pg":
+		buf := make([]byte, len(postgresSSLRequest))
+		if _, err := io.ReadFull(r, buf); err == nil && bytes.Equal(buf, postgresSSLRequest) {
+			io.WriteString(conn, "N")
+		}
+	case "redis":
+		if _, err := r.ReadString('\n'); err == nil {
+			io.WriteString(conn, "+PONG\r\n")
+		}
+	case "socks":
+		buf := make([]byte, len(socks5Greeting))
+		if _, err := io.ReadFull(r, buf); err == nil && buf[0] == 0x05 {
+			conn.Write([]byte{0x05, 0x00})
+		}
+	default:
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.TrimSpace(line) == "" {
+				break
+			}
+		}
+		body := "ssh-tunnel-manager demo\n"
+		fmt.Fprintf(conn, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}
+}
+
+type demoStartMsg struct{}
+
+type demoTickMsg time.Time
+
+func demoTickCmd() tea.Cmd {
+	return tea.Tick(demoTickInterval, func(t time.Time) tea.Msg {
+		return demoTickMsg(t)
+	})
+}
+
+// startDemoTunnels starts the sample tunnels shown when --demo begins.
+func (m *model) startDemoTunnels() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, spec := range demoSpecs {
+		cmd, err := m.startTunnel(spec, precheckMsg{}, nil, 0)
+		if err != nil {
+			m.statusMessage = fmt.Sprintf("Demo tunnel %s: %v", spec.Tag, err)
+			continue
+		}
+		cmds = append(cmds, cmd)
+	}
+	return tea.Batch(cmds...)
+}
+
+// demoStep advances the simulation for one random tunnel: a log line, a
+// dropped connection, or a step of reconnecting.
+func (m *model) demoStep() {
+	if len(m.tunnels) == 0 {
+		return
+	}
+	t := m.tunnels[rand.IntN(len(m.tunnels))]
+	s := t.demo
+	if s == nil {
+		return // stopped
+	}
+
+	switch {
+	case s.down > 0:
+		s.down--
+		s.attempt++
+		if s.down > 0 {
+			t.appendLog(fmt.Sprintf("ssh: connect to host %s port 22: Connection timed out (attempt %d)", t.host, s.attempt))
+			return
+		}
+		t.appendLog(fmt.Sprintf("Reconnected to %s after %d attempt(s)", t.host, s.attempt))
+		t.active = true
+		t.markReconnected()
+		m.updateTunnelList()
+
+	case rand.IntN(20) == 0:
+		s.down = 2 + rand.IntN(3)
+		s.attempt = 0
+		t.appendLog(fmt.Sprintf("Connection to %s closed by remote host.", t.host))
+		t.appendLog("Reconnecting...")
+		t.markDown()
+		t.active = false
+		m.updateTunnelList()
+
+	default:
+		line := demoLogLines[rand.IntN(len(demoLogLines))]
+		switch strings.Count(line, "%") {
+		case 1:
+			line = fmt.Sprintf(line, rand.IntN(8)+2)
+		case 2:
+			line = fmt.Sprintf(line, t.localPort, t.remotePort)
+		case 3:
+			line = fmt.Sprintf(line, rand.IntN(8)+2, t.localPort, t.remotePort)
+		}
+		t.appendLog(line)
+	}
+}
+
+// demoPortChoicesCmd and demoRemoteProcessCmd replace what discovery and the
+// remote process lookup would find over ssh.
+func demoPortChoicesCmd() tea.Cmd {
+	return func() tea.Msg {
+		return portChoicesMsg{choices: []portChoice{
+			{port: "80", label: "nginx", detail: "0.0.0.0", pid: "812"},
+			{port: "5432", label: "postgres", detail: "127.0.0.1", tag: "postgres", pid: "1044"},
+			{port: "6379", label: "redis-server", detail: "127.0.0.1", tag: "redis", pid: "977"},
+			{port: "9090", label: "prometheus", detail: "0.0.0.0", tag: "prometheus", pid: "1530"},
+		}}
+	}
+}
+
+func demoRemoteProcessCmd(tunnelID int, host, port string) tea.Cmd {
+	return func() tea.Msg {
+		return remoteProcessMsg{tunnelID: tunnelID, info: fmt.Sprintf("port %s on %s is served by demo-service, user demo", port, host)}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// appLogTail is how much of the end of the --log-file goes in a bundle.
+const appLogTail = 1 << 20
+
+// diagnostics is what goes into a bundle. The subcommand only has what is
+// on disk; the TUI adds its tunnels and their logs.
+type diagnostics struct {
+	cfg     config
+	cfgErr  error
+	logFile string
+	tunnels []diagTunnel
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+type diagTunnel struct {
+	id     int
+	spec   tunnelSpec
+	active bool
+	logs   []string
+}
+
+// writeDiagnosticBundle writes a .tar.gz for bug reports. Proxy passwords,
+// URL query strings, the web UI token and preparation commands are removed
+// everywhere they could appear, log files included.
+func writeDiagnosticBundle(path string, d diagnostics) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	redact := d.redactor()
+	files := []bundleFile{
+		{"system.txt", systemInfo()},
+		{"config.json", d.redactedConfig()},
+	}
+	if data, err := os.ReadFile(policyPath()); err == nil {
+		files = append(files, bundleFile{"policy.json", data})
+	}
+	if profiles, err := loadProfiles(); err == nil {
+		files = append(files, bundleFile{"profiles.json", sanitizedSpecs(profiles)})
+	}
+	if len(d.tunnels) > 0 {
+		specs := make([]tunnelSpec, len(d.tunnels))
+		for i, t := range d.tunnels {
+			specs[i] = t.spec
+		}
+		files = append(files, bundleFile{"tunnels.json", sanitizedSpecs(specs)})
+	}
+	for _, t := range d.tunnels {
+		state := "inactive"
+		if t.active {
+			state = "active"
+		}
+		text := fmt.Sprintf("# %s (%s)\n%s\n", t.spec.Tag, state, strings.Join(t.logs, "\n"))
+		files = append(files, bundleFile{fmt.Sprintf("tunnel-logs/%d-%s.log", t.id, t.spec.Tag), []byte(redact.Replace(text))})
+	}
+	if d.logFile != "" {
+		if data, err := tailFile(d.logFile, appLogTail); err == nil {
+			files = append(files, bundleFile{"app.log", []byte(redact.Replace(string(data)))})
+		}
+	}
+	for _, path := range recentCrashReports(3) {
+		if data, err := os.ReadFile(path); err == nil {
+			files = append(files, bundleFile{"crashes/" + filepath.Base(path), data})
+		}
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:    "ssh-tunnel-manager-diag/" + file.name,
+			Mode:    0o600,
+			Size:    int64(len(file.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func systemInfo() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\n", appName, Version)
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "generated: %s\n", time.Now().Format(time.RFC3339))
+	// ssh -V prints its version on stderr
+	out, err := exec.Command("ssh", "-V").CombinedOutput()
+	if err != nil && len(out) == 0 {
+		out = []byte(err.Error())
+	}
+	fmt.Fprintf(&b, "ssh: %s\n", strings.TrimSpace(string(out)))
+	return b.Bytes()
+}
+
+func (d diagnostics) redactedConfig() []byte {
+	if d.cfgErr != nil {
+		return []byte(fmt.Sprintf("config could not be loaded: %v\n", d.cfgErr))
+	}
+	cfg := d.cfg
+	cfg.Proxy = redactURL(cfg.Proxy)
+	cfg.ProfilesURL = redactURL(cfg.ProfilesURL)
+	if cfg.WebUIToken != "" {
+		cfg.WebUIToken = "(redacted)"
+	}
+	data, _ := json.MarshalIndent(cfg, "", "  ")
+	return append(data, '\n')
+}
+
+// redactor replaces every secret known to the bundle in free text.
+func (d diagnostics) redactor() *strings.Replacer {
+	var pairs []string
+	secret := func(s, with string) {
+		if s != "" && s != with {
+			pairs = append(pairs, s, with)
+		}
+	}
+	secret(d.cfg.Proxy, redactURL(d.cfg.Proxy))
+	secret(d.cfg.ProfilesURL, redactURL(d.cfg.ProfilesURL))
+	secret(d.cfg.WebUIToken, "(redacted)")
+	if dir, err := configDir(); err == nil {
+		if token, err := os.ReadFile(filepath.Join(dir, "webui-token")); err == nil {
+			secret(strings.TrimSpace(string(token)), "(redacted)")
+		}
+	}
+	specs, _ := loadProfiles()
+	for _, t := range d.tunnels {
+		specs = append(specs, t.spec)
+	}
+	for _, s := range specs {
+		secret(s.Proxy, redactURL(s.Proxy))
+		secret(s.Prep, "(redacted)")
+		secret(s.OnConnect, "(redacted)")
+		secret(s.OnDisconnect, "(redacted)")
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// redactURL hides the password and query of a URL, which is where
+// proxies and bundle servers carry credentials.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || s == "" {
+		return s
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.Redacted()
+}
+
+func sanitizedSpecs(specs []tunnelSpec) []byte {
+	clean := make([]tunnelSpec, len(specs))
+	for i, s := range specs {
+		clean[i] = s.sanitized()
+	}
+	data, _ := json.MarshalIndent(profileBundle{Profiles: clean}, "", "  ")
+	return append(data, '\n')
+}
+
+// tailFile reads at most the last n bytes of path.
+func tailFile(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > n {
+		if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
+
+func recentCrashReports(n int) []string {
+	dir, err := configDir()
+	if err != nil {
+		return nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "crashes", "crash-*.txt"))
+	// The names sort by time
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths[:min(n, len(paths))]
+}
+
+func diagnosticBundleName() string {
+	return "ssh-tunnel-manager-diag-" + time.Now().Format("20060102-150405") + ".tar.gz"
+}
+
+// diagnostics snapshots the running manager for a bundle.
+func (m model) diagnostics() diagnostics {
+	d := diagnostics{cfg: m.cfg, logFile: m.logFile}
+	for _, t := range m.tunnels {
+		d.tunnels = append(d.tunnels, diagTunnel{id: t.id, spec: t.spec(), active: t.active, logs: t.logs.lines()})
+	}
+	return d
+}
+
+type diagnosticsMsg struct {
+	path string
+	err  error
+}
+
+// diagnosticBundleCmd writes a bundle to diagnostics/ in the config
+// directory.
+func diagnosticBundleCmd(d diagnostics) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := configDir()
+		if err != nil {
+			return diagnosticsMsg{err: err}
+		}
+		path := filepath.Join(dir, "diagnostics", diagnosticBundleName())
+		return diagnosticsMsg{path: path, err: writeDiagnosticBundle(path, d)}
+	}
+}
+
+// runDiagnose implements the diagnose subcommand.
+func runDiagnose(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	out := fs.String("out", diagnosticBundleName(), "where to write the bundle")
+	logFile := fs.String("log-file", "", "app log file to include (the one passed to --log-file)")
+	fs.Parse(args)
+
+	d := diagnostics{logFile: *logFile}
+	d.cfg, d.cfgErr = loadConfig()
+	if err := writeDiagnosticBundle(*out, d); err != nil {
+		return err
+	}
+	fmt.Printf("Diagnostic bundle written to %s\nCheck it before sharing: secrets known to the manager are redacted, host names are not.\n", *out)
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const discoverTimeout = 15 * time.Second
+
+// portChoice is one entry of the remote port picker.
+type portChoice struct {
+	port   string
+	label  string // what listens there, e.g. the process name
+	detail string // extra context such as the bind address
+	tag    string // suggested tunnel tag, if the choice implies one
+	pid    string
+}
+
+type portChoicesMsg struct {
+	choices []portChoice
+	err     error
+}
+
+// listenersScript prefers ss and falls back to netstat for older hosts.
+// -p only reports processes the remote user may see, which is fine.
+const listenersScript = "ss -tlnp 2>/dev/null || netstat -tlnp 2>/dev/null"
+
+// containersScript lists running containers with their port mappings and,
+// for compose projects, the service name.
+const containersScript = `docker ps --format '{{.Names}}\t{{.Ports}}\t{{.Label "com.docker.compose.service"}}'`
+
+var ssProcessRe = regexp.MustCompile(`users:\(\("([^"]+)",pid=(\d+)`)
+
+// runRemote runs a non-interactive command on host and returns its stdout.
+func runRemote(host, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "--", host, command)
+	setProcessGroup(cmd)
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s did not answer within %s", host, discoverTimeout)
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+func discoverListenersCmd(host string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := runRemote(host, listenersScript)
+		if err != nil {
+			return portChoicesMsg{err: fmt.Errorf("cannot list ports on %s: %v", host, err)}
+		}
+		choices := parseListeners(out)
+		if len(choices) == 0 {
+			return portChoicesMsg{err: fmt.Errorf("no listening TCP ports found on %s", host)}
+		}
+		return portChoicesMsg{choices: choices}
+	}
+}
+
+func discoverContainersCmd(host string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := runRemote(host, containersScript)
+		if err != nil {
+			return portChoicesMsg{err: fmt.Errorf("cannot list containers on %s: %v", host, err)}
+		}
+		choices := parseContainers(out)
+		if len(choices) == 0 {
+			return portChoicesMsg{err: fmt.Errorf("no containers with published ports on %s", host)}
+		}
+		return portChoicesMsg{choices: choices}
+	}
+}
+
+// parseContainers turns `docker ps` rows into picker entries, one per
+// published TCP port. Ports that aren't published on the host can't be
+// reached through a localhost forward, so they are left out.
+func parseContainers(output string) []portChoice {
+	var choices []portChoice
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		name, ports := fields[0], fields[1]
+		label := name
+		if len(fields) >= 3 && fields[2] != "" {
+			label = fmt.Sprintf("%s (%s)", name, fields[2])
+		}
+
+		for _, mapping := range strings.Split(ports, ",") {
+			// e.g. "0.0.0.0:5432->5432/tcp" or ":::5432->5432/tcp"
+			published, target, ok := strings.Cut(strings.TrimSpace(mapping), "->")
+			if !ok || !strings.HasSuffix(target, "/tcp") {
+				continue
+			}
+			hostPort := published[strings.LastIndex(published, ":")+1:]
+			if _, err := strconv.Atoi(hostPort); err != nil || seen[name+hostPort] {
+				continue
+			}
+			seen[name+hostPort] = true
+			choices = append(choices, portChoice{
+				port:   hostPort,
+				label:  label,
+				detail: "→ " + target,
+				tag:    sanitizeTag(name),
+			})
+		}
+	}
+
+	sortPortChoices(choices)
+	return choices
+}
+
+// sanitizeTag maps a name onto the characters the tag field accepts.
+func sanitizeTag(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// parseListeners understands both `ss -tlnp` and `netstat -tlnp` output,
+// merging IPv4/IPv6 sockets bound to the same port into one entry.
+func parseListeners(output string) []portChoice {
+	byPort := map[string]*portChoice{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		var local, process, pid string
+
+		switch {
+		case len(fields) >= 5 && fields[0] == "LISTEN":
+			// ss: State Recv-Q Send-Q Local Peer [Process]
+			local = fields[3]
+			if match := ssProcessRe.FindStringSubmatch(line); match != nil {
+				process = fmt.Sprintf("%s (pid %s)", match[1], match[2])
+				pid = match[2]
+			}
+		case len(fields) >= 6 && strings.HasPrefix(fields[0], "tcp") && fields[5] == "LISTEN":
+			// netstat: Proto Recv-Q Send-Q Local Foreign State [PID/Program]
+			local = fields[3]
+			if len(fields) >= 7 && fields[6] != "-" {
+				if id, name, ok := strings.Cut(fields[6], "/"); ok {
+					process = fmt.Sprintf("%s (pid %s)", name, id)
+					pid = id
+				}
+			}
+		default:
+			continue
+		}
+
+		i := strings.LastIndex(local, ":")
+		if i < 0 {
+			continue
+		}
+		addr, port := strings.Trim(local[:i], "[]"), local[i+1:]
+		if _, err := strconv.Atoi(port); err != nil {
+			continue
+		}
+
+		if c, ok := byPort[port]; ok {
+			if c.label == "" {
+				c.label, c.pid = process, pid
+			}
+			if !strings.Contains(c.detail, addr) {
+				c.detail += ", " + addr
+			}
+			continue
+		}
+		byPort[port] = &portChoice{port: port, label: process, detail: addr, pid: pid}
+	}
+
+	choices := make([]portChoice, 0, len(byPort))
+	for _, c := range byPort {
+		if c.label == "" {
+			c.label = "unknown process"
+		}
+		choices = append(choices, *c)
+	}
+	sortPortChoices(choices)
+	return choices
+}
+
+type remoteProcessMsg struct {
+	tunnelID int
+	info     string
+	err      error
+}
+
+// remoteProcessCmd asks the host which process listens on port, adding the
+// owning user from ps so the answer can be checked against expectations.
+func remoteProcessCmd(tunnelID int, host, port string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := runRemote(host, listenersScript+"; echo ---; ps -eo pid=,user=")
+		if err != nil {
+			return remoteProcessMsg{tunnelID: tunnelID, err: fmt.Errorf("cannot inspect %s: %v", host, err)}
+		}
+
+		listeners, users, _ := strings.Cut(out, "---")
+		for _, c := range parseListeners(listeners) {
+			if c.port != port {
+				continue
+			}
+			if c.pid == "" {
+				return remoteProcessMsg{tunnelID: tunnelID, info: fmt.Sprintf("port %s is open on %s, but its process isn't visible to this user", port, host)}
+			}
+			info := fmt.Sprintf("port %s on %s is served by %s", port, host, c.label)
+			for _, line := range strings.Split(users, "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == c.pid {
+					info += ", user " + fields[1]
+				}
+			}
+			return remoteProcessMsg{tunnelID: tunnelID, info: info}
+		}
+		return remoteProcessMsg{tunnelID: tunnelID, err: fmt.Errorf("nothing is listening on port %s on %s", port, host)}
+	}
+}
+
+func sortPortChoices(choices []portChoice) {
+	sort.Slice(choices, func(i, j int) bool {
+		a, _ := strconv.Atoi(choices[i].port)
+		b, _ := strconv.Atoi(choices[j].port)
+		if a != b {
+			return a < b
+		}
+		return choices[i].label < choices[j].label
+	})
+}
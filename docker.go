@@ -0,0 +1,24 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+// The Remote Docker template forwards the host's /var/run/docker.sock to
+// local port 2375, so the docker CLI here drives the host's daemon once
+// DOCKER_HOST points at it. The detail panel shows the line that sets it,
+// and c copies it.
+
+// dockerHostLine sets DOCKER_HOST to t, for a tunnel to a Docker socket:
+// export for sh and the like, $env: for PowerShell on Windows.
+func (t *tunnel) dockerHostLine() string {
+	if t.tunnelType != "" || !isSocketPath(t.remotePort) || !strings.HasSuffix(t.remotePort, "docker.sock") {
+		return ""
+	}
+	host := "tcp://localhost:" + t.localPort
+	if runtime.GOOS == "windows" {
+		return `$env:DOCKER_HOST = "` + host + `"`
+	}
+	return "export DOCKER_HOST=" + host
+}
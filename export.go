@@ -0,0 +1,382 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Export writes tunnels out as something that runs without the manager,
+// to set the same tunnels up on a server: a shell script of plain ssh
+// commands, the same under autossh so they come back after a drop, or a
+// systemd user unit per tunnel. Only the forwarding is exported; local
+// TLS, smoke tests, health checks and prep commands are the manager's
+// own, and the output notes where one was left out. Paths under the home
+// directory are written relative to it, so they work for another user.
+
+var exportFormats = []string{"shell", "autossh", "systemd"}
+
+const exportPrompt = "Export all tunnels as: s shell script • a autossh script • u systemd units • Esc cancel"
+
+// exportFile is a file of an export, named relative to where it goes.
+type exportFile struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+type exporter struct {
+	cfg      config
+	pol      policy
+	backends map[string]tunnelBackend
+	home     string
+}
+
+func newExporter(cfg config, pol policy) exporter {
+	home, _ := os.UserHomeDir()
+	return exporter{cfg: cfg, pol: pol, backends: backendsFromConfig(cfg), home: home}
+}
+
+// export renders specs in format: one script, or one unit per tunnel.
+func (e exporter) export(specs []tunnelSpec, format string) ([]exportFile, error) {
+	switch format {
+	case "shell", "autossh":
+		script, err := e.script(specs, format == "autossh")
+		if err != nil {
+			return nil, err
+		}
+		return []exportFile{{"ssh-tunnels.sh", script, 0o700}}, nil
+	case "systemd":
+		var files []exportFile
+		for _, spec := range specs {
+			unit, err := e.unit(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", spec.Tag, err)
+			}
+			files = append(files, exportFile{unitName(spec.Tag), unit, 0o600})
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (have %s)", format, strings.Join(exportFormats, ", "))
+}
+
+// exportCommand is the command that carries a tunnel, with the variables
+// an external backend gets on top of the environment.
+type exportCommand struct {
+	args []string
+	env  []string
+	ssh  bool
+}
+
+func (e exporter) command(spec tunnelSpec) (exportCommand, error) {
+	cmd, err := specCmd(e.backends, e.cfg, e.pol, spec)
+	if err != nil {
+		return exportCommand{}, err
+	}
+	c := exportCommand{args: cmd.Args, ssh: usesSSH(spec.Backend)}
+	for _, kv := range cmd.Env {
+		if name, _, _ := strings.Cut(kv, "="); name == "TUNNEL_HOST" || name == "TUNNEL_REMOTE_PORT" || name == "TUNNEL_LOCAL_PORT" {
+			c.env = append(c.env, kv)
+		}
+	}
+	return c, nil
+}
+
+// restarting makes ssh exit when a forward cannot be set up, so whatever
+// starts it again does, instead of it staying up without the forward.
+func (c exportCommand) restarting() exportCommand {
+	if !c.ssh || slices.Contains(c.args, "ExitOnForwardFailure=yes") {
+		return c
+	}
+	host := len(c.args) - 2 // "--" and the host
+	c.args = append(slices.Clone(c.args[:host]), append([]string{"-o", "ExitOnForwardFailure=yes"}, c.args[host:]...)...)
+	return c
+}
+
+func (e exporter) script(specs []tunnelSpec, autossh bool) (string, error) {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Tunnels exported from ssh-tunnel-manager %s.\n", Version)
+	if autossh {
+		b.WriteString("# autossh starts ssh again whenever it exits; -M 0 leaves noticing a dead\n")
+		b.WriteString("# connection to ssh's ServerAlive checks.\n")
+	}
+	b.WriteString("# The tunnels run in the background; Ctrl+C stops them all.\n")
+	b.WriteString("trap 'trap - INT TERM; kill 0' INT TERM\n")
+	for _, spec := range specs {
+		c, err := e.command(spec)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", spec.Tag, err)
+		}
+		fmt.Fprintf(&b, "\n# %s: %s on %s\n", spec.Tag, spec.ports(), spec.Host)
+		for _, note := range exportNotes(spec, e.cfg) {
+			b.WriteString("# " + note + "\n")
+		}
+		words := slices.Clone(c.env)
+		switch {
+		case autossh && c.ssh:
+			c = c.restarting()
+			words = append(words, "AUTOSSH_GATETIME=0", "autossh", "-M", "0")
+			c.args = c.args[1:]
+		case autossh:
+			b.WriteString("# Not ssh, so it runs as is, without autossh\n")
+		}
+		for _, arg := range c.args {
+			words = append(words, e.shellWord(arg))
+		}
+		b.WriteString(strings.Join(words, " ") + " &\n")
+	}
+	b.WriteString("\nwait\n")
+	return b.String(), nil
+}
+
+func (e exporter) unit(spec tunnelSpec) (string, error) {
+	c, err := e.command(spec)
+	if err != nil {
+		return "", err
+	}
+	c = c.restarting()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Exported from ssh-tunnel-manager %s: %s on %s\n", Version, spec.ports(), spec.Host)
+	for _, note := range exportNotes(spec, e.cfg) {
+		b.WriteString("# " + note + "\n")
+	}
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=SSH tunnel %s to %s\n", spec.Tag, spec.Host)
+	b.WriteString("After=network-online.target\nWants=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	for _, kv := range c.env {
+		fmt.Fprintf(&b, "Environment=%s\n", e.systemdWord(kv))
+	}
+	words := make([]string, len(c.args))
+	for i, arg := range c.args {
+		words[i] = e.systemdWord(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(words, " "))
+	b.WriteString("Restart=always\nRestartSec=10\n\n")
+	b.WriteString("[Install]\nWantedBy=default.target\n")
+	return b.String(), nil
+}
+
+// exportNotes says what of spec the export leaves out.
+func exportNotes(spec tunnelSpec, cfg config) []string {
+	var notes []string
+	if spec.Backend == nativeBackend || (spec.Backend == "" && cfg.SSHTransport == nativeBackend) {
+		notes = append(notes, "Runs with the built-in SSH client in the manager; exported as ssh")
+	}
+	var skipped []string
+	if spec.TLSMode != "" {
+		skipped = append(skipped, "local TLS ("+spec.TLSMode+"; the port is plain TCP)")
+	}
+	if spec.Prep != "" {
+		skipped = append(skipped, "prep command")
+	}
+	if spec.SmokeTest != "" {
+		skipped = append(skipped, "smoke test")
+	}
+	if spec.HealthCheck != "" {
+		skipped = append(skipped, "health check")
+	}
+	if spec.OnConnect != "" || spec.OnDisconnect != "" {
+		skipped = append(skipped, "hooks")
+	}
+	if spec.CloseAfter > 0 || spec.CloseIdle > 0 {
+		skipped = append(skipped, "auto close")
+	}
+	if spec.Lazy {
+		skipped = append(skipped, "on demand (connects right away)")
+	}
+	if spec.Backend == "" && (spec.ControlPath != "" && spec.ControlPath != "none" || spec.ControlPath == "" && cfg.Multiplex) {
+		skipped = append(skipped, "the shared master connection (the tunnel gets its own)")
+	}
+	if len(skipped) > 0 {
+		notes = append(notes, "Not exported: "+strings.Join(skipped, ", "))
+	}
+	return notes
+}
+
+// homeRelative splits a path under the home directory into what follows
+// it, e.g. .ssh/id_ed25519.
+func (e exporter) homeRelative(arg string) (string, bool) {
+	if e.home == "" {
+		return "", false
+	}
+	return strings.CutPrefix(arg, e.home+string(filepath.Separator))
+}
+
+func (e exporter) shellWord(arg string) string {
+	if rest, ok := e.homeRelative(arg); ok {
+		return `"$HOME"/` + shellQuote(filepath.ToSlash(rest))
+	}
+	return shellQuote(arg)
+}
+
+// systemdWord quotes arg for a unit file, where % starts a specifier and
+// $ a variable; %h is the home directory.
+func (e exporter) systemdWord(arg string) string {
+	escape := strings.NewReplacer("%", "%%", "$", "$$")
+	if rest, ok := e.homeRelative(arg); ok {
+		arg = "%h/" + escape.Replace(filepath.ToSlash(rest))
+	} else {
+		arg = escape.Replace(arg)
+	}
+	if !shellSafeRe.MatchString(arg) {
+		arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+	return arg
+}
+
+// unitName is the systemd unit for the tunnel tagged tag.
+func unitName(tag string) string {
+	return "ssh-tunnel-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, tag) + ".service"
+}
+
+// writeExport writes files into dir, or a single script to path.
+func writeExport(path string, files []exportFile, format string) ([]string, error) {
+	if format != "systemd" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		return []string{path}, os.WriteFile(path, []byte(files[0].content), files[0].mode)
+	}
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, f := range files {
+		p := filepath.Join(path, f.name)
+		if err := os.WriteFile(p, []byte(f.content), f.mode); err != nil {
+			return written, err
+		}
+		written = append(written, p)
+	}
+	return written, nil
+}
+
+func (m model) handleExportKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.exportPending = false
+	format := map[string]string{"s": "shell", "a": "autossh", "u": "systemd"}[msg.String()]
+	if format == "" {
+		m.statusMessage = m.exportReturnStatus
+		return m, nil
+	}
+	specs := make([]tunnelSpec, len(m.tunnels))
+	for i, t := range m.tunnels {
+		specs[i] = t.spec()
+	}
+	m.statusMessage = "Exporting..."
+	return m, exportCmd(newExporter(m.cfg, m.policy), specs, format)
+}
+
+type exportMsg struct {
+	path  string
+	count int
+	err   error
+}
+
+// exportCmd writes the export under exports/ in the config directory.
+func exportCmd(e exporter, specs []tunnelSpec, format string) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := configDir()
+		if err != nil {
+			return exportMsg{err: err}
+		}
+		files, err := e.export(specs, format)
+		if err != nil {
+			return exportMsg{err: err}
+		}
+		name := "ssh-tunnels-" + time.Now().Format("20060102-150405") + ".sh"
+		if format == "systemd" {
+			name = strings.TrimSuffix(name, ".sh")
+		}
+		path := filepath.Join(dir, "exports", name)
+		_, err = writeExport(path, files, format)
+		return exportMsg{path: path, count: len(specs), err: err}
+	}
+}
+
+// runExport implements the export subcommand: it writes the saved
+// profiles, all of them or the given tags or group, in one of the export
+// formats.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "shell", "shell, autossh or systemd")
+	out := fs.String("out", "", "file to write the script to (default: standard output), or directory for the systemd units (default: the current one)")
+	group := fs.String("group", "", "export the profiles in this group")
+	tags := parseInterspersed(fs, args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	if *group != "" {
+		groupTags, ok := cfg.Groups[*group]
+		if !ok {
+			return fmt.Errorf("no group named %q in the config", *group)
+		}
+		tags = append(tags, groupTags...)
+	}
+	specs := profiles
+	if len(tags) > 0 {
+		specs = nil
+		for _, tag := range tags {
+			i := slices.IndexFunc(profiles, func(p tunnelSpec) bool { return p.Tag == tag })
+			if i < 0 {
+				return fmt.Errorf("%s: no saved profile", tag)
+			}
+			specs = append(specs, profiles[i])
+		}
+	}
+	if len(specs) == 0 {
+		return errors.New("no saved profiles to export")
+	}
+
+	files, err := newExporter(cfg, pol).export(specs, *format)
+	if err != nil {
+		return err
+	}
+	if *format != "systemd" && *out == "" {
+		fmt.Print(files[0].content)
+		return nil
+	}
+	if *out == "" {
+		*out = "."
+	}
+	written, err := writeExport(*out, files, *format)
+	if err != nil {
+		return err
+	}
+	for _, path := range written {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if *format == "systemd" {
+		units := make([]string, len(files))
+		for i, f := range files {
+			units[i] = f.name
+		}
+		fmt.Printf("\nTo install them for the current user:\n  cp %s ~/.config/systemd/user/\n  systemctl --user daemon-reload\n  systemctl --user enable --now %s\n",
+			filepath.Join(*out, "ssh-tunnel-*.service"), strings.Join(units, " "))
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Groups bundle the tunnels needed for one job, e.g. "staging" or
+// "prod-debug", so they are started and stopped together. config.json
+// maps each group to the tags of its members' saved profiles, which is
+// what a group starts from when a member is not in the list yet. In the
+// list, each group is a section under a heading that Enter folds away.
+
+// groupHeader is a group's heading in the tunnel list.
+type groupHeader struct {
+	name      string
+	up, total int
+	collapsed bool
+}
+
+func (g groupHeader) FilterValue() string { return g.name }
+
+func (g groupHeader) title() string {
+	arrow := "▾"
+	if g.collapsed {
+		arrow = "▸"
+	}
+	return fmt.Sprintf("%s %s", arrow, strings.ToUpper(g.name))
+}
+
+func (g groupHeader) description() string {
+	return fmt.Sprintf("%d/%d up", g.up, g.total)
+}
+
+// groupOf returns the group tag is in, or "" when it is in none.
+func (c config) groupOf(tag string) string {
+	for name, tags := range c.Groups {
+		if slices.Contains(tags, tag) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (c config) groupNames() []string {
+	names := make([]string, 0, len(c.Groups))
+	for name := range c.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withGroup moves tag to group, or out of its group when group is "". A
+// group left without members is dropped.
+func (c config) withGroup(tag, group string) config {
+	groups := map[string][]string{}
+	for name, tags := range c.Groups {
+		tags = slices.DeleteFunc(slices.Clone(tags), func(t string) bool { return t == tag })
+		if len(tags) > 0 {
+			groups[name] = tags
+		}
+	}
+	if group != "" {
+		groups[group] = append(groups[group], tag)
+	}
+	if len(groups) == 0 {
+		groups = nil
+	}
+	c.Groups = groups
+	return c
+}
+
+// checkGroups rejects group names that could not be typed after up, and
+// tags listed in more than one group.
+func (c config) checkGroups() error {
+	seen := map[string]string{}
+	for _, name := range c.groupNames() {
+		if name == "" || sanitizeTag(name) != name {
+			return fmt.Errorf("groups: name %q may only contain a-z, 0-9, '-' and '_'", name)
+		}
+		for _, tag := range c.Groups[name] {
+			if other, ok := seen[tag]; ok {
+				return fmt.Errorf("groups: %q is in both %s and %s", tag, other, name)
+			}
+			seen[tag] = name
+		}
+	}
+	return nil
+}
+
+// sidebarItems lays out the list: tunnels in no group first, then each
+// group's heading followed by its tunnels unless it is folded. rows maps
+// each item to its tunnel's index, or -1 for a heading. With the list
+// filter on, only matching tunnels and their groups are listed, unfolded.
+// Tunnels are in the list's sort mode (see listsort.go).
+func (m model) sidebarItems() (items []list.Item, rows []int) {
+	var ungrouped []int
+	grouped := map[string][]int{}
+	for i, t := range m.tunnels {
+		if !t.matches(m.listFilter) {
+			continue
+		}
+		if g := m.cfg.groupOf(t.tag); g != "" {
+			grouped[g] = append(grouped[g], i)
+			continue
+		}
+		ungrouped = append(ungrouped, i)
+	}
+	m.sortTunnels(ungrouped)
+	for _, i := range ungrouped {
+		items = append(items, m.tunnels[i])
+		rows = append(rows, i)
+	}
+	for _, name := range m.cfg.groupNames() {
+		if m.listFilter != "" && len(grouped[name]) == 0 {
+			continue
+		}
+		h := groupHeader{name: name, total: len(m.cfg.Groups[name]), collapsed: m.collapsed[name] && m.listFilter == ""}
+		for _, tag := range m.cfg.Groups[name] {
+			if m.tagUp(tag) {
+				h.up++
+			}
+		}
+		items = append(items, h)
+		rows = append(rows, -1)
+		if h.collapsed {
+			continue
+		}
+		m.sortTunnels(grouped[name])
+		for _, i := range grouped[name] {
+			items = append(items, m.tunnels[i])
+			rows = append(rows, i)
+		}
+	}
+	return items, rows
+}
+
+// tagUp reports whether a tunnel tagged tag is up, or on its way up.
+func (m model) tagUp(tag string) bool {
+	for _, t := range m.tunnels {
+		// A reconnecting demo tunnel is down but still holds its port
+		if t.tag == tag && (t.active || t.demo != nil || t.restarting) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m model) groupRow(name string) int {
+	for i, item := range m.tunnelList.Items() {
+		if h, ok := item.(groupHeader); ok && h.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectRow makes the list's row the selection. A heading selects its
+// group and leaves selectedTunnel past the end, so the keys for a single
+// tunnel do nothing.
+func (m *model) selectRow(row int) {
+	m.selectedGroup = ""
+	m.selectedTunnel = len(m.tunnels)
+	if row < 0 || row >= len(m.listRows) {
+		return
+	}
+	if i := m.listRows[row]; i >= 0 {
+		m.selectedTunnel = i
+		return
+	}
+	if h, ok := m.tunnelList.Items()[row].(groupHeader); ok {
+		m.selectedGroup = h.name
+	}
+}
+
+// selectTunnel selects the tunnel at idx, or its group's heading while
+// the group is folded.
+func (m *model) selectTunnel(idx int) {
+	m.selectedGroup = ""
+	m.selectedTunnel = idx
+	m.syncSelection()
+}
+
+// syncSelection moves the list's cursor back onto the selected tunnel or
+// group after the rows have changed.
+func (m *model) syncSelection() {
+	row := -1
+	switch {
+	case m.selectedGroup != "":
+		row = m.groupRow(m.selectedGroup)
+	case m.selectedTunnel < len(m.tunnels):
+		row = slices.Index(m.listRows, m.selectedTunnel)
+		if row < 0 {
+			row = m.groupRow(m.cfg.groupOf(m.tunnels[m.selectedTunnel].tag))
+		}
+	}
+	if row >= 0 {
+		m.tunnelList.Select(row)
+	}
+	m.selectRow(m.tunnelList.Index())
+}
+
+// toggleCollapsed folds the group's section away, or opens it again.
+func (m *model) toggleCollapsed(name string) {
+	if m.collapsed[name] {
+		delete(m.collapsed, name)
+	} else {
+		m.collapsed[name] = true
+	}
+	m.updateTunnelList()
+}
+
+// startStopGroup starts every member of the group that is down, or stops
+// them all when none is left to start. Members not in the list start from
+// their profiles.
+func (m model) startStopGroup(name string) (tea.Model, tea.Cmd) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		m.statusMessage = err.Error()
+		return m, nil
+	}
+	var ids []int
+	var specs []tunnelSpec
+	var missing []string
+	for _, tag := range m.cfg.Groups[name] {
+		if m.tagUp(tag) {
+			continue
+		}
+		if i := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.tag == tag }); i >= 0 {
+			ids = append(ids, m.tunnels[i].id)
+		} else if i := slices.IndexFunc(profiles, func(p tunnelSpec) bool { return p.Tag == tag }); i >= 0 {
+			specs = append(specs, profiles[i])
+		} else {
+			missing = append(missing, tag)
+		}
+	}
+	if len(ids)+len(specs) == 0 {
+		m.stopGroup(name)
+		return m, nil
+	}
+
+	m.pendingStarts, m.pendingProfiles = ids, specs
+	slog.Info("starting group", "group", name, "count", len(ids)+len(specs), "missing", missing)
+	m.statusMessage = fmt.Sprintf("Starting %d tunnel(s) in %s", len(ids)+len(specs), name)
+	if len(missing) > 0 {
+		m.statusMessage += fmt.Sprintf(" • no profile for %s", strings.Join(missing, ", "))
+	}
+	return m.startNext()
+}
+
+func (m *model) stopGroup(name string) {
+	stopped := 0
+	for _, t := range m.tunnels {
+		if m.cfg.groupOf(t.tag) != name || (!t.active && t.demo == nil && !t.restarting) {
+			continue
+		}
+		t.restarting = false
+		t.stop()
+		t.appendLog(fmt.Sprintf("Stopped along with group %s, press %s to start it again", name, m.keys.StartStop.Help().Key))
+		stopped++
+	}
+	m.pendingStarts, m.pendingProfiles = nil, nil
+	slog.Info("group stopped", "group", name, "count", stopped)
+	m.updateTunnelList()
+	m.statusMessage = fmt.Sprintf("Stopped %d tunnel(s) in %s", stopped, name)
+}
+
+// The g key asks for the selected tunnel's group in the status bar.
+
+// editGroup asks for the group of the marked tunnels, or of the selected
+// one, starting from the one they are in.
+func (m model) editGroup() model {
+	ts := m.targets()
+	m.groupEditing = true
+	m.groupInput = m.cfg.groupOf(ts[0].tag)
+	for _, t := range ts {
+		if m.cfg.groupOf(t.tag) != m.groupInput {
+			m.groupInput = ""
+			break
+		}
+	}
+	m.groupPrevStatus = m.statusMessage
+	m.statusMessage = m.groupPrompt()
+	return m
+}
+
+func (m model) groupPrompt() string {
+	name := m.targets()[0].tag
+	if ts := m.marked(); len(ts) > 1 {
+		name = fmt.Sprintf("%d marked tunnels", len(ts))
+	}
+	return fmt.Sprintf("Group for %s: %s█ • Enter save, empty for none • Esc cancel", name, m.groupInput)
+}
+
+func (m model) handleGroupKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.groupEditing = false
+		m.statusMessage = m.groupPrevStatus
+		return m, nil
+	case "enter":
+		m.groupEditing = false
+		m.assignGroup(m.groupInput)
+		return m, nil
+	case "backspace":
+		if len(m.groupInput) > 0 {
+			m.groupInput = m.groupInput[:len(m.groupInput)-1]
+		}
+	default:
+		if c := msg.String(); len(c) == 1 && sanitizeTag(strings.ToLower(c)) == strings.ToLower(c) {
+			m.groupInput += strings.ToLower(c)
+		}
+	}
+	m.statusMessage = m.groupPrompt()
+	return m, nil
+}
+
+// assignGroup moves the marked tunnels, or the selected one, to group and
+// saves config.json. The tunnels are saved as profiles too, since that is
+// what the group starts them from later.
+func (m *model) assignGroup(group string) {
+	ts := m.targets()
+	if group != "" {
+		profiles, err := loadProfiles()
+		if err == nil {
+			for _, t := range ts {
+				profiles = putProfile(profiles, t.spec())
+			}
+			err = saveProfiles(profiles)
+		}
+		if err != nil {
+			m.statusMessage = "Cannot save profile: " + err.Error()
+			return
+		}
+	}
+	cfg := m.cfg
+	for _, t := range ts {
+		cfg = cfg.withGroup(t.tag, group)
+	}
+	if err := saveConfig(cfg); err != nil {
+		m.statusMessage = fmt.Sprintf("Cannot save the config: %v", err)
+		return
+	}
+	m.cfg = cfg
+	for _, t := range ts {
+		slog.Info("tunnel group changed", append(t.logAttrs(), "group", group)...)
+	}
+	m.clearMarks()
+	m.updateTunnelList()
+	if group == "" && len(ts) == 1 {
+		m.statusMessage = fmt.Sprintf("Removed %s from its group", ts[0].tag)
+	} else if group == "" {
+		m.statusMessage = fmt.Sprintf("Removed %s from their groups", tagList(ts))
+	} else if len(ts) == 1 {
+		m.statusMessage = fmt.Sprintf("Moved %s to group %s (saved as a profile)", ts[0].tag, group)
+	} else {
+		m.statusMessage = fmt.Sprintf("Moved %s to group %s (saved as profiles)", tagList(ts), group)
+	}
+}
+
+// renderGroup is the output panel for a selected group heading.
+func (m model) renderGroup(name string) string {
+	content := successStyle.Render("▶ group "+name) + "\n\n"
+	for _, tag := range m.cfg.Groups[name] {
+		state := subtleStyle.Render("not started")
+		if i := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.tag == tag }); i >= 0 {
+			t := m.tunnels[i]
+			switch {
+			case m.tagUp(tag):
+				state = activeStyle.Render("up") + subtleStyle.Render(" "+t.spec().ports())
+			default:
+				state = inactiveStyle.Render("stopped")
+			}
+		}
+		content += fmt.Sprintf("  %-24s %s\n", tag, state)
+	}
+	k := m.keys
+	content += "\n" + subtleStyle.Render(fmt.Sprintf("%s: start the stopped ones, or stop all when none is stopped\n%s: fold or unfold • %s on a tunnel: change its group",
+		k.StartStop.Help().Key, k.Fold.Help().Key, k.Group.Help().Key))
+	content += "\n" + subtleStyle.Render("From a shell: ssh-tunnel-manager up "+name)
+	return content
+}
+
+// runUp implements the up subcommand: it starts headless every profile in
+// the group that is not already running.
+func runUp(args []string) error {
+	fs := flag.NewFlagSet("up", flag.ExitOnError)
+	noPrecheck := fs.Bool("no-precheck", false, "skip the TCP reachability check")
+	asJSON := fs.Bool("json", false, "print the started tunnels as JSON")
+	names := parseInterspersed(fs, args)
+	if len(names) != 1 {
+		return fmt.Errorf("usage: up <group>")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	tags, ok := cfg.Groups[names[0]]
+	if !ok {
+		return fmt.Errorf("no group named %q in the config", names[0])
+	}
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	started := []headlessTunnel{}
+	var running, failed []string
+	for _, tag := range tags {
+		old, oldErr := findHeadlessTunnel(tag)
+		if oldErr == nil && processAlive(old.PID) {
+			running = append(running, tag)
+			continue
+		}
+		i := slices.IndexFunc(profiles, func(p tunnelSpec) bool { return p.Tag == tag })
+		if i < 0 {
+			fmt.Fprintf(os.Stderr, "%s: no saved profile\n", tag)
+			failed = append(failed, tag)
+			continue
+		}
+		if oldErr == nil {
+			// Exited; it is started again from the profile
+			removeHeadlessTunnel(old)
+		}
+		t, err := startHeadless(profiles[i], cfg, pol, !*noPrecheck)
+		if _, missing := findHeadlessTunnel(tag); missing != nil && oldErr == nil {
+			// Keep it listed, as exited
+			saveHeadlessTunnel(old)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", tag, err)
+			failed = append(failed, tag)
+			continue
+		}
+		started = append(started, t)
+	}
+	if *asJSON {
+		if err := printJSON(started); err != nil {
+			return err
+		}
+	} else {
+		for _, tag := range running {
+			fmt.Printf("%s is already up\n", tag)
+		}
+		for _, t := range started {
+			fmt.Printf("Started %s: %s on %s (pid %d, log %s)\n", t.Tag, t.ports(), t.Host, t.PID, t.LogFile)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not start %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runDown implements the down subcommand: it stops the group's headless
+// tunnels.
+func runDown(args []string) error {
+	fs := flag.NewFlagSet("down", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the stopped tags as JSON")
+	names := parseInterspersed(fs, args)
+	if len(names) != 1 {
+		return fmt.Errorf("usage: down <group>")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	tags, ok := cfg.Groups[names[0]]
+	if !ok {
+		return fmt.Errorf("no group named %q in the config", names[0])
+	}
+	all, err := loadHeadlessTunnels()
+	if err != nil {
+		return err
+	}
+	var tunnels []headlessTunnel
+	for _, t := range all {
+		if slices.Contains(tags, t.Tag) {
+			tunnels = append(tunnels, t)
+		}
+	}
+	return stopHeadlessTunnels(tunnels, *asJSON)
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Headless mode drives tunnels from the command line for scripts and CI:
+// start launches the backend detached from the terminal and records it in
+// headless/ in the config directory, where list, status and stop find it.
+
+// remoteReadyWait is how long start watches a remote forward for an early
+// exit, since there is no local port to wait for.
+const remoteReadyWait = 3 * time.Second
+
+// headlessStopWait is how long restart waits for a tunnel to exit before
+// starting it again on the same port.
+const headlessStopWait = 5 * time.Second
+
+// headlessTunnel is a tunnel started by the start subcommand.
+type headlessTunnel struct {
+	tunnelSpec
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	LogFile string    `json:"log_file"`
+}
+
+// headlessStatus is what list and status report for a tunnel.
+type headlessStatus struct {
+	headlessTunnel
+	Running   bool     `json:"running"`
+	Reachable *bool    `json:"reachable,omitempty"` // local port accepting, for status
+	Protocol  string   `json:"protocol,omitempty"`
+	Smoke     string   `json:"smoke,omitempty"`
+	SmokeOK   *bool    `json:"smoke_ok,omitempty"`
+	Logs      []string `json:"logs,omitempty"`
+}
+
+func headlessDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "headless"), nil
+}
+
+func loadHeadlessTunnels() ([]headlessTunnel, error) {
+	dir, err := headlessDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var tunnels []headlessTunnel
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var t headlessTunnel
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tunnels = append(tunnels, t)
+	}
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Tag < tunnels[j].Tag })
+	return tunnels, nil
+}
+
+func findHeadlessTunnel(tag string) (headlessTunnel, error) {
+	tunnels, err := loadHeadlessTunnels()
+	if err != nil {
+		return headlessTunnel{}, err
+	}
+	for _, t := range tunnels {
+		if t.Tag == tag {
+			return t, nil
+		}
+	}
+	return headlessTunnel{}, fmt.Errorf("no headless tunnel tagged %q", tag)
+}
+
+// checkHeadlessPorts fails when one of spec's local ports is held by a
+// running headless tunnel, naming it, or by another program.
+func checkHeadlessPorts(spec tunnelSpec) error {
+	tunnels, err := loadHeadlessTunnels()
+	if err != nil {
+		return err
+	}
+	for _, port := range spec.localPorts() {
+		for _, t := range tunnels {
+			if processAlive(t.PID) && slices.Contains(t.localPorts(), port) {
+				return fmt.Errorf("local port %s is already used by headless tunnel %s", port, t.Tag)
+			}
+		}
+		if isPortInUse(port) {
+			return fmt.Errorf("local port %s is already in use by another program", port)
+		}
+	}
+	return nil
+}
+
+func saveHeadlessTunnel(t headlessTunnel) error {
+	dir, err := headlessDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, t.Tag+".json"), append(data, '\n'), 0o600)
+}
+
+func removeHeadlessTunnel(t headlessTunnel) {
+	if dir, err := headlessDir(); err == nil {
+		os.Remove(filepath.Join(dir, t.Tag+".json"))
+	}
+	os.Remove(t.LogFile)
+}
+
+// runStart implements the start subcommand.
+func runStart(args []string) error {
+	fs := flag.NewFlagSet("start", flag.ExitOnError)
+	var spec tunnelSpec
+	fs.StringVar(&spec.Host, "host", "", "SSH host, as in ~/.ssh/config or user@host")
+	fs.StringVar(&spec.LocalPort, "local", "", "local port")
+	fs.StringVar(&spec.RemotePort, "remote", "", "remote port (not for --type socks)")
+	fs.StringVar(&spec.RemoteHost, "remote-host", "", "host to forward to, as seen from the SSH host (default: the SSH host itself)")
+	fs.StringVar(&spec.Tag, "tag", "", "name of the tunnel (default: generated)")
+	fs.StringVar(&spec.Type, "type", "", "local, remote or socks")
+	fs.StringVar(&spec.Backend, "backend", "", "backend from the config instead of ssh")
+	fs.StringVar(&spec.Proxy, "proxy", "", "upstream proxy, or none to connect directly (default: proxy from the config)")
+	fs.StringVar(&spec.Prep, "prep", "", "command to run on the host before forwarding")
+	fs.StringVar(&spec.SmokeTest, "smoke-test", "", "check to run once the tunnel is up, e.g. tcp or \"http /health\"")
+	fs.BoolVar(&spec.Verbose, "verbose", false, "log ssh -v output")
+	fs.StringVar(&spec.IdentityFile, "identity", "", "the only key to log in with, e.g. ~/.ssh/work_ed25519 (default: any key)")
+	fs.Func("keepalive", "seconds between keepalives and how many may go unanswered, e.g. 30,3, or off (default: from the config)", func(s string) error {
+		k, err := parseKeepalive(s)
+		spec.Keepalive = &k
+		return err
+	})
+	fs.BoolFunc("compression", "compress the connection, ssh -C; --compression=false for none (default: from the config)", func(s string) error {
+		on, err := strconv.ParseBool(s)
+		spec.Compression = &on
+		return err
+	})
+	fs.StringVar(&spec.Ciphers, "ciphers", "", "ciphers to use, the preferred first, e.g. aes128-gcm@openssh.com,chacha20-poly1305@openssh.com (default: from the config)")
+	fs.Func("forward", "another forward over the same connection, e.g. \"-L 16379:6379\" (repeatable)", func(s string) error {
+		f, err := parseForward(s)
+		spec.Forwards = append(spec.Forwards, f)
+		return err
+	})
+	profile := fs.String("profile", "", "start a saved profile instead (other flags are ignored)")
+	all := fs.Bool("all", false, "start again every headless tunnel whose process has exited (other flags are ignored)")
+	noPrecheck := fs.Bool("no-precheck", false, "skip the TCP reachability check")
+	asJSON := fs.Bool("json", false, "print the started tunnel as JSON")
+	fs.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	if *all {
+		tunnels, err := loadHeadlessTunnels()
+		if err != nil {
+			return err
+		}
+		var exited []headlessTunnel
+		for _, t := range tunnels {
+			if !processAlive(t.PID) {
+				exited = append(exited, t)
+			}
+		}
+		return restartHeadlessTunnels(exited, cfg, pol, !*noPrecheck, *asJSON)
+	}
+	if *profile != "" {
+		profiles, err := loadProfiles()
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(profiles, func(p tunnelSpec) bool { return p.Tag == *profile })
+		if i < 0 {
+			return fmt.Errorf("no saved profile tagged %q", *profile)
+		}
+		spec = profiles[i]
+	} else if spec.Proxy == "none" {
+		spec.Proxy = ""
+	} else if spec.Proxy == "" && spec.Backend == "" {
+		spec.Proxy = cfg.Proxy
+	}
+
+	t, err := startHeadless(spec, cfg, pol, !*noPrecheck)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(t)
+	}
+	fmt.Printf("Started %s: %s on %s (pid %d, log %s)\n", t.Tag, t.ports(), t.Host, t.PID, t.LogFile)
+	return nil
+}
+
+// startHeadless runs the wizard's checks, then starts the backend process
+// detached and waits until the tunnel is up or the process has failed.
+func startHeadless(spec tunnelSpec, cfg config, pol policy, dial bool) (headlessTunnel, error) {
+	if err := spec.normalize(); err != nil {
+		return headlessTunnel{}, err
+	}
+	if spec.Backend == nativeBackend || (spec.Backend == "" && cfg.SSHTransport == nativeBackend) {
+		return headlessTunnel{}, errors.New("the native backend runs inside the manager and is not available headless; use --backend ssh")
+	}
+	if spec.TLSMode != "" {
+		return headlessTunnel{}, errors.New("local TLS runs inside the manager and is not available headless")
+	}
+	if spec.HealthCheck != "" {
+		return headlessTunnel{}, errors.New("health checks run inside the manager and are not available headless")
+	}
+	if spec.CloseAfter > 0 || spec.CloseIdle > 0 {
+		return headlessTunnel{}, errors.New("auto close runs inside the manager and is not available headless")
+	}
+	if spec.Lazy {
+		return headlessTunnel{}, errors.New("on-demand tunnels run inside the manager and are not available headless")
+	}
+	if err := pol.check(spec); err != nil {
+		return headlessTunnel{}, err
+	}
+	backend, ok := backendsFromConfig(cfg)[spec.Backend]
+	if !ok {
+		return headlessTunnel{}, fmt.Errorf("unknown backend %q", spec.Backend)
+	}
+	if _, err := findHeadlessTunnel(spec.Tag); err == nil {
+		return headlessTunnel{}, fmt.Errorf("a headless tunnel tagged %q already exists; stop it first", spec.Tag)
+	}
+	if err := checkHeadlessPorts(spec); err != nil {
+		return headlessTunnel{}, err
+	}
+
+	var pre precheckMsg
+	if spec.Backend == "" {
+		pre = precheckCmd(spec.Host, spec.Proxy, dial)().(precheckMsg)
+		if pre.err != nil {
+			return headlessTunnel{}, pre.err
+		}
+		if spec.Prep != "" {
+			prep := prepCmd(sshConnectArgs(spec.Proxy, pre, pol), spec.Host, spec.Prep)().(prepMsg)
+			if prep.err != nil {
+				return headlessTunnel{}, fmt.Errorf("%v\n%s", prep.err, strings.Join(prep.output, "\n"))
+			}
+		}
+	}
+
+	dir, err := headlessDir()
+	if err != nil {
+		return headlessTunnel{}, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return headlessTunnel{}, err
+	}
+	logPath := filepath.Join(dir, spec.Tag+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return headlessTunnel{}, err
+	}
+	defer logFile.Close()
+
+	cmd := backend.Command(cfg.withDefaults(spec), spec.LocalPort, pre, pol)
+	detachProcess(cmd)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return headlessTunnel{}, fmt.Errorf("cannot start %s: %v", backend.Name(), err)
+	}
+	t := headlessTunnel{tunnelSpec: spec, PID: cmd.Process.Pid, Started: time.Now(), LogFile: logPath}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan bool, 1)
+	go func() {
+		if spec.Type == "remote" {
+			time.Sleep(remoteReadyWait)
+			ready <- true
+			return
+		}
+		ready <- waitForLocalPort(spec.LocalPort, smokeReadyWait)
+	}()
+
+	select {
+	case <-exited:
+		logs, _ := tailFile(logPath, 4096)
+		os.Remove(logPath)
+		return t, fmt.Errorf("%s exited (%s):\n%s", backend.Name(), cmd.ProcessState, strings.TrimSpace(string(logs)))
+	case ok := <-ready:
+		if !ok {
+			terminateProcessGroup(t.PID)
+			os.Remove(logPath)
+			return t, fmt.Errorf("local port %s did not come up within %s", spec.LocalPort, smokeReadyWait)
+		}
+	}
+
+	if err := saveHeadlessTunnel(t); err != nil {
+		terminateProcessGroup(t.PID)
+		return t, err
+	}
+	if spec.SmokeTest != "" {
+		if st, err := parseSmokeTest(spec.SmokeTest); err == nil {
+			if res := st.run(spec.LocalPort); !res.ok {
+				return t, fmt.Errorf("tunnel %s is up but its smoke test failed: %s", t.Tag, res.detail)
+			}
+		}
+	}
+	return t, nil
+}
+
+// runList implements the list subcommand.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the tunnels as JSON")
+	fs.Parse(args)
+
+	tunnels, err := loadHeadlessTunnels()
+	if err != nil {
+		return err
+	}
+	statuses := make([]headlessStatus, len(tunnels))
+	for i, t := range tunnels {
+		statuses[i] = headlessStatus{headlessTunnel: t, Running: processAlive(t.PID)}
+	}
+	if *asJSON {
+		return printJSON(statuses)
+	}
+	printStatusTable(os.Stdout, statuses)
+	return nil
+}
+
+// runStatus implements the status subcommand. It checks each tunnel's
+// local port and smoke test, and fails when any tunnel is unhealthy so
+// scripts can gate on it.
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	tags := parseInterspersed(fs, args)
+
+	tunnels, err := loadHeadlessTunnels()
+	if err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		t, err := findHeadlessTunnel(tags[0])
+		if err != nil {
+			return err
+		}
+		tunnels = []headlessTunnel{t}
+	}
+
+	healthy := true
+	statuses := make([]headlessStatus, len(tunnels))
+	for i, t := range tunnels {
+		s := t.status()
+		healthy = healthy && s.healthy()
+		statuses[i] = s
+	}
+	if *asJSON {
+		if err := printJSON(statuses); err != nil {
+			return err
+		}
+	} else {
+		if len(statuses) == 0 {
+			fmt.Println("No headless tunnels.")
+		}
+		for i, s := range statuses {
+			if i > 0 {
+				fmt.Println()
+			}
+			s.print(os.Stdout)
+		}
+	}
+	if !healthy {
+		return errors.New("some tunnels are not healthy")
+	}
+	return nil
+}
+
+func (t headlessTunnel) status() headlessStatus {
+	s := headlessStatus{headlessTunnel: t, Running: processAlive(t.PID)}
+	if data, err := tailFile(t.LogFile, 2048); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		s.Logs = lines[max(0, len(lines)-5):]
+	}
+	if !s.Running || t.Type == "remote" {
+		return s
+	}
+	reachable := waitForLocalPort(t.LocalPort, probeTimeout)
+	s.Reachable = &reachable
+	if !reachable {
+		return s
+	}
+	s.Protocol = detectProtocol(t.LocalPort)
+	if st, err := parseSmokeTest(t.SmokeTest); t.SmokeTest != "" && err == nil {
+		res := st.run(t.LocalPort)
+		s.Smoke, s.SmokeOK = res.detail, &res.ok
+	}
+	return s
+}
+
+func (s headlessStatus) healthy() bool {
+	return s.Running && (s.Reachable == nil || *s.Reachable) && (s.SmokeOK == nil || *s.SmokeOK)
+}
+
+func (s headlessStatus) state() string {
+	if s.Running {
+		return "running"
+	}
+	return "exited"
+}
+
+func (s headlessStatus) print(w io.Writer) {
+	fmt.Fprintf(w, "%s: %s\n", s.Tag, s.state())
+	fmt.Fprintf(w, "  host:    %s\n", s.Host)
+	fmt.Fprintf(w, "  ports:   %s\n", s.ports())
+	fmt.Fprintf(w, "  pid:     %d, started %s\n", s.PID, s.Started.Format(time.DateTime))
+	if s.Reachable != nil && *s.Reachable {
+		fmt.Fprintln(w, "  local:   accepting connections")
+	} else if s.Reachable != nil {
+		fmt.Fprintln(w, "  local:   not accepting connections")
+	}
+	if s.Protocol != "" {
+		fmt.Fprintf(w, "  service: %s\n", protocolNames[s.Protocol])
+	}
+	if s.SmokeOK != nil && *s.SmokeOK {
+		fmt.Fprintf(w, "  smoke:   ✅ %s\n", s.Smoke)
+	} else if s.SmokeOK != nil {
+		fmt.Fprintf(w, "  smoke:   ❌ %s\n", s.Smoke)
+	}
+	for _, line := range s.Logs {
+		fmt.Fprintf(w, "  | %s\n", line)
+	}
+}
+
+func printStatusTable(w io.Writer, statuses []headlessStatus) {
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, "No headless tunnels.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tHOST\tPORTS\tSTATE\tPID")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", s.Tag, s.Host, s.ports(), s.state(), s.PID)
+	}
+	tw.Flush()
+}
+
+// selectHeadlessTunnels picks the tunnel named by the one tag, or every
+// tunnel with --all.
+func selectHeadlessTunnels(command string, all bool, tags []string) ([]headlessTunnel, error) {
+	switch {
+	case all:
+		return loadHeadlessTunnels()
+	case len(tags) == 1:
+		t, err := findHeadlessTunnel(tags[0])
+		if err != nil {
+			return nil, err
+		}
+		return []headlessTunnel{t}, nil
+	}
+	return nil, fmt.Errorf("usage: %s <tag> or %s --all", command, command)
+}
+
+// runStop implements the stop subcommand.
+func runStop(args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	all := fs.Bool("all", false, "stop every headless tunnel")
+	asJSON := fs.Bool("json", false, "print the stopped tags as JSON")
+	tags := parseInterspersed(fs, args)
+
+	tunnels, err := selectHeadlessTunnels("stop", *all, tags)
+	if err != nil {
+		return err
+	}
+	return stopHeadlessTunnels(tunnels, *asJSON)
+}
+
+// stopHeadlessTunnels stops each tunnel and forgets it.
+func stopHeadlessTunnels(tunnels []headlessTunnel, asJSON bool) error {
+	stopped := []string{}
+	for _, t := range tunnels {
+		if processAlive(t.PID) {
+			if err := terminateProcessGroup(t.PID); err != nil {
+				return fmt.Errorf("%s: %v", t.Tag, err)
+			}
+		}
+		removeHeadlessTunnel(t)
+		stopped = append(stopped, t.Tag)
+	}
+	if asJSON {
+		return printJSON(map[string][]string{"stopped": stopped})
+	}
+	for _, tag := range stopped {
+		fmt.Printf("Stopped %s\n", tag)
+	}
+	return nil
+}
+
+// runRestart implements the restart subcommand: it stops the tunnel and
+// starts it again with the same settings, e.g. after switching networks
+// or VPNs.
+func runRestart(args []string) error {
+	fs := flag.NewFlagSet("restart", flag.ExitOnError)
+	all := fs.Bool("all", false, "restart every headless tunnel")
+	noPrecheck := fs.Bool("no-precheck", false, "skip the TCP reachability check")
+	asJSON := fs.Bool("json", false, "print the restarted tunnels as JSON")
+	tags := parseInterspersed(fs, args)
+
+	tunnels, err := selectHeadlessTunnels("restart", *all, tags)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	pol, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	return restartHeadlessTunnels(tunnels, cfg, pol, !*noPrecheck, *asJSON)
+}
+
+// restartHeadlessTunnels stops each tunnel that is still running and
+// starts it again. One that fails to start is kept, as exited, so that
+// start --all can try it again; the others go on regardless.
+func restartHeadlessTunnels(tunnels []headlessTunnel, cfg config, pol policy, dial, asJSON bool) error {
+	started := []headlessTunnel{}
+	var failed []string
+	for _, t := range tunnels {
+		if processAlive(t.PID) {
+			if err := terminateProcessGroup(t.PID); err != nil {
+				return fmt.Errorf("%s: %v", t.Tag, err)
+			}
+			if !waitForExit(t.PID, headlessStopWait) {
+				fmt.Fprintf(os.Stderr, "%s: still running %s after being asked to stop\n", t.Tag, headlessStopWait)
+				failed = append(failed, t.Tag)
+				continue
+			}
+		}
+		removeHeadlessTunnel(t)
+		nt, err := startHeadless(t.tunnelSpec, cfg, pol, dial)
+		if _, missing := findHeadlessTunnel(t.Tag); missing != nil {
+			// Keep it listed, as exited
+			saveHeadlessTunnel(t)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", t.Tag, err)
+			failed = append(failed, t.Tag)
+			continue
+		}
+		started = append(started, nt)
+	}
+	if asJSON {
+		if err := printJSON(started); err != nil {
+			return err
+		}
+	} else {
+		for _, t := range started {
+			fmt.Printf("Started %s: %s on %s (pid %d, log %s)\n", t.Tag, t.ports(), t.Host, t.PID, t.LogFile)
+		}
+		if len(tunnels) == 0 {
+			fmt.Println("No headless tunnels to start.")
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not start %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// waitForExit polls until pid has exited or timeout has passed. The
+// process is not a child of this one, so it cannot be waited for.
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// parseInterspersed parses flags that come before or after the positional
+// arguments, as in "stop db --json", and returns the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	minHealthInterval     = 5 * time.Second
+)
+
+// A health check is a smoke test (tcp, http [/path] [status], banner)
+// repeated while the tunnel is up. A tunnel whose ssh is running but whose
+// last check failed is degraded: 🟡 in the list.
+
+type healthMsg struct {
+	tunnelID int
+	run      int // the start of the tunnel the check belongs to
+	result   smokeResult
+}
+
+// healthInterval is the time between checks, health_interval in the config.
+func (c config) healthInterval() time.Duration {
+	d, err := time.ParseDuration(c.HealthInterval)
+	if err != nil {
+		return defaultHealthInterval
+	}
+	return max(d, minHealthInterval)
+}
+
+// healthCheckCmd waits one interval, then runs the check.
+func healthCheckCmd(tunnelID, run int, check, localPort string, interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		st, err := parseSmokeTest(check)
+		if err != nil {
+			return healthMsg{tunnelID: tunnelID, run: run, result: smokeResult{detail: err.Error(), at: time.Now()}}
+		}
+		return healthMsg{tunnelID: tunnelID, run: run, result: st.run(localPort)}
+	})
+}
+
+// degraded reports whether the tunnel is up but failing its health check.
+func (t *tunnel) degraded() bool {
+	return t.active && t.healthCheck != "" && !t.health.at.IsZero() && !t.health.ok
+}
+
+// healthChecked records a check and schedules the next one. Checks of a
+// tunnel that was stopped or restarted since are dropped, which ends
+// their chain.
+func (m *model) healthChecked(msg healthMsg) tea.Cmd {
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || !t.active || t.healthRun != msg.run {
+		return nil
+	}
+	wasOK := t.health.at.IsZero() || t.health.ok
+	t.health = msg.result
+	switch {
+	case wasOK && !msg.result.ok:
+		slog.Warn("health check failed", append(t.logAttrs(), "detail", msg.result.detail)...)
+		t.appendLog("Health check failed: " + msg.result.detail)
+	case !wasOK && msg.result.ok:
+		slog.Info("health check passed", t.logAttrs()...)
+		t.appendLog("Health check passes again: " + msg.result.detail)
+	}
+	if wasOK != msg.result.ok {
+		m.updateTunnelList()
+	}
+	return healthCheckCmd(t.id, t.healthRun, t.healthCheck, t.localPort, m.cfg.healthInterval())
+}
+
+// healthStatus is the detail panel's line for the check.
+func (t *tunnel) healthStatus(interval time.Duration) string {
+	result := subtleStyle.Render(fmt.Sprintf("first check in %s", interval))
+	if !t.health.at.IsZero() {
+		if t.health.ok {
+			result = activeStyle.Render("✅ " + t.health.detail)
+		} else {
+			result = degradedStyle.Render("🟡 " + t.health.detail)
+		}
+		result += subtleStyle.Render(fmt.Sprintf(" at %s, every %s", t.health.at.Format("15:04:05"), interval))
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// The history remembers the tunnels started, newest first, in history.json
+// in the config directory; deleting a tunnel leaves it there. The host
+// picker lists the recent ones at the top: picking one fills in the whole
+// tunnel and goes to the review step, so setting it up again takes two
+// Enters. For another pick of the same host, the port steps start with the
+// ports last used with it. Like state.json it is the app's own file, so a
+// damaged one is ignored.
+
+const (
+	maxHistory   = 20
+	recentShown  = 5
+	historyFile  = "history.json"
+	historyWrite = 0o600
+)
+
+type tunnelHistory struct {
+	Tunnels []tunnelSpec `json:"tunnels"`
+}
+
+func historyPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFile), nil
+}
+
+func loadHistory() []tunnelSpec {
+	path, err := historyPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var h tunnelHistory
+	if err := json.Unmarshal(data, &h); err != nil {
+		slog.Warn("ignoring unreadable history", "path", path, "err", err)
+		return nil
+	}
+	return h.Tunnels
+}
+
+func saveHistory(tunnels []tunnelSpec) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tunnelHistory{Tunnels: tunnels}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), historyWrite)
+}
+
+// sameSetup reports whether a and b forward the same ports to the same
+// place, whatever their tags and options.
+func sameSetup(a, b tunnelSpec) bool {
+	return a.Backend == b.Backend && a.Type == b.Type && a.Host == b.Host &&
+		a.RemoteHost == b.RemoteHost && a.RemotePort == b.RemotePort && a.LocalPort == b.LocalPort
+}
+
+// remember puts spec first in the history, in place of the same setup.
+func (m *model) remember(spec tunnelSpec) {
+	spec.Forwards = append([]forwardSpec(nil), spec.Forwards...)
+	history := []tunnelSpec{spec}
+	for _, h := range m.history {
+		if !sameSetup(h, spec) && len(history) < maxHistory {
+			history = append(history, h)
+		}
+	}
+	m.history = history
+	if m.demo {
+		return
+	}
+	if err := saveHistory(history); err != nil {
+		slog.Warn("cannot save history", "err", err)
+	}
+}
+
+// lastUsed is the latest tunnel of the wizard's type to host.
+func (m model) lastUsed(host string) (tunnelSpec, bool) {
+	for _, h := range m.history {
+		if h.Host == host && h.Type == m.tempType && h.Backend == m.tempBackend {
+			return h, true
+		}
+	}
+	return tunnelSpec{}, false
+}
+
+// suggestFromHistory starts a port step with what was last used with the
+// host: the destination, the remote port, and the local port that went
+// with it.
+func (m *model) suggestFromHistory() {
+	last, ok := m.lastUsed(m.tempHost)
+	if !ok {
+		return
+	}
+	switch m.step {
+	case stepRemoteHost:
+		m.setInput(orNone(last.RemoteHost, "localhost"))
+	case stepRemotePort:
+		if last.RemoteHost == m.tempRemoteHost {
+			m.setInput(last.RemotePort)
+		}
+	case stepLocalPort:
+		if last.RemoteHost == m.tempRemoteHost && last.RemotePort == m.tempRemote {
+			m.setInput(last.LocalPort)
+		}
+	}
+}
+
+// recentLabel is how the picker shows and matches a recent tunnel.
+func recentLabel(s tunnelSpec) string {
+	label := fmt.Sprintf("%s  %s  %s", s.Tag, s.Host, s.ports())
+	if s.Backend != "" {
+		label += "  (" + s.Backend + ")"
+	}
+	return label
+}
+
+// recentMatches is the recent section of the host picker for the
+// current filter: the latest tunnels of the type being set up. Index
+// points into m.history.
+func (m model) recentMatches() fuzzy.Matches {
+	var labels []string
+	var indexes []int
+	for i, h := range m.history {
+		if h.Type == m.tempType && h.Backend == m.tempBackend {
+			labels = append(labels, recentLabel(h))
+			indexes = append(indexes, i)
+		}
+	}
+	var matches fuzzy.Matches
+	if m.hostFilter == "" {
+		for i, label := range labels {
+			matches = append(matches, fuzzy.Match{Str: label, Index: i})
+		}
+	} else {
+		matches = fuzzy.Find(m.hostFilter, labels)
+	}
+	matches = matches[:min(len(matches), recentShown)]
+	for i := range matches {
+		matches[i].Index = indexes[matches[i].Index]
+	}
+	return matches
+}
+
+// pickRecent fills in the wizard from the recent tunnel h and goes to the
+// review step. A local port that is taken now moves up to a free one.
+func (m model) pickRecent(h tunnelSpec) (model, error) {
+	if err := m.policy.check(h); err != nil {
+		return m, err
+	}
+	local := h.LocalPort
+	if h.Type != "remote" {
+		var err error
+		if local, err = m.freeLocalPort(h.LocalPort); err != nil {
+			return m, err
+		}
+		if local != h.LocalPort {
+			m.statusMessage = fmt.Sprintf("Local port %s is taken, using %s", h.LocalPort, local)
+		}
+	}
+	h.LocalPort = local
+	m.setTemp(h)
+	m.tempResume = 0
+	m.toReview()
+	return m, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A tunnel can run commands on this machine when it connects and when it
+// disconnects, set as on_connect and on_disconnect in its profile or
+// tunnels file: open a browser on it, mount a directory over sshfs, tell a
+// webhook. They run through the shell (cmd on Windows) in the background,
+// with the tunnel in TUNNEL_* variables, and their output goes to the
+// tunnel's log.
+//
+// A tunnel is connected once its first port check finds the local port
+// accepting connections; a remote forward, whose port is on the host,
+// once its ssh has stayed up through that check; a native tunnel when its
+// client has logged in, again after each reconnect. It is disconnected
+// when it stops for any reason after that, including quitting, which waits
+// up to hookQuitWait for the hooks still running.
+
+const (
+	hookTimeout  = 30 * time.Second
+	hookQuitWait = 5 * time.Second
+)
+
+// hooksRunning counts the hooks not finished yet, for quitting to wait on.
+var hooksRunning sync.WaitGroup
+
+// connected runs the tunnel's on_connect hook, once per connection. It
+// reports whether the tunnel just connected.
+func (t *tunnel) connected() bool {
+	if t.hooked || !t.active {
+		return false
+	}
+	t.hooked = true
+	t.runHook("connected", t.onConnect)
+	return true
+}
+
+// disconnected runs the on_disconnect hook of a tunnel that connected.
+func (t *tunnel) disconnected() {
+	if !t.hooked {
+		return
+	}
+	t.hooked = false
+	t.runHook("disconnected", t.onDisconnect)
+}
+
+// runHook starts command for event. Demo tunnels come and go all the
+// time, so they run none.
+func (t *tunnel) runHook(event, command string) {
+	if command == "" || t.hookLog == nil || t.demo != nil {
+		return
+	}
+	// The goroutine gets copies: placeTunnel may overwrite *t meanwhile
+	logf, tag := t.hookLog, t.tag
+	env := append(os.Environ(),
+		"TUNNEL_EVENT="+event,
+		"TUNNEL_TAG="+tag,
+		"TUNNEL_HOST="+t.host,
+		"TUNNEL_LOCAL_PORT="+t.localPort,
+		"TUNNEL_REMOTE_PORT="+t.remotePort,
+	)
+	slog.Info("running hook", append(t.logAttrs(), "event", event, "command", command)...)
+	logf(fmt.Sprintf("Running %s hook: %s", event, command))
+	hooksRunning.Add(1)
+	go func() {
+		defer hooksRunning.Done()
+		defer recoverPanic("hook")
+		out, err := runHookCommand(command, env)
+		sc := bufio.NewScanner(bytes.NewReader(out))
+		for sc.Scan() {
+			if line := sc.Text(); line != "" {
+				logf("  " + line)
+			}
+		}
+		if err != nil {
+			slog.Warn("hook failed", "tag", tag, "event", event, "err", err)
+			logf(fmt.Sprintf("The %s hook failed: %v", event, err))
+		}
+	}()
+}
+
+// runHookCommand runs command through the shell, stopping it after
+// hookTimeout.
+func runHookCommand(command string, env []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	cmd.Env = env
+	// A hook may leave something running in the background, e.g. sshfs,
+	// holding on to its output
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("still running after %s, stopped", hookTimeout)
+	case errors.Is(err, exec.ErrWaitDelay):
+		err = nil
+	}
+	return out, err
+}
+
+// hooksSummary is the detail panel's line for the hooks set.
+func (t *tunnel) hooksSummary() string {
+	var hooks []string
+	if t.onConnect != "" {
+		hooks = append(hooks, "on connect: "+t.onConnect)
+	}
+	if t.onDisconnect != "" {
+		hooks = append(hooks, "on disconnect: "+t.onDisconnect)
+	}
+	return strings.Join(hooks, " • ")
+}
+
+// waitHooks waits up to hookQuitWait for the hooks still running.
+func waitHooks() {
+	done := make(chan struct{})
+	go func() {
+		hooksRunning.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(hookQuitWait):
+		slog.Warn("hooks still running at exit", "waited", hookQuitWait)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
+)
+
+// The host picker filters as you type, fzf style: the typed characters
+// must appear in order in the entry or its resolved user@hostname:port,
+// and the best matches come first. Recent tunnels come before the hosts,
+// see history.go; the cursor goes through both.
+
+// hostSearchText is what the filter matches against for entry.
+func (m model) hostSearchText(entry string) string {
+	if labels := m.tshLabels[entry]; labels != "" && m.tempBackend == teleportBackend {
+		return entry + "  " + labels
+	}
+	if ep, ok := m.hostEndpoints[entry]; ok {
+		return entry + "  " + hostDetail(ep)
+	}
+	return entry
+}
+
+// hostMatches is the picker's list for the current filter. Str is the
+// host entry; MatchedIndexes point into its search text.
+func (m model) hostMatches() fuzzy.Matches {
+	hosts := m.pickerHosts()
+	if m.hostFilter == "" {
+		all := make(fuzzy.Matches, len(hosts))
+		for i, h := range hosts {
+			all[i] = fuzzy.Match{Str: h, Index: i}
+		}
+		return all
+	}
+	texts := make([]string, len(hosts))
+	for i, h := range hosts {
+		texts[i] = m.hostSearchText(h)
+	}
+	matches := fuzzy.Find(m.hostFilter, texts)
+	for i := range matches {
+		matches[i].Str = hosts[matches[i].Index]
+	}
+	return matches
+}
+
+func (m model) handleHostPickerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		return m.handleEnter()
+	case "esc":
+		if m.hostFilter == "" {
+			m.view = viewMain
+			return m, nil
+		}
+		m.hostFilter = ""
+	case "tab":
+		m.step = stepManualHost
+		m.setInput(m.hostFilter)
+		m.err = nil
+		return m, nil
+	case "up", "ctrl+p", "ctrl+k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		if host := m.cursor - len(m.recentMatches()); host >= 0 && host < m.hostScroll {
+			m.hostScroll = host
+		}
+		return m, nil
+	case "down", "ctrl+n", "ctrl+j":
+		recents := len(m.recentMatches())
+		if m.cursor < recents+len(m.hostMatches())-1 {
+			m.cursor++
+		}
+		if host := m.cursor - recents; host >= m.hostScroll+maxHostVisible {
+			m.hostScroll = host - maxHostVisible + 1
+		}
+		return m, nil
+	case "backspace":
+		if r := []rune(m.hostFilter); len(r) > 0 {
+			m.hostFilter = string(r[:len(r)-1])
+		}
+	case "ctrl+u":
+		m.hostFilter = ""
+	default:
+		if msg.Type != tea.KeyRunes {
+			return m, nil
+		}
+		m.hostFilter += string(msg.Runes)
+	}
+	m.cursor, m.hostScroll = 0, 0
+	m.err = nil
+	return m, nil
+}
+
+func (m model) renderHostPicker() string {
+	recents := m.recentMatches()
+	matches := m.hostMatches()
+	start := m.hostScroll
+	end := min(start+maxHostVisible, len(matches))
+
+	title := "Select SSH Host:"
+	if m.tempBackend == teleportBackend {
+		title = "Select Teleport Node:"
+	}
+	content := lipgloss.NewStyle().Bold(true).Render(title) + "\n\n"
+	content += "> " + m.hostFilter + "█  " + subtleStyle.Render(fmt.Sprintf("%d/%d", len(matches), len(m.pickerHosts()))) + "\n\n"
+	if len(recents) > 0 {
+		content += subtleStyle.Render("Recent") + "\n"
+		for i, r := range recents {
+			content += m.renderRecentMatch(r, i == m.cursor) + "\n"
+		}
+		content += "\n" + subtleStyle.Render("Hosts") + "\n"
+	}
+	for i := start; i < end; i++ {
+		content += m.renderHostMatch(matches[i], len(recents)+i == m.cursor)
+		if i < end-1 {
+			content += "\n"
+		}
+	}
+	switch {
+	case len(matches) > 0:
+	case m.tempBackend == teleportBackend && m.hostFilter == "" && m.tshPickerNote() != "":
+		content += subtleStyle.Render("     " + m.tshPickerNote())
+	case len(recents) > 0:
+		content += subtleStyle.Render("     No host matches, Tab to connect to it as typed")
+	default:
+		content += subtleStyle.Render("     No match, Enter to connect to it as typed")
+	}
+
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+
+	help := "Type to filter • ↑/↓ to move • Enter to select • Tab for manual • Esc to cancel"
+	if len(matches) > maxHostVisible {
+		help = fmt.Sprintf("(%d/%d) ", max(m.cursor-len(recents), 0)+1, len(matches)) + help
+	}
+	return content + "\n\n" + subtleStyle.Render(help)
+}
+
+// renderRecentMatch shows a recent tunnel, with the matched characters
+// highlighted.
+func (m model) renderRecentMatch(match fuzzy.Match, selected bool) string {
+	nameStyle, prefix := lipgloss.NewStyle(), "     "
+	if selected {
+		nameStyle, prefix = selectedStyle, "  ▶  "
+	}
+	matched := make(map[int]bool, len(match.MatchedIndexes))
+	for _, i := range match.MatchedIndexes {
+		matched[i] = true
+	}
+	var b strings.Builder
+	b.WriteString(nameStyle.Render(prefix))
+	for i, r := range match.Str {
+		if matched[i] {
+			b.WriteString(highlightStyle.Bold(true).Underline(true).Render(string(r)))
+		} else {
+			b.WriteString(nameStyle.Render(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// renderHostMatch shows one picker line, with the matched characters
+// highlighted and the resolved address dimmed.
+func (m model) renderHostMatch(match fuzzy.Match, selected bool) string {
+	nameStyle, prefix := lipgloss.NewStyle(), "     "
+	if selected {
+		nameStyle, prefix = selectedStyle, "  ▶  "
+	}
+	matched := make(map[int]bool, len(match.MatchedIndexes))
+	for _, i := range match.MatchedIndexes {
+		matched[i] = true
+	}
+
+	// 0 name, 1 resolved address, 2 matched character
+	styles := []lipgloss.Style{nameStyle, subtleStyle, highlightStyle.Bold(true).Underline(true)}
+	kind := func(i int) int {
+		switch {
+		case matched[i]:
+			return 2
+		case i >= len(match.Str):
+			return 1
+		}
+		return 0
+	}
+
+	// Render runs of characters that share a style together
+	var b strings.Builder
+	b.WriteString(nameStyle.Render(prefix))
+	text := m.hostSearchText(match.Str)
+	runStart := 0
+	for i := range text {
+		if i > runStart && kind(i) != kind(runStart) {
+			b.WriteString(styles[kind(runStart)].Render(text[runStart:i]))
+			runStart = i
+		}
+	}
+	if runStart < len(text) {
+		b.WriteString(styles[kind(runStart)].Render(text[runStart:]))
+	}
+	return b.String()
+}
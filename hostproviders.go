@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const hostProviderTimeout = 15 * time.Second
+
+// hostProvider feeds the host picker. Each host is a picker entry: the
+// name to ssh to, optionally followed by addresses the user may pick
+// instead (the format ~/.ssh/config entries use, e.g. "db db.internal").
+type hostProvider interface {
+	Name() string
+	ListHosts() ([]string, error)
+}
+
+// sshConfigProvider lists the Host entries of ~/.ssh/config.
+type sshConfigProvider struct{}
+
+func (sshConfigProvider) Name() string { return "ssh-config" }
+
+func (sshConfigProvider) ListHosts() ([]string, error) {
+	return getSSHHosts(), nil
+}
+
+// hostProviderConfig declares an external provider in config.json.
+type hostProviderConfig struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+}
+
+// execProvider runs an external binary that prints its inventory to
+// stdout as JSON: [{"name": "web-1", "address": "10.0.0.5"}, ...]. The
+// address is optional. Anything on stderr is reported when it fails.
+type execProvider struct {
+	name    string
+	command []string
+}
+
+func (p execProvider) Name() string { return p.name }
+
+func (p execProvider) ListHosts() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hostProviderTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	setProcessGroup(cmd)
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("no answer within %s", hostProviderTimeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var hosts []struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(out, &hosts); err != nil {
+		return nil, fmt.Errorf("invalid output: %v", err)
+	}
+
+	entries := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if strings.TrimSpace(h.Name) == "" || strings.ContainsAny(h.Name, " \t") {
+			return nil, fmt.Errorf("invalid host name %q", h.Name)
+		}
+		if h.Address != "" && h.Address != h.Name {
+			entries = append(entries, h.Name+" "+h.Address)
+		} else {
+			entries = append(entries, h.Name)
+		}
+	}
+	return entries, nil
+}
+
+func hostProvidersFromConfig(cfg config) []hostProvider {
+	providers := make([]hostProvider, 0, len(cfg.HostProviders))
+	for _, p := range cfg.HostProviders {
+		providers = append(providers, execProvider{name: p.Name, command: p.Command})
+	}
+	return providers
+}
+
+type hostProvidersMsg struct {
+	hosts []string
+	errs  []error
+}
+
+// listHostsCmd queries the providers in parallel, keeping their order, so
+// a slow inventory doesn't hold up the picker's ssh config entries.
+func listHostsCmd(providers []hostProvider) tea.Cmd {
+	if len(providers) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		results := make([][]string, len(providers))
+		errs := make([]error, len(providers))
+		done := make(chan struct{})
+		for i, p := range providers {
+			go func() {
+				results[i], errs[i] = p.ListHosts()
+				if errs[i] != nil {
+					errs[i] = fmt.Errorf("host provider %s: %w", p.Name(), errs[i])
+				}
+				done <- struct{}{}
+			}()
+		}
+		for range providers {
+			<-done
+		}
+
+		var msg hostProvidersMsg
+		for i := range providers {
+			msg.hosts = append(msg.hosts, results[i]...)
+			if errs[i] != nil {
+				msg.errs = append(msg.errs, errs[i])
+			}
+		}
+		return msg
+	}
+}
+
+// mergeHosts appends the entries not already in hosts.
+func mergeHosts(hosts, more []string) []string {
+	seen := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		seen[h] = true
+	}
+	for _, h := range more {
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Which key a tunnel logs in with. ssh offers every key in ssh-agent and
+// ~/.ssh in turn, so a login can fail on "too many authentication
+// failures" or land as the wrong user before the right key comes up. A
+// tunnel can pin one key with identity_file instead, which is passed as
+// ssh -i with IdentitiesOnly, so only that key is offered.
+
+// agentStatus is what ssh-agent holds, for the status bar and the
+// wizard's key list.
+type agentStatus struct {
+	checked bool
+	socket  bool            // SSH_AUTH_SOCK is set
+	keys    map[string]bool // public keys, marshalled
+	err     error
+}
+
+type agentStatusMsg struct{ status agentStatus }
+
+func checkAgentCmd() tea.Cmd {
+	return func() tea.Msg { return agentStatusMsg{queryAgent()} }
+}
+
+func queryAgent() agentStatus {
+	st := agentStatus{checked: true}
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return st
+	}
+	st.socket = true
+	conn, err := net.DialTimeout("unix", sock, 2*time.Second)
+	if err != nil {
+		st.err = err
+		return st
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		st.err = err
+		return st
+	}
+	st.keys = map[string]bool{}
+	for _, k := range keys {
+		st.keys[string(k.Marshal())] = true
+	}
+	return st
+}
+
+// label is the status bar's indicator.
+func (a agentStatus) label() string {
+	switch {
+	case !a.checked:
+		return ""
+	case !a.socket:
+		return "🔑 no agent (SSH_AUTH_SOCK unset)"
+	case a.err != nil:
+		return "🔑 agent not answering"
+	case len(a.keys) == 1:
+		return "🔑 agent: 1 key"
+	}
+	return fmt.Sprintf("🔑 agent: %d keys", len(a.keys))
+}
+
+// identityPath expands identity_file: ~/ is the home directory and a bare
+// file name is taken from ~/.ssh.
+func identityPath(file string) string {
+	return sshIncludePath(file)
+}
+
+// identityChoice is a key pair offered by the wizard's identity step.
+type identityChoice struct {
+	path        string // as saved in the spec
+	detail      string // key type and comment
+	fingerprint string
+	key         string // the public key, marshalled
+}
+
+// listIdentities finds the key pairs in ~/.ssh: private keys with a .pub
+// file next to them.
+func listIdentities() []identityChoice {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	pubs, _ := filepath.Glob(filepath.Join(home, ".ssh", "*.pub"))
+	var choices []identityChoice
+	for _, pub := range pubs {
+		private := strings.TrimSuffix(pub, ".pub")
+		if _, err := os.Stat(private); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(pub)
+		if err != nil {
+			continue
+		}
+		key, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			continue
+		}
+		c := identityChoice{
+			path:        "~/.ssh/" + filepath.Base(private),
+			detail:      strings.TrimPrefix(key.Type(), "ssh-") + " key",
+			fingerprint: ssh.FingerprintSHA256(key),
+			key:         string(key.Marshal()),
+		}
+		if comment != "" {
+			c.detail += " " + comment
+		}
+		choices = append(choices, c)
+	}
+	return choices
+}
+
+// pinnedAgentSigners narrows the agent's keys to the pinned identity, as
+// IdentitiesOnly does: the agent still signs for it when the file has a
+// passphrase. Without a .pub file to match against, no agent key is used.
+func pinnedAgentSigners(signers func() ([]ssh.Signer, error), pubFile string) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		data, err := os.ReadFile(pubFile)
+		if err != nil {
+			return nil, nil
+		}
+		pinned, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, nil
+		}
+		all, err := signers()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range all {
+			if string(s.PublicKey().Marshal()) == string(pinned.Marshal()) {
+				return []ssh.Signer{s}, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// toIdentityStep moves the wizard on from the tag to picking a key,
+// skipping the step when ~/.ssh has no key pairs to pick from.
+func (m model) toIdentityStep() (tea.Model, tea.Cmd) {
+	m.identityChoices = listIdentities()
+	if len(m.identityChoices) == 0 {
+		m.tempIdentity = ""
+		return m.afterIdentityStep(), nil
+	}
+	m.identityIndex = 0
+	for i, c := range m.identityChoices {
+		if c.path == m.tempIdentity {
+			m.identityIndex = i + 1
+		}
+	}
+	m.step = stepIdentity
+	if m.demo {
+		return m, nil
+	}
+	return m, checkAgentCmd()
+}
+
+// afterIdentityStep goes on to the proxy, which only the ssh binary
+// takes.
+func (m model) afterIdentityStep() model {
+	if m.tempBackend != "" {
+		m.setInput("")
+		m.step = stepSmokeTest
+		return m
+	}
+	// Offer the global proxy as the default; clearing it means direct
+	m.setInput(m.cfg.Proxy)
+	m.step = stepProxy
+	return m
+}
+
+func (m model) handleIdentityKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.view = viewMain
+	case "up", "k":
+		if m.identityIndex > 0 {
+			m.identityIndex--
+		}
+	case "down", "j":
+		if m.identityIndex < len(m.identityChoices) {
+			m.identityIndex++
+		}
+	case "enter":
+		m.tempIdentity = ""
+		if m.identityIndex > 0 {
+			m.tempIdentity = m.identityChoices[m.identityIndex-1].path
+		}
+		return m.afterIdentityStep(), nil
+	}
+	return m, nil
+}
+
+func (m model) renderIdentityStep() string {
+	content := lipgloss.NewStyle().Bold(true).Render("Log in with:") + "\n\n"
+	detail := "Whatever ssh-agent and ~/.ssh/config offer, in turn"
+	for i := 0; i <= len(m.identityChoices); i++ {
+		label, mark := "Any key", ""
+		if i > 0 {
+			c := m.identityChoices[i-1]
+			label = c.path
+			if m.agent.keys[c.key] {
+				mark = " " + successStyle.Render("● agent")
+			}
+			if i == m.identityIndex {
+				detail = c.detail + ", the only one offered\n" + c.fingerprint
+			}
+		}
+		if i == m.identityIndex {
+			content += selectedStyle.Render("  ▶  "+label) + mark
+		} else {
+			content += "     " + label + mark
+		}
+		if i < len(m.identityChoices) {
+			content += "\n"
+		}
+	}
+	content += "\n\n" + subtleStyle.Render(detail)
+	if label := m.agent.label(); label != "" {
+		content += "\n" + subtleStyle.Render(label)
+	}
+	content += "\n\n" + subtleStyle.Render("↑/↓ and Enter • Esc to cancel")
+	return content
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The wizard's text steps share one textinput, so each of them gets
+// cursor movement, paste and readline-style editing (ctrl+a, ctrl+e,
+// ctrl+w, ctrl+u). A step's inputRules say what it takes: clean drops
+// what the step can never accept as it is typed or pasted, and validate
+// flags a value that is not usable yet next to the field and keeps Enter
+// from taking it. handleEnter still runs the step's full checks.
+
+func newWizardInput() textinput.Model {
+	in := textinput.New()
+	in.Prompt = ""
+	in.Cursor.SetMode(cursor.CursorStatic)
+	// The k8s steps complete from kubectl, the ciphers step from sshCiphers
+	in.ShowSuggestions = true
+	in.Focus()
+	return in
+}
+
+// isTextStep reports whether step reads a line of text into m.input.
+func isTextStep(step tunnelStep) bool {
+	switch step {
+	case stepRemoteHost, stepRemotePort, stepLocalPort, stepForwards, stepTag, stepColor, stepManualHost,
+		stepKubeContext, stepKubeNamespace, stepKubeTarget, stepProxy, stepPrepCommand, stepSmokeTest, stepHealthCheck, stepTLSMode, stepCiphers,
+		stepCloseAfter, stepCloseIdle:
+		return true
+	}
+	return false
+}
+
+type inputRules struct {
+	placeholder string
+	clean       func(string) string // nil keeps everything
+	validate    textinput.ValidateFunc
+}
+
+func (m model) inputRules() inputRules {
+	switch m.step {
+	case stepRemotePort:
+		return inputRules{"e.g. 5432", keepOnly("0123456789"), func(s string) error {
+			if err := checkPort(s); err != nil {
+				return err
+			}
+			return m.policy.checkRemotePort(s)
+		}}
+	case stepLocalPort:
+		placeholder := "e.g. 15432"
+		if m.tempType == "socks" {
+			placeholder = "e.g. 1080"
+		}
+		return inputRules{placeholder, keepOnly("0123456789"), checkPort}
+	case stepTag:
+		return inputRules{"random name", cleanTag, nil}
+	case stepColor:
+		return inputRules{"none", keepOnly("abcdefghijklmnopqrstuvwxyz"), checkColor}
+	case stepManualHost:
+		if m.tempBackend == kubectlBackend {
+			return inputRules{"e.g. shop/svc/postgres@prod", nil, nil}
+		}
+		if !usesSSH(m.tempBackend) && m.tempBackend != teleportBackend {
+			// e.g. i-0abc for SSM
+			return inputRules{"e.g. svc/postgres", keepOnly("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-@/:_"), nil}
+		}
+		return inputRules{"user@host", keepOnly("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-@"), checkHostSyntax}
+	case stepRemoteHost:
+		return inputRules{"localhost", func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if destinationHostRe.MatchString(string(r)) {
+					return r
+				}
+				return -1
+			}, s)
+		}, nil}
+	case stepKubeContext:
+		return inputRules{"current context", dropSpaces, nil}
+	case stepKubeNamespace:
+		return inputRules{"default", keepOnly("abcdefghijklmnopqrstuvwxyz0123456789-"), nil}
+	case stepKubeTarget:
+		return inputRules{"e.g. svc/postgres", keepOnly("abcdefghijklmnopqrstuvwxyz0123456789-./"), nil}
+	case stepForwards:
+		return inputRules{"-L 16379:6379", keepOnly("0123456789:-LRDlrd "), nil}
+	case stepProxy:
+		return inputRules{"direct", dropSpaces, nil}
+	case stepTLSMode:
+		return inputRules{"none", dropSpaces, nil}
+	case stepCiphers:
+		return inputRules{"default", keepOnly("abcdefghijklmnopqrstuvwxyz0123456789@.,-"), nil}
+	case stepCloseAfter, stepCloseIdle:
+		return inputRules{"never", keepOnly("0123456789"), nil}
+	}
+	return inputRules{}
+}
+
+// setInput replaces the field's text, with the cursor at its end.
+func (m *model) setInput(s string) {
+	m.input.Validate = nil
+	m.input.SetSuggestions(nil)
+	m.input.SetValue(s)
+	m.input.CursorEnd()
+}
+
+// updateInput passes msg to the field and applies the step's rules.
+func (m model) updateInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	rules := m.inputRules()
+	m.input.Validate = rules.validate
+	if m.tempBackend == kubectlBackend {
+		m.input.SetSuggestions(m.kubeChoices[m.step].choices)
+	}
+	if m.step == stepCiphers {
+		m.input.SetSuggestions(cipherSuggestions(m.input.Value()))
+	}
+	if m.step == stepColor {
+		m.input.SetSuggestions(labelNames)
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	if rules.clean != nil {
+		value := m.input.Value()
+		if cleaned := rules.clean(value); cleaned != value {
+			pos := m.input.Position() - (len([]rune(value)) - len([]rune(cleaned)))
+			m.input.SetValue(cleaned)
+			m.input.SetCursor(pos)
+		}
+	}
+	if m.step == stepCiphers {
+		// Complete the cipher after the comma just typed
+		m.input.SetSuggestions(cipherSuggestions(m.input.Value()))
+	}
+	return m, cmd
+}
+
+// inputView renders the field, with what validate found next to it.
+func (m model) inputView() string {
+	in := m.input
+	in.Placeholder = m.inputRules().placeholder
+	view := in.View()
+	if in.Err != nil {
+		view += "  " + errorStyle.Render(in.Err.Error())
+	}
+	return view
+}
+
+func keepOnly(chars string) func(string) string {
+	return func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if strings.ContainsRune(chars, r) {
+				return r
+			}
+			return -1
+		}, s)
+	}
+}
+
+// cleanTag lowercases a tag and turns spaces into underscores.
+func cleanTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '_'
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_':
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func dropSpaces(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func checkPort(s string) error {
+	if s == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(s); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("ports go from 1 to 65535")
+	}
+	return nil
+}
+
+// checkHostSyntax catches what ssh would take for an option or an empty
+// host, without resolving anything.
+func checkHostSyntax(s string) error {
+	user, host, found := strings.Cut(s, "@")
+	switch {
+	case s == "":
+		return nil
+	case strings.HasPrefix(s, "-"):
+		return fmt.Errorf("a host cannot start with -")
+	case found && (user == "" || host == "" || strings.Contains(host, "@")):
+		return fmt.Errorf("use user@host")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Only one manager runs per user at a time: two would check the same
+// ports, start the same profiles and fight over state.json. The TUI and
+// the daemon hold instance.lock in the config directory, which records
+// their pid. Started while a daemon runs, the TUI attaches to it instead,
+// as another view of the same tunnels; while a TUI runs in another
+// terminal, it refuses. A lock left behind by a manager that was killed is
+// taken over, as its pid is no longer running.
+
+const instanceLockFile = "instance.lock"
+
+type instanceLock struct {
+	path string
+}
+
+// instanceRunningError names the manager holding the lock.
+type instanceRunningError struct {
+	pid  int
+	path string
+}
+
+func (e *instanceRunningError) Error() string {
+	return fmt.Sprintf("ssh-tunnel-manager is already running (pid %d). Quit it first, or run both as views of one background manager with attach; if pid %d is not the manager, delete %s",
+		e.pid, e.pid, e.path)
+}
+
+// acquireInstanceLock takes the lock, failing with an
+// *instanceRunningError while another manager holds it.
+func acquireInstanceLock() (*instanceLock, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, instanceLockFile)
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &instanceLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			return nil, &instanceRunningError{pid: pid, path: path}
+		}
+		// Stale: the manager that wrote it is gone
+		os.Remove(path)
+	}
+	return nil, fmt.Errorf("cannot take %s", path)
+}
+
+// release gives the lock up, unless another manager has taken it over.
+// A nil lock, as in the demo, holds nothing.
+func (l *instanceLock) release() {
+	if l == nil {
+		return
+	}
+	data, err := os.ReadFile(l.path)
+	if err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(l.path)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keepalive makes the SSH client check an idle connection, so a tunnel
+// through a NAT or firewall that forgot it fails and reconnects instead of
+// hanging silently. It maps to ssh's ServerAliveInterval and
+// ServerAliveCountMax, and drives the native client's keepalives.
+type keepalive struct {
+	// Interval is the seconds between checks. 0 sends none, leaving it to
+	// ~/.ssh/config for the ssh binary.
+	Interval int `json:"interval" yaml:"interval"`
+	// CountMax is how many checks may go unanswered before the connection
+	// is dropped (default 3).
+	CountMax int `json:"count_max,omitempty" yaml:"count_max,omitempty"`
+}
+
+var defaultKeepalive = keepalive{Interval: 30, CountMax: 3}
+
+// parseKeepalive reads "30", "30,3" or "off".
+func parseKeepalive(s string) (keepalive, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return keepalive{}, nil
+	}
+	interval, count, hasCount := strings.Cut(s, ",")
+	var k keepalive
+	var err error
+	if k.Interval, err = strconv.Atoi(strings.TrimSpace(interval)); err != nil {
+		return k, fmt.Errorf("keepalive: expected seconds, e.g. 30 or 30,3, got %q", s)
+	}
+	if hasCount {
+		if k.CountMax, err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
+			return k, fmt.Errorf("keepalive: expected seconds, e.g. 30 or 30,3, got %q", s)
+		}
+	}
+	return k, k.check()
+}
+
+func (k *keepalive) check() error {
+	if k.Interval < 0 || k.Interval > 3600 {
+		return fmt.Errorf("keepalive interval must be from 0 to 3600 seconds, got %d", k.Interval)
+	}
+	if k.CountMax < 0 || k.CountMax > 100 {
+		return fmt.Errorf("keepalive count_max must be from 1 to 100, got %d", k.CountMax)
+	}
+	if k.CountMax == 0 {
+		k.CountMax = defaultKeepalive.CountMax
+	}
+	return nil
+}
+
+func (k keepalive) String() string {
+	if k.Interval == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("every %ds, dropped after %d unanswered", k.Interval, k.CountMax)
+}
+
+// sshArgs go after the policy's options, which win when they set the
+// same ones.
+func (k keepalive) sshArgs() []string {
+	if k.Interval == 0 {
+		return nil
+	}
+	return []string{
+		"-o", "ServerAliveInterval=" + strconv.Itoa(k.Interval),
+		"-o", "ServerAliveCountMax=" + strconv.Itoa(k.CountMax),
+	}
+}
+
+// keepalive is the default for tunnels without their own.
+func (c config) keepalive() keepalive {
+	if c.Keepalive != nil {
+		return *c.Keepalive
+	}
+	return defaultKeepalive
+}
+
+// withDefaults fills in the config's keepalive, TCP tuning, compression
+// and ciphers where the spec has none of its own, for the backend that
+// starts it.
+func (c config) withDefaults(spec tunnelSpec) tunnelSpec {
+	if spec.Keepalive == nil {
+		k := c.keepalive()
+		spec.Keepalive = &k
+	}
+	if spec.TCP == nil && usesSSH(spec.Backend) {
+		spec.TCP = c.TCP
+	}
+	return c.withLink(spec)
+}
+
+// keepaliveSetting shows the spec's own keepalive, if any.
+func (s tunnelSpec) keepaliveSetting() string {
+	if s.Keepalive == nil {
+		return "default"
+	}
+	return s.Keepalive.String()
+}
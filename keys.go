@@ -0,0 +1,627 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Key bindings for the main screen. Each one can be changed under "keys"
+// in the config, by action name:
+//
+//	"keys": {"delete": ["x"], "up": ["up"], "down": ["down"]}
+//
+// An empty list turns the action off. The footer and the help screen are
+// generated from the bindings, so they show what is actually bound. Esc,
+// ctrl+c and the keys inside prompts and dialogs are fixed.
+
+// Where an action applies, since the list and the log panel can share a
+// key (n creates a tunnel in the list and jumps to the next match in the
+// logs).
+const (
+	inList = 1 << iota
+	inLogs
+	inBoth = inList | inLogs
+)
+
+type keyMap struct {
+	SwitchPanel    key.Binding
+	New            key.Binding
+	Delete         key.Binding
+	Undo           key.Binding
+	StartStop      key.Binding
+	Restart        key.Binding
+	Refresh        key.Binding
+	All            key.Binding
+	Group          key.Binding
+	Fold           key.Binding
+	Mark           key.Binding
+	Filter         key.Binding
+	Sort           key.Binding
+	Compact        key.Binding
+	Dashboard      key.Binding
+	Profiles       key.Binding
+	History        key.Binding
+	Topology       key.Binding
+	Note           key.Binding
+	QuickSwitch    key.Binding
+	SaveProfile    key.Binding
+	Inspect        key.Binding
+	SmokeTest      key.Binding
+	Copy           key.Binding
+	CopyCommand    key.Binding
+	Shell          key.Binding
+	Browser        key.Binding
+	Settings       key.Binding
+	Up             key.Binding
+	Down           key.Binding
+	Search         key.Binding
+	NextMatch      key.Binding
+	PrevMatch      key.Binding
+	FilterMatches  key.Binding
+	ShrinkSidebar  key.Binding
+	GrowSidebar    key.Binding
+	FullscreenLogs key.Binding
+	Export         key.Binding
+	FromFile       key.Binding
+	Debug          key.Binding
+	Quit           key.Binding
+	Help           key.Binding
+}
+
+// keyAction is a binding with its name in the config, the panel it
+// applies to and its line on the help screen.
+type keyAction struct {
+	name    string
+	scope   int
+	desc    string
+	binding *key.Binding
+}
+
+func (k *keyMap) actions() []keyAction {
+	return []keyAction{
+		{"switch_panel", inBoth, "Switch between panels", &k.SwitchPanel},
+		{"new", inList, "Create new tunnel", &k.New},
+		{"delete", inList, "Delete selected tunnel", &k.Delete},
+		{"undo", inBoth, "Undo the last delete, starting the tunnel again if it was running", &k.Undo},
+		{"inspect", inBoth, "Show the remote process behind the port", &k.Inspect},
+		{"smoke_test", inBoth, "Re-run the tunnel's smoke test, or test a SOCKS proxy by fetching a page through it", &k.SmokeTest},
+		{"copy", inBoth, "Copy the tunnel's address", &k.Copy},
+		{"copy_command", inBoth, "Copy the tunnel's ssh command", &k.CopyCommand},
+		{"shell", inBoth, "Open an interactive ssh session on the tunnel's host", &k.Shell},
+		{"browser", inBoth, "Open the tunnel's web app in the browser", &k.Browser},
+		{"settings", inBoth, "Settings (keepalive)", &k.Settings},
+		{"restart", inBoth, "Restart the selected tunnel (kill and relaunch its ssh)", &k.Restart},
+		{"refresh", inBoth, "Refresh now: re-check every active tunnel's port", &k.Refresh},
+		{"all", inBoth, "All tunnels: then s to start, x to stop or r to restart them", &k.All},
+		{"group", inBoth, "Put the selected tunnel in a group", &k.Group},
+		{"fold", inList, "Fold or unfold the selected group", &k.Fold},
+		{"mark", inList, "Mark the selected tunnel, or a group's tunnels, for d, r and g to act on together", &k.Mark},
+		{"filter", inList, "Filter the list by tag, host or port", &k.Filter},
+		{"sort", inList, "Sort the list by creation order, tag, host, status or uptime", &k.Sort},
+		{"compact", inList, "Show one line per tunnel in the list, or three", &k.Compact},
+		{"dashboard", inBoth, "Show every tunnel in a table instead of the list and logs, or go back", &k.Dashboard},
+		{"profiles", inBoth, "Start a saved profile (u inside: update from profiles_url)", &k.Profiles},
+		{"history", inBoth, "History of deleted and failed tunnels (Enter inside: set one up again)", &k.History},
+		{"topology", inBoth, "Draw the selected tunnel's path: this machine, jump hosts, SSH host and destination", &k.Topology},
+		{"note", inBoth, "Edit the selected tunnel's note, saved with its profile", &k.Note},
+		{"quick_switch", inBoth, "Select the list's first nine tunnels, by the number next to them", &k.QuickSwitch},
+		{"start_stop", inBoth, "Stop the selected tunnel or group, or start it again", &k.StartStop},
+		{"save_profile", inBoth, "Save selected tunnel as a profile", &k.SaveProfile},
+		{"up", inBoth, "Move up the list, or scroll back through the logs", &k.Up},
+		{"down", inBoth, "Move down the list, or scroll towards the newest logs", &k.Down},
+		{"search", inLogs, "Search the logs", &k.Search},
+		{"next_match", inLogs, "Jump to the next match", &k.NextMatch},
+		{"prev_match", inLogs, "Jump to the previous match", &k.PrevMatch},
+		{"filter_matches", inLogs, "Show only the matching lines, or all of them", &k.FilterMatches},
+		{"shrink_sidebar", inBoth, "Narrow the tunnel list, widening the logs", &k.ShrinkSidebar},
+		{"grow_sidebar", inBoth, "Widen the tunnel list, narrowing the logs", &k.GrowSidebar},
+		{"fullscreen_logs", inBoth, "Show the selected tunnel's logs full screen, wrapped", &k.FullscreenLogs},
+		{"from_file", inBoth, "Start the tunnels listed in a YAML or JSON file", &k.FromFile},
+		{"export", inBoth, "Export all tunnels as a shell script, autossh script or systemd units", &k.Export},
+		{"debug", inBoth, "Debug view", &k.Debug},
+		{"quit", inBoth, "Quit (with confirmation)", &k.Quit},
+		{"help", inBoth, "Show this help", &k.Help},
+	}
+}
+
+func binding(short string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyLabel(keys), short))
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		SwitchPanel:    binding("switch", "tab"),
+		New:            binding("new", "n"),
+		Delete:         binding("delete", "d"),
+		Undo:           binding("undo", "u"),
+		StartStop:      binding("start/stop", "s"),
+		Restart:        binding("restart", "r"),
+		Refresh:        binding("refresh", "R"),
+		All:            binding("all", "a"),
+		Group:          binding("group", "g"),
+		Fold:           binding("fold", "enter"),
+		Mark:           binding("mark", " "),
+		Filter:         binding("filter", "/"),
+		Sort:           binding("sort", "="),
+		Compact:        binding("compact", "z"),
+		Dashboard:      binding("dashboard", "v"),
+		Profiles:       binding("profiles", "p"),
+		History:        binding("history", "H"),
+		Topology:       binding("topology", "T"),
+		Note:           binding("note", "e"),
+		QuickSwitch:    key.NewBinding(key.WithKeys("1", "2", "3", "4", "5", "6", "7", "8", "9"), key.WithHelp("1-9", "select")),
+		SaveProfile:    binding("save", "S"),
+		Inspect:        binding("inspect", "i"),
+		SmokeTest:      binding("smoke test", "t"),
+		Copy:           binding("copy", "c"),
+		CopyCommand:    binding("copy command", "C"),
+		Shell:          binding("shell", "O"),
+		Browser:        binding("browser", "b"),
+		Settings:       binding("settings", "o"),
+		Up:             binding("up", "up", "k"),
+		Down:           binding("down", "down", "j"),
+		Search:         binding("search", "/"),
+		NextMatch:      binding("next match", "n"),
+		PrevMatch:      binding("previous match", "N"),
+		FilterMatches:  binding("only matches", "f"),
+		ShrinkSidebar:  binding("narrower list", "<"),
+		GrowSidebar:    binding("wider list", ">"),
+		FullscreenLogs: binding("full screen", "F"),
+		Export:         binding("export", "E"),
+		FromFile:       binding("from file", "I"),
+		Debug:          binding("debug", "ctrl+d"),
+		Quit:           binding("quit", "q"),
+		Help:           binding("help", "?"),
+	}
+}
+
+// newKeyMap is the default bindings with the config's changes applied.
+func newKeyMap(changes map[string][]string) (keyMap, error) {
+	k := defaultKeyMap()
+	actions := k.actions()
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names) // report the same mistake every time
+	for _, name := range names {
+		i := slices.IndexFunc(actions, func(a keyAction) bool { return a.name == name })
+		if i < 0 {
+			return k, fmt.Errorf("unknown action %q", name)
+		}
+		keys := slices.Clone(changes[name])
+		for j, s := range keys {
+			if s == "space" {
+				keys[j] = " "
+			}
+			switch keys[j] {
+			case "":
+				return k, fmt.Errorf("%s: empty key", name)
+			case "esc", "ctrl+c":
+				return k, fmt.Errorf("%s: %s cannot be rebound", name, keys[j])
+			}
+		}
+		b := actions[i].binding
+		*b = key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyLabel(keys), b.Help().Desc))
+		if len(keys) == 0 {
+			b.SetEnabled(false)
+		}
+	}
+
+	// A key can do one thing per panel
+	owner := map[string]string{}
+	for _, a := range actions {
+		for _, s := range a.binding.Keys() {
+			for _, scope := range []int{inList, inLogs} {
+				if a.scope&scope == 0 {
+					continue
+				}
+				id := fmt.Sprintf("%d %s", scope, s)
+				if prev, ok := owner[id]; ok {
+					return k, fmt.Errorf("%s is bound to both %s and %s", keyLabel([]string{s}), prev, a.name)
+				}
+				owner[id] = a.name
+			}
+		}
+	}
+	return k, nil
+}
+
+// keyMap is the config's bindings. loadConfig has checked them already.
+func (c config) keyMap() keyMap {
+	k, err := newKeyMap(c.Keys)
+	if err != nil {
+		slog.Warn("ignoring key bindings", "err", err)
+		return defaultKeyMap()
+	}
+	return k
+}
+
+// keyLabel shows keys the way the help does, e.g. ↑/k.
+func keyLabel(keys []string) string {
+	labels := make([]string, len(keys))
+	for i, s := range keys {
+		switch s {
+		case "up":
+			s = "↑"
+		case "down":
+			s = "↓"
+		case "left":
+			s = "←"
+		case "right":
+			s = "→"
+		case " ":
+			s = "space"
+		}
+		labels[i] = s
+	}
+	return strings.Join(labels, "/")
+}
+
+// listKeyMap lets the tunnel list move with the configured up and down
+// keys and nothing else, so its own bindings don't swallow ours.
+func (k keyMap) listKeyMap() list.KeyMap {
+	return list.KeyMap{
+		CursorUp:   k.Up,
+		CursorDown: k.Down,
+		PrevPage:   key.NewBinding(key.WithKeys("pgup")),
+		NextPage:   key.NewBinding(key.WithKeys("pgdown")),
+		GoToStart:  key.NewBinding(key.WithKeys("home")),
+		GoToEnd:    key.NewBinding(key.WithKeys("end")),
+	}
+}
+
+// footerKeys are the bindings the footer shows for the selected panel.
+func (k keyMap) footerKeys(panel int) []key.Binding {
+	if panel == 0 {
+		return []key.Binding{k.New, k.Profiles, k.Delete, k.Copy, k.Filter, k.upDown("nav")}
+	}
+	return []key.Binding{k.upDown("scroll"), k.Search, k.FullscreenLogs, k.Inspect, k.SmokeTest}
+}
+
+// upDown shows the up and down keys as one entry, e.g. ↑/↓: nav.
+func (k keyMap) upDown(desc string) key.Binding {
+	var keys []string
+	for _, b := range []key.Binding{k.Up, k.Down} {
+		if b.Enabled() {
+			keys = append(keys, b.Keys()[0])
+		}
+	}
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyLabel(keys), desc))
+}
+
+// handleMainKey runs what msg is bound to on the main screen. Keys bound
+// to nothing go to the tunnel list.
+func (m model) handleMainKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.keys
+	inLogPanel := m.selectedPanel == 1
+	searched := inLogPanel && m.logQuery != ""
+	selected := m.selectedTunnel < len(m.tunnels)
+	if reason := m.denied(msg); reason != "" {
+		m.statusMessage = reason
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(msg, k.Help):
+		m.view = viewHelp
+
+	case msg.String() == "ctrl+c" || key.Matches(msg, k.Quit):
+		m.view = viewQuitConfirm
+
+	case key.Matches(msg, k.Debug):
+		m.view = viewDebug
+
+	case key.Matches(msg, k.Dashboard):
+		m.toggleDashboard()
+
+	case m.dashboard && key.Matches(msg, k.Up):
+		m.moveDashboard(-1)
+
+	case m.dashboard && key.Matches(msg, k.Down):
+		m.moveDashboard(1)
+
+	case m.dashboard && (key.Matches(msg, k.SwitchPanel) || msg.String() == "enter"):
+		// Back to the list and logs, on the selected tunnel
+		m.toggleDashboard()
+
+	case key.Matches(msg, k.SwitchPanel):
+		m.selectedPanel = (m.selectedPanel + 1) % 2 // Only 2 panels now
+
+	case key.Matches(msg, k.Profiles):
+		profiles, err := loadProfiles()
+		if err != nil {
+			m.statusMessage = err.Error()
+			return m, nil
+		}
+		m.profiles = profiles
+		m.profileIndex = 0
+		m.profileScroll = 0
+		m.view = viewProfiles
+
+	case key.Matches(msg, k.History):
+		m = m.openClosed()
+
+	case key.Matches(msg, k.Topology):
+		m = m.openTopology()
+
+	case key.Matches(msg, k.Note):
+		m = m.editNote()
+
+	case key.Matches(msg, k.QuickSwitch):
+		return m.quickSwitch(slices.Index(k.QuickSwitch.Keys(), msg.String()) + 1)
+
+	case key.Matches(msg, k.Undo):
+		return m.undoDelete()
+
+	case key.Matches(msg, k.StartStop):
+		if m.selectedGroup != "" {
+			return m.startStopGroup(m.selectedGroup)
+		}
+		if selected {
+			t := m.tunnels[m.selectedTunnel]
+			// A reconnecting demo tunnel is down but still holds its port
+			if !t.active && t.demo == nil {
+				return m.resumeTunnel(m.selectedTunnel)
+			}
+			slog.Info("tunnel stopped", t.logAttrs()...)
+			t.stop()
+			t.appendLog(fmt.Sprintf("Stopped, press %s to start it again", k.StartStop.Help().Key))
+			m.updateTunnelList()
+			m.statusMessage = fmt.Sprintf("Stopped %s", t.tag)
+		}
+
+	case key.Matches(msg, k.SaveProfile):
+		if selected {
+			profiles, err := loadProfiles()
+			if err == nil {
+				t := m.tunnels[m.selectedTunnel]
+				err = saveProfiles(putProfile(profiles, t.spec()))
+			}
+			if err != nil {
+				m.statusMessage = "Cannot save profile: " + err.Error()
+			} else {
+				m.statusMessage = fmt.Sprintf("Saved %s as a profile", m.tunnels[m.selectedTunnel].tag)
+			}
+		}
+
+	case !inLogPanel && key.Matches(msg, k.New):
+		m.view = viewNewTunnel
+		m.step = stepTunnelType
+		if len(m.backendNames) > 1 {
+			m.step = stepBackend
+		}
+		m.tempBackend = ""
+		m.tempType = ""
+		m.kubeChoices = nil
+		m.tempResume = 0
+		m.tempForwards = nil
+		m.tempKeepalive = nil
+		m.tempIdentity = ""
+		m.tempControlPath = ""
+		m.tempCompression, m.tempCiphers = nil, ""
+		m.tempAgent, m.tempX11 = false, ""
+		m.tempCloseAfter, m.tempCloseIdle = 0, 0
+		m.tempLazy = false
+		m.tempOnConnect, m.tempOnDisc = "", ""
+		m.tempWeb, m.tempWebURL = false, ""
+		m.tempNote, m.tempColor = "", ""
+		m.reviewEditing = false
+		m.backendIndex = 0
+		m.typeIndex = 0
+		m.cursor = 0
+		m.hostScroll = 0
+		m.setInput("")
+		m.suggestedTag = ""
+		m.err = nil
+
+	case searched && key.Matches(msg, k.NextMatch):
+		m.jumpToLogMatch(true, -1)
+
+	case searched && key.Matches(msg, k.PrevMatch):
+		m.jumpToLogMatch(false, -1)
+
+	case !inLogPanel && key.Matches(msg, k.Mark):
+		m.toggleMark()
+
+	case !inLogPanel && key.Matches(msg, k.Compact):
+		m.toggleCompact()
+
+	case !inLogPanel && key.Matches(msg, k.Sort):
+		m.cycleSort()
+
+	case !inLogPanel && key.Matches(msg, k.Filter):
+		m.listFiltering = true
+		m.updateTunnelList()
+
+	case inLogPanel && selected && key.Matches(msg, k.Search):
+		m.logSearching = true
+		m.logQuery = ""
+		m.logFilterOnly = false
+
+	case searched && key.Matches(msg, k.FilterMatches):
+		m.logFilterOnly = !m.logFilterOnly
+		m.logScroll = 0
+
+	case msg.String() == "esc":
+		if !inLogPanel && len(m.marked()) > 0 {
+			m.clearMarks()
+			m.statusMessage = "Marks cleared"
+		} else if !inLogPanel && m.listFilter != "" {
+			m.listFilter = ""
+			m.updateTunnelList()
+		} else if m.logQuery != "" {
+			m.logQuery = ""
+			m.logFilterOnly = false
+			m.logScroll = 0
+		}
+
+	case !inLogPanel && m.selectedGroup != "" && key.Matches(msg, k.Fold):
+		m.toggleCollapsed(m.selectedGroup)
+
+	case inLogPanel && key.Matches(msg, k.Up):
+		// Scroll back through older logs
+		if selected && m.logScroll < m.logLines(m.tunnels[m.selectedTunnel]).len()-1 {
+			m.logScroll++
+		}
+
+	case inLogPanel && key.Matches(msg, k.Down):
+		// Scroll towards the newest logs
+		if m.logScroll > 0 {
+			m.logScroll--
+		}
+
+	case selected && m.selectedGroup == "" && key.Matches(msg, k.FullscreenLogs):
+		return m.openLogView()
+
+	case key.Matches(msg, k.FromFile):
+		return m.editTunnelsFile(), nil
+
+	case key.Matches(msg, k.Export):
+		if len(m.tunnels) == 0 {
+			m.statusMessage = "No tunnels to export"
+			return m, nil
+		}
+		m.exportPending = true
+		m.exportReturnStatus = m.statusMessage
+		m.statusMessage = exportPrompt
+
+	case key.Matches(msg, k.ShrinkSidebar):
+		m.resizeSidebar(-sidebarStep)
+
+	case key.Matches(msg, k.GrowSidebar):
+		m.resizeSidebar(sidebarStep)
+
+	case key.Matches(msg, k.Restart):
+		if ts := m.marked(); len(ts) > 0 {
+			m.clearMarks()
+			return m.restartTunnels(ts, "along with the marked tunnels")
+		}
+		if selected {
+			return m.restartTunnel(m.selectedTunnel)
+		}
+
+	case key.Matches(msg, k.Refresh):
+		return m, m.refresh()
+
+	case key.Matches(msg, k.Group):
+		if len(m.targets()) > 0 {
+			return m.editGroup(), nil
+		}
+
+	case key.Matches(msg, k.All):
+		if len(m.tunnels) > 0 {
+			m.bulkPending = true
+			m.bulkReturnStatus = m.statusMessage
+			m.statusMessage = bulkPrompt
+		}
+
+	case key.Matches(msg, k.SmokeTest):
+		if selected {
+			t := m.tunnels[m.selectedTunnel]
+			switch {
+			case t.tunnelType == "socks" && !t.active:
+				m.statusMessage = fmt.Sprintf("Tunnel %s is down", t.tag)
+			case t.tunnelType == "socks":
+				m.statusMessage = fmt.Sprintf("Fetching %s through %s...", proxyTestURL, t.tag)
+				cmds := []tea.Cmd{proxyTestCmd(t.id, t.localPort, m.demo)}
+				if t.smokeTest != "" {
+					cmds = append(cmds, smokeTestCmd(t.id, t.smokeTest, t.localPort, false))
+				}
+				return m, tea.Batch(cmds...)
+			case t.smokeTest == "":
+				m.statusMessage = fmt.Sprintf("Tunnel %s has no smoke test", t.tag)
+			default:
+				m.statusMessage = fmt.Sprintf("Running smoke test for %s...", t.tag)
+				return m, smokeTestCmd(t.id, t.smokeTest, t.localPort, false)
+			}
+		}
+
+	case key.Matches(msg, k.Copy):
+		if selected {
+			t := m.tunnels[m.selectedTunnel]
+			if line := t.dockerHostLine(); line != "" {
+				return m, copyCmd(m.termOut, "the DOCKER_HOST line", line)
+			}
+			if t.tunnelType != "remote" {
+				return m, copyCmd(m.termOut, t.address(), t.address())
+			}
+			// A remote forward is reached on the SSH host, so its
+			// address is no use here; copy how to set it up instead
+			line, err := m.commandLine(t)
+			if err != nil {
+				m.statusMessage = "Cannot copy: " + err.Error()
+				return m, nil
+			}
+			return m, copyCmd(m.termOut, "the command for "+t.tag, line)
+		}
+
+	case key.Matches(msg, k.CopyCommand):
+		if selected {
+			t := m.tunnels[m.selectedTunnel]
+			line, err := m.commandLine(t)
+			if err != nil {
+				m.statusMessage = "Cannot copy: " + err.Error()
+				return m, nil
+			}
+			return m, copyCmd(m.termOut, "the command for "+t.tag, line)
+		}
+
+	case key.Matches(msg, k.Browser):
+		if selected {
+			return m.openWeb(m.tunnels[m.selectedTunnel])
+		}
+
+	case key.Matches(msg, k.Shell):
+		if selected {
+			return m.openShell(m.tunnels[m.selectedTunnel])
+		}
+
+	case key.Matches(msg, k.Settings):
+		return m.openSettings(), nil
+
+	case key.Matches(msg, k.Inspect):
+		if selected {
+			t := m.tunnels[m.selectedTunnel]
+			if t.backend != "" {
+				m.statusMessage = "Inspecting the remote process needs the ssh backend"
+				return m, nil
+			}
+			if t.tunnelType == "socks" {
+				m.statusMessage = "A SOCKS proxy has no remote port to inspect"
+				return m, nil
+			}
+			if t.remoteHost != "" {
+				m.statusMessage = fmt.Sprintf("The port is on %s, not on %s; nothing to inspect there", t.remoteHost, t.host)
+				return m, nil
+			}
+			if isSocketPath(t.remotePort) {
+				m.statusMessage = fmt.Sprintf("%s forwards the socket %s, not a port", t.tag, t.remotePort)
+				return m, nil
+			}
+			m.statusMessage = fmt.Sprintf("Inspecting port %s on %s...", t.remotePort, t.host)
+			if m.demo {
+				return m, demoRemoteProcessCmd(t.id, t.host, t.remotePort)
+			}
+			return m, remoteProcessCmd(t.id, t.host, t.remotePort)
+		}
+
+	case !inLogPanel && key.Matches(msg, k.Delete):
+		if selected || len(m.marked()) > 0 {
+			m.view = viewDeleteConfirm
+			m.deleteTunnelIdx = m.selectedTunnel
+		}
+
+	case !inLogPanel && !m.dashboard:
+		// Moving through the list, with the configured up and down keys
+		return m, m.updateList(msg)
+	}
+	return m, nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The k8s backend wraps kubectl port-forward, so forwards into a cluster
+// live next to the ssh tunnels with the same logs, restarts, smoke tests
+// and health checks. Its host names what to forward to as
+// namespace/kind/name@context, e.g. shop/svc/postgres@prod, where kind is
+// svc, deploy or pod and the context defaults to kubectl's current one.
+// The wizard asks for the context, namespace and target in turn, and for
+// the remote port, completing each from what kubectl lists.
+const kubectlBackend = "k8s"
+
+// kubectlTimeout bounds the kubectl calls behind the wizard's completion.
+const kubectlTimeout = 10 * time.Second
+
+type kubectlPortForward struct{}
+
+func (kubectlPortForward) Name() string { return kubectlBackend }
+
+func (kubectlPortForward) Command(spec tunnelSpec, forwardPort string, pre precheckMsg, pol policy) *exec.Cmd {
+	t, _ := parseKubeTarget(spec.Host)
+	args := append(t.flags(), "port-forward", "--address", "127.0.0.1", t.resource, forwardPort+":"+spec.RemotePort)
+	return exec.Command("kubectl", args...)
+}
+
+// kubeTarget is a k8s tunnel's host taken apart.
+type kubeTarget struct {
+	context   string // "" for kubectl's current context
+	namespace string
+	resource  string // svc/postgres, deploy/api or pod/api-7d9c-x2x4
+}
+
+var (
+	kubeNameRe     = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	kubeResourceRe = regexp.MustCompile(`^(svc|deploy|pod)/[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+)
+
+func parseKubeTarget(host string) (kubeTarget, error) {
+	target, kubeContext, _ := strings.Cut(host, "@")
+	namespace, resource, _ := strings.Cut(target, "/")
+	if !kubeNameRe.MatchString(namespace) || !kubeResourceRe.MatchString(resource) {
+		return kubeTarget{}, fmt.Errorf("k8s target %q must be namespace/kind/name[@context] with kind svc, deploy or pod, e.g. shop/svc/postgres@prod", host)
+	}
+	return kubeTarget{context: kubeContext, namespace: namespace, resource: resource}, nil
+}
+
+func (t kubeTarget) String() string {
+	s := t.namespace + "/" + t.resource
+	if t.context != "" {
+		s += "@" + t.context
+	}
+	return s
+}
+
+// flags selects the target's context and namespace on the kubectl command
+// line.
+func (t kubeTarget) flags() []string {
+	var args []string
+	if t.context != "" {
+		args = append(args, "--context", t.context)
+	}
+	if t.namespace != "" {
+		args = append(args, "--namespace", t.namespace)
+	}
+	return args
+}
+
+// kubeChoicesMsg carries what kubectl listed for a wizard step: contexts,
+// namespaces, targets or ports. prefill is the current context, for the
+// context step to start with.
+type kubeChoicesMsg struct {
+	step    tunnelStep
+	target  kubeTarget
+	choices []string
+	prefill string
+	err     error
+}
+
+// kubeChoicesCmd asks kubectl what step can complete to, given what the
+// wizard has of target so far.
+func kubeChoicesCmd(step tunnelStep, target kubeTarget) tea.Cmd {
+	return func() tea.Msg {
+		msg := kubeChoicesMsg{step: step, target: target}
+		var out string
+		switch step {
+		case stepKubeContext:
+			msg.prefill, _ = runKubectl("config", "current-context")
+			out, msg.err = runKubectl("config", "get-contexts", "--output", "name")
+		case stepKubeNamespace:
+			out, msg.err = runKubectl(append(kubeTarget{context: target.context}.flags(), "get", "namespaces", "--output", "name")...)
+		case stepKubeTarget:
+			out, msg.err = runKubectl(append(target.flags(), "get", "services,deployments,pods", "--output", "name")...)
+		case stepRemotePort:
+			path := "{.spec.containers[*].ports[*].containerPort}"
+			switch {
+			case strings.HasPrefix(target.resource, "svc/"):
+				path = "{.spec.ports[*].port}"
+			case strings.HasPrefix(target.resource, "deploy/"):
+				path = "{.spec.template.spec.containers[*].ports[*].containerPort}"
+			}
+			out, msg.err = runKubectl(append(target.flags(), "get", target.resource, "--output", "jsonpath="+path)...)
+		}
+		// kubectl names resources kind/name with the long kind, e.g.
+		// service/postgres and deployment.apps/api
+		r := strings.NewReplacer("namespace/", "", "service/", "svc/", "deployment.apps/", "deploy/")
+		for _, choice := range strings.Fields(out) {
+			if choice = r.Replace(choice); !slices.Contains(msg.choices, choice) {
+				msg.choices = append(msg.choices, choice)
+			}
+		}
+		return msg
+	}
+}
+
+func runKubectl(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubectlTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "kubectl", args...).Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		if line := lastLine(string(ee.Stderr)); line != "" {
+			err = fmt.Errorf("%s", line)
+		}
+	}
+	return strings.TrimSpace(string(out)), err
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// toKubeStep moves the wizard to one of the k8s steps and asks kubectl
+// for its choices. Demo mode has no cluster to ask.
+func (m model) toKubeStep(step tunnelStep, input string) (tea.Model, tea.Cmd) {
+	m.step = step
+	m.setInput(input)
+	m.err = nil
+	delete(m.kubeChoices, step)
+	if m.demo {
+		return m, nil
+	}
+	return m, kubeChoicesCmd(step, m.tempKube)
+}
+
+// startKube begins the k8s steps after the backend was picked.
+func (m model) startKube() (tea.Model, tea.Cmd) {
+	if _, err := exec.LookPath("kubectl"); err != nil && !m.demo {
+		m.err = fmt.Errorf("the k8s backend needs kubectl on the PATH")
+		return m, nil
+	}
+	m.tempBackend = kubectlBackend
+	m.tempType = ""
+	m.tempKube = kubeTarget{}
+	m.kubeChoices = make(map[tunnelStep]kubeChoicesMsg)
+	return m.toKubeStep(stepKubeContext, "")
+}
+
+// kubeChoicesArrived records what kubectl listed, unless the wizard has
+// moved on to another target since it asked.
+func (m model) kubeChoicesArrived(msg kubeChoicesMsg) (tea.Model, tea.Cmd) {
+	if m.tempBackend != kubectlBackend || m.kubeChoices == nil || msg.target != m.tempKube {
+		return m, nil
+	}
+	m.kubeChoices[msg.step] = msg
+	if m.step != msg.step {
+		return m, nil
+	}
+	m.input.SetSuggestions(msg.choices)
+	if msg.prefill != "" && m.input.Value() == "" {
+		m.setInput(msg.prefill)
+		m.input.SetSuggestions(msg.choices)
+	}
+	return m, nil
+}
+
+// handleKubeEnter takes the value of a k8s step.
+func (m model) handleKubeEnter() (tea.Model, tea.Cmd) {
+	value := strings.TrimSpace(m.input.Value())
+	switch m.step {
+	case stepKubeContext:
+		m.tempKube.context = value
+		return m.toKubeStep(stepKubeNamespace, "default")
+	case stepKubeNamespace:
+		if !kubeNameRe.MatchString(value) {
+			m.err = fmt.Errorf("%q is not a namespace name", value)
+			return m, nil
+		}
+		m.tempKube.namespace = value
+		return m.toKubeStep(stepKubeTarget, "")
+	}
+
+	if !kubeResourceRe.MatchString(value) {
+		m.err = fmt.Errorf("%q is not svc/<name>, deploy/<name> or pod/<name>", value)
+		return m, nil
+	}
+	m.tempKube.resource = value
+	m.tempHost = m.tempKube.String()
+	if err := m.policy.checkHost(m.tempHost); err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.err = nil
+	m.setInput("")
+	m.toPortStep()
+	if m.demo {
+		return m, nil
+	}
+	// Ask for the ports now, so they are there once the templates are left
+	return m, kubeChoicesCmd(stepRemotePort, m.tempKube)
+}
+
+// renderKubeStep draws the context, namespace and target steps.
+func (m model) renderKubeStep() string {
+	var content string
+	label := map[tunnelStep]string{stepKubeContext: "Context", stepKubeNamespace: "Namespace", stepKubeTarget: "Target"}[m.step]
+	if m.step != stepKubeContext {
+		content += "Context: " + selectedStyle.Render(orNone(m.tempKube.context, "current")) + "\n"
+	}
+	if m.step == stepKubeTarget {
+		content += "Namespace: " + selectedStyle.Render(m.tempKube.namespace) + "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	content += label + ": " + m.inputView()
+	content += "\n\n" + m.kubeChoicesView(m.step)
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	hint := "Tab completes • ↑/↓ for the other matches • Esc to cancel"
+	if m.step == stepKubeContext {
+		hint = "Empty for kubectl's current context • " + hint
+	}
+	return content + "\n\n" + subtleStyle.Render(hint)
+}
+
+// kubeChoicesView lists the choices for step that match what is typed,
+// or says why there are none.
+func (m model) kubeChoicesView(step tunnelStep) string {
+	listed, ok := m.kubeChoices[step]
+	choices := listed.choices
+	switch {
+	case listed.err != nil:
+		return subtleStyle.Render("No completion: " + listed.err.Error())
+	case !ok && !m.demo:
+		return subtleStyle.Render("Asking kubectl...")
+	case len(choices) == 0:
+		return subtleStyle.Render("Nothing to complete")
+	}
+
+	// A partial value narrows the list to what Tab would complete it to
+	in := m.input
+	current := in.Value()
+	if current != "" && !slices.Contains(choices, current) {
+		choices, current = in.MatchedSuggestions(), in.CurrentSuggestion()
+	}
+	var lines []string
+	for _, c := range choices[:min(len(choices), maxKubeChoices)] {
+		if c == current {
+			lines = append(lines, selectedStyle.Render("  ▶  "+c))
+		} else {
+			lines = append(lines, "     "+c)
+		}
+	}
+	if more := len(choices) - maxKubeChoices; more > 0 {
+		lines = append(lines, subtleStyle.Render(fmt.Sprintf("     and %d more", more)))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+const maxKubeChoices = 8
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// tunnelSummary is the read-only view of a tunnel shared with goroutines
+// outside the Bubbletea loop, such as the landing page server.
+type tunnelSummary struct {
+	Tag        string `json:"tag"`
+	Host       string `json:"host"`
+	LocalPort  string `json:"local_port"`
+	RemotePort string `json:"remote_port"`
+	RemoteHost string `json:"remote_host,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Active     bool   `json:"active"`
+	Degraded   bool   `json:"degraded,omitempty"` // up, but failing its health check
+
+	Forwards []forwardSpec `json:"forwards,omitempty"`
+}
+
+// Ports shows the ports and which way the tunnel forwards.
+func (s tunnelSummary) Ports() string {
+	return tunnelSpec{Type: s.Type, LocalPort: s.LocalPort, RemotePort: s.RemotePort, RemoteHost: s.RemoteHost, Forwards: s.Forwards}.ports()
+}
+
+// URL is the address to open for web tunnels, empty for anything else.
+func (s tunnelSummary) URL() string {
+	if s.Type == "remote" {
+		return ""
+	}
+	switch s.Protocol {
+	case "http":
+		return "http://localhost:" + s.LocalPort + "/"
+	case "tls":
+		return "https://localhost:" + s.LocalPort + "/"
+	}
+	return ""
+}
+
+// ConnectionString is a ready-to-paste way to reach the forwarded service.
+func (s tunnelSummary) ConnectionString() string {
+	switch s.Type {
+	case "remote":
+		// Exposed on the host, not here
+		return s.Host + ":" + s.RemotePort
+	case "socks":
+		return "socks5h://localhost:" + s.LocalPort
+	}
+	switch s.Protocol {
+	case "pg":
+		return fmt.Sprintf(`psql "postgresql://localhost:%s/"`, s.LocalPort)
+	case "mysql":
+		return "mysql -h 127.0.0.1 -P " + s.LocalPort
+	case "redis":
+		return "redis-cli -p " + s.LocalPort
+	case "ssh":
+		return "ssh -p " + s.LocalPort + " localhost"
+	case "http", "tls":
+		return s.URL()
+	}
+	return "localhost:" + s.LocalPort
+}
+
+// landingPage serves a small page listing the active tunnels, for people
+// who'd rather click a link than use the TUI.
+type landingPage struct {
+	mu      sync.Mutex
+	tunnels []tunnelSummary
+}
+
+func (p *landingPage) publish(tunnels []tunnelSummary) {
+	p.mu.Lock()
+	p.tunnels = tunnels
+	p.mu.Unlock()
+}
+
+func (p *landingPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	p.mu.Lock()
+	var active []tunnelSummary
+	for _, t := range p.tunnels {
+		if t.Active {
+			active = append(active, t)
+		}
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	landingTemplate.Execute(w, struct {
+		Version string
+		Tunnels []tunnelSummary
+	}{Version, active})
+}
+
+// serveLandingPage binds addr right away, so a taken port is reported at
+// startup, and serves the page in the background.
+func serveLandingPage(addr string, page *landingPage) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("landing page: %w", err)
+	}
+	go http.Serve(ln, page)
+	return nil
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>SSH Tunnel Manager</title>
+<style>
+  body { background: #282C34; color: #ABB2BF; font-family: ui-monospace, monospace; margin: 2em; }
+  h1 { color: #61AFEF; font-size: 1.2em; }
+  table { border-collapse: collapse; }
+  th { color: #5C6370; text-align: left; }
+  th, td { padding: .4em 1em; border-bottom: 1px solid #3E4451; }
+  a { color: #98C379; }
+  code { color: #E5C07B; }
+  button { background: #3E4451; color: #ABB2BF; border: 0; cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>SSH TUNNEL MANAGER <small>v{{.Version}}</small></h1>
+{{if .Tunnels}}
+<table>
+<tr><th>Tag</th><th>Host</th><th>Ports</th><th>Connect</th></tr>
+{{range .Tunnels}}
+<tr>
+  <td>{{.Tag}}</td>
+  <td>{{.Host}}</td>
+  <td>{{.Ports}}</td>
+  <td>{{if .URL}}<a href="{{.URL}}">{{.URL}}</a>{{else}}<code>{{.ConnectionString}}</code>
+    <button onclick="navigator.clipboard.writeText(this.previousElementSibling.textContent)">copy</button>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No active tunnels.</p>
+{{end}}
+</body>
+</html>
+`))
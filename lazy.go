@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// On-demand tunnels keep many tunnels at hand without an ssh session each.
+// The manager listens on the local port itself and starts the tunnel's
+// ssh (or backend) only when the first client connects, relaying to it
+// once it is up. After lazy_idle with no connections it disconnects again
+// and goes back to listening. The checks of the first start are reused
+// for every connection, and as what runs comes and goes, on-demand
+// tunnels take no prep command, health check, local TLS or additional
+// forwards.
+
+const (
+	defaultLazyIdle = 5 * time.Minute
+	minLazyIdle     = 30 * time.Second
+	// lazyConnectWait is how long a client waits for the tunnel to come up.
+	lazyConnectWait = 30 * time.Second
+	// lazyRetryDelay keeps a tunnel that failed to come up from being
+	// started again and again by clients that are still waiting.
+	lazyRetryDelay = 5 * time.Second
+)
+
+func (c config) lazyIdle() time.Duration {
+	d, err := time.ParseDuration(c.LazyIdle)
+	if err != nil {
+		return defaultLazyIdle
+	}
+	return max(d, minLazyIdle)
+}
+
+func (s tunnelSpec) checkLazy() error {
+	if !s.Lazy {
+		return nil
+	}
+	switch {
+	case s.Type == "remote":
+		return fmt.Errorf("lazy needs a local forward or SOCKS proxy, whose port the manager can listen on")
+	case s.TLSMode != "":
+		return fmt.Errorf("lazy tunnels cannot use local TLS")
+	case s.Prep != "":
+		return fmt.Errorf("lazy tunnels cannot run a prep command")
+	case s.HealthCheck != "":
+		return fmt.Errorf("lazy tunnels cannot take a health check, which would keep them connected")
+	case len(s.Forwards) > 0:
+		return fmt.Errorf("lazy tunnels cannot have additional forwards")
+	}
+	return nil
+}
+
+// lazyListener holds an on-demand tunnel's local port and relays its
+// connections to the internal port the tunnel forwards while it is up.
+type lazyListener struct {
+	ln    net.Listener
+	pre   precheckMsg   // what the checks of the first start found
+	wake  chan struct{} // a client is waiting for the tunnel
+	done  chan struct{}
+	once  sync.Once
+	bytes atomic.Uint64
+	conns atomic.Int64
+
+	mu       sync.Mutex
+	upstream string      // the internal port, "" while asleep
+	ready    func() bool // nil when the port answering is enough
+}
+
+func listenLazy(port string, pre precheckMsg) (*lazyListener, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		return nil, err
+	}
+	return &lazyListener{ln: ln, pre: pre, wake: make(chan struct{}, 1), done: make(chan struct{})}, nil
+}
+
+func (l *lazyListener) Close() {
+	l.once.Do(func() {
+		close(l.done)
+		l.ln.Close()
+	})
+}
+
+// setUpstream points the listener at the tunnel that just came up, or
+// back at nothing.
+func (l *lazyListener) setUpstream(port string, ready func() bool) {
+	l.mu.Lock()
+	l.upstream, l.ready = port, ready
+	l.mu.Unlock()
+	if port == "" {
+		// Clients still waiting ask again
+		select {
+		case <-l.wake:
+		default:
+		}
+	}
+}
+
+func (l *lazyListener) upstreamPort() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ready != nil && !l.ready() {
+		return ""
+	}
+	return l.upstream
+}
+
+func (l *lazyListener) serve(logf func(string)) {
+	go func() {
+		defer recoverPanic("lazy listener")
+		for {
+			client, err := l.ln.Accept()
+			if err != nil {
+				return
+			}
+			go l.relay(client, logf)
+		}
+	}()
+}
+
+// relay waits for the tunnel to be up, waking it, then copies both ways.
+func (l *lazyListener) relay(client net.Conn, logf func(string)) {
+	defer recoverPanic("lazy relay")
+	defer client.Close()
+	l.conns.Add(1)
+	defer l.conns.Add(-1)
+
+	var upstream net.Conn
+	deadline := time.Now().Add(lazyConnectWait)
+	for upstream == nil {
+		if port := l.upstreamPort(); port != "" {
+			upstream, _ = net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), time.Second)
+		} else {
+			select {
+			case l.wake <- struct{}{}:
+			default:
+			}
+		}
+		if upstream != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			logf(fmt.Sprintf("Dropped a connection: the tunnel did not come up within %s", lazyConnectWait))
+			return
+		}
+		select {
+		case <-l.done:
+			return
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		countedCopy(upstream, client, &l.bytes)
+		wg.Done()
+	}()
+	go func() {
+		countedCopy(client, upstream, &l.bytes)
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+// lazyWakeMsg says a client connected to a sleeping tunnel.
+type lazyWakeMsg struct {
+	tunnelID int
+	lazy     *lazyListener
+}
+
+// lazyWaitCmd waits for a client, after delay.
+func lazyWaitCmd(tunnelID int, l *lazyListener, delay time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case <-time.After(delay):
+		case <-l.done:
+			return nil
+		}
+		select {
+		case <-l.wake:
+			return lazyWakeMsg{tunnelID: tunnelID, lazy: l}
+		case <-l.done:
+			return nil
+		}
+	}
+}
+
+// startLazy lists spec as a sleeping tunnel listening on its local port.
+func (m *model) startLazy(spec tunnelSpec, pre precheckMsg, tunnelID, slot int) (tea.Cmd, error) {
+	l, err := listenLazy(spec.LocalPort, pre)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("lazy tunnel listening", "tunnel", tunnelID, "tag", spec.Tag, "host", spec.Host, "local_port", spec.LocalPort)
+	t := newTunnel(tunnelID, spec)
+	t.endpoint = pre.endpoint
+	t.lazy, t.active, t.sleeping = l, true, true
+	t.armClose()
+	t = m.placeTunnel(t, slot, []string{fmt.Sprintf("[%s] On demand: listening on 127.0.0.1:%s, connecting to %s on first use", time.Now().Format("15:04:05"), spec.LocalPort, spec.Host)})
+	logf := m.logSink.writer(t.id)
+	t.hookLog = logf
+	l.serve(logf)
+	return lazyWaitCmd(t.id, l, 0), nil
+}
+
+// wakeLazy starts a sleeping tunnel for the client that connected.
+func (m model) wakeLazy(msg lazyWakeMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || t.lazy != msg.lazy || !t.sleeping {
+		return m, nil
+	}
+	slog.Info("lazy tunnel woken", t.logAttrs()...)
+	t.appendLog("A client connected, connecting to " + t.host)
+	cmd, err := m.startTunnel(t.spec(), msg.lazy.pre, nil, t.id)
+	if err != nil {
+		slog.Warn("cannot wake lazy tunnel", append(t.logAttrs(), "err", err)...)
+		t.appendLog("Cannot connect: " + err.Error())
+		return m, lazyWaitCmd(t.id, t.lazy, lazyRetryDelay)
+	}
+	return m, cmd
+}
+
+// sleep disconnects an on-demand tunnel and leaves its listener waiting
+// for the next client.
+func (t *tunnel) sleep() {
+	l := t.lazy
+	l.setUpstream("", nil)
+	t.lazy = nil
+	t.stop()
+	// Its exit is expected now
+	t.cmd = nil
+	t.lazy, t.active, t.sleeping = l, true, true
+}
+
+// sleepIdle puts the tunnels that had no connection for lazy_idle to
+// sleep.
+func (m *model) sleepIdle(now time.Time) []tea.Cmd {
+	var cmds []tea.Cmd
+	idle := m.cfg.lazyIdle()
+	for _, t := range m.tunnels {
+		if t.lazy == nil || t.sleeping || t.restarting || t.lazy.conns.Load() > 0 || now.Sub(t.idleSince) < idle {
+			continue
+		}
+		slog.Info("lazy tunnel idle", t.logAttrs()...)
+		t.sleep()
+		t.appendLog(fmt.Sprintf("No connections for %s, disconnected until the next one", fmtUptime(idle)))
+		cmds = append(cmds, lazyWaitCmd(t.id, t.lazy, 0))
+	}
+	return cmds
+}
+
+// lazyStatus is the detail panel's line for an on-demand tunnel.
+func (t *tunnel) lazyStatus(idle time.Duration) string {
+	if t.sleeping {
+		return "asleep, connects when a client connects to 127.0.0.1:" + t.localPort
+	}
+	return fmt.Sprintf("connected, %d open • disconnects after %s without connections", t.lazy.conns.Load(), fmtUptime(idle))
+}
+
+// canBeLazy reports whether the tunnel can connect on demand.
+func (s tunnelSpec) canBeLazy() bool {
+	s.Lazy = true
+	return s.checkLazy() == nil
+}
+
+// toLazyStep asks whether to connect on demand, for the tunnels that can.
+func (m *model) toLazyStep() {
+	if !m.tempSpec().canBeLazy() {
+		m.tempLazy = false
+		m.toReview()
+		return
+	}
+	m.step = stepLazy
+	m.setInput("")
+	m.err = nil
+}
+
+func (m model) renderLazyStep() string {
+	return "Connect on demand? " + subtleStyle.Render("(y/n or just Enter for no)") +
+		"\n\n" + subtleStyle.Render(fmt.Sprintf("The manager listens on the local port and connects when a client does, disconnecting after %s without connections", fmtUptime(m.cfg.lazyIdle())))
+}
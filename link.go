@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Compression and ciphers tune a tunnel for a slow link. Over a
+// high-latency or narrow connection, ssh -C compresses what the tunnel
+// carries (worth it for text such as SQL results or JSON, not for what is
+// already compressed), and a cipher such as aes128-gcm@openssh.com, with
+// AES in hardware on both ends, or chacha20-poly1305@openssh.com, on small
+// machines without it, keeps the CPU from being the bottleneck. The config
+// sets the defaults, a tunnel its own. The built-in client takes the
+// ciphers but does not compress.
+
+// sshCiphers are the ciphers a tunnel can ask for, those that both OpenSSH
+// and the built-in client speak.
+var sshCiphers = []string{
+	"chacha20-poly1305@openssh.com",
+	"aes128-gcm@openssh.com",
+	"aes256-gcm@openssh.com",
+	"aes128-ctr",
+	"aes192-ctr",
+	"aes256-ctr",
+}
+
+// parseCiphers checks a comma-separated list of ciphers, the preferred
+// first, and returns it without spaces or repeats.
+func parseCiphers(s string) (string, error) {
+	var ciphers []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" || slices.Contains(ciphers, c) {
+			continue
+		}
+		if !slices.Contains(sshCiphers, c) {
+			return "", fmt.Errorf("unknown cipher %q, expected one of %s", c, strings.Join(sshCiphers, ", "))
+		}
+		ciphers = append(ciphers, c)
+	}
+	return strings.Join(ciphers, ","), nil
+}
+
+// cipherSuggestions completes the last cipher of a list being typed.
+func cipherSuggestions(typed string) []string {
+	done, _ := cutLast(typed, ",")
+	var suggestions []string
+	for _, c := range sshCiphers {
+		if !slices.Contains(strings.Split(done, ","), c) {
+			suggestions = append(suggestions, done+c)
+		}
+	}
+	return suggestions
+}
+
+// cutLast splits s at its last sep, keeping sep on the left: "a,b,c" is
+// "a,b," and "c".
+func cutLast(s, sep string) (string, string) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return "", s
+	}
+	return s[:i+len(sep)], s[i+len(sep):]
+}
+
+// compressed reports whether the spec asks ssh to compress.
+func (s tunnelSpec) compressed() bool {
+	return s.Compression != nil && *s.Compression
+}
+
+// linkArgs are ssh's options for the spec's compression and ciphers.
+func (s tunnelSpec) linkArgs() []string {
+	var args []string
+	if s.compressed() {
+		args = append(args, "-C")
+	}
+	if s.Ciphers != "" {
+		args = append(args, "-c", s.Ciphers)
+	}
+	return args
+}
+
+// withLink fills in the config's compression and ciphers when the spec
+// has none of its own. Compression is left off for the built-in client.
+func (c config) withLink(spec tunnelSpec) tunnelSpec {
+	if !usesSSH(spec.Backend) {
+		return spec
+	}
+	if spec.Compression == nil && c.Compression && spec.Backend == "" && c.SSHTransport != nativeBackend {
+		on := true
+		spec.Compression = &on
+	}
+	if spec.Ciphers == "" {
+		spec.Ciphers = c.Ciphers
+	}
+	return spec
+}
+
+// link shows the compression and ciphers of a spec with the config's
+// filled in, for the detail panel and the tunnel's log; "" when neither is
+// set.
+func (s tunnelSpec) link() string {
+	var parts []string
+	if s.compressed() {
+		parts = append(parts, "compressed (ssh -C)")
+	}
+	if s.Ciphers != "" {
+		parts = append(parts, "ciphers "+strings.ReplaceAll(s.Ciphers, ",", ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// compressionSetting shows the spec's own compression, if any.
+func (s tunnelSpec) compressionSetting() string {
+	if s.Compression == nil {
+		return "default"
+	}
+	if *s.Compression {
+		return "on"
+	}
+	return "off"
+}
+
+// toLinkSteps asks for compression and ciphers after the verbose logs, for
+// the tunnels that take them: both for ssh, the ciphers for the built-in
+// client.
+func (m *model) toLinkSteps() {
+	switch {
+	case m.tempBackend == "" && m.cfg.SSHTransport != nativeBackend:
+		m.step = stepCompression
+		m.err = nil
+	case usesSSH(m.tempBackend):
+		m.toCiphersStep()
+	default:
+		m.toCloseSteps()
+	}
+}
+
+func (m *model) toCiphersStep() {
+	m.step = stepCiphers
+	m.setInput(m.tempCiphers)
+	m.err = nil
+}
+
+// renderLinkStep draws the compression and ciphers steps.
+func (m model) renderLinkStep() string {
+	if m.step == stepCompression {
+		def := "off"
+		if m.cfg.Compression {
+			def = "on"
+		}
+		return "Compress the connection (ssh -C)? " + subtleStyle.Render("(y/n or just Enter for the default, "+def+")") +
+			"\n\n" + subtleStyle.Render("Helps on slow links with text such as SQL results or JSON, not with what is already compressed")
+	}
+	content := "Ciphers, the preferred first:\n\n" + m.inputView()
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	def := "ssh's"
+	if m.cfg.Ciphers != "" {
+		def = m.cfg.Ciphers
+	}
+	return content + "\n\n" + subtleStyle.Render("Tab completes, e.g. aes128-gcm@openssh.com with AES in hardware, chacha20-poly1305@openssh.com without • Empty for the default ("+def+")")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// Compact mode lists each tunnel on a single line instead of three and a
+// blank one: its status, tag, host, ports and uptime, cut to the sidebar's
+// width. That fits four times as many tunnels on a small terminal. z
+// switches between the two, and state.json keeps the choice.
+
+// listTop is how far below the sidebar's top border the first item is:
+// the padding, the title and the blank lines under it.
+const listTop = 4
+
+func (m *model) toggleCompact() {
+	m.compact = !m.compact
+	m.tunnelList.SetDelegate(tunnelDelegate{compact: m.compact})
+	m.syncSelection()
+	if m.compact {
+		m.statusMessage = "Compact list, one line per tunnel"
+	} else {
+		m.statusMessage = "Full list, three lines per tunnel"
+	}
+}
+
+func (d tunnelDelegate) renderCompact(w io.Writer, m list.Model, index int, listItem list.Item) {
+	var line string
+	switch item := listItem.(type) {
+	case groupHeader:
+		line = item.title() + " " + item.description()
+	case *tunnel:
+		line = item.tag
+		if item.marked {
+			line = "✓ " + line
+		}
+		if item.quick != "" {
+			line = item.quick + " " + line
+		}
+		line = fmt.Sprintf("%s %s  %s %s", item.statusDot(), line, item.host,
+			forwardPorts(item.tunnelType, item.localPort, remoteEnd(item.remoteHost, item.remotePort)))
+		if since := item.upSince(); !since.IsZero() {
+			line += "  " + fmtUptime(time.Since(since))
+		}
+	default:
+		return
+	}
+	style := subtleStyle
+	if _, ok := listItem.(groupHeader); ok {
+		style = highlightStyle
+	}
+	prefix := "  "
+	if t, ok := listItem.(*tunnel); ok {
+		prefix = t.gutter()
+	}
+	// The ▶ goes after the gutter, keeping the color label when selected
+	if index == m.Index() {
+		style, line = selectedStyle, "▶ "+line
+	}
+	fmt.Fprint(w, prefix+style.MaxWidth(m.Width()-2).Render(line))
+}
+
+// listRowAt is the row of the tunnel list at y lines below the sidebar's
+// top border, or -1 for none.
+func (m model) listRowAt(y int) int {
+	d := tunnelDelegate{compact: m.compact}
+	step := d.Height() + d.Spacing()
+	if y < listTop || (y-listTop)%step >= d.Height() {
+		return -1
+	}
+	p := m.tunnelList.Paginator
+	row := p.Page*p.PerPage + (y-listTop)/step
+	if row >= len(m.listRows) || (y-listTop)/step >= p.ItemsOnPage(len(m.listRows)) {
+		return -1
+	}
+	return row
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// List filter: / in the tunnel list types a filter that narrows the list
+// to the tunnels whose tag, host or ports contain it, as typed. Enter
+// keeps it while the list is used as usual, and Esc clears it. Like the
+// log search it is smart-case. A group shows its heading only while one
+// of its tunnels matches, folded or not.
+
+// matches reports whether the tunnel is in the list filtered by filter.
+func (t *tunnel) matches(filter string) bool {
+	return filter == "" || logMatchRanges(t.FilterValue(), filter) != nil
+}
+
+func (m model) handleListFilterKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.listFiltering = false
+		m.listFilter = ""
+	case "enter":
+		m.listFiltering = false
+	case "backspace":
+		if r := []rune(m.listFilter); len(r) > 0 {
+			m.listFilter = string(r[:len(r)-1])
+		}
+	case " ":
+		m.listFilter += " "
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.listFilter += string(msg.Runes)
+		}
+	}
+	m.updateTunnelList()
+	return m, nil
+}
+
+// listTitle heads the tunnel list or the dashboard with name, its sort
+// mode, the filter and how many tunnels the filter lets through.
+func (m model) listTitle(name string) string {
+	title := name
+	if m.listSort != sortCreated {
+		title += " ↕" + m.listSort.String()
+	}
+	if !m.listFiltering && m.listFilter == "" {
+		return title
+	}
+	title += " /" + m.listFilter
+	if m.listFiltering {
+		title += "█"
+	}
+	shown := 0
+	for _, t := range m.tunnels {
+		if t.matches(m.listFilter) {
+			shown++
+		}
+	}
+	return title + fmt.Sprintf(" %d/%d", shown, len(m.tunnels))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// The tunnel list is in the order the tunnels were created, or sorted by
+// tag, host, status or uptime: = goes through the modes, the sidebar title
+// shows the one in use and state.json keeps it. Groups keep their place,
+// and their members are sorted among themselves. Ties keep the creation
+// order. The order follows the tunnels as they are added, started and
+// stopped, and is brought up to date once a minute with the uptimes.
+
+type sortMode int
+
+const (
+	sortCreated sortMode = iota
+	sortTag
+	sortHost
+	sortStatus
+	sortUptime
+)
+
+var sortNames = []string{"created", "tag", "host", "status", "uptime"}
+
+func (s sortMode) String() string { return sortNames[s] }
+
+// parseSortMode reads a mode from state.json, the creation order for one
+// it does not know.
+func parseSortMode(name string) sortMode {
+	if i := slices.Index(sortNames, name); i >= 0 {
+		return sortMode(i)
+	}
+	return sortCreated
+}
+
+// statusRank puts the tunnels that need a look first: degraded, then down,
+// scheduled, sleeping and up.
+func (t *tunnel) statusRank() int {
+	switch {
+	case t.degraded():
+		return 0
+	case t.sleeping:
+		return 3
+	case t.active:
+		return 4
+	case !t.restarting && !t.nextStart.IsZero():
+		return 2
+	default:
+		return 1
+	}
+}
+
+// sortTunnels orders the indexes of m.tunnels in idx by the list's mode.
+func (m model) sortTunnels(idx []int) {
+	compare := func(a, b *tunnel) int { return 0 }
+	switch m.listSort {
+	case sortTag:
+		compare = func(a, b *tunnel) int {
+			return cmp.Compare(strings.ToLower(a.tag), strings.ToLower(b.tag))
+		}
+	case sortHost:
+		compare = func(a, b *tunnel) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.host), strings.ToLower(b.host)),
+				cmp.Compare(strings.ToLower(a.tag), strings.ToLower(b.tag)))
+		}
+	case sortStatus:
+		compare = func(a, b *tunnel) int { return cmp.Compare(a.statusRank(), b.statusRank()) }
+	case sortUptime:
+		// Up the longest first, down last
+		compare = func(a, b *tunnel) int {
+			sa, sb := a.upSince(), b.upSince()
+			switch {
+			case sa.IsZero() && sb.IsZero():
+				return 0
+			case sa.IsZero():
+				return 1
+			case sb.IsZero():
+				return -1
+			}
+			return sa.Compare(sb)
+		}
+	}
+	slices.SortStableFunc(idx, func(a, b int) int { return compare(m.tunnels[a], m.tunnels[b]) })
+}
+
+// cycleSort switches the list to the next sort mode.
+func (m *model) cycleSort() {
+	m.listSort = (m.listSort + 1) % sortMode(len(sortNames))
+	m.updateTunnelList()
+	m.statusMessage = "Tunnels sorted by " + m.listSort.String()
+	if m.listSort == sortCreated {
+		m.statusMessage = "Tunnels in the order they were created"
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+const defaultLogMemoryMB = 8
+
+// logLineOverhead approximates what a retained line costs beyond its text
+// (the string header in the slice).
+const logLineOverhead = 16
+
+func logLineSize(line string) int { return len(line) + logLineOverhead }
+
+// logMemoryLimit is the byte budget shared by all tunnel logs.
+func (m model) logMemoryLimit() int {
+	mb := m.cfg.LogMemoryMB
+	if mb == 0 {
+		mb = defaultLogMemoryMB
+	}
+	return mb << 20
+}
+
+// logMemoryUsed sums what the tunnel logs currently retain.
+func (m model) logMemoryUsed() int {
+	total := 0
+	for i := range m.tunnels {
+		total += m.tunnels[i].logBytes
+	}
+	return total
+}
+
+// enforceLogLimit trims tunnel logs back under the global limit. It is
+// fair: quiet tunnels keep everything, and the noisy ones are cut down to
+// an equal share of what is left, dropping their oldest lines first.
+func (m *model) enforceLogLimit() {
+	limit := m.logMemoryLimit()
+	used := make([]int, len(m.tunnels))
+	total := 0
+	for i := range m.tunnels {
+		used[i] = m.tunnels[i].logBytes
+		total += used[i]
+	}
+	if total <= limit {
+		return
+	}
+
+	// Find the share: walk the tunnels from smallest to largest, letting
+	// each keep its logs while it fits in an even split of the remainder
+	sorted := append([]int(nil), used...)
+	sort.Ints(sorted)
+	share, remaining := 0, limit
+	for i, u := range sorted {
+		share = remaining / (len(sorted) - i)
+		if u > share {
+			break
+		}
+		remaining -= u
+	}
+
+	for i := range m.tunnels {
+		if used[i] > share {
+			m.tunnels[i].trimLogs(share)
+		}
+	}
+}
+
+// trimLogs drops the oldest lines until the log fits in maxBytes. When the
+// app log is enabled, the dropped lines are written there instead of lost.
+func (t *tunnel) trimLogs(maxBytes int) {
+	n := 0
+	for n < t.logs.len() && t.logBytes > maxBytes {
+		t.logBytes -= logLineSize(t.logs.at(n))
+		n++
+	}
+	dropped := t.logs.dropOldest(n)
+	t.logSeq++
+
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		for _, line := range dropped {
+			slog.Info("log line evicted", append(t.logAttrs(), "line", line)...)
+		}
+	}
+}
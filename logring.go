@@ -0,0 +1,94 @@
+package main
+
+// A tunnel's log is a ring of its latest lines, log_lines of them (10000
+// by default). The buffer grows up to that size and from then on the
+// newest line takes the oldest one's place, so a chatty ssh -v costs no
+// reallocation or copying per line. Lines are read by index, and the log
+// panels render only those on screen, whatever the size of the log.
+
+const defaultLogLines = 10000
+
+// logLines is how many lines each tunnel keeps.
+func (c config) logLines() int {
+	if c.LogLines == 0 {
+		return defaultLogLines
+	}
+	return c.LogLines
+}
+
+type logRing struct {
+	buf   []string
+	start int // where the oldest line is once buf is full
+	limit int // 0 for defaultLogLines
+}
+
+func newLogRing(limit int) logRing {
+	return logRing{limit: limit}
+}
+
+func (r *logRing) len() int { return len(r.buf) }
+
+// at is the i-th line, oldest first.
+func (r *logRing) at(i int) string {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+// push adds line, returning the oldest line if it had to make room.
+func (r *logRing) push(line string) (string, bool) {
+	if r.limit == 0 {
+		r.limit = defaultLogLines
+	}
+	if len(r.buf) < r.limit {
+		r.buf = append(r.buf, line)
+		return "", false
+	}
+	oldest := r.buf[r.start]
+	r.buf[r.start] = line
+	r.start = (r.start + 1) % len(r.buf)
+	return oldest, true
+}
+
+// slice copies lines from up to to.
+func (r *logRing) slice(from, to int) []string {
+	lines := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		lines = append(lines, r.at(i))
+	}
+	return lines
+}
+
+// lines copies every line, oldest first.
+func (r *logRing) lines() []string {
+	return r.slice(0, r.len())
+}
+
+// dropOldest removes the n oldest lines and returns them. The rest is
+// copied rather than resliced, so the dropped strings can be collected.
+func (r *logRing) dropOldest(n int) []string {
+	dropped := r.slice(0, n)
+	r.buf, r.start = r.slice(n, r.len()), 0
+	return dropped
+}
+
+// logWindow is what a log panel scrolls through: all of a tunnel's lines,
+// or only the matching ones in filter mode. It reads from the ring rather
+// than copying it.
+type logWindow struct {
+	ring    *logRing
+	matches []int // the matching lines' indexes in filter mode
+	filter  bool
+}
+
+func (w logWindow) len() int {
+	if w.filter {
+		return len(w.matches)
+	}
+	return w.ring.len()
+}
+
+func (w logWindow) at(i int) string {
+	if w.filter {
+		return w.ring.at(w.matches[i])
+	}
+	return w.ring.at(i)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Log search: / in the output panel types a query, whose matches are
+// highlighted; n and N jump to the previous and next matching line, and f
+// shows only the matching lines. The query is smart-case, like less -i:
+// case-insensitive unless it contains an upper-case letter.
+
+// logMatchRanges returns the byte ranges of query in line.
+func logMatchRanges(line, query string) [][2]int {
+	if query == "" {
+		return nil
+	}
+	haystack := line
+	if strings.ToLower(query) == query {
+		haystack = asciiLower(line)
+	}
+	var ranges [][2]int
+	for start := 0; ; {
+		i := strings.Index(haystack[start:], query)
+		if i < 0 {
+			return ranges
+		}
+		ranges = append(ranges, [2]int{start + i, start + i + len(query)})
+		start += i + len(query)
+	}
+}
+
+// asciiLower lower-cases A-Z only, so byte offsets into the result are
+// valid in s.
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// logLines is what the output panel scrolls through for t: every line, or
+// only the matching ones in filter mode.
+func (m model) logLines(t *tunnel) logWindow {
+	w := logWindow{ring: &t.logs}
+	if !m.logFilterOnly || m.logQuery == "" {
+		return w
+	}
+	w.filter = true
+	for i := range t.logs.len() {
+		if logMatchRanges(t.logs.at(i), m.logQuery) != nil {
+			w.matches = append(w.matches, i)
+		}
+	}
+	return w
+}
+
+// jumpToLogMatch scrolls the nearest matching line older (or newer) than
+// the bottom one to the bottom of the panel. from is the line to start
+// at, -1 for the one next to the bottom.
+func (m *model) jumpToLogMatch(older bool, from int) {
+	if m.selectedTunnel >= len(m.tunnels) {
+		return
+	}
+	lines := m.logLines(m.tunnels[m.selectedTunnel])
+	bottom := lines.len() - 1 - m.logScroll
+	step := 1
+	if older {
+		step = -1
+	}
+	if from < 0 {
+		from = bottom + step
+	}
+	for i := from; i >= 0 && i < lines.len(); i += step {
+		if logMatchRanges(lines.at(i), m.logQuery) != nil {
+			m.logScroll = lines.len() - 1 - i
+			return
+		}
+	}
+	if older {
+		m.statusMessage = fmt.Sprintf("No older line matches %q", m.logQuery)
+	} else {
+		m.statusMessage = fmt.Sprintf("No newer line matches %q", m.logQuery)
+	}
+}
+
+// handleLogSearchKey edits the query while / is active.
+func (m model) handleLogSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.logSearching = false
+		m.logQuery = ""
+		m.logFilterOnly = false
+	case "enter":
+		m.logSearching = false
+		if m.logQuery != "" {
+			m.logScroll = 0
+			m.jumpToLogMatch(true, m.logLines(m.tunnels[m.selectedTunnel]).len()-1)
+		}
+	case "backspace":
+		if r := []rune(m.logQuery); len(r) > 0 {
+			m.logQuery = string(r[:len(r)-1])
+		}
+	case " ":
+		m.logQuery += " "
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.logQuery += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+// logSearchStatus is shown next to the log header.
+func (m model) logSearchStatus(t *tunnel) string {
+	if m.logSearching {
+		return " /" + m.logQuery + "█"
+	}
+	if m.logQuery == "" {
+		return ""
+	}
+	matches := 0
+	for i := range t.logs.len() {
+		if logMatchRanges(t.logs.at(i), m.logQuery) != nil {
+			matches++
+		}
+	}
+	status := fmt.Sprintf(" /%s (%d) • n/N jump • f ", m.logQuery, matches)
+	if m.logFilterOnly {
+		return status + "show all • Esc clear"
+	}
+	return status + "filter • Esc clear"
+}
+
+// renderLogLine styles a log line, highlighting what matches the query.
+// current marks the line a jump landed on.
+func (m model) renderLogLine(line string, current bool) string {
+	ranges := logMatchRanges(line, m.logQuery)
+	if ranges == nil {
+		return subtleStyle.Render(line)
+	}
+	base := subtleStyle
+	if current {
+		base = selectedStyle
+	}
+	var b strings.Builder
+	prev := 0
+	for _, r := range ranges {
+		b.WriteString(base.Render(line[prev:r[0]]))
+		b.WriteString(logMatchStyle.Render(line[r[0]:r[1]]))
+		prev = r[1]
+	}
+	b.WriteString(base.Render(line[prev:]))
+	return b.String()
+}
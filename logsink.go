@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// logSink carries log lines from tunnel goroutines (ssh output, the native
+// client, the TLS proxy) into the Bubbletea loop, which alone owns the
+// tunnel logs. Writers never block, not even when called from Update:
+// lines queue up and one goroutine delivers them in batches, so a chatty
+// ssh -v costs one update per batch rather than one per line.
+type logSink struct {
+	mu    sync.Mutex
+	queue logBatchMsg
+	wake  chan struct{}
+}
+
+// logMsg is one line for the tunnel with the given id. Lines are matched
+// by id, so a tunnel that moved in the slice or was restarted in place
+// still gets them.
+type logMsg struct {
+	tunnelID int
+	line     string
+}
+
+type logBatchMsg []logMsg
+
+func newLogSink() *logSink {
+	return &logSink{wake: make(chan struct{}, 1)}
+}
+
+// attach starts delivering to p, including the lines written before.
+func (s *logSink) attach(p *tea.Program) {
+	go func() {
+		for range s.wake {
+			s.mu.Lock()
+			batch := s.queue
+			s.queue = nil
+			s.mu.Unlock()
+			if len(batch) > 0 {
+				p.Send(batch)
+			}
+		}
+	}()
+	s.signal()
+}
+
+func (s *logSink) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // a delivery is already pending and will pick this up
+	}
+}
+
+// writer returns the log function for one tunnel.
+func (s *logSink) writer(tunnelID int) func(string) {
+	return func(line string) {
+		s.mu.Lock()
+		s.queue = append(s.queue, logMsg{tunnelID: tunnelID, line: line})
+		s.mu.Unlock()
+		s.signal()
+	}
+}
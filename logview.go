@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The log viewer shows the selected tunnel's logs full screen: long lines
+// wrap instead of being cut short, and the whole log can be scrolled
+// through with the keys or the mouse wheel. Mouse reporting is only on
+// while it is open, so text can still be selected in the terminal
+// elsewhere. Like the panel, it follows new output while scrolled to the
+// bottom, and keeps the panel's search and filter. Scrolled back, it stays
+// on the same lines as new ones arrive.
+//
+// Only the lines on screen are wrapped and styled, from the bottom up, so
+// a frame costs the same with ten thousand lines as with ten.
+
+// logViewWheel is how many lines a turn of the mouse wheel scrolls.
+const logViewWheel = 3
+
+// openLogView shows the selected tunnel's logs full screen.
+func (m model) openLogView() (tea.Model, tea.Cmd) {
+	m.view = viewLogs
+	m.logViewTunnel = m.tunnels[m.selectedTunnel].id
+	m.logViewBack = 0
+	return m, tea.EnableMouseCellMotion
+}
+
+// logViewHeight leaves a line above and below the logs for the title and
+// the keys.
+func (m model) logViewHeight() int {
+	return max(m.height-2, 1)
+}
+
+// wrapLogLine styles line and wraps it at the screen's width.
+func (m model) wrapLogLine(line string) string {
+	return lipgloss.NewStyle().Width(m.width).Render(m.renderLogLine(line, false))
+}
+
+// logViewRows wraps the lines that fill the screen with the line back
+// from the newest at the bottom. It returns the screen's rows and how
+// many lines they show.
+func (m model) logViewRows(lines logWindow, back, height int) ([]string, int) {
+	var rows []string
+	shown := 0
+	for i := lines.len() - 1 - back; i >= 0 && len(rows) < height; i-- {
+		rows = append(strings.Split(m.wrapLogLine(lines.at(i)), "\n"), rows...)
+		shown++
+	}
+	if len(rows) > height {
+		// The top line only partly fits
+		rows = rows[len(rows)-height:]
+	}
+	return rows, shown
+}
+
+// logViewMaxBack is how far back the viewer scrolls: until the oldest
+// line is at the top.
+func (m model) logViewMaxBack(lines logWindow, height int) int {
+	rows := 0
+	for i := range lines.len() {
+		rows += lipgloss.Height(m.wrapLogLine(lines.at(i)))
+		if rows >= height {
+			return lines.len() - 1 - i
+		}
+	}
+	return 0
+}
+
+// scrollLogView moves the viewer by n lines, back when n is positive.
+func (m *model) scrollLogView(t *tunnel, n int) {
+	lines := m.logLines(t)
+	m.logViewBack = max(min(m.logViewBack+n, m.logViewMaxBack(lines, m.logViewHeight())), 0)
+}
+
+// logViewPage is how many lines the screen shows, which a page scrolls.
+func (m model) logViewPage(t *tunnel) int {
+	_, shown := m.logViewRows(m.logLines(t), m.logViewBack, m.logViewHeight())
+	return max(shown, 1)
+}
+
+// keepLogViewPlace keeps the viewer on the same lines when l arrives
+// while it is scrolled back.
+func (m *model) keepLogViewPlace(l logMsg) {
+	if m.view != viewLogs || l.tunnelID != m.logViewTunnel || m.logViewBack == 0 {
+		return
+	}
+	if !m.logFilterOnly || logMatchRanges(l.line, m.logQuery) != nil {
+		m.logViewBack++
+	}
+}
+
+func (m model) handleLogViewKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case msg.String() == "ctrl+c":
+		m.view = viewQuitConfirm
+		return m, tea.DisableMouse
+	case msg.String() == "esc" || msg.String() == "q" || key.Matches(msg, m.keys.FullscreenLogs):
+		m.view = viewMain
+		return m, tea.DisableMouse
+	}
+	t := m.tunnelByID(m.logViewTunnel)
+	if t == nil {
+		return m, nil
+	}
+	switch s := msg.String(); {
+	case key.Matches(msg, m.keys.Up):
+		m.scrollLogView(t, 1)
+	case key.Matches(msg, m.keys.Down):
+		m.scrollLogView(t, -1)
+	case s == "pgup" || s == "b":
+		m.scrollLogView(t, m.logViewPage(t))
+	case s == "pgdown" || s == "f" || s == " ":
+		m.scrollLogView(t, -m.logViewPage(t))
+	case s == "ctrl+u" || s == "u":
+		m.scrollLogView(t, max(m.logViewPage(t)/2, 1))
+	case s == "ctrl+d" || s == "d":
+		m.scrollLogView(t, -max(m.logViewPage(t)/2, 1))
+	case s == "home" || s == "g":
+		m.scrollLogView(t, m.logLines(t).len())
+	case s == "end" || s == "G":
+		m.logViewBack = 0
+	}
+	return m, nil
+}
+
+// updateLogViewMouse scrolls the viewer with the mouse wheel.
+func (m model) updateLogViewMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(m.logViewTunnel)
+	if t == nil || msg.Action != tea.MouseActionPress {
+		return m, nil
+	}
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.scrollLogView(t, logViewWheel)
+	case tea.MouseButtonWheelDown:
+		m.scrollLogView(t, -logViewWheel)
+	}
+	return m, nil
+}
+
+func (m model) renderLogView() string {
+	t := m.tunnelByID(m.logViewTunnel)
+	if t == nil {
+		return subtleStyle.Render("The tunnel was removed • Esc to go back")
+	}
+	height := m.logViewHeight()
+	lines := m.logLines(t)
+	// The window can shrink under it, when the memory limit trims the log
+	maxBack := m.logViewMaxBack(lines, height)
+	back := min(m.logViewBack, maxBack)
+	rows, _ := m.logViewRows(lines, back, height)
+	if len(rows) == 0 {
+		if m.logFilterOnly {
+			rows = []string{subtleStyle.Render("No line matches")}
+		} else {
+			rows = []string{subtleStyle.Render("No logs yet...")}
+		}
+	}
+	for len(rows) < height {
+		rows = append(rows, "")
+	}
+
+	title := titleStyle.Render("▶ " + t.tag + " logs")
+	if m.logQuery != "" {
+		title += subtleStyle.Render(fmt.Sprintf(" /%s", m.logQuery))
+		if m.logFilterOnly {
+			title += subtleStyle.Render(" (matching lines only)")
+		}
+	}
+	percent := 100
+	if maxBack > 0 {
+		percent = 100 * (maxBack - back) / maxBack
+	}
+	title += subtleStyle.Render(fmt.Sprintf("  %d%%", percent))
+	if back > 0 {
+		title += subtleStyle.Render(fmt.Sprintf(" • %d lines back", back))
+	}
+
+	k := m.keys
+	help := []string{
+		k.upDown("scroll").Help().Key + " scroll",
+		"pgup/pgdn page",
+		"home/end top/bottom",
+		"wheel scrolls",
+		k.FullscreenLogs.Help().Key + "/esc back",
+	}
+	if !k.FullscreenLogs.Enabled() {
+		help[len(help)-1] = "esc back"
+	}
+	footer := subtleStyle.Render(strings.Join(help, " • "))
+
+	return title + "\n" + strings.Join(rows, "\n") + "\n" + footer
+}
@@ -5,35 +5,43 @@ package main
 // Main Goroutine (Navigator):
 //   - Runs the Bubbletea TUI program
 //   - Handles user input (keyboard, resize events)
-//   - Refreshes UI every 100ms via tickMsg
+//   - Redraws only when a message changes something: input, a log line,
+//     a port check, a process exit
 //   - Navigates between different tunnel views
 //   - Coordinates all tunnel goroutines
 //
 // Tunnel Goroutines (Workers):
 //   - One goroutine per active tunnel
 //   - Reads SSH stderr output independently
-//   - Updates tunnel logs with mutex protection
 //   - Runs until SSH connection closes
 //
 // Communication:
-//   - Tunnels update logs directly (thread-safe with mutex)
-//   - Navigator reads logs when rendering UI
-//   - No blocking channels or message passing
-//   - Clean separation: workers write, navigator reads
+//   - Workers never touch the model; their log lines go through the
+//     logSink, which sends them to the program as logBatchMsg
+//   - Only the navigator reads and writes tunnel state, so nothing in
+//     the model needs a lock
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/moby/moby/pkg/namesgenerator"
@@ -47,78 +55,466 @@ const (
 	viewQuitConfirm
 	viewDeleteConfirm
 	viewHelp
+	viewProfiles
+	viewImportConfirm
+	viewDebug
+	viewSettings
+	viewAuthPrompt
+	viewLogs
+	viewHistory
+	viewTopology
 	maxHostVisible = 10
 )
 
 type tunnelStep int
 
 const (
-	stepHost tunnelStep = iota
+	stepBackend tunnelStep = iota
+	stepTunnelType
+	stepHost
 	stepHostIP
 	stepManualHost
+	stepKubeContext
+	stepKubeNamespace
+	stepKubeTarget
+	stepTemplate
+	stepRemoteHost
 	stepRemotePort
+	stepRemotePortPick
 	stepLocalPort
+	stepForwards
 	stepTag
+	stepColor
+	stepIdentity
+	stepProxy
+	stepPrepCommand
+	stepSmokeTest
+	stepHealthCheck
+	stepTLSMode
 	stepVerbose
+	stepCompression
+	stepCiphers
+	stepAdvanced
+	stepCloseAfter
+	stepCloseIdle
+	stepLazy
+	stepReview
 	stepConnecting
 )
 
 type tunnel struct {
-	id         int
-	tag        string
-	host       string
-	localPort  string
-	remotePort string
-	verbose    bool
-	cmd        *exec.Cmd
-	logs       []string
-	active     bool
-	logChan    chan string
-	logMutex   sync.Mutex
-}
-
-// Implement list.Item interface for tunnel
-func (t tunnel) FilterValue() string { return t.tag }
-func (t tunnel) Title() string       { return t.tag }
+	id              int
+	tag             string
+	host            string
+	localPort       string
+	remotePort      string
+	remoteHost      string // "" for the SSH host itself
+	proxy           string
+	prep            string
+	smokeTest       string
+	smoke           smokeResult
+	healthCheck     string
+	health          smokeResult
+	healthRun       int // which start of the tunnel its checks belong to
+	protocol        string
+	tlsMode         string
+	backend         string
+	tunnelType      string     // "" for a local forward, "remote" for -R, "socks" for -D
+	keepalive       *keepalive // nil for the config's
+	tcp             *tcpTuning // nil for the config's, see tcptune.go
+	identity        string     // identity_file, "" for any key
+	controlPath     string     // control_path, see mux.go
+	compression     *bool      // nil for the config's, see link.go
+	ciphers         string     // "" for the config's
+	forwardAgent    bool       // ssh -A, see advanced.go
+	x11             string     // "", "untrusted" (-X) or "trusted" (-Y)
+	closeAfter      int        // minutes, see autoclose.go
+	closeIdle       int
+	lazyMode        bool      // connects on demand, see lazy.go
+	closeAt         time.Time // when closeAfter is up, zero for never
+	idleSince       time.Time // since the traffic last changed
+	idleBytes       uint64
+	mux             *muxForwards  // its forwards on an ssh master, replacing its own ssh
+	lazy            *lazyListener // holds the local port of an on-demand tunnel, see lazy.go
+	sleeping        bool          // on demand and waiting for a client
+	forwards        []forwardStatus
+	tlsProxy        *tlsProxy
+	demo            *demoService     // stands in for ssh with --demo
+	native          *nativeTransport // replaces ssh with the native backend
+	mdns            *mdnsAnnouncement
+	endpoint        sshEndpoint
+	verbose         bool
+	cmd             *exec.Cmd
+	logs            logRing // see logring.go
+	logSeq          uint64  // bumped on every change, so renders can be cached
+	logBytes        int     // retained log memory, see logbudget.go
+	active          bool
+	restarting      bool          // killed by a restart, to be started again once it exits
+	nextStart       time.Time     // its next scheduled start, see schedule.go
+	startedAt       time.Time     // when it last came up, zero while down; see uptime.go
+	createdAt       time.Time     // when it was first added to the list
+	retired         bool          // recorded among the closed tunnels, see closed.go
+	failed          bool          // went down on its own, see statusbar.go
+	marked          bool          // marked for a bulk delete, restart or group, see marks.go
+	quick           string        // its quick-switch key, shown in the list, "" for none; see quickswitch.go
+	upTotal         time.Duration // up before startedAt
+	rate            throughput    // the last minute's traffic, see throughput.go
+	reconnects      int
+	linkState       string // the native client's connection as last seen: "", "up" or "down"
+	proxyConns      int    // connections through a SOCKS proxy, see proxyhealth.go
+	proxyConnsKnown bool
+	proxyTest       smokeResult
+	adoptedPID      int // an ssh started outside the manager, see adopt.go
+	onConnect       string
+	onDisconnect    string
+	hookLog         func(string) // the tunnel's log, for hooks finishing later
+	hooked          bool         // connected, so on_disconnect is due; see hooks.go
+	web             bool         // a web app, see browser.go
+	webLink         string       // web_url, "" for the default
+	note            string       // see notes.go
+	color           string       // a label in labelNames, see colors.go
+	owner           string       // who started it, on a shared daemon (see users.go)
+	loginExpired    bool         // its tsh exited for an expired Teleport login, see teleport.go
+}
+
+// forwardStatus is one of a tunnel's additional forwards and what its
+// last port check found.
+type forwardStatus struct {
+	forwardSpec
+	protocol  string
+	checked   bool
+	reachable bool
+}
+
+// forwardChecked records what a port check found for forwards[i].
+func (t *tunnel) forwardChecked(i int, msg protocolMsg) {
+	f := &t.forwards[i]
+	f.checked, f.reachable, f.protocol = true, msg.reachable, msg.protocol
+	if !msg.reachable {
+		slog.Warn("local port not accepting connections", append(t.logAttrs(), "local_port", f.LocalPort)...)
+		t.appendLog("Local port " + f.LocalPort + " is not accepting connections")
+		return
+	}
+	name := "unknown"
+	if msg.protocol != "" {
+		name = protocolNames[msg.protocol]
+	}
+	t.appendLog(fmt.Sprintf("Detected protocol on %s: %s", f.LocalPort, name))
+}
+
+func (t *tunnel) forwardSpecs() []forwardSpec {
+	var specs []forwardSpec
+	for _, f := range t.forwards {
+		specs = append(specs, f.forwardSpec)
+	}
+	return specs
+}
+
+// appendLog adds a timestamped line to the tunnel's log. Goroutines go
+// through the logSink instead.
+func (t *tunnel) appendLog(line string) {
+	t.pushLog(fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), line))
+}
+
+// pushLog adds entry as it is, making room in the ring if it is full.
+func (t *tunnel) pushLog(entry string) {
+	t.logBytes += logLineSize(entry)
+	if oldest, ok := t.logs.push(entry); ok {
+		t.logBytes -= logLineSize(oldest)
+	}
+	t.logSeq++
+}
+
+// stop kills the tunnel's ssh process and anything the manager runs in
+// front of it.
+func (t *tunnel) stop() {
+	t.disconnected()
+	t.markDown()
+	if t.lazy != nil {
+		t.lazy.Close()
+		t.lazy = nil
+	}
+	t.sleeping = false
+	if t.tlsProxy != nil {
+		t.tlsProxy.Close()
+		t.tlsProxy = nil
+	}
+	if t.demo != nil {
+		t.demo.Close()
+		t.demo = nil
+	}
+	if t.native != nil {
+		t.native.Close()
+		t.native = nil
+	}
+	if t.mux != nil {
+		t.mux.stop()
+		t.mux = nil
+	}
+	if t.mdns != nil {
+		t.mdns.stop()
+		t.mdns = nil
+	}
+	if t.active && t.cmd != nil {
+		killProcessTree(t.cmd)
+	}
+	if t.active && t.adoptedPID != 0 {
+		terminateProcessGroup(t.adoptedPID)
+	}
+	t.active = false
+}
+
+// hasProcess reports whether the tunnel is up in a process that has to
+// exit before its ports are free again.
+func (t *tunnel) hasProcess() bool {
+	return t.active && (t.cmd != nil || t.adoptedPID != 0)
+}
+
+func (t *tunnel) summary() tunnelSummary {
+	return tunnelSummary{
+		Tag:        t.tag,
+		Host:       t.host,
+		LocalPort:  t.localPort,
+		RemotePort: t.remotePort,
+		RemoteHost: t.remoteHost,
+		Protocol:   t.protocol,
+		Type:       t.tunnelType,
+		Active:     t.active,
+		Degraded:   t.degraded(),
+		Forwards:   t.forwardSpecs(),
+	}
+}
+
+// Implement list.Item interface for tunnel. FilterValue is what the list
+// filter looks in (see listfilter.go): the tag, the hosts and every port.
+func (t tunnel) FilterValue() string {
+	parts := []string{t.tag, t.host, t.localPort, t.remotePort, t.remoteHost}
+	for _, f := range t.forwards {
+		parts = append(parts, f.LocalPort, f.RemotePort, f.RemoteHost)
+	}
+	return strings.Join(parts, " ")
+}
+func (t tunnel) Title() string { return t.tag }
+
+// statusDot is the tunnel's state at a glance.
+func (t tunnel) statusDot() string {
+	if t.degraded() {
+		return "🟡"
+	} else if t.sleeping {
+		return "💤"
+	} else if t.active {
+		return "🟢"
+	} else if t.scheduled() {
+		return "🕘"
+	}
+	return "🔴"
+}
+
+// scheduled reports whether the tunnel is down until its next scheduled
+// start.
+func (t tunnel) scheduled() bool {
+	return !t.active && !t.restarting && !t.nextStart.IsZero()
+}
+
 func (t tunnel) Description() string {
-	status := "●"
-	if t.active {
-		status = "🟢"
-	} else {
-		status = "🔴"
+	scheduled := t.scheduled()
+	desc := fmt.Sprintf("%s %s  %s", t.statusDot(), t.host, forwardPorts(t.tunnelType, t.localPort, remoteEnd(t.remoteHost, t.remotePort)))
+	switch t.tunnelType {
+	case "remote":
+		desc += " -R"
+	case "socks":
+		desc += " -D"
+	}
+	if len(t.forwards) > 0 {
+		desc += fmt.Sprintf(" +%d", len(t.forwards))
+	}
+	if t.protocol != "" {
+		desc += " " + t.protocol + " ✅"
+	}
+	if !t.smoke.at.IsZero() {
+		if t.smoke.ok {
+			desc += " smoke ✅"
+		} else {
+			desc += " smoke ❌"
+		}
 	}
-	return fmt.Sprintf("%s %s  %s → %s", status, t.host, t.localPort, t.remotePort)
+	if scheduled {
+		desc += " scheduled, next start in " + fmtUptime(time.Until(t.nextStart))
+	}
+	if t.lazyMode {
+		desc += " on demand"
+	}
+	if t.owner != "" {
+		desc += " @" + t.owner
+	}
+	return desc
 }
 
 type model struct {
-	view            view
-	tunnels         []tunnel
-	tunnelList      list.Model
-	selectedPanel   int
-	selectedTunnel  int
-	logScroll       int
-	deleteTunnelIdx int
-
-	step         tunnelStep
-	hosts        []string
-	hostIPs      []string
-	hostIPIndex  int
-	hostIPScroll int
-	cursor       int
-	hostScroll   int
-	input        string
-	tempHost     string
-	tempRemote   string
-	tempLocal    string
-	tempTag      string
-	tempVerbose  bool
-	err          error
-	spinner      spinner.Model
-
-	nextTunnelID int
-	width        int
-	height       int
-	program      *tea.Program
+	view               view
+	tunnels            []*tunnel
+	tunnelList         list.Model
+	selectedPanel      int
+	selectedTunnel     int
+	selectedGroup      string // heading selected in the list, see groups.go
+	listRows           []int  // tunnel index of each list item, -1 for a heading
+	collapsed          map[string]bool
+	groupEditing       bool // g was pressed
+	groupInput         string
+	groupPrevStatus    string
+	noteEditing        bool // e was pressed, see notes.go
+	noteInput          string
+	notePrevStatus     string
+	tunnelsFile        string // the last tunnels file, see tunnelsfile.go
+	fileEditing        bool   // I was pressed
+	fileInput          string
+	filePrevStatus     string
+	logScroll          int // lines scrolled back from the newest log
+	logSearching       bool
+	logQuery           string // see logsearch.go
+	logFilterOnly      bool
+	listSort           sortMode
+	compact            bool
+	dashboard          bool       // the table instead of the list and logs, see dashboard.go
+	throughputTicking  bool       // the sparklines are sampled, see throughput.go
+	user               daemonUser // who typed last, on a shared daemon (see users.go)
+	dashboardTop       int
+	listFilter         string
+	listFiltering      bool // / was pressed in the list, see listfilter.go
+	logViewTunnel      int  // full-screen logs, see logview.go
+	logViewBack        int  // lines scrolled back from the newest
+	bulkPending        bool // a was pressed, see bulk.go
+	adoptPending       bool // ssh tunnels started elsewhere were found, see adopt.go
+	adoptable          []adoptable
+	adoptReturnStatus  string
+	bulkReturnStatus   string
+	exportPending      bool // E was pressed, see export.go
+	exportReturnStatus string
+	pendingStarts      []int // tunnel ids waiting to be started again
+	pendingProfiles    []tunnelSpec
+	schedules          []*schedule // from the config, see schedule.go
+	sidebarWidth       int
+	restoreTunnel      string // tag selected when the app last exited
+	deleteTunnelIdx    int
+
+	step            tunnelStep
+	hosts           []string
+	hostIPs         []string
+	hostEndpoints   map[string]sshEndpoint // ssh config aliases, resolved by ssh -G
+	hostIPIndex     int
+	hostIPScroll    int
+	cursor          int
+	hostScroll      int
+	hostFilter      string          // typed in the host picker
+	history         []tunnelSpec    // tunnels started, newest first, see history.go
+	input           textinput.Model // see input.go
+	tempHost        string
+	tempRemote      string
+	tempRemoteHost  string
+	tempLocal       string
+	tempTag         string
+	tempProxy       string
+	tempPrep        string
+	tempSmoke       string
+	tempHealth      string
+	tempTLS         string
+	tempVerbose     bool
+	tempBackend     string
+	tempType        string
+	tempResume      int // id of the stopped tunnel being started again, 0 for a new one
+	tempForwards    []forwardSpec
+	tempKeepalive   *keepalive
+	tempIdentity    string
+	tempOnConnect   string
+	tempOnDisc      string
+	tempWeb         bool
+	tempWebURL      string
+	tempNote        string
+	tempColor       string
+	tempControlPath string
+	tempCompression *bool
+	tempCiphers     string
+	tempAgent       bool
+	tempX11         string
+	tempCloseAfter  int
+	tempCloseIdle   int
+	tempLazy        bool
+	tempPrecheck    precheckMsg
+	tempPrepLogs    []string
+	tempKube        kubeTarget                    // the k8s target being picked
+	kubeChoices     map[tunnelStep]kubeChoicesMsg // what kubectl listed for each k8s step
+	tshNodes        []string                      // the host picker's list for the tsh backend
+	tshLabels       map[string]string
+	tshListing      bool
+	tshErr          error
+	reviewIndex     int        // field picked on the review step
+	reviewEditing   bool       // a field is being changed from the review step
+	reviewSaved     tunnelSpec // the wizard's fields before that change
+	connectStage    string
+	err             error
+	spinner         spinner.Model
+
+	portChoices  []portChoice
+	portIndex    int
+	portScroll   int
+	discovering  bool
+	suggestedTag string
+
+	profiles         []tunnelSpec
+	profileIndex     int
+	profileScroll    int
+	importChanges    []profileChange
+	fetchingProfiles bool
+
+	// History view (H)
+	closed       []closedTunnel // tunnels that ended, newest first, see closed.go
+	closedIndex  int
+	closedScroll int
+	deleted      []deletedTunnel // the latest last, see undo.go
+
+	lastEvent   statusEvent // see statusbar.go
+	configLabel string
+
+	// Debug view (ctrl+d)
+	recentMsgs []recentMsg
+	logSink    *logSink
+
+	prof    *uiProfiler // nil unless --profile-ui
+	logFile string      // --log-file, for diagnostic bundles
+	demo    bool        // --demo: simulated tunnels, no ssh
+
+	bodyCache *renderCache
+
+	nextTunnelID       int
+	healthRuns         int  // numbers each start of a tunnel with a health check
+	proxyConnsCounting bool // SOCKS tunnels' connections are being counted, see proxyhealth.go
+	width              int
+	height             int
+	program            *tea.Program
+	precheck           bool
+	cfg                config
+	providers          []hostProvider
+	backends           map[string]tunnelBackend
+	backendNames       []string
+	backendIndex       int
+	typeIndex          int
+	advancedIndex      int
+	templateIndex      int // 0 is custom ports, then m.cfg.templates()
+	settingsIndex      int
+	settingsInputs     []string // see settings.go
+	prompter           *prompter
+	masters            *sshMasters // shared ssh connections, see mux.go
+	agent              agentStatus // see identity.go
+	identityChoices    []identityChoice
+	identityIndex      int
+	prompts            []authPrompt // waiting for the user, see askpass.go
+	promptInput        string
+	promptReturn       view
+	policy             policy
+	landing            *landingPage
+	daemon             *daemonServer // nil unless running as the daemon
+	termOut            io.Writer     // the terminal, for OSC 52 copies
+	keys               keyMap        // see keys.go
 
 	toast         string
 	toastType     string
@@ -133,132 +529,723 @@ const banner = `
 `
 
 // Custom list delegate for fancy rendering
-type tunnelDelegate struct{}
+type tunnelDelegate struct {
+	compact bool // one line per tunnel, see listdensity.go
+}
+
+func (d tunnelDelegate) Height() int {
+	if d.compact {
+		return 1
+	}
+	return 3
+}
+
+func (d tunnelDelegate) Spacing() int {
+	if d.compact {
+		return 0
+	}
+	return 1
+}
 
-func (d tunnelDelegate) Height() int                             { return 3 }
-func (d tunnelDelegate) Spacing() int                            { return 1 }
 func (d tunnelDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
 func (d tunnelDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
-	t, ok := listItem.(tunnel)
+	if d.compact {
+		d.renderCompact(w, m, index, listItem)
+		return
+	}
+	if g, ok := listItem.(groupHeader); ok {
+		title := highlightStyle.Render(g.title())
+		if index == m.Index() {
+			title = selectedStyle.Render(g.title())
+		}
+		fmt.Fprint(w, title+"\n"+subtleStyle.Render("  "+g.description()))
+		return
+	}
+	t, ok := listItem.(*tunnel)
 	if !ok {
 		return
 	}
 
 	var str string
+	title := t.Title()
+	if t.marked {
+		title = "✓ " + title
+	}
+	if t.quick != "" {
+		title = t.quick + " " + title
+	}
+	// Every line starts with the gutter, so a color label runs down the
+	// whole entry, selected or not, and is cut to the sidebar: one that
+	// wrapped would take the tunnel past the delegate's height
+	room := m.Width() - 2
+	indent := ""
 	if index == m.Index() {
-		str = selectedStyle.Render(fmt.Sprintf("▶ %s", t.Title())) + "\n"
-		str += selectedStyle.Render(fmt.Sprintf("  %s", t.Description()))
+		indent = "  "
+		str = t.gutter() + selectedStyle.MaxWidth(room).Render("▶ "+title) + "\n"
+		str += t.gutter() + selectedStyle.MaxWidth(room).Render(indent+t.Description())
 	} else {
-		str = subtleStyle.Render(fmt.Sprintf("  %s", t.Title())) + "\n"
-		str += subtleStyle.Render(fmt.Sprintf("  %s", t.Description()))
+		style := subtleStyle
+		if t.color != "" {
+			style = t.labelStyle()
+		}
+		str = t.gutter() + style.MaxWidth(room).Render(title) + "\n"
+		str += t.gutter() + subtleStyle.MaxWidth(room).Render(t.Description())
+	}
+	if uptime := t.uptimeLabel(); uptime != "" {
+		str += "\n" + t.gutter() + subtleStyle.MaxWidth(room).Render(indent+uptime)
 	}
 
 	fmt.Fprint(w, str)
 }
 
-func initialModel() model {
+// appOptions holds the command-line settings that shape the model.
+type appOptions struct {
+	noPrecheck bool
+	logFile    string
+	logLevel   string
+	profileUI  bool
+	profileDir string
+	demo       bool
+	fromFile   string // tunnels file to start, see tunnelsfile.go
+}
+
+func initialModel(opts appOptions, cfg config, pol policy, st uiState, landing *landingPage) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("#C678DD"))
+	s.Style = spinnerStyle
 
 	// Initialize list
-	delegate := tunnelDelegate{}
+	delegate := tunnelDelegate{compact: st.Compact}
 	tunnelList := list.New([]list.Item{}, delegate, 0, 0)
 	tunnelList.Title = "ACTIVE TUNNELS"
 	tunnelList.SetShowStatusBar(false)
+	// The list filter is ours (see listfilter.go), keeping the groups
 	tunnelList.SetFilteringEnabled(false)
 	tunnelList.SetShowHelp(false)
-	tunnelList.Styles.Title = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#61AFEF")).
-		Bold(true).
-		Padding(0, 0, 1, 0)
+	keys := cfg.keyMap()
+	tunnelList.KeyMap = keys.listKeyMap()
+	// The padding goes under the bar, not the title, which the list
+	// truncates with the filter in it
+	tunnelList.Styles.Title = helpTitleStyle.UnsetPadding()
+	tunnelList.Styles.TitleBar = tunnelList.Styles.TitleBar.PaddingBottom(2)
+
+	hosts, _ := sshConfigProvider{}.ListHosts()
+	providers := hostProvidersFromConfig(cfg)
+	history := loadHistory()
+	closed := loadClosed()
+	schedules := newSchedules(cfg.Schedules, time.Now())
+	if opts.demo {
+		hosts, providers, history, closed, schedules = demoHosts, nil, nil, nil, nil
+		opts.noPrecheck = true
+	}
+
+	backendNames := []string{"ssh", nativeBackend, kubectlBackend, teleportBackend}
+	for _, b := range cfg.Backends {
+		backendNames = append(backendNames, b.Name)
+	}
+
+	var prof *uiProfiler
+	if opts.profileUI {
+		prof = newUIProfiler()
+	}
 
 	return model{
 		view:          viewMain,
-		hosts:         getSSHHosts(),
-		selectedPanel: 0,
+		hosts:         hosts,
+		history:       history,
+		configLabel:   configLabel(opts.demo),
+		closed:        closed,
+		selectedPanel: st.SelectedPanel,
+		sidebarWidth:  st.SidebarWidth,
+		restoreTunnel: st.SelectedTunnel,
+		collapsed:     st.collapsedGroups(),
+		listSort:      parseSortMode(st.Sort),
+		compact:       st.Compact,
 		nextTunnelID:  1,
 		spinner:       s,
+		input:         newWizardInput(),
 		tunnelList:    tunnelList,
-		statusMessage: "Ready • Press ? for help",
+		statusMessage: "Ready • Press " + keys.Help.Help().Key + " for help",
+		keys:          keys,
+		precheck:      !opts.noPrecheck,
+		cfg:           cfg,
+		providers:     providers,
+		backends:      backendsFromConfig(cfg),
+		backendNames:  backendNames,
+		policy:        pol,
+		landing:       landing,
+		logSink:       newLogSink(),
+		prompter:      &prompter{},
+		masters:       &sshMasters{},
+		termOut:       os.Stdout,
+		prof:          prof,
+		logFile:       opts.logFile,
+		demo:          opts.demo,
+		tunnelsFile:   opts.fromFile,
+		schedules:     schedules,
+		bodyCache:     &renderCache{},
 	}
 }
 
-type logMsg struct {
-	tunnelID int
-	line     string
+func (m model) Init() tea.Cmd {
+	cmds := []tea.Cmd{listHostsCmd(m.providers), uptimeTickCmd(), closeTickCmd()}
+	if m.tunnelsFile != "" {
+		cmds = append(cmds, readTunnelsFileCmd(m.tunnelsFile))
+	}
+	if len(m.schedules) > 0 {
+		cmds = append(cmds, loadSchedulesCmd())
+	}
+	if m.demo {
+		cmds = append(cmds, func() tea.Msg { return demoStartMsg{} }, demoTickCmd())
+	} else {
+		// Only the ssh config aliases are in the picker yet
+		cmds = append(cmds, resolveSSHHostsCmd(m.hosts), checkAgentCmd(), findAdoptableCmd(nil))
+	}
+	return tea.Batch(cmds...)
 }
 
-type connectingMsg struct{}
+// startConnecting moves the wizard to the connecting step, checking that
+// the SSH endpoint answers first unless the pre-check is disabled.
+func (m model) startConnecting() (tea.Model, tea.Cmd) {
+	m.step = stepConnecting
+	m.err = nil
+	m.tempPrecheck = precheckMsg{}
+	m.tempPrepLogs = nil
+	if m.tempBackend == teleportBackend && !m.demo {
+		m.connectStage = "Checking the Teleport login..."
+		return m, tea.Batch(m.spinner.Tick, checkTshLoginCmd(0))
+	}
+	if !usesSSH(m.tempBackend) || m.demo {
+		// Only ssh has an endpoint to check, and demo tunnels don't run ssh
+		return m.finalizeTunnel()
+	}
+	m.connectStage = "Checking host..."
+	return m, tea.Batch(m.spinner.Tick, precheckCmd(m.tempHost, m.tempProxy, m.precheck))
+}
 
-type tickMsg time.Time
+// spinnerVisible reports whether any screen currently shows the spinner.
+func (m model) spinnerVisible() bool {
+	return m.fetchingProfiles || m.discovering || (m.view == viewNewTunnel && m.step == stepConnecting && m.err == nil)
+}
 
-func (m model) Init() tea.Cmd {
-	return tea.Batch(m.spinner.Tick, tickCmd())
+// refresh re-polls every active tunnel right away: its local port and
+// protocol, and its smoke test when it has one.
+func (m *model) refresh() tea.Cmd {
+	var cmds []tea.Cmd
+	active := 0
+	for _, t := range m.tunnels {
+		if !t.active {
+			continue
+		}
+		active++
+		cmds = append(cmds, detectProtocolCmd(t.id, t.localPort))
+		for i, f := range t.forwards {
+			cmds = append(cmds, detectForwardCmd(t.id, i+1, f.LocalPort))
+		}
+		if t.smokeTest != "" {
+			cmds = append(cmds, smokeTestCmd(t.id, t.smokeTest, t.localPort, false))
+		}
+	}
+	if !m.demo {
+		cmds = append(cmds, checkAgentCmd())
+	}
+	m.enforceLogLimit()
+	m.statusMessage = fmt.Sprintf("Refreshing %d active tunnel(s)...", active)
+	slog.Debug("manual refresh", "active", active)
+	return tea.Batch(cmds...)
 }
 
-func tickCmd() tea.Cmd {
-	return tea.Tick(time.Second*1, func(t time.Time) tea.Msg {
-		return tickMsg(t)
-	})
+// afterPrecheck runs the remote preparation command, if the tunnel has
+// one, and otherwise starts the tunnel.
+func (m model) afterPrecheck() (tea.Model, tea.Cmd) {
+	if m.tempPrep == "" {
+		return m.finalizeTunnel()
+	}
+	m.err = nil
+	m.connectStage = "Running: " + m.tempPrep
+	return m, tea.Batch(m.spinner.Tick, prepCmd(sshConnectArgs(m.tempProxy, m.tempPrecheck, m.policy), m.tempHost, m.tempPrep))
 }
 
-func waitForConnection() tea.Cmd {
-	return tea.Tick(2*time.Second, func(t time.Time) tea.Msg {
-		return connectingMsg{}
-	})
+// sshConnectArgs are the options shared by every ssh invocation for a
+// tunnel: options mandated by policy, then the upstream proxy or the
+// pre-check's address family.
+func sshConnectArgs(proxySetting string, pre precheckMsg, pol policy) []string {
+	args := pol.sshArgs()
+	if proxy, err := parseProxy(proxySetting); proxySetting != "" && err == nil {
+		return append(args, proxy.sshArgs()...)
+	}
+	if pre.candidates > 1 {
+		// When the host has several addresses, keep ssh on the family that
+		// won the pre-check race instead of letting it stall on a dead one.
+		if host, _, err := net.SplitHostPort(pre.addr); err == nil {
+			if net.ParseIP(host).To4() != nil {
+				return append(args, "-4")
+			}
+			return append(args, "-6")
+		}
+	}
+	return args
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Report and clean up, then let Bubbletea restore the terminal
+	defer func() {
+		if r := recover(); r != nil {
+			handleCrash(fmt.Sprintf("update (%T)", msg), r, debug.Stack())
+			panic(r)
+		}
+	}()
+	if m.prof != nil {
+		defer m.prof.trackUpdate(time.Now())
+	}
+	next, cmd := m.update(msg)
+	if m, ok := next.(model); ok {
+		if tick := m.startThroughputTick(); tick != nil {
+			return m, tea.Batch(cmd, tick)
+		}
+	}
+	return next, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m.noteMsg(msg)
+
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
-	case tickMsg:
-		// Main UI refresh tick - the navigator polls all tunnel goroutines
-		// and updates the display without blocking
-		return m, tickCmd()
+	case logBatchMsg:
+		for _, l := range msg {
+			t := m.tunnelByID(l.tunnelID)
+			if t == nil {
+				continue // deleted since
+			}
+			t.appendLog(l.line)
+			m.keepLogViewPlace(l)
+			// The native client logs why it gave up after recording it
+			if t.native != nil && t.native.failed() {
+				cmds = append(cmds, m.nativeGaveUp(t))
+				reason := t.native.status()
+				t.stop()
+				m.markFailed(t, reason)
+				m.updateTunnelList()
+			} else if t.native != nil {
+				cmds = append(cmds, m.watchNative(t))
+			}
+		}
+		m.enforceLogLimit()
+		return m, tea.Batch(cmds...)
+
+	case precheckMsg:
+		if m.view == viewNewTunnel && m.step == stepConnecting && m.err == nil {
+			m.tempPrecheck = msg
+			if msg.err != nil {
+				slog.Warn("reachability check failed", "host", m.tempHost, "err", msg.err)
+				m.err = msg.err
+				return m, nil
+			}
+			slog.Debug("reachability check passed", "host", m.tempHost, "addr", msg.addr, "candidates", msg.candidates, "skipped", msg.skipped)
+			return m.afterPrecheck()
+		}
+
+	case apiListMsg:
+		tunnels := make([]tunnelStatus, len(m.tunnels))
+		for i, t := range m.tunnels {
+			tunnels[i] = tunnelStatus{ID: t.id, tunnelSummary: t.summary(), Logs: t.logs.lines()}
+		}
+		msg.reply <- tunnels
+		return m, nil
+
+	case apiCreateMsg:
+		spec := msg.spec
+		if err := spec.normalize(); err != nil {
+			msg.reply <- err
+			return m, nil
+		}
+		if err := m.policy.check(spec); err != nil {
+			msg.reply <- err
+			return m, nil
+		}
+		for _, port := range spec.localPorts() {
+			if err := m.checkLocalPort(port); err != nil {
+				msg.reply <- err
+				return m, nil
+			}
+		}
+		if m.demo {
+			reply := msg.reply
+			return m, func() tea.Msg { return apiStartMsg{spec: spec, reply: reply} }
+		}
+		return m, apiStartCmd(spec, m.precheck, m.policy, msg.reply)
+
+	case apiStartMsg:
+		slog.Info("api: create tunnel", "tag", msg.spec.Tag, "host", msg.spec.Host, "err", msg.err)
+		if msg.err != nil {
+			msg.reply <- msg.err
+			return m, nil
+		}
+		cmd, err := m.startTunnel(msg.spec, msg.precheck, msg.prepLogs, 0)
+		msg.reply <- err
+		if err == nil {
+			m.statusMessage = fmt.Sprintf("Tunnel %s started from the web UI", msg.spec.Tag)
+		}
+		return m, cmd
+
+	case apiDeleteMsg:
+		slog.Info("api: delete tunnel", "tunnel", msg.id)
+		for i := range m.tunnels {
+			if m.tunnels[i].id == msg.id {
+				m.removeTunnel(i)
+				m.statusMessage = "Tunnel deleted from the web UI"
+				msg.reply <- nil
+				return m, nil
+			}
+		}
+		msg.reply <- fmt.Errorf("no tunnel with id %d", msg.id)
+		return m, nil
+
+	case sshHostsResolvedMsg:
+		if m.hostEndpoints == nil {
+			m.hostEndpoints = make(map[string]sshEndpoint, len(msg.endpoints))
+		}
+		maps.Copy(m.hostEndpoints, msg.endpoints)
+		return m, nil
+
+	case hostProvidersMsg:
+		m.hosts = mergeHosts(m.hosts, msg.hosts)
+		slog.Info("host providers listed", "hosts", len(msg.hosts), "failed", len(msg.errs))
+		if len(msg.errs) > 0 {
+			problems := make([]string, len(msg.errs))
+			for i, err := range msg.errs {
+				slog.Warn("host provider failed", "err", err)
+				problems[i] = err.Error()
+			}
+			m.statusMessage = strings.Join(problems, "; ")
+		}
+		return m, nil
+
+	case demoStartMsg:
+		return m, m.startDemoTunnels()
+
+	case demoTickMsg:
+		m.demoStep()
+		return m, demoTickCmd()
+
+	case diagnosticsMsg:
+		if msg.err != nil {
+			m.statusMessage = "Cannot write diagnostic bundle: " + msg.err.Error()
+		} else {
+			m.statusMessage = "Diagnostic bundle written to " + msg.path
+		}
+		return m, nil
+
+	case tunnelsFileMsg:
+		if msg.err != nil {
+			slog.Warn("tunnels file unreadable", "path", msg.path, "err", msg.err)
+			m.statusMessage = "Cannot start tunnels: " + msg.err.Error()
+			return m, nil
+		}
+		if m.view != viewMain {
+			m.statusMessage = fmt.Sprintf("%s is read; close this screen and press %s to start its tunnels", filepath.Base(msg.path), m.keys.FromFile.Help().Key)
+			return m, nil
+		}
+		return m.startTunnelsFile(msg.path, msg.specs)
+
+	case exportMsg:
+		if msg.err != nil {
+			m.statusMessage = "Cannot export: " + msg.err.Error()
+		} else {
+			m.statusMessage = fmt.Sprintf("Exported %d tunnel(s) to %s", msg.count, msg.path)
+		}
+		return m, nil
+
+	case agentStatusMsg:
+		m.agent = msg.status
+		return m, nil
+
+	case kubeChoicesMsg:
+		return m.kubeChoicesArrived(msg)
+
+	case browserMsg:
+		if msg.err != nil {
+			slog.Warn("cannot open browser", "url", msg.url, "err", msg.err)
+			m.statusMessage = fmt.Sprintf("Cannot open a browser (%v); the address is %s", msg.err, msg.url)
+		} else {
+			m.statusMessage = "Opened " + msg.url + " in the browser"
+		}
+		return m, nil
+
+	case clipboardMsg:
+		if msg.terminal {
+			m.statusMessage = "Sent " + msg.what + " to the terminal's clipboard"
+		} else {
+			m.statusMessage = "Copied " + msg.what
+		}
+		return m, nil
+
+	case daemonInputMsg:
+		m.user = msg.user
+		return m, nil
+
+	case profileBundleMsg:
+		m.fetchingProfiles = false
+		if msg.err != nil {
+			slog.Warn("profile bundle fetch failed", "url", m.cfg.ProfilesURL, "err", msg.err)
+			m.statusMessage = "Profile update failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.importChanges = diffProfiles(m.profiles, msg.profiles)
+		if len(m.importChanges) == 0 {
+			m.statusMessage = "Profiles are up to date"
+		} else if m.view == viewProfiles {
+			m.view = viewImportConfirm
+		} else {
+			m.statusMessage = fmt.Sprintf("%d profile update(s) available • press %s, then u to review", len(m.importChanges), m.keys.Profiles.Help().Key)
+		}
+		return m, nil
+
+	case portChoicesMsg:
+		if m.view == viewNewTunnel && m.step == stepRemotePort && m.discovering {
+			m.discovering = false
+			if msg.err != nil {
+				m.err = msg.err
+				return m, nil
+			}
+			m.portChoices = msg.choices
+			m.portIndex = 0
+			m.portScroll = 0
+			m.step = stepRemotePortPick
+		}
+
+	case remoteProcessMsg:
+		if t := m.tunnelByID(msg.tunnelID); t != nil {
+			line := msg.info
+			if msg.err != nil {
+				line = msg.err.Error()
+			}
+			m.statusMessage = line
+			t.appendLog(line)
+		}
+
+	case healthMsg:
+		return m, m.healthChecked(msg)
+
+	case authPromptMsg:
+		m.showPrompt(msg.prompt)
+		return m, nil
+
+	case authPromptGoneMsg:
+		m.dropPrompt(msg.id, authReply{})
+		return m, nil
+
+	case smokeMsg:
+		if t := m.tunnelByID(msg.tunnelID); t != nil {
+			t.smoke = msg.result
+			slog.Info("smoke test", append(t.logAttrs(), "ok", msg.result.ok, "detail", msg.result.detail)...)
+			verdict := "passed"
+			if !msg.result.ok {
+				verdict = "FAILED"
+				m.statusMessage = fmt.Sprintf("Smoke test for %s failed: %s", t.tag, msg.result.detail)
+			}
+			t.appendLog(fmt.Sprintf("Smoke test %s: %s", verdict, msg.result.detail))
+			m.updateTunnelList()
+		}
+
+	case uptimeTickMsg:
+		if m.listSort == sortUptime || m.listSort == sortStatus {
+			m.updateTunnelList()
+		}
+		return m, uptimeTickCmd()
+
+	case schedulesLoadedMsg:
+		return m.schedulesLoaded(msg)
+
+	case scheduleTickMsg:
+		return m.runSchedules(msg.at)
+
+	case closeTickMsg:
+		return m.closeExpired(time.Now())
+
+	case throughputTickMsg:
+		return m.sampleThroughputs()
+
+	case lazyWakeMsg:
+		return m.wakeLazy(msg)
+
+	case adoptableMsg:
+		return m.offerAdoption(msg), nil
 
-	case connectingMsg:
-		if m.view == viewNewTunnel && m.step == stepConnecting {
+	case adoptedExitMsg:
+		return m.adoptedExited(msg)
+
+	case shutdownMsg:
+		m.stopTunnels()
+		return m, tea.Quit
+
+	case proxyConnsMsg:
+		return m, m.proxyConnsCounted(msg)
+
+	case shellExitMsg:
+		m.shellExited(msg)
+		return m, nil
+
+	case tshNodesMsg:
+		m.tshListing = false
+		m.tshNodes, m.tshLabels, m.tshErr = msg.nodes, msg.labels, msg.err
+		if msg.err != nil {
+			slog.Warn("cannot list teleport nodes", "err", msg.err)
+		}
+		return m, nil
+
+	case tshLoginMsg:
+		return m.tshLoggedIn(msg)
+
+	case tshLoginCheckedMsg:
+		return m.tshLoginChecked(msg)
+
+	case proxyTestMsg:
+		if t := m.tunnelByID(msg.tunnelID); t != nil {
+			t.proxyTest = msg.result
+			slog.Info("proxy test", append(t.logAttrs(), "ok", msg.result.ok, "detail", msg.result.detail)...)
+			verdict := "passed"
+			if !msg.result.ok {
+				verdict = "FAILED"
+				m.statusMessage = fmt.Sprintf("Proxy test for %s failed: %s", t.tag, msg.result.detail)
+			} else {
+				m.statusMessage = fmt.Sprintf("Proxy test for %s passed", t.tag)
+			}
+			t.appendLog(fmt.Sprintf("Proxy test %s: %s", verdict, msg.result.detail))
+		}
+
+	case tunnelExitMsg:
+		t := m.tunnelByID(msg.tunnelID)
+		if t != nil && t.cmd == msg.cmd && t.restarting {
+			// Its port is free now. Mid-wizard, it waits its turn
+			t.restarting = false
+			m.pendingStarts = append(m.pendingStarts, t.id)
+			if m.view == viewMain {
+				return m.startNext()
+			}
+			break
+		}
+		if t == nil || t.cmd != msg.cmd || !t.active {
+			// Removed or stopped on purpose
+			break
+		}
+		name := "ssh"
+		if t.backend != "" {
+			name = t.backend
+		}
+		slog.Warn("tunnel process exited", append(t.logAttrs(), "state", msg.state)...)
+		if t.lazy != nil {
+			t.appendLog(fmt.Sprintf("%s exited (%s), connecting again for the next client", name, msg.state))
+			t.sleep()
+			m.updateTunnelList()
+			cmds = append(cmds, lazyWaitCmd(t.id, t.lazy, lazyRetryDelay))
+			break
+		}
+		t.appendLog(fmt.Sprintf("%s exited (%s), tunnel is down", name, msg.state))
+		t.stop()
+		m.markFailed(t, fmt.Sprintf("%s exited (%s)", name, msg.state))
+		m.updateTunnelList()
+		if t.backend == teleportBackend {
+			// An expired login is the usual reason, and tsh doesn't say so plainly
+			cmds = append(cmds, checkTshLoginCmd(t.id))
+		}
+		cmds = append(cmds, m.notify(t.tag+" is down", fmt.Sprintf("%s to %s exited (%s)", name, t.host, msg.state)))
+
+	case muxForwardedMsg:
+		return m.muxForwarded(msg)
+
+	case muxDownMsg:
+		return m.muxDown(msg)
+
+	case protocolMsg:
+		t := m.tunnelByID(msg.tunnelID)
+		if t == nil {
+			break
+		}
+		if msg.forward > 0 {
+			if msg.forward <= len(t.forwards) {
+				t.forwardChecked(msg.forward-1, msg)
+			}
+			break
+		}
+		if t.native == nil && (msg.reachable || t.tunnelType == "remote") {
+			// The native client tells when it is connected itself
+			if t.connected() {
+				m.recordEvent(t.tag + " connected")
+			}
+		}
+		if !msg.reachable {
+			slog.Warn("local port not accepting connections", append(t.logAttrs(), "local_port", t.localPort)...)
+			t.appendLog("Local port " + t.localPort + " is not accepting connections")
+			break
+		}
+		t.protocol = msg.protocol
+		slog.Debug("protocol detected", append(t.logAttrs(), "protocol", msg.protocol)...)
+		name := "unknown"
+		if msg.protocol != "" {
+			name = protocolNames[msg.protocol]
+		}
+		t.appendLog("Detected protocol: " + name)
+
+		if m.cfg.MDNS && t.active && t.mdns == nil {
+			announcement, err := announceService(t.tag, t.protocol, t.localPort)
+			if err != nil {
+				slog.Warn("mdns announcement failed", append(t.logAttrs(), "err", err)...)
+				t.appendLog(err.Error())
+			} else {
+				t.mdns = announcement
+				t.appendLog(fmt.Sprintf("Announced %s.%s.local on port %s, relaying to %s", t.tag, mdnsServiceType(t.protocol), announcement.port, t.localPort))
+			}
+		}
+		m.updateTunnelList()
+
+	case prepMsg:
+		if m.view == viewNewTunnel && m.step == stepConnecting && m.err == nil {
+			m.tempPrepLogs = msg.output
+			if msg.err != nil {
+				slog.Warn("preparation command failed", "host", m.tempHost, "command", m.tempPrep, "err", msg.err)
+				m.err = msg.err
+				return m, nil
+			}
 			return m.finalizeTunnel()
 		}
 
 	case spinner.TickMsg:
-		var cmd tea.Cmd
-		m.spinner, cmd = m.spinner.Update(msg)
-		cmds = append(cmds, cmd)
-
-	case logMsg:
-		// Legacy - logs are now updated directly by goroutines
-		break
+		// Let the spinner stop while nothing shows it, so an idle screen
+		// doesn't redraw at all
+		if m.spinnerVisible() {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			cmds = append(cmds, cmd)
+		}
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 
-		// Update list size
-		listWidth := 36
-		listHeight := msg.Height - 12
-		if listHeight < 5 {
-			listHeight = 5
-		}
-		m.tunnelList.SetSize(listWidth, listHeight)
+		m.sizeList()
 
 	case tea.MouseMsg:
+		if m.view == viewLogs {
+			return m.updateLogViewMouse(msg)
+		}
 		if msg.Type == tea.MouseLeft {
 			y := msg.Y - 4
 			x := msg.X
-			panelWidth := 40
+			panelWidth := m.sidebarWidth
 
-			if m.view == viewMain {
+			if m.view == viewMain && m.dashboard {
+				if row := y - dashboardTableTop; row >= 0 {
+					m.clickDashboard(row)
+				}
+			} else if m.view == viewMain {
 				if x < panelWidth {
 					m.selectedPanel = 0
-					if y >= 3 && y < len(m.tunnels)+3 {
-						idx := y - 3
-						if idx < len(m.tunnels) {
-							m.tunnelList.Select(idx)
-							m.selectedTunnel = idx
-						}
+					if row := m.listRowAt(y); row >= 0 {
+						m.tunnelList.Select(row)
+						m.selectRow(row)
 					}
 				} else {
 					m.selectedPanel = 1
@@ -267,61 +1254,131 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case tea.KeyMsg:
+		if m.view == viewNewTunnel && m.reviewEditing {
+			return m.updateReviewEdit(msg)
+		}
+		if m.view == viewLogs {
+			return m.handleLogViewKey(msg)
+		}
+		if m.view == viewAuthPrompt && msg.String() != "ctrl+c" {
+			return m.handleAuthPromptKey(msg)
+		}
+		if m.view == viewSettings && msg.String() != "ctrl+c" {
+			return m.handleSettingsKey(msg)
+		}
+		if m.view == viewHistory && msg.String() != "ctrl+c" {
+			return m.handleClosedKey(msg)
+		}
+		if m.view == viewTopology && msg.String() != "ctrl+c" {
+			return m.handleTopologyKey(msg)
+		}
+		if m.view == viewMain && m.logSearching && msg.String() != "ctrl+c" {
+			return m.handleLogSearchKey(msg)
+		}
+		if m.view == viewMain && m.listFiltering && msg.String() != "ctrl+c" {
+			return m.handleListFilterKey(msg)
+		}
+		if m.view == viewMain && m.adoptPending && msg.String() != "ctrl+c" {
+			return m.handleAdoptKey(msg)
+		}
+		if m.view == viewMain && m.bulkPending && msg.String() != "ctrl+c" {
+			return m.handleBulkKey(msg)
+		}
+		if m.view == viewMain && m.exportPending && msg.String() != "ctrl+c" {
+			return m.handleExportKey(msg)
+		}
+		if m.view == viewMain && m.fileEditing && msg.String() != "ctrl+c" {
+			return m.handleTunnelsFileKey(msg)
+		}
+		if m.view == viewMain && m.groupEditing && msg.String() != "ctrl+c" {
+			return m.handleGroupKey(msg)
+		}
+		if m.view == viewMain && m.noteEditing && msg.String() != "ctrl+c" {
+			return m.handleNoteKey(msg)
+		}
+		if m.view == viewNewTunnel && m.step == stepHost && msg.String() != "ctrl+c" {
+			return m.handleHostPickerKey(msg)
+		}
+		if m.view == viewNewTunnel && m.step == stepIdentity && msg.String() != "ctrl+c" {
+			return m.handleIdentityKey(msg)
+		}
+		if m.view == viewNewTunnel && m.step == stepAdvanced && msg.String() != "ctrl+c" {
+			return m.handleAdvancedKey(msg)
+		}
+		if m.view == viewNewTunnel && m.step == stepReview && msg.String() != "ctrl+c" {
+			return m.handleReviewKey(msg)
+		}
+		if m.view == viewNewTunnel && m.step == stepTemplate {
+			// Digits pick a template in one keystroke
+			if k := msg.String(); len(k) == 1 && k >= "1" && k <= "9" {
+				if n := int(k[0] - '0'); n <= len(m.cfg.templates()) {
+					return m.applyTemplate(n - 1)
+				}
+				return m, nil
+			} else if k == "c" {
+				m.toCustomPorts()
+				return m, nil
+			}
+		}
+
 		// Handle text input first for forms
-		if m.view == viewNewTunnel && (m.step == stepRemotePort || m.step == stepLocalPort || m.step == stepTag || m.step == stepManualHost) {
+		if m.view == viewNewTunnel && isTextStep(m.step) {
 			switch msg.String() {
 			case "esc":
 				m.view = viewMain
 				return m, nil
 			case "enter":
+				if m.input.Err != nil {
+					return m, nil
+				}
 				return m.handleEnter()
 			case "backspace":
-				if len(m.input) > 0 {
-					m.input = m.input[:len(m.input)-1]
+				if m.input.Value() == "" && m.step == stepForwards && len(m.tempForwards) > 0 {
+					m.tempForwards = m.tempForwards[:len(m.tempForwards)-1]
+					return m, nil
 				}
-			default:
-				if m.step == stepRemotePort || m.step == stepLocalPort {
-					if len(msg.String()) == 1 && msg.String()[0] >= '0' && msg.String()[0] <= '9' {
-						m.input += msg.String()
-					}
-				} else if m.step == stepTag {
-					if len(msg.String()) == 1 {
-						c := msg.String()[0]
-						if c == ' ' {
-							m.input += "_"
-						} else if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
-							m.input += msg.String()
-						} else if c >= 'A' && c <= 'Z' {
-							m.input += strings.ToLower(msg.String())
+			case "l", "c":
+				if m.step == stepRemotePort && m.tempBackend == "" && m.tempType == "" && m.tempRemoteHost == "" {
+					if !m.discovering {
+						m.discovering = true
+						m.err = nil
+						discover := discoverListenersCmd(m.tempHost)
+						if msg.String() == "c" {
+							discover = discoverContainersCmd(m.tempHost)
 						}
-					}
-				} else if m.step == stepManualHost {
-					if len(msg.String()) == 1 {
-						c := msg.String()[0]
-						if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '@' {
-							m.input += msg.String()
+						if m.demo {
+							discover = demoPortChoicesCmd()
 						}
+						return m, tea.Batch(m.spinner.Tick, discover)
 					}
+					return m, nil
 				}
 			}
+			return m.updateInput(msg)
+		}
+
+		if m.view == viewMain {
+			return m.handleMainKey(msg)
+		}
+		if m.view == viewDebug && key.Matches(msg, m.keys.Debug) {
+			m.view = viewMain
 			return m, nil
 		}
 
 		// Handle other commands
 		switch msg.String() {
-		case "?":
-			if m.view == viewMain {
-				m.view = viewHelp
+		case "ctrl+c", "q":
+			if m.view == viewQuitConfirm && !m.admin() {
+				// Only admins stop the daemon: the others leave it
+				slog.Info("detaching client", "user", m.user.name)
+				m.view = viewMain
+				m.daemon.detach()
 				return m, nil
 			}
-
-		case "ctrl+c", "q":
 			if m.view == viewQuitConfirm {
 				// Already in quit confirm, force quit
 				for i := range m.tunnels {
-					if m.tunnels[i].active && m.tunnels[i].cmd != nil {
-						m.tunnels[i].cmd.Process.Kill()
-					}
+					m.tunnels[i].stop()
 				}
 				return m, tea.Quit
 			}
@@ -334,20 +1391,45 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.view = viewQuitConfirm
 			return m, nil
 
-		case "tab":
-			if m.view == viewMain {
-				m.selectedPanel = (m.selectedPanel + 1) % 2 // Only 2 panels now
+		case "e":
+			if m.view == viewDebug {
+				m.statusMessage = "Writing diagnostic bundle..."
+				return m, diagnosticBundleCmd(m.diagnostics())
+			}
+
+		case "u":
+			if m.view == viewProfiles && !m.fetchingProfiles {
+				if !m.admin() {
+					m.statusMessage = "Only admins can update the profiles"
+					return m, nil
+				}
+				if m.cfg.ProfilesURL == "" {
+					m.statusMessage = "Set profiles_url in the config to update profiles"
+					return m, nil
+				}
+				m.fetchingProfiles = true
+				m.statusMessage = "Fetching profiles from " + m.cfg.ProfilesURL + "..."
+				return m, tea.Batch(m.spinner.Tick, fetchProfileBundleCmd(m.cfg.ProfilesURL))
 			}
 
 		case "n":
-			if m.view == viewMain && m.selectedPanel == 0 {
-				m.view = viewNewTunnel
-				m.step = stepHost
-				m.cursor = 0
-				m.hostScroll = 0
-				m.input = ""
-				m.err = nil
-			} else if m.view == viewQuitConfirm {
+			if m.view == viewNewTunnel && m.step == stepLazy {
+				m.tempLazy = false
+				m.toReview()
+				return m, nil
+			}
+			if m.view == viewNewTunnel && m.step == stepCompression {
+				off := false
+				m.tempCompression = &off
+				m.toCiphersStep()
+				return m, nil
+			}
+			if m.view == viewImportConfirm {
+				m.importChanges = nil
+				m.view = viewProfiles
+				return m, nil
+			}
+			if m.view == viewQuitConfirm {
 				m.view = viewMain
 			}
 
@@ -356,23 +1438,32 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.view = viewMain
 			}
 
-		case "m":
-			if m.view == viewNewTunnel && m.step == stepHost {
-				m.step = stepManualHost
-				m.input = ""
-			}
-
 		case "esc", "escape":
 			if m.view == viewNewTunnel && m.step == stepHostIP {
 				m.step = stepHost
 				m.hostIPs = nil
+				m.err = nil
+			} else if m.view == viewNewTunnel && m.step == stepRemotePortPick {
+				m.step = stepRemotePort
+				m.portChoices = nil
+				m.err = nil
+			} else if m.view == viewNewTunnel && m.step == stepConnecting && m.err != nil && m.queued() {
+				// Skip the tunnel that failed and go on with the others
+				m.view = viewMain
+				return m.startNext()
 			} else if m.view == viewNewTunnel {
 				m.view = viewMain
+				m.pendingStarts, m.pendingProfiles = nil, nil
+			} else if m.view == viewImportConfirm {
+				m.importChanges = nil
+				m.view = viewProfiles
+			} else if m.view == viewProfiles {
+				m.view = viewMain
 			} else if m.view == viewQuitConfirm {
 				m.view = viewMain
 			} else if m.view == viewDeleteConfirm {
 				m.view = viewMain
-			} else if m.view == viewHelp {
+			} else if m.view == viewHelp || m.view == viewDebug {
 				m.view = viewMain
 			}
 
@@ -380,245 +1471,1137 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.handleEnter()
 
 		case "up", "k":
-			if m.view == viewMain && m.selectedPanel == 0 {
-				// Let list handle navigation
-			} else if m.view == viewMain && m.selectedPanel == 1 {
-				// Scroll logs up
-				if m.logScroll > 0 {
-					m.logScroll--
-				}
-			} else if m.view == viewNewTunnel && m.step == stepHost {
-				if m.cursor > 0 {
-					m.cursor--
-				}
-				if m.cursor < m.hostScroll {
-					m.hostScroll = m.cursor
-				}
-			} else if m.view == viewNewTunnel && m.step == stepHostIP {
+			if m.view == viewNewTunnel && m.step == stepHostIP {
 				if m.hostIPIndex > 0 {
 					m.hostIPIndex--
 				}
 				if m.hostIPIndex < m.hostIPScroll {
 					m.hostIPScroll = m.hostIPIndex
 				}
-			}
-
-		case "down", "j":
-			if m.view == viewMain && m.selectedPanel == 0 {
-				// Let list handle navigation
-			} else if m.view == viewMain && m.selectedPanel == 1 {
-				// Scroll logs down
-				if len(m.tunnels) > 0 && m.selectedTunnel < len(m.tunnels) {
-					maxScroll := len(m.tunnels[m.selectedTunnel].logs) - 1
-					if m.logScroll < maxScroll {
-						m.logScroll++
-					}
+			} else if m.view == viewNewTunnel && m.step == stepRemotePortPick {
+				if m.portIndex > 0 {
+					m.portIndex--
+				}
+				if m.portIndex < m.portScroll {
+					m.portScroll = m.portIndex
 				}
-			} else if m.view == viewNewTunnel && m.step == stepHost {
-				if m.cursor < len(m.hosts)-1 {
-					m.cursor++
+			} else if m.view == viewNewTunnel && m.step == stepBackend {
+				if m.backendIndex > 0 {
+					m.backendIndex--
 				}
-				if m.cursor >= m.hostScroll+maxHostVisible {
-					m.hostScroll = m.cursor - maxHostVisible + 1
+			} else if m.view == viewNewTunnel && m.step == stepTunnelType {
+				if m.typeIndex > 0 {
+					m.typeIndex--
 				}
-			} else if m.view == viewNewTunnel && m.step == stepHostIP {
+			} else if m.view == viewNewTunnel && m.step == stepTemplate {
+				if m.templateIndex > 0 {
+					m.templateIndex--
+				}
+			} else if m.view == viewProfiles {
+				if m.profileIndex > 0 {
+					m.profileIndex--
+				}
+				if m.profileIndex < m.profileScroll {
+					m.profileScroll = m.profileIndex
+				}
+			}
+
+		case "down", "j":
+			if m.view == viewNewTunnel && m.step == stepHostIP {
 				if m.hostIPIndex < len(m.hostIPs)-1 {
 					m.hostIPIndex++
 				}
 				if m.hostIPIndex >= m.hostIPScroll+maxHostVisible {
 					m.hostIPScroll = m.hostIPIndex - maxHostVisible + 1
 				}
+			} else if m.view == viewNewTunnel && m.step == stepRemotePortPick {
+				if m.portIndex < len(m.portChoices)-1 {
+					m.portIndex++
+				}
+				if m.portIndex >= m.portScroll+maxHostVisible {
+					m.portScroll = m.portIndex - maxHostVisible + 1
+				}
+			} else if m.view == viewNewTunnel && m.step == stepBackend {
+				if m.backendIndex < len(m.backendNames)-1 {
+					m.backendIndex++
+				}
+			} else if m.view == viewNewTunnel && m.step == stepTunnelType {
+				if m.typeIndex < len(tunnelTypes)-1 {
+					m.typeIndex++
+				}
+			} else if m.view == viewNewTunnel && m.step == stepTemplate {
+				if m.templateIndex < len(m.cfg.templates()) {
+					m.templateIndex++
+				}
+			} else if m.view == viewProfiles {
+				if m.profileIndex < len(m.profiles)-1 {
+					m.profileIndex++
+				}
+				if m.profileIndex >= m.profileScroll+maxHostVisible {
+					m.profileScroll = m.profileIndex - maxHostVisible + 1
+				}
 			}
 
 		case "d":
-			if m.view == viewMain && m.selectedPanel == 0 && len(m.tunnels) > 0 {
-				idx := m.tunnelList.Index()
-				if idx < len(m.tunnels) {
-					m.view = viewDeleteConfirm
-					m.deleteTunnelIdx = idx
-				}
+			if m.view == viewQuitConfirm && m.daemon != nil {
+				slog.Info("detaching client")
+				m.view = viewMain
+				m.daemon.detach()
 			}
 
 		case "y", "Y":
 			if m.view == viewNewTunnel && m.step == stepVerbose {
 				m.tempVerbose = true
-				m.step = stepConnecting
-				return m, tea.Batch(m.spinner.Tick, waitForConnection())
+				m.toLinkSteps()
+				return m, nil
+			} else if m.view == viewNewTunnel && m.step == stepLazy {
+				m.tempLazy = true
+				m.toReview()
+				return m, nil
+			} else if m.view == viewNewTunnel && m.step == stepCompression {
+				on := true
+				m.tempCompression = &on
+				m.toCiphersStep()
+				return m, nil
+			} else if m.view == viewImportConfirm {
+				merged := mergeProfiles(m.profiles, m.importChanges)
+				if err := saveProfiles(merged); err != nil {
+					m.statusMessage = "Cannot save profiles: " + err.Error()
+				} else {
+					slog.Info("profiles merged", "url", m.cfg.ProfilesURL, "changes", len(m.importChanges))
+					m.statusMessage = fmt.Sprintf("Merged %d profile(s)", len(m.importChanges))
+					m.profiles = merged
+				}
+				m.importChanges = nil
+				m.view = viewProfiles
+			} else if m.view == viewQuitConfirm && !m.admin() {
+				m.view = viewMain
+				m.statusMessage = "Only admins can stop the daemon; press q, then d to detach"
 			} else if m.view == viewQuitConfirm {
 				// Confirm quit
-				for i := range m.tunnels {
-					if m.tunnels[i].active && m.tunnels[i].cmd != nil {
-						m.tunnels[i].cmd.Process.Kill()
-					}
-				}
+				m.stopTunnels()
 				return m, tea.Quit
 			} else if m.view == viewDeleteConfirm {
-				idx := m.deleteTunnelIdx
-				if idx < len(m.tunnels) {
-					if m.tunnels[idx].active && m.tunnels[idx].cmd != nil {
-						m.tunnels[idx].cmd.Process.Kill()
-						m.tunnels[idx].active = false
-					}
-					m.tunnels = append(m.tunnels[:idx], m.tunnels[idx+1:]...)
-					m.updateTunnelList()
-					if idx >= len(m.tunnels) && idx > 0 {
-						m.selectedTunnel = idx - 1
-					}
+				if len(m.marked()) > 0 {
+					m.deleteMarked()
+				} else if m.deleteTunnelIdx < len(m.tunnels) {
+					tag := m.tunnels[m.deleteTunnelIdx].tag
+					m.removeTunnel(m.deleteTunnelIdx)
+					m.statusMessage = fmt.Sprintf("Deleted %s • %s to undo", tag, m.keys.Undo.Help().Key)
 				}
 				m.view = viewMain
 			}
 		}
 	}
 
-	// Update list if in main view and left panel selected
-	if m.view == viewMain && m.selectedPanel == 0 {
-		var cmd tea.Cmd
-		m.tunnelList, cmd = m.tunnelList.Update(msg)
-		m.selectedTunnel = m.tunnelList.Index()
-		cmds = append(cmds, cmd)
+	// Update list if in main view and left panel selected
+	if m.view == viewMain && m.selectedPanel == 0 && !m.dashboard {
+		cmds = append(cmds, m.updateList(msg))
+	}
+
+	// ctrl+v in a wizard field pastes through a message of its own
+	if _, isKey := msg.(tea.KeyMsg); !isKey && m.view == viewNewTunnel && isTextStep(m.step) {
+		next, cmd := m.updateInput(msg)
+		return next, tea.Batch(append(cmds, cmd)...)
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+// updateList passes msg to the tunnel list and follows its selection.
+func (m *model) updateList(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	prev := m.tunnelList.Index()
+	m.tunnelList, cmd = m.tunnelList.Update(msg)
+	if m.tunnelList.Index() != prev {
+		m.logScroll = 0
+		m.restoreTunnel = ""
+	}
+	m.selectRow(m.tunnelList.Index())
+	return cmd
+}
+
+// sizeList fits the tunnel list to the sidebar.
+func (m *model) sizeList() {
+	listHeight := m.height - 12
+	if listHeight < 5 {
+		listHeight = 5
+	}
+	m.tunnelList.SetSize(m.sidebarWidth-4, listHeight)
+}
+
+// resizeSidebar moves the split between the sidebar and the logs by delta
+// columns, leaving the logs at least minBodyWidth.
+func (m *model) resizeSidebar(delta int) {
+	width := max(minSidebarWidth, min(m.sidebarWidth+delta, m.width-4-minBodyWidth))
+	if width == m.sidebarWidth {
+		return
+	}
+	m.sidebarWidth = width
+	m.sizeList()
+}
+
+// tunnelByID finds a tunnel by the id its messages carry. Entries are
+// pointers, so the result stays valid while the list grows or shrinks.
+func (m *model) tunnelByID(id int) *tunnel {
+	for _, t := range m.tunnels {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// removeTunnel stops the tunnel at idx and drops it from the list, keeping
+// it for undo.
+func (m *model) removeTunnel(idx int) {
+	t := m.tunnels[idx]
+	slog.Info("tunnel removed", t.logAttrs()...)
+	running, recorded := t.active || t.demo != nil, !t.retired
+	t.stop()
+	t.marked = false
+	m.retire(t, deletedReason)
+	m.pushDeleted(deletedTunnel{t: t, idx: idx, running: running, recorded: recorded})
+	m.tunnels = append(m.tunnels[:idx], m.tunnels[idx+1:]...)
+	if m.selectedGroup == "" && m.selectedTunnel >= len(m.tunnels) && len(m.tunnels) > 0 {
+		m.selectedTunnel = len(m.tunnels) - 1
+	}
+	m.updateTunnelList()
+}
+
+// toPortStep moves the wizard on from picking a host. A local forward
+// offers the templates first; a SOCKS proxy has no remote port, so it goes
+// straight to the local one.
+func (m *model) toPortStep() {
+	m.step = stepRemotePort
+	m.tempRemoteHost = ""
+	switch m.tempType {
+	case "socks":
+		m.tempRemote = ""
+		m.step = stepLocalPort
+	case "":
+		m.templateIndex = 0
+		m.step = stepTemplate
+	}
+	m.suggestFromHistory()
+}
+
+// toCustomPorts leaves the templates for entering the ports by hand. A
+// local forward over SSH first asks where to forward to.
+func (m *model) toCustomPorts() {
+	m.step = stepRemotePort
+	if usesSSH(m.tempBackend) {
+		m.setInput("localhost")
+		m.step = stepRemoteHost
 	}
+	m.suggestFromHistory()
+}
 
-	return m, tea.Batch(cmds...)
+// checkLocalPort fails when port is already forwarded by one of our
+// tunnels, naming it, or bound by something else on this machine.
+func (m *model) checkLocalPort(port string) error {
+	for i := range m.tunnels {
+		if m.tunnels[i].active && slices.Contains(m.tunnels[i].spec().localPorts(), port) {
+			return fmt.Errorf("local port %s is already used by tunnel %s", port, m.tunnels[i].tag)
+		}
+	}
+	if isPortInUse(port) {
+		return fmt.Errorf("local port %s is already in use by another program", port)
+	}
+	return nil
 }
 
 func (m *model) updateTunnelList() {
-	items := make([]list.Item, len(m.tunnels))
-	for i, t := range m.tunnels {
-		items[i] = t
-	}
+	items, rows := m.sidebarItems()
 	m.tunnelList.SetItems(items)
+	m.tunnelList.Title = m.listTitle("ACTIVE TUNNELS")
+	m.listRows = rows
+	m.numberTunnels()
+	recordTunnels(m.tunnels)
+
+	// Reselect the tunnel that was selected last time once it is back
+	if m.restoreTunnel != "" {
+		for i := range m.tunnels {
+			if m.tunnels[i].tag == m.restoreTunnel {
+				m.selectedGroup = ""
+				m.selectedTunnel = i
+				m.restoreTunnel = ""
+				break
+			}
+		}
+	}
+	m.syncSelection()
+
+	if m.landing != nil {
+		summaries := make([]tunnelSummary, len(m.tunnels))
+		for i := range m.tunnels {
+			summaries[i] = m.tunnels[i].summary()
+		}
+		m.landing.publish(summaries)
+	}
 }
 
 func (m model) handleEnter() (tea.Model, tea.Cmd) {
+	if m.view == viewProfiles && m.profileIndex < len(m.profiles) {
+		m.tempResume = 0
+		return m.startProfile(m.profiles[m.profileIndex])
+	}
 	if m.view == viewNewTunnel {
 		switch m.step {
+		case stepBackend:
+			m.tempBackend = ""
+			m.step = stepTunnelType
+			if name := m.backendNames[m.backendIndex]; name == nativeBackend {
+				m.tempBackend = name
+			} else if name == kubectlBackend {
+				return m.startKube()
+			} else if name == teleportBackend {
+				return m.startTeleport()
+			} else if m.backendIndex > 0 {
+				// Other backends don't take ssh config hosts
+				m.tempBackend = m.backendNames[m.backendIndex]
+				m.setInput("")
+				m.step = stepManualHost
+			}
+
+		case stepTunnelType:
+			m.tempType = tunnelTypes[m.typeIndex].value
+			m.step = stepHost
+			m.hostFilter = ""
+			m.cursor = 0
+			m.hostScroll = 0
+
 		case stepHost:
-			selectedHost := m.hosts[m.cursor]
+			recents := m.recentMatches()
+			if m.cursor < len(recents) {
+				next, err := m.pickRecent(m.history[recents[m.cursor].Index])
+				if err != nil {
+					m.err = err
+					return m, nil
+				}
+				next.err = nil
+				return next, next.resolveRouteCmd()
+			}
+			matches := m.hostMatches()
+			idx := m.cursor - len(recents)
+			if idx >= len(matches) && m.tempBackend == teleportBackend && errors.Is(m.tshErr, errTshLogin) && m.hostFilter == "" {
+				return m.tshLogin()
+			}
+			if idx >= len(matches) {
+				// Nothing matches: take what was typed as the host
+				m.step = stepManualHost
+				m.setInput(m.hostFilter)
+				m.err = nil
+				return m, nil
+			}
+			selectedHost := matches[idx].Str
 			m.hostIPs = extractAllHostnames(selectedHost)
 			if len(m.hostIPs) > 1 {
 				m.step = stepHostIP
 				m.hostIPIndex = 0
 				m.hostIPScroll = 0
 			} else {
-				m.tempHost = extractHostname(selectedHost)
-				m.step = stepRemotePort
+				host := extractHostname(selectedHost)
+				if err := m.policy.checkHost(host); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.tempHost = host
+				m.err = nil
+				m.toPortStep()
+				return m, m.resolveRouteCmd()
 			}
 
 		case stepHostIP:
+			if err := m.policy.checkHost(m.hostIPs[m.hostIPIndex]); err != nil {
+				m.err = err
+				return m, nil
+			}
 			m.tempHost = m.hostIPs[m.hostIPIndex]
 			m.hostIPs = nil
-			m.step = stepRemotePort
+			m.err = nil
+			m.toPortStep()
+			return m, m.resolveRouteCmd()
 
 		case stepManualHost:
-			if m.input != "" {
-				m.tempHost = m.input
-				m.input = ""
-				m.step = stepRemotePort
+			if m.input.Value() != "" {
+				if m.tempBackend == kubectlBackend {
+					if _, err := parseKubeTarget(m.input.Value()); err != nil {
+						m.err = err
+						return m, nil
+					}
+				}
+				if err := m.policy.checkHost(m.input.Value()); err != nil {
+					m.err = err
+					return m, nil
+				}
+				m.tempHost = m.input.Value()
+				m.setInput("")
+				m.err = nil
+				m.toPortStep()
+				return m, m.resolveRouteCmd()
+			}
+
+		case stepKubeContext, stepKubeNamespace, stepKubeTarget:
+			return m.handleKubeEnter()
+
+		case stepTemplate:
+			if m.templateIndex > 0 {
+				return m.applyTemplate(m.templateIndex - 1)
+			}
+			m.toCustomPorts()
+
+		case stepRemoteHost:
+			host := m.input.Value()
+			if err := checkDestinationHost(&host); err != nil {
+				m.err = err
+				return m, nil
 			}
+			m.tempRemoteHost = host
+			m.setInput("")
+			m.err = nil
+			m.step = stepRemotePort
+			m.suggestFromHistory()
 
 		case stepRemotePort:
-			if m.input != "" {
-				m.tempRemote = m.input
-				m.input = ""
+			if m.input.Value() != "" {
+				if err := m.policy.checkRemotePort(m.input.Value()); err != nil {
+					m.err = err
+					m.setInput("")
+					return m, nil
+				}
+				m.tempRemote = m.input.Value()
+				m.setInput("")
+				m.err = nil
 				m.step = stepLocalPort
+				m.suggestFromHistory()
+			}
+
+		case stepRemotePortPick:
+			if err := m.policy.checkRemotePort(m.portChoices[m.portIndex].port); err != nil {
+				m.err = err
+				return m, nil
 			}
+			m.err = nil
+			m.tempRemote = m.portChoices[m.portIndex].port
+			m.suggestedTag = m.portChoices[m.portIndex].tag
+			m.portChoices = nil
+			m.setInput("")
+			m.step = stepLocalPort
+			m.suggestFromHistory()
 
 		case stepLocalPort:
-			if m.input != "" {
-				if isPortInUse(m.input) {
-					m.err = fmt.Errorf("port %s is already in use", m.input)
-					m.input = ""
+			if m.input.Value() != "" {
+				// A remote forward exposes a local port, so it should be in use
+				if err := m.checkLocalPort(m.input.Value()); m.tempType != "remote" && err != nil {
+					m.err = err
+					m.setInput("")
 				} else {
-					m.tempLocal = m.input
-					m.input = ""
+					m.tempLocal = m.input.Value()
+					m.setInput(m.suggestedTag)
 					m.err = nil
 					m.step = stepTag
+					if m.tempBackend == "" && m.cfg.SSHTransport != nativeBackend {
+						// Only the ssh binary takes several forwards
+						m.setInput("")
+						m.step = stepForwards
+					}
+				}
+			}
+
+		case stepForwards:
+			if strings.TrimSpace(m.input.Value()) == "" {
+				m.setInput(m.suggestedTag)
+				m.err = nil
+				m.step = stepTag
+				break
+			}
+			f, err := parseForward(m.input.Value())
+			if err == nil {
+				err = m.policy.checkRemotePort(f.RemotePort)
+			}
+			if err == nil {
+				spec := tunnelSpec{Type: m.tempType, LocalPort: m.tempLocal, Forwards: m.tempForwards}
+				if f.Type != "remote" && slices.Contains(spec.localPorts(), f.LocalPort) {
+					err = fmt.Errorf("local port %s is already forwarded by this tunnel", f.LocalPort)
+				} else if f.Type != "remote" {
+					err = m.checkLocalPort(f.LocalPort)
 				}
 			}
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.tempForwards = append(m.tempForwards, f)
+			m.setInput("")
+			m.err = nil
 
 		case stepTag:
-			if m.input == "" {
+			if m.input.Value() == "" {
 				m.tempTag = namesgenerator.GetRandomName(0)
 			} else {
-				m.tempTag = m.input
+				m.tempTag = m.input.Value()
+			}
+			m.err = nil
+			m.setInput(m.tempColor)
+			m.step = stepColor
+
+		case stepColor:
+			color := strings.ToLower(strings.TrimSpace(m.input.Value()))
+			if err := checkColor(color); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.tempColor = color
+			m.err = nil
+			if usesSSH(m.tempBackend) {
+				return m.toIdentityStep()
+			}
+			// Proxy and prep commands only apply to ssh
+			m.setInput("")
+			m.step = stepSmokeTest
+
+		case stepProxy:
+			if m.input.Value() != "" {
+				if _, err := parseProxy(m.input.Value()); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			m.tempProxy = m.input.Value()
+			m.setInput("")
+			m.err = nil
+			m.step = stepPrepCommand
+
+		case stepPrepCommand:
+			m.tempPrep = strings.TrimSpace(m.input.Value())
+			m.setInput("")
+			m.step = stepSmokeTest
+
+		case stepSmokeTest:
+			spec := strings.TrimSpace(m.input.Value())
+			if spec != "" {
+				if _, err := parseSmokeTest(spec); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			if m.tempType == "socks" {
+				if err := checkSocksSmokeTest(spec); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			m.tempSmoke = spec
+			m.setInput("")
+			m.err = nil
+			m.step = stepHealthCheck
+
+		case stepHealthCheck:
+			check := strings.TrimSpace(m.input.Value())
+			if check != "" {
+				if _, err := parseSmokeTest(check); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			if m.tempType == "socks" {
+				if err := checkSocksSmokeTest(check); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			m.tempHealth = check
+			m.setInput("")
+			m.err = nil
+			m.step = stepTLSMode
+			if m.tempType != "" {
+				// Local TLS fronts a local forward's port; skip it
+				m.tempTLS = ""
+				m.step = stepVerbose
+			}
+
+		case stepTLSMode:
+			mode, err := parseTLSMode(m.input.Value())
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.tempTLS = mode
+			m.setInput("")
+			m.err = nil
+			if !usesSSH(m.tempBackend) {
+				m.tempVerbose = false
+				m.toCloseSteps()
+				break
 			}
-			m.input = ""
 			m.step = stepVerbose
 
 		case stepVerbose:
 			m.tempVerbose = false
-			m.step = stepConnecting
-			return m, tea.Batch(m.spinner.Tick, waitForConnection())
+			m.toLinkSteps()
+
+		case stepCompression:
+			m.tempCompression = nil
+			m.toCiphersStep()
+
+		case stepCiphers:
+			ciphers, err := parseCiphers(m.input.Value())
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.tempCiphers = ciphers
+			m.toAdvancedStep()
+
+		case stepCloseAfter, stepCloseIdle:
+			return m.handleCloseStep()
+
+		case stepLazy:
+			m.tempLazy = false
+			m.toReview()
+
+		case stepConnecting:
+			// Pre-check failed and the user chose to connect anyway, or the
+			// preparation command failed and the user wants to retry it
+			if errors.Is(m.err, errTshLogin) {
+				if m.daemon != nil {
+					// Logged in from another terminal, hopefully
+					m.err = nil
+					return m.startConnecting()
+				}
+				return m.tshLogin()
+			}
+			if m.err != nil {
+				m.err = nil
+				m.tempPrecheck.err = nil
+				return m.afterPrecheck()
+			}
 		}
 	}
 	return m, nil
 }
 
-func (m *model) finalizeTunnel() (tea.Model, tea.Cmd) {
-	args := []string{"-N", "-L", fmt.Sprintf("%s:localhost:%s", m.tempLocal, m.tempRemote)}
-	if m.tempVerbose {
-		args = append(args, "-v")
+// startProfile connects a saved profile through the wizard's connecting
+// step, so it gets the same checks and error handling.
+func (m model) startProfile(p tunnelSpec) (tea.Model, tea.Cmd) {
+	for _, port := range p.localPorts() {
+		if err := m.checkLocalPort(port); err != nil {
+			m.statusMessage = fmt.Sprintf("Cannot start %s: %v", p.Tag, err)
+			m.view = viewMain
+			return m, nil
+		}
 	}
-	args = append(args, m.tempHost)
 
-	cmd := exec.Command("ssh", args...)
+	m.setTemp(p)
+	m.view = viewNewTunnel
+	return m.startConnecting()
+}
 
-	// Create pipes for stderr (SSH outputs to stderr)
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return m, nil
+// tempSpec is the tunnel the wizard has put together so far.
+func (m model) tempSpec() tunnelSpec {
+	return tunnelSpec{
+		Tag:          m.tempTag,
+		Host:         m.tempHost,
+		LocalPort:    m.tempLocal,
+		RemotePort:   m.tempRemote,
+		RemoteHost:   m.tempRemoteHost,
+		Proxy:        m.tempProxy,
+		Prep:         m.tempPrep,
+		SmokeTest:    m.tempSmoke,
+		HealthCheck:  m.tempHealth,
+		TLSMode:      m.tempTLS,
+		Verbose:      m.tempVerbose,
+		Backend:      m.tempBackend,
+		Type:         m.tempType,
+		Keepalive:    m.tempKeepalive,
+		IdentityFile: m.tempIdentity,
+		ControlPath:  m.tempControlPath,
+		Compression:  m.tempCompression,
+		Ciphers:      m.tempCiphers,
+		ForwardAgent: m.tempAgent,
+		X11:          m.tempX11,
+		CloseAfter:   m.tempCloseAfter,
+		CloseIdle:    m.tempCloseIdle,
+		Lazy:         m.tempLazy,
+		Forwards:     m.tempForwards,
+		OnConnect:    m.tempOnConnect,
+		OnDisconnect: m.tempOnDisc,
+		Web:          m.tempWeb,
+		WebURL:       m.tempWebURL,
+		Note:         m.tempNote,
+		Color:        m.tempColor,
 	}
+}
+
+// setTemp loads p into the wizard's fields.
+func (m *model) setTemp(p tunnelSpec) {
+	m.tempHost = p.Host
+	m.tempRemote = p.RemotePort
+	m.tempRemoteHost = p.RemoteHost
+	m.tempLocal = p.LocalPort
+	m.tempTag = p.Tag
+	m.tempProxy = p.Proxy
+	m.tempPrep = p.Prep
+	m.tempSmoke = p.SmokeTest
+	m.tempHealth = p.HealthCheck
+	m.tempTLS = p.TLSMode
+	m.tempVerbose = p.Verbose
+	m.tempBackend = p.Backend
+	m.tempType = p.Type
+	m.tempForwards = p.Forwards
+	m.tempKeepalive = p.Keepalive
+	m.tempIdentity = p.IdentityFile
+	m.tempControlPath = p.ControlPath
+	m.tempCompression = p.Compression
+	m.tempCiphers = p.Ciphers
+	m.tempAgent = p.ForwardAgent
+	m.tempX11 = p.X11
+	m.tempCloseAfter = p.CloseAfter
+	m.tempCloseIdle = p.CloseIdle
+	m.tempLazy = p.Lazy
+	m.tempOnConnect = p.OnConnect
+	m.tempOnDisc = p.OnDisconnect
+	m.tempWeb = p.Web
+	m.tempWebURL = p.WebURL
+	m.tempNote = p.Note
+	m.tempColor = p.Color
+}
+
+// tempSpecPorts shows the forwards entered in the wizard so far.
+func (m model) tempSpecPorts() string {
+	return tunnelSpec{Type: m.tempType, LocalPort: m.tempLocal, RemotePort: m.tempRemote, RemoteHost: m.tempRemoteHost, Forwards: m.tempForwards}.ports()
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
+// restartTunnel kills the tunnel at idx and starts it again, for a
+// connection that is up but wedged. ssh is started again once the old one
+// has exited and freed the port.
+func (m model) restartTunnel(idx int) (tea.Model, tea.Cmd) {
+	t := m.tunnels[idx]
+	slog.Info("tunnel restarted", t.logAttrs()...)
+	t.appendLog("Manually restarted")
+	running := t.hasProcess()
+	t.stop()
+	m.statusMessage = fmt.Sprintf("Restarting %s", t.tag)
+	if running {
+		t.restarting = true
+		m.updateTunnelList()
 		return m, nil
 	}
+	return m.resumeTunnel(idx)
+}
+
+// resumeTunnel starts the stopped tunnel at idx again, with the same checks
+// as a profile. It keeps its place in the list and its log.
+func (m model) resumeTunnel(idx int) (tea.Model, tea.Cmd) {
+	t := m.tunnels[idx]
+	slog.Info("tunnel resumed", t.logAttrs()...)
+	m.tempResume = t.id
+	return m.startProfile(t.spec())
+}
 
-	tunnelID := m.nextTunnelID
+func (m *model) finalizeTunnel() (tea.Model, tea.Cmd) {
+	spec := m.tempSpec()
 
-	t := tunnel{
-		id:         tunnelID,
-		tag:        m.tempTag,
-		host:       m.tempHost,
-		localPort:  m.tempLocal,
-		remotePort: m.tempRemote,
-		verbose:    m.tempVerbose,
-		cmd:        cmd,
-		active:     true,
-		logs:       []string{fmt.Sprintf("[%s] Tunnel started", time.Now().Format("15:04:05"))},
+	cmd, err := m.startTunnel(spec, m.tempPrecheck, m.tempPrepLogs, m.tempResume)
+	if err != nil {
+		m.err = err
+		return m, nil
 	}
 
-	m.tunnels = append(m.tunnels, t)
-	m.nextTunnelID++
+	m.remember(spec)
 	m.view = viewMain
-	m.selectedTunnel = len(m.tunnels) - 1
+	// Starting a group keeps its heading selected
+	if m.tempResume == 0 && (m.selectedGroup == "" || m.cfg.groupOf(m.tempTag) != m.selectedGroup) {
+		m.selectTunnel(len(m.tunnels) - 1)
+	}
+	m.tempResume = 0
+	if m.queued() {
+		next, nextCmd := m.startNext()
+		return next, tea.Batch(cmd, nextCmd)
+	}
+	return m, cmd
+}
+
+// newTunnel is a stopped tunnel with spec's settings.
+func newTunnel(id int, spec tunnelSpec) *tunnel {
+	t := &tunnel{
+		id:           id,
+		createdAt:    time.Now(),
+		tag:          spec.Tag,
+		host:         spec.Host,
+		localPort:    spec.LocalPort,
+		remotePort:   spec.RemotePort,
+		remoteHost:   spec.RemoteHost,
+		proxy:        spec.Proxy,
+		prep:         spec.Prep,
+		smokeTest:    spec.SmokeTest,
+		healthCheck:  spec.HealthCheck,
+		tlsMode:      spec.TLSMode,
+		backend:      spec.Backend,
+		tunnelType:   spec.Type,
+		keepalive:    spec.Keepalive,
+		tcp:          spec.TCP,
+		identity:     spec.IdentityFile,
+		controlPath:  spec.ControlPath,
+		compression:  spec.Compression,
+		ciphers:      spec.Ciphers,
+		forwardAgent: spec.ForwardAgent,
+		x11:          spec.X11,
+		closeAfter:   spec.CloseAfter,
+		closeIdle:    spec.CloseIdle,
+		lazyMode:     spec.Lazy,
+		onConnect:    spec.OnConnect,
+		onDisconnect: spec.OnDisconnect,
+		web:          spec.Web,
+		webLink:      spec.WebURL,
+		note:         spec.Note,
+		color:        spec.Color,
+		forwards:     make([]forwardStatus, len(spec.Forwards)),
+		verbose:      spec.Verbose,
+	}
+	for i, f := range spec.Forwards {
+		t.forwards[i].forwardSpec = f
+	}
+	return t
+}
+
+// placeTunnel puts t in the list with logs: in place of the stopped tunnel
+// at slot, carrying its log and uptime over, or at the end.
+func (m *model) placeTunnel(t *tunnel, slot int, logs []string) *tunnel {
+	t.logs = newLogRing(m.cfg.logLines())
+	if slot >= 0 {
+		prev := m.tunnels[slot]
+		t.createdAt = prev.createdAt
+		t.upTotal = prev.upTotal
+		t.reconnects = prev.reconnects + 1
+		if prev.sleeping {
+			// An on-demand tunnel waking up keeps its listener and countdown
+			t.reconnects--
+			t.lazy, t.closeAt = prev.lazy, prev.closeAt
+		}
+		// The entry is overwritten below, so its ring carries over as is
+		t.logs, t.logBytes, t.logSeq = prev.logs, prev.logBytes, prev.logSeq
+		t.owner = prev.owner
+	} else {
+		t.owner = m.user.name
+	}
+	for _, line := range logs {
+		t.pushLog(line)
+	}
+	if slot >= 0 {
+		// Keep the entry itself, so pointers to it stay valid
+		*m.tunnels[slot] = *t
+		t = m.tunnels[slot]
+	} else {
+		m.tunnels = append(m.tunnels, t)
+		m.nextTunnelID++
+	}
 	m.updateTunnelList()
+	return t
+}
+
+// startTunnel launches ssh for spec and adds the tunnel to the list. pre
+// and prepLogs carry what the reachability check and preparation command
+// found, so it can be recorded in the tunnel's log. A non-zero resumeID
+// restarts that stopped tunnel in place instead of adding one.
+func (m *model) startTunnel(spec tunnelSpec, pre precheckMsg, prepLogs []string, resumeID int) (tea.Cmd, error) {
+	if err := m.policy.check(spec); err != nil {
+		slog.Warn("tunnel blocked by policy", "tag", spec.Tag, "host", spec.Host, "err", err)
+		return nil, err
+	}
+	if spec.IdentityFile != "" && !m.demo {
+		if _, err := os.Stat(identityPath(spec.IdentityFile)); err != nil {
+			return nil, fmt.Errorf("identity file: %v", err)
+		}
+	}
+
+	// With local TLS, or to count the traffic for the idle close, the
+	// manager owns the local port and ssh forwards to an internal one
+	// behind it
+	forwardPort := spec.LocalPort
+	relay := spec.TLSMode != "" || m.relaysTraffic(spec) || spec.Lazy
+	if relay {
+		port, err := freeLocalPort()
+		if err != nil {
+			return nil, err
+		}
+		forwardPort = port
+	}
+
+	tunnelID, slot := m.nextTunnelID, -1
+	for i := range m.tunnels {
+		if resumeID != 0 && m.tunnels[i].id == resumeID && (!m.tunnels[i].active || m.tunnels[i].sleeping) {
+			tunnelID, slot = resumeID, i
+		}
+	}
+	if spec.Lazy && (slot < 0 || !m.tunnels[slot].sleeping) {
+		return m.startLazy(spec, pre, tunnelID, slot)
+	}
+
+	var (
+		cmd    *exec.Cmd
+		output *os.File
+		demo   *demoService
+		native *nativeTransport
+		mux    *muxForwards
+	)
+	if m.demo && spec.Type == "remote" {
+		// The local side is the user's own service
+		demo = &demoService{}
+	} else if m.demo {
+		protocol := demoProtocol(spec.RemotePort)
+		if spec.Type == "socks" {
+			protocol = "socks"
+		}
+		svc, err := startDemoService(forwardPort, protocol)
+		if err != nil {
+			return nil, fmt.Errorf("cannot start demo service: %v", err)
+		}
+		demo = svc
+	}
+	if demo != nil {
+		for _, f := range spec.Forwards {
+			if f.Type == "remote" {
+				continue
+			}
+			protocol := demoProtocol(f.RemotePort)
+			if f.Type == "socks" {
+				protocol = "socks"
+			}
+			svc, err := startDemoService(f.LocalPort, protocol)
+			if err != nil {
+				demo.Close()
+				return nil, fmt.Errorf("cannot start demo service: %v", err)
+			}
+			demo.forwards = append(demo.forwards, svc)
+		}
+	} else if spec.Backend == nativeBackend || (spec.Backend == "" && m.cfg.SSHTransport == nativeBackend) {
+		if spec.ControlPath != "" && spec.ControlPath != "none" {
+			return nil, fmt.Errorf("control_path needs the ssh backend")
+		}
+		nt, err := newNativeTransport(m.cfg.withDefaults(spec), forwardPort, pre.endpoint, m.policy)
+		if err != nil {
+			return nil, err
+		}
+		pr := m.prompter
+		nt.ask = func(prompt authPrompt) (string, bool) { return pr.ask(tunnelID, prompt, nt.done) }
+		native = nt
+		slog.Info("tunnel started", "tunnel", tunnelID, "tag", spec.Tag, "host", spec.Host,
+			"local_port", spec.LocalPort, "remote_port", spec.RemotePort, "backend", nativeBackend)
+	} else if m.multiplexed(spec) {
+		var err error
+		if mux, err = m.newMuxForwards(m.cfg.withDefaults(spec), forwardPort, pre, tunnelID); err != nil {
+			return nil, err
+		}
+		slog.Info("tunnel started", "tunnel", tunnelID, "tag", spec.Tag, "host", spec.Host,
+			"local_port", spec.LocalPort, "remote_port", spec.RemotePort, "control_path", mux.socket)
+	} else {
+		backend, ok := m.backends[spec.Backend]
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q", spec.Backend)
+		}
+		cmd = backend.Command(m.cfg.withDefaults(spec), forwardPort, pre, m.policy)
+		setProcessGroup(cmd)
+		if env := m.prompter.env(tunnelID); spec.Backend == "" && env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+
+		// ssh logs to stderr, other backends often to stdout; capture both
+		var writer *os.File
+		var err error
+		output, writer, err = os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+
+		// Start the command
+		err = cmd.Start()
+		writer.Close()
+		if err != nil {
+			output.Close()
+			slog.Error("cannot start tunnel", "tag", spec.Tag, "host", spec.Host, "backend", backend.Name(), "err", err)
+			return nil, fmt.Errorf("cannot start %s: %v", backend.Name(), err)
+		}
+		slog.Info("tunnel started", "tunnel", tunnelID, "tag", spec.Tag, "host", spec.Host,
+			"local_port", spec.LocalPort, "remote_port", spec.RemotePort, "backend", backend.Name(), "pid", cmd.Process.Pid)
+	}
+
+	logs := []string{fmt.Sprintf("[%s] Tunnel started", time.Now().Format("15:04:05"))}
+	if spec.Type == "remote" {
+		logs = append(logs, fmt.Sprintf("[%s] Remote forward: connections to %s:%s reach localhost:%s", time.Now().Format("15:04:05"), spec.Host, spec.RemotePort, spec.LocalPort))
+	} else if spec.Type == "socks" {
+		logs = append(logs, fmt.Sprintf("[%s] SOCKS proxy on socks5h://localhost:%s: connections leave from %s", time.Now().Format("15:04:05"), spec.LocalPort, spec.Host))
+	}
+	if demo != nil {
+		logs = append(logs, fmt.Sprintf("[%s] Demo mode: a local stand-in plays %s, no ssh is run", time.Now().Format("15:04:05"), spec.Host))
+	} else if native != nil {
+		logs = append(logs, fmt.Sprintf("[%s] Native SSH client: connecting to %s@%s", time.Now().Format("15:04:05"), native.ep.user, native.addr()))
+	} else if mux != nil && mux.master == nil {
+		logs = append(logs, fmt.Sprintf("[%s] Over the ssh master at %s: ssh -O forward %s", time.Now().Format("15:04:05"), mux.socket, strings.Join(mux.args, " ")))
+	} else if mux != nil && mux.master.users > 1 {
+		logs = append(logs, fmt.Sprintf("[%s] Sharing the ssh master connection to %s: ssh -O forward %s", time.Now().Format("15:04:05"), spec.Host, strings.Join(mux.args, " ")))
+	} else if mux != nil {
+		logs = append(logs, fmt.Sprintf("[%s] Started an ssh master connection to %s for tunnels to share: %s", time.Now().Format("15:04:05"), spec.Host, strings.Join(mux.master.cmd.Args, " ")))
+	} else if spec.Backend != "" {
+		logs = append(logs, fmt.Sprintf("[%s] Backend %s: %s", time.Now().Format("15:04:05"), spec.Backend, strings.Join(cmd.Args, " ")))
+	}
+	ep := pre.endpoint
+	if ep.proxyJump != "" || ep.proxyCommand != "" {
+		logs = append(logs, fmt.Sprintf("[%s] Route: %s", time.Now().Format("15:04:05"), ep.route(spec.Proxy)))
+	}
+	if pre.skipped != "" {
+		logs = append(logs, fmt.Sprintf("[%s] Reachability check skipped: %s", time.Now().Format("15:04:05"), pre.skipped))
+	}
+	if spec.Proxy != "" {
+		logs = append(logs, fmt.Sprintf("[%s] Connecting through proxy %s", time.Now().Format("15:04:05"), spec.Proxy))
+	} else if pre.candidates > 1 {
+		logs = append(logs, fmt.Sprintf("[%s] Reachable via %s (first of %d addresses)", time.Now().Format("15:04:05"), pre.addr, pre.candidates))
+	}
+	if len(m.policy.SSHOptions) > 0 {
+		logs = append(logs, fmt.Sprintf("[%s] SSH options set by policy: %s", time.Now().Format("15:04:05"), strings.Join(m.policy.sshArgs(), " ")))
+	}
+	if demo == nil && usesSSH(spec.Backend) {
+		logs = append(logs, fmt.Sprintf("[%s] Keepalive: %s", time.Now().Format("15:04:05"), m.cfg.withDefaults(spec).Keepalive))
+	}
+	if link := m.cfg.withLink(spec).link(); link != "" && demo == nil {
+		logs = append(logs, fmt.Sprintf("[%s] Link: %s", time.Now().Format("15:04:05"), link))
+	}
+	if tcp := m.cfg.tcp(spec); tcp.String() != "" && demo == nil && usesSSH(spec.Backend) {
+		logs = append(logs, fmt.Sprintf("[%s] TCP: %s", time.Now().Format("15:04:05"), tcp))
+		if native == nil && tcp.nativeOnly() {
+			logs = append(logs, fmt.Sprintf("[%s] ssh only takes the TCP keepalive; no_delay and the buffer sizes need the native client", time.Now().Format("15:04:05")))
+		}
+	}
+	if spec.IdentityFile != "" && demo == nil {
+		logs = append(logs, fmt.Sprintf("[%s] Logging in with %s only", time.Now().Format("15:04:05"), spec.IdentityFile))
+	}
+	if spec.Prep != "" && demo == nil {
+		logs = append(logs, fmt.Sprintf("[%s] Ran preparation command: %s", time.Now().Format("15:04:05"), spec.Prep))
+		for _, line := range prepLogs {
+			logs = append(logs, fmt.Sprintf("[%s] [prep] %s", time.Now().Format("15:04:05"), line))
+		}
+	}
+
+	t := newTunnel(tunnelID, spec)
+	t.endpoint = ep
+	t.cmd, t.demo, t.native, t.mux = cmd, demo, native, mux
+	t.active, t.startedAt = true, time.Now()
+	t.armClose()
+	t = m.placeTunnel(t, slot, logs)
 
 	// Start dedicated goroutine for this tunnel's log stream
-	// This goroutine runs independently and updates logs in background
-	go m.streamTunnelLogs(&m.tunnels[len(m.tunnels)-1], stderr)
+	// This goroutine runs independently and sends lines to the loop
+	logf := m.logSink.writer(t.id)
+	t.hookLog = logf
+	if output != nil {
+		go streamTunnelLogs(output, logf)
+	}
+	if native != nil {
+		native.start(logf)
+	}
 
-	return m, nil
+	if t.lazy != nil {
+		var ready func() bool
+		if native != nil {
+			// The built-in client takes connections before it is logged in
+			ready = func() bool { return !native.connectedSince().IsZero() }
+		}
+		t.lazy.setUpstream(forwardPort, ready)
+	} else if relay {
+		proxy, err := startTLSProxy(t.tlsMode, t.localPort, forwardPort, logf)
+		if err != nil {
+			t.appendLog(fmt.Sprintf("Cannot start local TLS %s: %v", orNone(t.tlsMode, "relay"), err))
+			t.stop()
+			m.updateTunnelList()
+			return waitTunnelCmd(t.id, cmd), nil
+		}
+		t.tlsProxy = proxy
+	}
+
+	cmds := append(t.checkCmds(), waitTunnelCmd(t.id, cmd))
+	if mux != nil {
+		// The ports are there once the master has added the forwards
+		cmds = []tea.Cmd{muxForwardCmd(t.id, mux)}
+	}
+	if t.healthCheck != "" {
+		m.healthRuns++
+		t.healthRun = m.healthRuns
+		cmds = append(cmds, healthCheckCmd(t.id, t.healthRun, t.healthCheck, t.localPort, m.cfg.healthInterval()))
+	}
+	if t.tunnelType == "socks" && native == nil && !m.proxyConnsCounting {
+		m.proxyConnsCounting = true
+		cmds = append(cmds, proxyConnsCmd(map[int]string{t.id: t.localPort}))
+	}
+	return tea.Batch(cmds...), nil
+}
+
+// checkCmds look at a tunnel that has just come up: what answers on its
+// ports, and its smoke test.
+func (t *tunnel) checkCmds() []tea.Cmd {
+	cmds := []tea.Cmd{detectProtocolCmd(t.id, t.localPort)}
+	for i, f := range t.forwards {
+		cmds = append(cmds, detectForwardCmd(t.id, i+1, f.LocalPort))
+	}
+	if t.smokeTest != "" {
+		cmds = append(cmds, smokeTestCmd(t.id, t.smokeTest, t.localPort, true))
+	}
+	return cmds
+}
+
+// tunnelExitMsg reports that a tunnel's process has exited, whether it
+// died on its own or was stopped.
+type tunnelExitMsg struct {
+	tunnelID int
+	cmd      *exec.Cmd // a resumed tunnel keeps its id but not its process
+	state    string    // e.g. "exit status 255" or "signal: killed"
+}
+
+// waitTunnelCmd waits for the tunnel's process in the background, which
+// also reaps it. Tunnels without a process need no waiting.
+func waitTunnelCmd(tunnelID int, cmd *exec.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		err := cmd.Wait()
+		if cmd.ProcessState == nil {
+			return tunnelExitMsg{tunnelID: tunnelID, cmd: cmd, state: err.Error()}
+		}
+		return tunnelExitMsg{tunnelID: tunnelID, cmd: cmd, state: cmd.ProcessState.String()}
+	}
 }
 
 // streamTunnelLogs runs in a separate goroutine per tunnel
-// It reads from stderr and updates the tunnel's logs independently
-func (m *model) streamTunnelLogs(tun *tunnel, stderr io.ReadCloser) {
+// It reads from stderr and hands each line to logf
+func streamTunnelLogs(stderr io.ReadCloser, logf func(string)) {
+	defer recoverPanic("log stream")
 	scanner := bufio.NewScanner(stderr)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line != "" {
-			tun.logMutex.Lock()
-			tun.logs = append(tun.logs, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), line))
-			if len(tun.logs) > 100 {
-				tun.logs = tun.logs[1:]
-			}
-			tun.logMutex.Unlock()
+			logf(line)
 		}
 	}
 }
 
 func (m model) View() string {
+	defer func() {
+		if r := recover(); r != nil {
+			handleCrash("view", r, debug.Stack())
+			panic(r)
+		}
+	}()
+	if m.prof != nil {
+		defer m.prof.trackView(m.prof.sample())
+	}
+
+	if m.view == viewLogs {
+		return m.renderLogView()
+	}
+
 	// Top bar
 	topBar := m.renderTopBar()
 
@@ -646,6 +2629,34 @@ func (m model) View() string {
 		return m.renderModalOverlay(mainContent, m.renderHelp())
 	}
 
+	if m.view == viewProfiles {
+		return m.renderModalOverlay(mainContent, m.renderProfiles())
+	}
+
+	if m.view == viewImportConfirm {
+		return m.renderModalOverlay(mainContent, m.renderImportConfirm())
+	}
+
+	if m.view == viewDebug {
+		return m.renderModalOverlay(mainContent, m.renderDebug())
+	}
+
+	if m.view == viewSettings {
+		return m.renderModalOverlay(mainContent, m.renderSettings())
+	}
+
+	if m.view == viewHistory {
+		return m.renderModalOverlay(mainContent, m.renderClosed())
+	}
+
+	if m.view == viewTopology {
+		return m.renderModalOverlay(mainContent, m.renderTopology())
+	}
+
+	if m.view == viewAuthPrompt {
+		return m.renderModalOverlay(mainContent, m.renderAuthPrompt())
+	}
+
 	return mainContent
 }
 
@@ -689,68 +2700,54 @@ func (m model) renderModalOverlay(background, modalContent string) string {
 }
 
 func (m model) renderStatusBar() string {
-	if m.width < 10 || m.statusMessage == "" {
+	if m.width < 10 {
 		return ""
 	}
 
-	statusStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#ABB2BF")).
-		Background(lipgloss.Color("#282C34")).
-		Padding(0, 1).
-		Width(m.width - 2)
+	statusStyle := statusBarStyle.Width(m.width - 2)
 
-	return statusStyle.Render(m.statusMessage)
+	if m.prof != nil {
+		// Keep it to one line so the layout under test doesn't change
+		return statusStyle.MaxHeight(1).Render(m.prof.summary() + "  │  " + m.statusMessage)
+	}
+	return statusStyle.Render(m.statusLine(m.statusMessage, m.width-4))
 }
 
 func (m model) renderHelp() string {
 	var content strings.Builder
 
-	titleStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#61AFEF")).
-		Bold(true).
-		Padding(0, 0, 1, 0)
-
-	keyStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#D19A66"))
+	content.WriteString("  " + helpTitleStyle.Render("Keyboard Shortcuts") + "\n\n")
 
-	descStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#5C6370"))
-
-	content.WriteString("  " + titleStyle.Render("Keyboard Shortcuts") + "\n\n")
-
-	shortcuts := []struct {
+	type shortcut struct {
 		key  string
 		desc string
-	}{
-		{"Tab", "Switch between panels"},
-		{"n", "Create new tunnel"},
-		{"d", "Delete selected tunnel"},
-		{"↑/↓ or j/k", "Navigate tunnel list"},
-		{"enter", "Select / Confirm"},
-		{"esc", "Cancel / Go back"},
-		{"q or ctrl+c", "Quit (with confirmation)"},
-		{"?", "Show this help"},
 	}
+	var shortcuts []shortcut
+	for _, a := range m.keys.actions() {
+		if a.binding.Enabled() {
+			shortcuts = append(shortcuts, shortcut{a.binding.Help().Key, a.desc})
+		}
+	}
+	shortcuts = append(shortcuts,
+		shortcut{"enter", "Select / Confirm"},
+		shortcut{"esc", "Cancel / Go back (clear the marks or the list filter, or in the logs the search)"},
+		shortcut{"ctrl+c", "Quit (with confirmation)"},
+	)
 
 	for _, s := range shortcuts {
-		content.WriteString("  " + keyStyle.Render(fmt.Sprintf("%-15s", s.key+": ")))
-		content.WriteString(descStyle.Render(s.desc) + "\n")
+		content.WriteString("  " + helpKeyStyle.Render(fmt.Sprintf("%-15s", s.key+": ")))
+		content.WriteString(helpDescStyle.Render(s.desc) + "\n")
 	}
 
-	content.WriteString("\n  " + titleStyle.Render("Tips") + "\n\n")
-	content.WriteString("  " + descStyle.Render("• Click on tunnels to select them") + "\n")
-	content.WriteString("  " + descStyle.Render("• Use scroll wheel to navigate") + "\n")
-	content.WriteString("  " + descStyle.Render("• Press 'esc' to close this help") + "\n")
-
-	content.WriteString("\n  " + descStyle.Render("Version: "+Version))
+	content.WriteString("\n  " + helpTitleStyle.Render("Tips") + "\n\n")
+	content.WriteString("  " + helpDescStyle.Render("• Click on tunnels to select them") + "\n")
+	content.WriteString("  " + helpDescStyle.Render("• Use scroll wheel to navigate") + "\n")
+	content.WriteString("  " + helpDescStyle.Render("• Press 'esc' to close this help") + "\n")
 
-	helpStyle := lipgloss.NewStyle().
-		Background(lipgloss.Color("#1E2127")).
-		Foreground(lipgloss.Color("#ABB2BF")).
-		Padding(1, 2)
+	content.WriteString("\n  " + helpDescStyle.Render("Version: "+Version))
 
 	// Create panel with content
-	modal := helpStyle.Render(content.String())
+	modal := helpOverlayStyle.Render(content.String())
 
 	// Center the panel on screen
 	centered := lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
@@ -772,12 +2769,24 @@ func (m model) renderQuitConfirm() string {
 
 	if activeTunnels > 0 {
 		content += fmt.Sprintf("You have %s active tunnel(s).\n", highlightStyle.Render(fmt.Sprintf("%d", activeTunnels)))
-		content += "All tunnels will be closed.\n\n"
+		if m.admin() {
+			content += "All tunnels will be closed.\n"
+		}
+		if m.daemon != nil {
+			content += "Detach to leave them running in the background.\n"
+		}
+		content += "\n"
 	} else {
 		content += "Are you sure you want to quit?\n\n"
 	}
 
-	content += successStyle.Render("Y") + subtleStyle.Render(" - Yes, quit   ") + errorStyle.Render("Any key") + subtleStyle.Render(" - Cancel")
+	if m.admin() {
+		content += successStyle.Render("Y") + subtleStyle.Render(" - Yes, quit   ")
+	}
+	if m.daemon != nil {
+		content += highlightStyle.Render("D") + subtleStyle.Render(" - Detach   ")
+	}
+	content += errorStyle.Render("Any key") + subtleStyle.Render(" - Cancel")
 
 	// Center content and use same style as new tunnel form
 	centeredContent := lipgloss.NewStyle().Width(60).Align(lipgloss.Center).Render(content)
@@ -791,9 +2800,11 @@ func (m model) renderQuitConfirm() string {
 
 func (m model) renderDeleteConfirm() string {
 	var content string
-	content += errorStyle.Render("Delete Tunnel") + "\n\n"
-
-	if m.selectedTunnel < len(m.tunnels) {
+	if ts := m.marked(); len(ts) > 0 {
+		content += errorStyle.Render("Delete Tunnels") + "\n\n"
+		content += m.renderDeleteMarked(ts)
+	} else if m.selectedTunnel < len(m.tunnels) {
+		content += errorStyle.Render("Delete Tunnel") + "\n\n"
 		t := m.tunnels[m.selectedTunnel]
 		content += fmt.Sprintf("Delete tunnel %s?\n", highlightStyle.Render(t.tag))
 		content += fmt.Sprintf("Host: %s → %s\n\n", t.host, t.remotePort)
@@ -809,6 +2820,58 @@ func (m model) renderDeleteConfirm() string {
 	return centered
 }
 
+func (m model) renderProfiles() string {
+	content := lipgloss.NewStyle().Bold(true).Render("Profiles") + "\n\n"
+
+	if len(m.profiles) == 0 {
+		content += subtleStyle.Render("No saved profiles yet. Press " + m.keys.SaveProfile.Help().Key + " on a tunnel to save it.")
+	}
+	start := m.profileScroll
+	end := start + maxHostVisible
+	if end > len(m.profiles) {
+		end = len(m.profiles)
+	}
+	for i := start; i < end; i++ {
+		p := m.profiles[i]
+		line := fmt.Sprintf("%-20s %s  %s", p.Tag, p.Host, p.ports())
+		if i == m.profileIndex {
+			content += selectedStyle.Render("  ▶  " + line)
+		} else {
+			content += "     " + line
+		}
+		if i < end-1 {
+			content += "\n"
+		}
+	}
+
+	if m.fetchingProfiles {
+		content += "\n\n" + m.spinner.View() + " " + subtleStyle.Render("Fetching profiles...")
+	}
+	content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to start • u to update from profiles_url • Esc to close")
+
+	modal := panelStyle.Width(70).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
+
+func (m model) renderImportConfirm() string {
+	content := highlightStyle.Render("Update Profiles") + "\n\n"
+	content += subtleStyle.Render(m.cfg.ProfilesURL) + "\n\n"
+	for _, c := range m.importChanges {
+		for _, line := range c.describe() {
+			if strings.HasPrefix(line, "+") {
+				content += successStyle.Render(line) + "\n"
+			} else {
+				content += line + "\n"
+			}
+		}
+	}
+
+	content += "\n" + successStyle.Render("Y") + subtleStyle.Render(" - Merge   ") + errorStyle.Render("N/Esc") + subtleStyle.Render(" - Cancel")
+
+	modal := panelStyle.Width(70).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
+
 func (m model) renderTopBar() string {
 	if m.width < 10 {
 		return titleStyle.Render(banner)
@@ -816,7 +2879,7 @@ func (m model) renderTopBar() string {
 
 	title := "SSH TUNNEL MANAGER"
 	version := "v" + Version
-	versionStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#5C6370"))
+	versionStyle := subtleStyle
 
 	titleWithVersion := title + " " + versionStyle.Render(version)
 	titleLen := len(title) + len(version) + 1
@@ -838,9 +2901,14 @@ func (m model) renderMainView() string {
 		return subtleStyle.Render("Terminal too small. Please resize to at least 80x20")
 	}
 
-	sidebarWidth := 40
+	// Footer: Actions/Help
+	footer := m.renderFooter(m.width)
+
+	// Reserve the top bar, the status bar, the panels' borders and the
+	// footer
+	sidebarWidth := m.sidebarWidth
 	bodyWidth := m.width - sidebarWidth - 4
-	contentHeight := m.height - 8 // Reserve space for header and footer
+	contentHeight := m.height - 6 - lipgloss.Height(footer)
 
 	if bodyWidth < 10 {
 		bodyWidth = 10
@@ -849,6 +2917,10 @@ func (m model) renderMainView() string {
 		contentHeight = 5
 	}
 
+	if m.dashboard {
+		return m.renderDashboard(m.width-2, contentHeight) + "\n" + footer
+	}
+
 	// Sidebar: Active Tunnels
 	sidebar := m.renderSidebar(sidebarWidth, contentHeight)
 
@@ -858,9 +2930,6 @@ func (m model) renderMainView() string {
 	// Join sidebar and body
 	content := lipgloss.JoinHorizontal(lipgloss.Top, sidebar, body)
 
-	// Footer: Actions/Help
-	footer := m.renderFooter(m.width)
-
 	return content + "\n" + footer
 }
 
@@ -870,13 +2939,44 @@ func (m model) renderSidebar(width, height int) string {
 		style = selectedPanelStyle.Width(width).Height(height)
 	}
 
-	if len(m.tunnels) == 0 {
-		content := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#61AFEF")).Render("ACTIVE TUNNELS") + "\n\n"
-		content += subtleStyle.Render("No tunnels active\n\nPress 'n' to create one")
-		return style.Render(content)
+	if len(m.tunnels) == 0 {
+		content := titleStyle.Render("ACTIVE TUNNELS") + "\n\n"
+		content += subtleStyle.Render("No tunnels active\n\nPress 'n' to create one")
+		return style.Render(content)
+	}
+
+	return style.Render(m.tunnelList.View())
+}
+
+// renderKey identifies a rendered detail panel.
+type renderKey struct {
+	header        string
+	tunnelID      int
+	logSeq        uint64
+	scroll        int
+	search        string // the query and what it found, see logSearchStatus
+	filterOnly    bool
+	width, height int
+	focused       bool
+}
+
+// renderCache holds the last rendered detail panel. View runs on the event
+// loop only, so it needs no lock.
+type renderCache struct {
+	key renderKey
+	out string
+	ok  bool
+}
+
+func (c *renderCache) get(key renderKey) (string, bool) {
+	if c.ok && c.key == key {
+		return c.out, true
 	}
+	return "", false
+}
 
-	return style.Render(m.tunnelList.View())
+func (c *renderCache) put(key renderKey, out string) {
+	c.key, c.out, c.ok = key, out, true
 }
 
 func (m model) renderBody(width, height int) string {
@@ -885,8 +2985,11 @@ func (m model) renderBody(width, height int) string {
 		style = selectedPanelStyle.Width(width).Height(height)
 	}
 
+	if m.selectedGroup != "" {
+		return style.Render(m.renderGroup(m.selectedGroup))
+	}
 	if len(m.tunnels) == 0 || m.selectedTunnel >= len(m.tunnels) {
-		content := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#61AFEF")).Render("TUNNEL OUTPUT") + "\n\n"
+		content := titleStyle.Render("TUNNEL OUTPUT") + "\n\n"
 		content += subtleStyle.Render("No tunnel selected")
 		return style.Render(content)
 	}
@@ -896,72 +2999,241 @@ func (m model) renderBody(width, height int) string {
 	var content strings.Builder
 
 	// Header info (no glamour needed here)
-	content.WriteString(successStyle.Render(fmt.Sprintf("▶ %s", t.tag)) + "\n\n")
+	header := successStyle
+	if t.color != "" {
+		header = t.labelStyle().Bold(true)
+	}
+	content.WriteString(header.Render(fmt.Sprintf("▶ %s", t.tag)) + "\n\n")
+	content.WriteString(renderNote(t, width-6))
 	content.WriteString(fmt.Sprintf("Host: %s\n", selectedStyle.Render(t.host)))
+	if t.backend != "" {
+		content.WriteString(fmt.Sprintf("Backend: %s\n", selectedStyle.Render(t.backend)))
+	}
+	if t.tunnelType == "remote" {
+		content.WriteString(fmt.Sprintf("Type: %s\n", selectedStyle.Render("remote forward (-R)")))
+		content.WriteString(fmt.Sprintf("Forward: %s\n", selectedStyle.Render(fmt.Sprintf("localhost:%s ← %s:%s", t.localPort, t.host, t.remotePort))))
+	}
+	if t.tunnelType == "socks" {
+		content.WriteString(fmt.Sprintf("Type: %s\n", selectedStyle.Render("SOCKS proxy (-D)")))
+		content.WriteString(fmt.Sprintf("SOCKS proxy: %s\n", selectedStyle.Render("socks5h://localhost:"+t.localPort)))
+		content.WriteString(subtleStyle.Render(fmt.Sprintf("Set the browser's SOCKS v5 host to localhost, port %s, with DNS through the proxy", t.localPort)) + "\n")
+		content.WriteString(fmt.Sprintf("Listening on: %s\n", selectedStyle.Render("localhost:"+t.localPort+" (loopback only)")))
+		content.WriteString(fmt.Sprintf("Proxied connections: %s\n", t.proxyConnsStatus()))
+		content.WriteString(fmt.Sprintf("Proxy test: %s\n", t.proxyTestStatus(m.keys)))
+	}
 	content.WriteString(fmt.Sprintf("Local Port: %s\n", selectedStyle.Render(t.localPort)))
-	content.WriteString(fmt.Sprintf("Remote Port: %s\n", selectedStyle.Render(t.remotePort)))
+	if t.tunnelType != "socks" {
+		content.WriteString(fmt.Sprintf("Remote Port: %s\n", selectedStyle.Render(t.remotePort)))
+	}
+	if t.remoteHost != "" {
+		content.WriteString(fmt.Sprintf("Destination: %s\n", selectedStyle.Render(destination(t.remoteHost, t.remotePort)+" via "+t.host)))
+	}
+	for _, f := range t.forwards {
+		status := subtleStyle.Render("pending")
+		switch {
+		case !t.active:
+			status = inactiveStyle.Render("🔴 down")
+		case f.checked && f.reachable && f.protocol != "":
+			status = activeStyle.Render("🟢 " + protocolNames[f.protocol])
+		case f.checked && f.reachable:
+			status = activeStyle.Render("🟢 up")
+		case f.checked:
+			status = inactiveStyle.Render("❌ not accepting connections")
+		}
+		content.WriteString(fmt.Sprintf("Forward: %s %s\n", selectedStyle.Render(forwardPorts(f.Type, f.LocalPort, remoteEnd(f.RemoteHost, f.RemotePort))), status))
+	}
+	if t.identity != "" {
+		content.WriteString(fmt.Sprintf("Identity: %s\n", selectedStyle.Render(t.identity)))
+	}
+	if link := m.cfg.withLink(t.spec()).link(); link != "" {
+		content.WriteString(fmt.Sprintf("Link: %s\n", selectedStyle.Render(link)))
+	}
+	if tcp := m.cfg.tcp(t.spec()).String(); tcp != "" && usesSSH(t.backend) {
+		content.WriteString(fmt.Sprintf("TCP: %s\n", selectedStyle.Render(tcp)))
+	}
+	if fwd := t.spec().forwarding(); fwd != "" {
+		content.WriteString(fmt.Sprintf("Forwarding: %s\n", selectedStyle.Render(fwd+" into sessions over this connection")))
+	}
+	if s := m.scheduleFor(t.tag); s != nil {
+		content.WriteString(fmt.Sprintf("Schedule: %s%s\n", selectedStyle.Render(s.String()), subtleStyle.Render(s.upcoming())))
+	}
+	if countdown := t.closeCountdown(); countdown != "" {
+		content.WriteString(fmt.Sprintf("Closes: %s\n", degradedStyle.Render(countdown)))
+	}
+	if t.lazy != nil {
+		content.WriteString(fmt.Sprintf("On demand: %s\n", selectedStyle.Render(t.lazyStatus(m.cfg.lazyIdle()))))
+	}
+	if t.adoptedPID != 0 {
+		content.WriteString(fmt.Sprintf("Process: %s\n", selectedStyle.Render(fmt.Sprintf("ssh pid %d, adopted (its output is not shown)", t.adoptedPID))))
+	}
+	if t.proxy != "" {
+		content.WriteString(fmt.Sprintf("Proxy: %s\n", selectedStyle.Render(t.proxy)))
+	}
+	if t.endpoint.proxyJump != "" || t.endpoint.proxyCommand != "" {
+		content.WriteString(fmt.Sprintf("Route: %s\n", selectedStyle.Render(t.endpoint.route(t.proxy))))
+	}
+	if t.protocol != "" {
+		content.WriteString(fmt.Sprintf("Protocol: %s\n", selectedStyle.Render(protocolNames[t.protocol])))
+	}
+	if t.mux != nil {
+		content.WriteString(fmt.Sprintf("SSH: %s\n", selectedStyle.Render(t.mux.status())))
+	}
+	if t.native != nil {
+		content.WriteString(fmt.Sprintf("SSH: %s\n", selectedStyle.Render(t.native.status())))
+		content.WriteString(fmt.Sprintf("Traffic: %s\n", selectedStyle.Render(t.native.traffic())))
+	}
+	for _, line := range t.throughputLines(width - 6) {
+		content.WriteString(line + "\n")
+	}
+	if t.tlsMode != "" {
+		content.WriteString(fmt.Sprintf("Local TLS: %s\n", selectedStyle.Render(t.tlsMode)))
+	}
+	if t.owner != "" {
+		content.WriteString(fmt.Sprintf("Owner: %s\n", selectedStyle.Render(t.owner)))
+	}
+	if t.prep != "" {
+		content.WriteString(fmt.Sprintf("Prep: %s\n", selectedStyle.Render(t.prep)))
+	}
+	if t.onConnect != "" || t.onDisconnect != "" {
+		content.WriteString(fmt.Sprintf("Hooks: %s\n", selectedStyle.Render(t.hooksSummary())))
+	}
+	if line := t.dockerHostLine(); line != "" {
+		content.WriteString(fmt.Sprintf("Docker: %s%s\n", selectedStyle.Render(line), subtleStyle.Render(fmt.Sprintf("  (%s copies it)", m.keys.Copy.Help().Key))))
+	}
+	if t.loginExpired && !t.active {
+		content.WriteString(fmt.Sprintf("Teleport: %s%s\n", errorStyle.Render("login expired"), subtleStyle.Render(fmt.Sprintf("  (%s logs in again and starts it)", m.keys.StartStop.Help().Key))))
+	}
+	if t.web {
+		content.WriteString(fmt.Sprintf("Web: %s%s\n", selectedStyle.Render(t.webURL()), subtleStyle.Render(fmt.Sprintf("  (%s opens it)", m.keys.Browser.Help().Key))))
+	}
+	if t.smokeTest != "" {
+		result := subtleStyle.Render("pending")
+		if !t.smoke.at.IsZero() {
+			if t.smoke.ok {
+				result = activeStyle.Render("✅ " + t.smoke.detail)
+			} else {
+				result = inactiveStyle.Render("❌ " + t.smoke.detail)
+			}
+			result += subtleStyle.Render(" at " + t.smoke.at.Format("15:04:05"))
+		}
+		content.WriteString(fmt.Sprintf("Smoke test: %s %s\n", selectedStyle.Render(t.smokeTest), result))
+	}
+	if t.healthCheck != "" {
+		content.WriteString(fmt.Sprintf("Health check: %s %s\n", selectedStyle.Render(t.healthCheck), t.healthStatus(m.cfg.healthInterval())))
+	}
 
-	if t.active {
+	if label := t.uptimeDetail(); label != "" {
+		content.WriteString(fmt.Sprintf("Uptime: %s\n", selectedStyle.Render(label)))
+	}
+	if t.degraded() {
+		content.WriteString(fmt.Sprintf("Status: %s\n\n", degradedStyle.Render("🟡 DEGRADED")))
+	} else if t.active {
 		content.WriteString(fmt.Sprintf("Status: %s\n\n", activeStyle.Render("🟢 ACTIVE")))
 	} else {
-		content.WriteString(fmt.Sprintf("Status: %s\n\n", inactiveStyle.Render("🔴 INACTIVE")))
+		content.WriteString(fmt.Sprintf("Status: %s%s\n\n", inactiveStyle.Render("🔴 INACTIVE"), subtleStyle.Render("  (s to start)")))
 	}
 
-	content.WriteString(highlightStyle.Render("Logs:") + "\n")
-	content.WriteString(strings.Repeat("─", width-6) + "\n")
-
-	// Calculate available lines for logs
-	availableLines := height - 12
+	// The logs get what the header leaves: the panel's padding, the header
+	// as wrapped to the panel's width, and the "Logs:" and rule lines
+	headerLines := lipgloss.Height(lipgloss.NewStyle().Width(width-4).Render(content.String())) - 1
+	availableLines := height - 2 - headerLines - 2
 	if availableLines < 1 {
 		availableLines = 1
 	}
 
-	// Only read the last N logs we need
-	t.logMutex.Lock()
-	totalLogs := len(t.logs)
-	start := totalLogs - availableLines
-	if start < 0 {
-		start = 0
+	// Everything above comes from the model, so the header text plus the
+	// log sequence identifies the frame; re-styling the panel is the
+	// expensive part and only happens when one of them changes
+	logs := m.logLines(t)
+	search := m.logSearchStatus(t)
+	key := renderKey{
+		header:     content.String(),
+		tunnelID:   t.id,
+		logSeq:     t.logSeq,
+		scroll:     m.logScroll,
+		search:     search,
+		filterOnly: m.logFilterOnly,
+		width:      width,
+		height:     height,
+		focused:    m.selectedPanel == 1,
+	}
+	if out, ok := m.bodyCache.get(key); ok {
+		return out
+	}
+
+	content.WriteString(highlightStyle.Render("Logs:"))
+	if m.logScroll > 0 {
+		content.WriteString(subtleStyle.Render(fmt.Sprintf(" %d lines back • ↓ to follow", m.logScroll)))
 	}
-	visibleLogs := make([]string, totalLogs-start)
-	copy(visibleLogs, t.logs[start:])
-	t.logMutex.Unlock()
+	content.WriteString(subtleStyle.Render(search))
+	content.WriteString("\n" + strings.Repeat("─", width-6) + "\n")
 
-	if len(visibleLogs) > 0 {
+	// Only the lines on screen are read from the ring
+	end := max(logs.len()-m.logScroll, min(logs.len(), 1))
+	start := max(end-availableLines, 0)
+
+	if end > start {
 		maxWidth := width - 8 // Account for padding and borders
-		for i, log := range visibleLogs {
+		for i := start; i < end; i++ {
+			log := logs.at(i)
 			// Truncate long lines to prevent overflow
 			if len(log) > maxWidth {
 				log = log[:maxWidth-3] + "..."
 			}
-			content.WriteString(subtleStyle.Render(log))
-			if i < len(visibleLogs)-1 {
+			content.WriteString(m.renderLogLine(log, m.logQuery != "" && !m.logFilterOnly && i == end-1))
+			if i < end-1 {
 				content.WriteString("\n")
 			}
 		}
 	} else {
-		content.WriteString(subtleStyle.Render("No logs yet...") + "\n")
+		if m.logFilterOnly {
+			content.WriteString(subtleStyle.Render("No line matches") + "\n")
+		} else {
+			content.WriteString(subtleStyle.Render("No logs yet...") + "\n")
+		}
 	}
 
-	return style.Render(content.String())
+	out := style.Render(content.String())
+	m.bodyCache.put(key, out)
+	return out
 }
 
 func (m model) renderFooter(width int) string {
-	keyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#D19A66"))
-
-	leftHelp := keyStyle.Render("Tab") + ": switch"
-	centerHelp := ""
-	rightHelp := keyStyle.Render("?") + ": help"
-
-	if m.selectedPanel == 0 {
-		centerHelp = keyStyle.Render("n") + ": new  " + keyStyle.Render("d") + ": delete  " + keyStyle.Render("↑/↓") + ": nav"
-	} else if m.selectedPanel == 1 {
-		centerHelp = keyStyle.Render("↑/↓") + ": scroll"
+	// render lists the bindings that fit in room columns, dropping the
+	// rest so that the footer stays on one line
+	render := func(room int, bindings ...key.Binding) string {
+		var line string
+		for _, b := range bindings {
+			if !b.Enabled() {
+				continue
+			}
+			part := helpKeyStyle.Render(b.Help().Key) + ": " + b.Help().Desc
+			if line != "" {
+				part = "  " + part
+			}
+			if lipgloss.Width(line+part) > room {
+				break
+			}
+			line += part
+		}
+		return line
 	}
+	left := []key.Binding{m.keys.SwitchPanel}
+	center := m.keys.footerKeys(m.selectedPanel)
+	if m.dashboard {
+		left = []key.Binding{m.keys.Dashboard}
+		center = []key.Binding{m.keys.upDown("nav"), m.keys.Sort}
+	}
+
+	// The centre takes what the sides leave
+	side := min(max(lipgloss.Width(render(width, left...)), lipgloss.Width(render(width, m.keys.Help))), width/3)
+	leftHelp := render(side, left...)
+	centerHelp := render(width-2*side-2, center...)
+	rightHelp := render(side, m.keys.Help)
 
-	leftStyle := subtleStyle.Width(width / 3).Align(lipgloss.Left)
-	centerStyle := subtleStyle.Width(width / 3).Align(lipgloss.Center)
-	rightStyle := subtleStyle.Width(width / 3).Align(lipgloss.Right)
+	leftStyle := subtleStyle.Width(side).Align(lipgloss.Left)
+	centerStyle := subtleStyle.Width(width - 2*side).Align(lipgloss.Center)
+	rightStyle := subtleStyle.Width(side).Align(lipgloss.Right)
 
 	footer := lipgloss.JoinHorizontal(
 		lipgloss.Top,
@@ -978,33 +3250,10 @@ func (m model) renderNewTunnelForm() string {
 
 	switch m.step {
 	case stepHost:
-		maxVisible := maxHostVisible
-		start := m.hostScroll
-		end := start + maxVisible
-		if end > len(m.hosts) {
-			end = len(m.hosts)
-		}
-
-		content = lipgloss.NewStyle().Bold(true).Render("Select SSH Host:") + "\n\n"
-		for i := start; i < end; i++ {
-			if m.cursor == i {
-				content += selectedStyle.Render(fmt.Sprintf("  ▶  %s", m.hosts[i]))
-			} else {
-				content += fmt.Sprintf("     %s", m.hosts[i])
-			}
-			if i < end-1 {
-				content += "\n"
-			}
-		}
-
-		if len(m.hosts) > maxVisible {
-			content += "\n\n" + subtleStyle.Render(fmt.Sprintf("(%d/%d) ↑/↓ to scroll • Enter to select • m for manual • Esc to cancel", m.cursor+1, len(m.hosts)))
-		} else {
-			content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to select • m for manual • Esc to cancel")
-		}
+		content = m.renderHostPicker()
 
 	case stepHostIP:
-		hostName := m.hosts[m.cursor]
+		hostName := m.hostIPs[0]
 		content = lipgloss.NewStyle().Bold(true).Render("Select IP for "+hostName+":") + "\n\n"
 		start := m.hostIPScroll
 		end := start + maxHostVisible
@@ -1021,116 +3270,278 @@ func (m model) renderNewTunnelForm() string {
 				content += "\n"
 			}
 		}
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
 		content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to select • Esc to go back")
 
+	case stepRemoteHost:
+		content = "Host: " + selectedStyle.Render(m.tempHost) + "\n\n"
+		content += "Forward to: " + m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("localhost for the host itself, or a host it can reach (e.g. internal-db.corp) • Esc to cancel")
+
 	case stepRemotePort:
 		content = "Host: " + selectedStyle.Render(m.tempHost) + "\n\n"
-		content += fmt.Sprintf("Remote port: %s█", m.input)
-		content += "\n\n" + subtleStyle.Render("Enter port number • Esc to cancel")
+		if m.tempRemoteHost != "" {
+			content += "Forward to: " + selectedStyle.Render(m.tempRemoteHost) + "\n\n"
+		}
+		if m.tempType == "remote" {
+			content += "Port to open on the host: " + m.inputView()
+		} else {
+			content += "Remote port: " + m.inputView()
+		}
+		if m.discovering {
+			content += "\n\n" + m.spinner.View() + " " + subtleStyle.Render("Discovering remote services...")
+		} else if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		if m.tempBackend == kubectlBackend && m.kubeChoices != nil {
+			content += "\n\n" + m.kubeChoicesView(stepRemotePort)
+			content += "\n\n" + subtleStyle.Render("Enter port number • Tab completes • Esc to cancel")
+		} else if m.tempBackend != "" || m.tempType == "remote" || m.tempRemoteHost != "" {
+			content += "\n\n" + subtleStyle.Render("Enter port number • Esc to cancel")
+		} else {
+			content += "\n\n" + subtleStyle.Render("Enter port number • l to list listening ports • c for Docker containers • Esc to cancel")
+		}
+
+	case stepRemotePortPick:
+		content = lipgloss.NewStyle().Bold(true).Render("Services on "+m.tempHost+":") + "\n\n"
+		start := m.portScroll
+		end := start + maxHostVisible
+		if end > len(m.portChoices) {
+			end = len(m.portChoices)
+		}
+		for i := start; i < end; i++ {
+			c := m.portChoices[i]
+			line := fmt.Sprintf("%-6s %s", c.port, c.label)
+			if i == m.portIndex {
+				content += selectedStyle.Render("  ▶  "+line) + " " + subtleStyle.Render(c.detail)
+			} else {
+				content += "     " + line + " " + subtleStyle.Render(c.detail)
+			}
+			if i < end-1 {
+				content += "\n"
+			}
+		}
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render(fmt.Sprintf("(%d/%d) ↑/↓ to move • Enter to select • Esc to go back", m.portIndex+1, len(m.portChoices)))
 
 	case stepLocalPort:
 		content = "Remote port: " + successStyle.Render(m.tempRemote) + "\n\n"
-		content += fmt.Sprintf("Local port: %s█", m.input)
+		switch m.tempType {
+		case "remote":
+			content += "Local port to expose: " + m.inputView()
+		case "socks":
+			content = "Host: " + selectedStyle.Render(m.tempHost) + "\n\n"
+			content += "Local port for the SOCKS proxy: " + m.inputView()
+		default:
+			content += "Local port: " + m.inputView()
+		}
 		if m.err != nil {
 			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
 		}
 		content += "\n\n" + subtleStyle.Render("Enter port number • Esc to cancel")
 
+	case stepForwards:
+		content = "Forwarding: " + successStyle.Render(forwardPorts(m.tempType, m.tempLocal, m.tempRemote)) + "\n"
+		for _, f := range m.tempForwards {
+			content += "       and: " + successStyle.Render(forwardPorts(f.Type, f.LocalPort, remoteEnd(f.RemoteHost, f.RemotePort))) + subtleStyle.Render("  "+f.String()) + "\n"
+		}
+		content += "\nAnother forward over the same connection: " + m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("-L local:remote • -R remote:local • -D port • Empty to continue • Backspace removes the last • Esc to cancel")
+
 	case stepTag:
 		content = "Tag for this tunnel:\n\n"
-		content += fmt.Sprintf("%s█", m.input)
+		content += m.inputView()
 		content += "\n\n" + subtleStyle.Render("Enter tag or press Enter for random • Esc to cancel")
 
+	case stepColor:
+		content = m.renderColorStep()
+
+	case stepProxy:
+		content = "Upstream proxy for this tunnel:\n\n"
+		content += m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("socks5://host:port or http://host:port • Empty for direct • Esc to cancel")
+
+	case stepPrepCommand:
+		content = "Remote command to run before forwarding:\n\n"
+		content += m.inputView()
+		content += "\n\n" + subtleStyle.Render("e.g. systemctl --user start jupyter • Empty to skip • Esc to cancel")
+
+	case stepSmokeTest:
+		content = "Smoke test to run once connected:\n\n"
+		content += m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("tcp • http [/path] [status] • banner <regex> • Empty to skip • Esc to cancel")
+
+	case stepHealthCheck:
+		content = fmt.Sprintf("Health check to repeat every %s while connected:\n\n", m.cfg.healthInterval())
+		content += m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("Same as the smoke test; a failure marks the tunnel degraded 🟡 • Empty for none")
+
+	case stepTLSMode:
+		content = "Local TLS for this tunnel:\n\n"
+		content += m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("wrap: serve https locally • unwrap: plain locally, TLS to remote • Empty for none")
+
 	case stepVerbose:
 		content = "Show verbose SSH logs? " + subtleStyle.Render("(y/n or just Enter for no)")
 
-	case stepManualHost:
-		content = lipgloss.NewStyle().Bold(true).Render("Enter SSH host manually:") + "\n\n"
-		content += fmt.Sprintf("Host: %s█", m.input)
-		content += "\n\n" + subtleStyle.Render("Format: user@host or host • Esc to cancel")
-
-	case stepConnecting:
-		content = highlightStyle.Render("Connecting to tunnel...") + "\n\n"
-		content += m.spinner.View() + " " + subtleStyle.Render("Please wait...") + "\n\n"
-		content += subtleStyle.Render(fmt.Sprintf("Host: %s\nPorts: %s → %s", m.tempHost, m.tempLocal, m.tempRemote))
-	}
+	case stepCompression, stepCiphers:
+		content = m.renderLinkStep()
 
-	// Create panel with content (text left-aligned)
-	modal := panelStyle.Width(60).Render(content)
+	case stepAdvanced:
+		content = m.renderAdvancedStep()
 
-	// Center the panel on screen
-	centered := lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+	case stepCloseAfter, stepCloseIdle:
+		content = m.renderCloseStep()
 
-	return centered
-}
+	case stepLazy:
+		content = m.renderLazyStep()
 
-func getSSHHosts() []string {
-	file, err := os.Open(os.Getenv("HOME") + "/.ssh/config")
-	if err != nil {
-		return []string{}
-	}
-	defer file.Close()
+	case stepIdentity:
+		content = m.renderIdentityStep()
 
-	var hosts []string
-	scanner := bufio.NewScanner(file)
-	re := regexp.MustCompile(`^Host\s+(.+)`)
+	case stepReview:
+		content = m.renderReview()
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if matches := re.FindStringSubmatch(line); matches != nil {
-			host := strings.TrimSpace(matches[1])
-			if host != "*" {
-				hosts = append(hosts, host)
+	case stepTemplate:
+		content = "Host: " + selectedStyle.Render(m.tempHost) + "\n\n"
+		content += lipgloss.NewStyle().Bold(true).Render("Service:") + "\n\n"
+		templates := m.cfg.templates()
+		for i := 0; i <= len(templates); i++ {
+			label, hint := "c  Custom ports", "enter them by hand"
+			if i > 0 {
+				t := templates[i-1]
+				label = fmt.Sprintf("%-2d %s", i, t.label())
+				hint = "as " + t.tag(m.tempHost)
+				if i > 9 {
+					label = "   " + t.label()
+				}
+			}
+			if i == m.templateIndex {
+				content += selectedStyle.Render("  ▶  "+label) + "  " + subtleStyle.Render(hint)
+			} else {
+				content += "     " + label
+			}
+			if i < len(templates) {
+				content += "\n"
 			}
 		}
-	}
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("1-9 to connect • ↑/↓ and Enter • c for custom • Esc to cancel")
 
-	hosts = expandSSHHosts(hosts)
-	return hosts
-}
+	case stepTunnelType:
+		content = lipgloss.NewStyle().Bold(true).Render("Tunnel type:") + "\n\n"
+		for i, tt := range tunnelTypes {
+			if i == m.typeIndex {
+				content += selectedStyle.Render("  ▶  "+tt.label) + " " + subtleStyle.Render(tt.hint)
+			} else {
+				content += "     " + tt.label + " " + subtleStyle.Render(tt.hint)
+			}
+			if i < len(tunnelTypes)-1 {
+				content += "\n"
+			}
+		}
+		content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to select • Esc to cancel")
 
-func expandSSHHosts(hosts []string) []string {
-	file, err := os.Open(os.Getenv("HOME") + "/.ssh/config")
-	if err != nil {
-		return hosts
-	}
-	defer file.Close()
+	case stepBackend:
+		content = lipgloss.NewStyle().Bold(true).Render("Carry the tunnel with:") + "\n\n"
+		for i, name := range m.backendNames {
+			if i == m.backendIndex {
+				content += selectedStyle.Render("  ▶  " + name)
+			} else {
+				content += "     " + name
+			}
+			if i < len(m.backendNames)-1 {
+				content += "\n"
+			}
+		}
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		content += "\n\n" + subtleStyle.Render("↑/↓ to move • Enter to select • Esc to cancel")
 
-	var expanded []string
-	currentHost := ""
-	reHost := regexp.MustCompile(`^Host\s+(.+)`)
-	reHostname := regexp.MustCompile(`(?i)^Hostname\s+(.+)`)
+	case stepKubeContext, stepKubeNamespace, stepKubeTarget:
+		content = m.renderKubeStep()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
+	case stepManualHost:
+		if m.tempBackend == teleportBackend {
+			content = lipgloss.NewStyle().Bold(true).Render("Enter Teleport node manually:") + "\n\n"
+		} else if !usesSSH(m.tempBackend) {
+			content = lipgloss.NewStyle().Bold(true).Render("Target for "+m.tempBackend+":") + "\n\n"
+		} else {
+			content = lipgloss.NewStyle().Bold(true).Render("Enter SSH host manually:") + "\n\n"
+		}
+		content += "Host: " + m.inputView()
+		if m.err != nil {
+			content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+		}
+		if !usesSSH(m.tempBackend) && m.tempBackend != teleportBackend {
+			content += "\n\n" + subtleStyle.Render("Passed to the backend as {host} • Esc to cancel")
+		} else {
+			content += "\n\n" + subtleStyle.Render("Format: user@host or host • Esc to cancel")
+		}
 
-		if matches := reHost.FindStringSubmatch(line); matches != nil {
-			currentHost = strings.TrimSpace(matches[1])
-			if currentHost != "*" && currentHost != "" {
-				expanded = append(expanded, currentHost)
-			}
-		} else if matches := reHostname.FindStringSubmatch(line); matches != nil && currentHost != "" {
-			hostname := strings.TrimSpace(matches[1])
-			if hostname != "" && !strings.HasPrefix(hostname, "*") {
-				expanded = append(expanded, currentHost+" "+hostname)
+	case stepConnecting:
+		if m.err != nil {
+			content = errorStyle.Render("❌ "+m.err.Error()) + "\n\n"
+			content += subtleStyle.Render(fmt.Sprintf("Host: %s\nPorts: %s", m.tempHost, m.tempSpecPorts()))
+			if errors.Is(m.err, errTshLogin) && m.daemon != nil {
+				content += "\n\n" + subtleStyle.Render("Run tsh login in another terminal, then Enter to check again • Esc to cancel")
+			} else if errors.Is(m.err, errTshLogin) {
+				content += "\n\n" + subtleStyle.Render("Enter to log in again with tsh login • Esc to cancel")
+			} else if m.tempPrecheck.err != nil {
+				content += "\n\n" + subtleStyle.Render("Enter to connect anyway • Esc to cancel")
+			} else {
+				content += "\n\n" + subtleStyle.Render("Enter to retry • Esc to cancel")
 			}
+			break
 		}
+		content = highlightStyle.Render("Connecting to tunnel...") + "\n\n"
+		content += m.spinner.View() + " " + subtleStyle.Render(m.connectStage) + "\n\n"
+		content += subtleStyle.Render(fmt.Sprintf("Host: %s\nPorts: %s", m.tempHost, m.tempSpecPorts()))
 	}
 
-	if len(expanded) == 0 {
-		return hosts
-	}
-	return expanded
+	// Create panel with content (text left-aligned)
+	modal := panelStyle.Width(60).Render(content)
+
+	// Center the panel on screen
+	centered := lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+
+	return centered
 }
 
+// isPortInUse reports whether ssh could not bind port here, by binding it
+// the way ssh does: on the loopback address.
 func isPortInUse(port string) bool {
-	cmd := exec.Command("ss", "-tuln")
-	output, err := cmd.Output()
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port))
 	if err != nil {
-		return false
+		return true
 	}
-	return strings.Contains(string(output), ":"+port+" ")
+	ln.Close()
+	return false
 }
 
 func extractHostname(hostWithIP string) string {
@@ -1152,12 +3563,221 @@ func extractAllHostnames(hostWithIP string) []string {
 }
 
 func main() {
+	if os.Getenv(askpassSocketEnv) != "" {
+		// Run by a tunnel's ssh as its SSH_ASKPASS program
+		if err := runAskpass(strings.Join(os.Args[1:], " ")); err != nil {
+			fmt.Fprintf(os.Stderr, "ssh-tunnel-manager askpass: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diagnose" {
+		if err := runDiagnose(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	headless := map[string]func([]string) error{"start": runStart, "list": runList, "status": runStatus, "stop": runStop, "restart": runRestart, "up": runUp, "down": runDown, "attach": runAttach}
+	if len(os.Args) > 1 && headless[os.Args[1]] != nil {
+		if err := headless[os.Args[1]](os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// "daemon" takes the same flags as the TUI
+	daemonMode := len(os.Args) > 1 && os.Args[1] == "daemon"
+	if daemonMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	var opts appOptions
+	flag.BoolVar(&opts.noPrecheck, "no-precheck", false, "skip the TCP reachability check before starting ssh")
+	flag.StringVar(&opts.logFile, "log-file", "", "write the manager's own log (not ssh output) to this file")
+	flag.StringVar(&opts.logLevel, "log-level", "info", "log file verbosity: debug, info, warn or error")
+	flag.BoolVar(&opts.profileUI, "profile-ui", false, "show Update/View latency and per-frame allocations in the status bar")
+	flag.BoolVar(&opts.demo, "demo", false, "show simulated tunnels instead of running ssh (for screenshots and testing)")
+	flag.StringVar(&opts.profileDir, "profile-ui-dir", "", "with --profile-ui, write cpu.pprof and heap.pprof to this directory")
+	flag.StringVar(&opts.fromFile, "from-file", "", "start the tunnels listed in this YAML or JSON file")
+	flag.Parse()
+
+	closeLog, err := setupLogging(opts.logFile, opts.logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	if opts.profileUI && opts.profileDir != "" {
+		stopPprof, err := startPprof(opts.profileDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: profiling: %v\n", err)
+			os.Exit(1)
+		}
+		defer stopPprof()
+	}
+
+	var lock *instanceLock
+	if !opts.demo {
+		// With a daemon running, this terminal becomes another view of it
+		if path, err := daemonSocketPath(); err == nil && !daemonMode && daemonRunning(path) {
+			slog.Info("attaching to the running daemon", "socket", path)
+			if err := runAttach(os.Args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		var err error
+		if lock, err = acquireInstanceLock(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer lock.release()
+	}
+
+	if opts.fromFile != "" {
+		// Checked now so a mistake is reported before the UI takes the
+		// terminal, and made absolute for the daemon
+		if _, err := readTunnelsFile(opts.fromFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if abs, err := filepath.Abs(opts.fromFile); err == nil && !strings.HasPrefix(opts.fromFile, "~/") {
+			opts.fromFile = abs
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("config load failed", "err", err)
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if th, err := cfg.theme(); err == nil { // loadConfig has checked it
+		applyTheme(th)
+	}
+	path, _ := configPath()
+	slog.Info("config loaded", "path", path, "proxy", cfg.Proxy, "web_ui", cfg.WebUI, "host_providers", len(cfg.HostProviders), "backends", len(cfg.Backends))
+
+	pol, err := loadPolicy()
+	if err != nil {
+		slog.Error("policy load failed", "err", err)
+		fmt.Fprintf(os.Stderr, "Error loading policy: %v\n", err)
+		os.Exit(1)
+	}
+	if len(pol.AllowedHosts) > 0 || len(pol.ForbiddenRemotePorts) > 0 || len(pol.SSHOptions) > 0 {
+		slog.Info("policy loaded", "path", policyPath(), "allowed_hosts", pol.AllowedHosts, "forbidden_remote_ports", pol.ForbiddenRemotePorts)
+	}
+
+	var landing *landingPage
+	if cfg.LandingPage != "" {
+		landing = &landingPage{}
+		if err := serveLandingPage(cfg.LandingPage, landing); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var attachWebUI func(*tea.Program)
+	if cfg.WebUI != "" {
+		token, err := webUIToken(cfg.WebUIToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: web UI token: %v\n", err)
+			os.Exit(1)
+		}
+		if attachWebUI, err = serveWebUI(cfg.WebUI, token); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Create the main TUI program (navigator)
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	m := initialModel(opts, cfg, pol, loadUIState(), landing)
+	programOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if daemonMode {
+		d, err := listenDaemon(pol)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer d.Close()
+		m.daemon = d
+		m.termOut = d
+		programOpts = d.programOptions()
+		slog.Info("daemon listening", "socket", d.listener.Addr())
+		if cfg.SSHUI != "" {
+			if d.sshUI, err = listenSSHUI(cfg.SSHUI, cfg.SSHUIAuthorizedKeys); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	} else if cfg.SSHUI != "" {
+		slog.Warn("ssh_ui is only served by the daemon; run attach", "ssh_ui", cfg.SSHUI)
+	}
+	p := tea.NewProgram(m, programOpts...)
+	m.logSink.attach(p)
+	m.prompter.attach(p)
+	defer m.prompter.Close()
+	defer m.masters.Close()
+	if attachWebUI != nil {
+		attachWebUI(p)
+	}
+	if m.daemon != nil {
+		m.daemon.serve(p)
+	}
+	crashState.Lock()
+	crashState.program = p
+	crashState.Unlock()
+
+	stopSignals := handleShutdownSignals(p)
 
 	// Run the navigator in the main goroutine
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	stopSignals()
+	if m, ok := final.(model); ok {
+		// Bubble Tea quits on SIGTERM and SIGINT without asking the model
+		m.stopTunnels()
+	}
+	waitHooks()
+	if err != nil {
+		slog.Error("program exited", "err", err)
+		lock.release()
+		if errors.Is(err, tea.ErrProgramPanic) || errors.Is(err, tea.ErrProgramKilled) {
+			// Panics in commands are recovered by Bubbletea itself, which
+			// has already printed the stack; this only cleans up and reports
+			handleCrash("command", err, []byte("(printed to the terminal)"))
+			fmt.Fprintf(os.Stderr, "\nssh-tunnel-manager crashed. Its tunnels were stopped.\nCrash report: %s\n", crashReport())
+			os.Exit(2)
+		}
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
 	}
+	if m, ok := final.(model); ok {
+		// A demo session shouldn't overwrite the real layout
+		if !m.demo {
+			if err := saveUIState(m.uiState()); err != nil {
+				slog.Warn("cannot save ui state", "err", err)
+			}
+		}
+		if m.prof != nil {
+			m.prof.logSummary()
+		}
+	}
+	slog.Info("exiting")
 }
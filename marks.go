@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Marks: space marks the selected tunnel, or every tunnel of the selected
+// group, and d, r and g then act on all the marked tunnels at once rather
+// than on the selected one. d deletes them after one confirmation listing
+// them, r restarts them and g moves them to a group; the marks are cleared
+// once done, or with Esc.
+
+// maxDeleteListed is how many tags the delete confirmation lists.
+const maxDeleteListed = 10
+
+// marked is the marked tunnels, in the order they were created.
+func (m model) marked() []*tunnel {
+	var ts []*tunnel
+	for _, t := range m.tunnels {
+		if t.marked {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// toggleMark marks the selected tunnel, or unmarks it. On a group heading
+// it marks the group's tunnels, or unmarks them once they all are.
+func (m *model) toggleMark() {
+	var ts []*tunnel
+	if m.selectedGroup != "" {
+		for _, t := range m.tunnels {
+			if m.cfg.groupOf(t.tag) == m.selectedGroup {
+				ts = append(ts, t)
+			}
+		}
+	} else if m.selectedTunnel < len(m.tunnels) {
+		ts = []*tunnel{m.tunnels[m.selectedTunnel]}
+	}
+	mark := false
+	for _, t := range ts {
+		mark = mark || !t.marked
+	}
+	for _, t := range ts {
+		t.marked = mark
+	}
+	n := len(m.marked())
+	m.statusMessage = fmt.Sprintf("%d marked • %s delete, %s restart, %s group them • Esc unmark",
+		n, m.keys.Delete.Help().Key, m.keys.Restart.Help().Key, m.keys.Group.Help().Key)
+	if n == 0 {
+		m.statusMessage = "Nothing marked"
+	}
+}
+
+func (m *model) clearMarks() {
+	for _, t := range m.tunnels {
+		t.marked = false
+	}
+}
+
+// targets is what d, r and g act on: the marked tunnels, or else the
+// selected one.
+func (m model) targets() []*tunnel {
+	if ts := m.marked(); len(ts) > 0 {
+		return ts
+	}
+	if m.selectedGroup == "" && m.selectedTunnel < len(m.tunnels) {
+		return []*tunnel{m.tunnels[m.selectedTunnel]}
+	}
+	return nil
+}
+
+// tagList names the tunnels, as in "a, b and c".
+func tagList(ts []*tunnel) string {
+	tags := make([]string, len(ts))
+	for i, t := range ts {
+		tags[i] = t.tag
+	}
+	if len(tags) == 1 {
+		return tags[0]
+	}
+	return strings.Join(tags[:len(tags)-1], ", ") + " and " + tags[len(tags)-1]
+}
+
+// deleteMarked deletes the marked tunnels, each of which u can put back.
+func (m *model) deleteMarked() {
+	ts := m.marked()
+	for _, t := range ts {
+		for i := range m.tunnels {
+			if m.tunnels[i] == t {
+				m.removeTunnel(i)
+				break
+			}
+		}
+	}
+	m.statusMessage = fmt.Sprintf("Deleted %d tunnels • %s to undo, one at a time", len(ts), m.keys.Undo.Help().Key)
+}
+
+// renderDeleteMarked asks to delete the marked tunnels, listing them.
+func (m model) renderDeleteMarked(ts []*tunnel) string {
+	content := fmt.Sprintf("Delete these %d tunnels?\n\n", len(ts))
+	for i, t := range ts {
+		if i == maxDeleteListed {
+			content += subtleStyle.Render(fmt.Sprintf("and %d more", len(ts)-i)) + "\n"
+			break
+		}
+		content += highlightStyle.Render(t.tag) + subtleStyle.Render(fmt.Sprintf("  %s %s", t.host, t.spec().ports())) + "\n"
+	}
+	if len(ts) > maxUndo {
+		content += subtleStyle.Render(fmt.Sprintf("Only the last %d can be undone", maxUndo)) + "\n"
+	}
+	return content + "\n"
+}
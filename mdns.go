@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mdnsServiceTypes maps detected protocols to their DNS-SD service types.
+var mdnsServiceTypes = map[string]string{
+	"http":  "_http._tcp",
+	"tls":   "_https._tcp",
+	"pg":    "_postgresql._tcp",
+	"mysql": "_mysql._tcp",
+	"redis": "_redis._tcp",
+	"ssh":   "_ssh._tcp",
+	"smtp":  "_smtp._tcp",
+	"ftp":   "_ftp._tcp",
+}
+
+func mdnsServiceType(protocol string) string {
+	if t, ok := mdnsServiceTypes[protocol]; ok {
+		return t
+	}
+	return "_ssh-tunnel._tcp"
+}
+
+// mdnsAnnouncement is a tunnel announced on the LAN. Forwards are bound
+// to loopback, where nobody else can reach them, so what is announced is a
+// relay to the local port listening on every address.
+type mdnsAnnouncement struct {
+	cmd   *exec.Cmd
+	ln    net.Listener
+	port  string
+	bytes atomic.Uint64 // relayed, counted by the tunnel's own port as well
+}
+
+// announceService registers name as a DNS-SD service using the platform's
+// own responder (Avahi on Linux, mDNSResponder on macOS), on a port of its
+// own relaying to the local port. The registration and the relay last
+// until stop.
+func announceService(name, protocol, localPort string) (*mdnsAnnouncement, error) {
+	serviceType := mdnsServiceType(protocol)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("mDNS announcements are not supported on %s", runtime.GOOS)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("cannot announce %s.%s.local: %v", name, serviceType, err)
+	}
+	a := &mdnsAnnouncement{ln: ln}
+	_, a.port, _ = net.SplitHostPort(ln.Addr().String())
+
+	if runtime.GOOS == "darwin" {
+		a.cmd = exec.Command("dns-sd", "-R", name, serviceType, "local", a.port)
+	} else {
+		a.cmd = exec.Command("avahi-publish-service", name, serviceType, a.port)
+	}
+	setProcessGroup(a.cmd)
+	if err := a.cmd.Start(); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("cannot announce %s.%s.local: %v", name, serviceType, err)
+	}
+	go a.cmd.Wait()
+
+	upstreamAddr := net.JoinHostPort("127.0.0.1", localPort)
+	go func() {
+		defer recoverPanic("mDNS relay")
+		for {
+			client, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go a.relay(client, upstreamAddr)
+		}
+	}()
+	return a, nil
+}
+
+func (a *mdnsAnnouncement) relay(client net.Conn, upstreamAddr string) {
+	defer recoverPanic("mDNS relay")
+	defer client.Close()
+	upstream, err := net.DialTimeout("tcp", upstreamAddr, 10*time.Second)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		countedCopy(upstream, client, &a.bytes)
+		wg.Done()
+	}()
+	go func() {
+		countedCopy(client, upstream, &a.bytes)
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+// stop withdraws the announcement and closes the relay. Connections
+// already relayed go on until the tunnel closes them.
+func (a *mdnsAnnouncement) stop() {
+	killProcessTree(a.cmd)
+	a.ln.Close()
+}
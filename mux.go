@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Multiplexing carries a host's tunnels over one SSH connection, so a
+// host behind 2FA asks once and later tunnels come up without a handshake.
+// With multiplex in config.json the manager runs a master connection per
+// host (ssh -M) and adds each tunnel's forwards to it with ssh -O forward
+// instead of running an ssh per tunnel. A tunnel's control_path uses a
+// master the user runs instead, e.g. one left by ssh's own ControlMaster,
+// and control_path: none gives it a connection of its own.
+//
+// Forwards added that way belong to the master, not to the ssh that asked
+// for them, so stopping a tunnel cancels them with ssh -O cancel, and the
+// manager closes its master with the last tunnel on it. A tunnel's own
+// ssh -N would not do as a client: through a master it opens a shell.
+
+// muxTimeout bounds the ssh -O commands, which only talk to the master
+// over its socket.
+const muxTimeout = 5 * time.Second
+
+// muxCheckInterval is how often a master the user runs is checked for.
+const muxCheckInterval = 5 * time.Second
+
+var errMuxUnsupported = errors.New("OpenSSH on Windows cannot multiplex connections")
+
+// multiplexed reports whether spec's tunnel goes over a master connection.
+func (m model) multiplexed(spec tunnelSpec) bool {
+	if spec.Backend != "" || m.cfg.SSHTransport == nativeBackend || m.demo {
+		return false
+	}
+	switch spec.ControlPath {
+	case "":
+		return m.cfg.Multiplex
+	case "none":
+		return false
+	}
+	return true
+}
+
+// sshMasters are the master connections the manager runs, by host, in a
+// private directory for their sockets.
+type sshMasters struct {
+	dir     string
+	masters map[string]*sshMaster
+}
+
+// sshMaster is one of them.
+type sshMaster struct {
+	host   string
+	socket string
+	cmd    *exec.Cmd
+	ready  chan struct{} // closed once it takes clients
+	done   chan struct{} // closed once it has exited
+	users  int           // tunnels on it, counted by the model
+	closed bool          // killed as its last tunnel stopped
+
+	mu    sync.Mutex
+	state string // how it exited
+	last  string // the last line it logged
+}
+
+// masterFor returns the running master for spec's host, or starts one,
+// logging its output to logf. ssh asks the manager for passwords as it
+// does for a tunnel's own ssh, on behalf of tunnelID.
+func (ms *sshMasters) masterFor(spec tunnelSpec, pre precheckMsg, pol policy, env []string, logf func(string)) (*sshMaster, error) {
+	if ms.masters == nil {
+		ms.masters = make(map[string]*sshMaster)
+	}
+	// The master authenticates, routes, compresses and forwards the agent
+	// and X11 for every tunnel on it
+	key := strings.Join([]string{spec.Host, spec.Proxy, spec.IdentityFile, spec.compressionSetting(), spec.Ciphers, spec.forwarding()}, "\x00")
+	if master := ms.masters[key]; master != nil && !master.closed && !master.exited() {
+		return master, nil
+	}
+	if ms.dir == "" {
+		dir, err := os.MkdirTemp("", "ssh-tunnel-manager-mux-")
+		if err != nil {
+			return nil, fmt.Errorf("cannot create a directory for the master sockets: %v", err)
+		}
+		ms.dir = dir
+	}
+
+	master := &sshMaster{
+		host:   spec.Host,
+		socket: filepath.Join(ms.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16]),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	args := []string{"-M", "-N", "-S", master.socket, "-o", "ControlPersist=no"}
+	if spec.Verbose {
+		args = append(args, "-v")
+	}
+	args = append(args, sshConnectArgs(spec.Proxy, pre, pol)...)
+	if spec.Keepalive != nil {
+		args = append(args, spec.Keepalive.sshArgs()...)
+	}
+	args = append(args, spec.linkArgs()...)
+	args = append(args, spec.forwardingArgs()...)
+	if spec.IdentityFile != "" {
+		args = append(args, "-i", identityPath(spec.IdentityFile), "-o", "IdentitiesOnly=yes")
+	}
+	master.cmd = exec.Command("ssh", append(args, "--", spec.Host)...)
+	setProcessGroup(master.cmd)
+	if env != nil {
+		master.cmd.Env = append(os.Environ(), env...)
+	}
+
+	output, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	master.cmd.Stdout = writer
+	master.cmd.Stderr = writer
+	err = master.cmd.Start()
+	writer.Close()
+	if err != nil {
+		output.Close()
+		return nil, fmt.Errorf("cannot start the ssh master: %v", err)
+	}
+	slog.Info("ssh master started", "host", spec.Host, "socket", master.socket, "pid", master.cmd.Process.Pid)
+	ms.masters[key] = master
+
+	go func() {
+		defer recoverPanic("ssh master log")
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				master.mu.Lock()
+				master.last = line
+				master.mu.Unlock()
+				logf("[master] " + line)
+			}
+		}
+	}()
+	go func() {
+		err := master.cmd.Wait()
+		master.mu.Lock()
+		if master.cmd.ProcessState != nil {
+			master.state = master.cmd.ProcessState.String()
+		} else {
+			master.state = err.Error()
+		}
+		master.mu.Unlock()
+		slog.Info("ssh master exited", "host", master.host, "state", master.state)
+		close(master.done)
+	}()
+	go master.waitReady()
+	return master, nil
+}
+
+// waitReady closes ready once the master answers on its socket, which it
+// opens after logging in.
+func (master *sshMaster) waitReady() {
+	for {
+		select {
+		case <-master.done:
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+		if _, err := os.Stat(master.socket); err != nil {
+			continue
+		}
+		if _, err := runMuxCommand(master.socket, master.host, "check"); err == nil {
+			close(master.ready)
+			return
+		}
+	}
+}
+
+func (master *sshMaster) exited() bool {
+	select {
+	case <-master.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitErr says how the master ended, with the last thing it logged.
+func (master *sshMaster) exitErr() error {
+	master.mu.Lock()
+	defer master.mu.Unlock()
+	if master.last != "" {
+		return fmt.Errorf("%s: %s", master.state, master.last)
+	}
+	return errors.New(master.state)
+}
+
+// release is called as a tunnel on the master stops; the last one closes
+// it.
+func (master *sshMaster) release() {
+	master.users--
+	if master.users > 0 || master.closed {
+		return
+	}
+	master.closed = true
+	slog.Info("closing ssh master", "host", master.host)
+	killProcessTree(master.cmd)
+}
+
+// Close removes the sockets' directory, once the masters are gone.
+func (ms *sshMasters) Close() {
+	if ms.dir != "" {
+		os.RemoveAll(ms.dir)
+	}
+}
+
+// muxForwards are a tunnel's forwards on a master connection.
+type muxForwards struct {
+	socket string
+	host   string
+	args   []string   // -L, -R and -D, as for ssh -N
+	master *sshMaster // nil for a master the user runs
+
+	mu      sync.Mutex
+	added   bool
+	stopped chan struct{} // closed once the tunnel stops
+}
+
+// newMuxForwards prepares spec's forwards for the master at its
+// control_path, or for the manager's master for its host.
+func (m *model) newMuxForwards(spec tunnelSpec, forwardPort string, pre precheckMsg, tunnelID int) (*muxForwards, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errMuxUnsupported
+	}
+	mux := &muxForwards{host: spec.Host, args: sshForwardArgs(spec, forwardPort), stopped: make(chan struct{})}
+	if spec.ControlPath != "" {
+		mux.socket = sshIncludePath(spec.ControlPath)
+		return mux, nil
+	}
+	master, err := m.masters.masterFor(spec, pre, m.policy, m.prompter.env(tunnelID), m.logSink.writer(tunnelID))
+	if err != nil {
+		return nil, err
+	}
+	master.users++
+	mux.master, mux.socket = master, master.socket
+	return mux, nil
+}
+
+// forward adds the forwards to the master, unless the tunnel was stopped
+// while the master was logging in.
+func (mux *muxForwards) forward() error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	select {
+	case <-mux.stopped:
+		return nil
+	default:
+	}
+	if _, err := runMuxCommand(mux.socket, mux.host, "forward", mux.args...); err != nil {
+		return err
+	}
+	mux.added = true
+	return nil
+}
+
+// stop cancels the forwards, freeing their ports, and lets go of the
+// manager's master.
+func (mux *muxForwards) stop() {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	select {
+	case <-mux.stopped:
+		return
+	default:
+	}
+	close(mux.stopped)
+	if mux.added {
+		if _, err := runMuxCommand(mux.socket, mux.host, "cancel", mux.args...); err != nil {
+			slog.Warn("cannot cancel forwards", "host", mux.host, "socket", mux.socket, "err", err)
+		}
+		mux.added = false
+	}
+	if mux.master != nil {
+		mux.master.release()
+	}
+}
+
+// status describes the connection for the detail panel.
+func (mux *muxForwards) status() string {
+	if mux.master == nil {
+		return "over the ssh master at " + mux.socket
+	}
+	switch {
+	case mux.master.exited():
+		return "the shared master has exited"
+	case mux.master.users == 1:
+		return "a master connection of its own, for tunnels to share"
+	}
+	return fmt.Sprintf("shared with %d other tunnel(s) to %s", mux.master.users-1, mux.host)
+}
+
+// runMuxCommand runs ssh -O command against the master at socket, with
+// what ssh printed as the error.
+func runMuxCommand(socket, host, command string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), muxTimeout)
+	defer cancel()
+	args = append([]string{"-S", socket, "-O", command}, args...)
+	out, err := exec.CommandContext(ctx, "ssh", append(args, "--", host)...).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("ssh -O %s: the master did not answer within %s", command, muxTimeout)
+	}
+	if err != nil {
+		if line := lastLine(string(out)); line != "" {
+			return "", fmt.Errorf("ssh -O %s: %s", command, line)
+		}
+		return "", fmt.Errorf("ssh -O %s: %v", command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// muxForwardedMsg reports whether a tunnel's forwards were added to its
+// master.
+type muxForwardedMsg struct {
+	tunnelID int
+	mux      *muxForwards
+	err      error
+}
+
+// muxDownMsg reports that a tunnel's master went away.
+type muxDownMsg struct {
+	tunnelID int
+	mux      *muxForwards
+	err      error
+}
+
+// muxForwardCmd adds the tunnel's forwards once its master has logged in.
+func muxForwardCmd(tunnelID int, mux *muxForwards) tea.Cmd {
+	return func() tea.Msg {
+		if master := mux.master; master != nil {
+			select {
+			case <-master.ready:
+			case <-master.done:
+				return muxDownMsg{tunnelID: tunnelID, mux: mux, err: master.exitErr()}
+			case <-mux.stopped:
+				return nil
+			}
+		}
+		return muxForwardedMsg{tunnelID: tunnelID, mux: mux, err: mux.forward()}
+	}
+}
+
+// watchMuxCmd waits for the tunnel's master to go away: the manager's own
+// exits, one the user runs stops answering.
+func watchMuxCmd(tunnelID int, mux *muxForwards) tea.Cmd {
+	return func() tea.Msg {
+		if master := mux.master; master != nil {
+			select {
+			case <-master.done:
+				return muxDownMsg{tunnelID: tunnelID, mux: mux, err: master.exitErr()}
+			case <-mux.stopped:
+				return nil
+			}
+		}
+		for {
+			select {
+			case <-mux.stopped:
+				return nil
+			case <-time.After(muxCheckInterval):
+			}
+			if _, err := runMuxCommand(mux.socket, mux.host, "check"); err != nil {
+				return muxDownMsg{tunnelID: tunnelID, mux: mux, err: err}
+			}
+		}
+	}
+}
+
+// muxForwarded starts the tunnel's checks once its forwards are in place,
+// or takes it down when they could not be added.
+func (m model) muxForwarded(msg muxForwardedMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || t.mux != msg.mux || !t.active {
+		return m, nil
+	}
+	if msg.err != nil {
+		slog.Warn("cannot add forwards to the ssh master", append(t.logAttrs(), "err", msg.err)...)
+		t.appendLog(fmt.Sprintf("Cannot add the forwards to the ssh master (%v), tunnel is down", msg.err))
+		t.stop()
+		m.markFailed(t, fmt.Sprintf("Cannot add the forwards to the ssh master (%v)", msg.err))
+		m.updateTunnelList()
+		return m, m.notify(t.tag+" is down", fmt.Sprintf("Cannot add its forwards to the ssh master for %s: %v", t.host, msg.err))
+	}
+	t.appendLog("Forwards added to the ssh master at " + msg.mux.socket)
+	return m, tea.Batch(append(t.checkCmds(), watchMuxCmd(t.id, msg.mux))...)
+}
+
+// muxDown takes down a tunnel whose master went away.
+func (m model) muxDown(msg muxDownMsg) (tea.Model, tea.Cmd) {
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || t.mux != msg.mux || !t.active {
+		return m, nil
+	}
+	slog.Warn("ssh master gone", append(t.logAttrs(), "err", msg.err)...)
+	t.appendLog(fmt.Sprintf("The ssh master is gone (%v), tunnel is down", msg.err))
+	t.stop()
+	m.markFailed(t, fmt.Sprintf("The ssh master is gone (%v)", msg.err))
+	m.updateTunnelList()
+	return m, m.notify(t.tag+" is down", fmt.Sprintf("The ssh master for %s is gone: %v", t.host, msg.err))
+}
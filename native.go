@@ -0,0 +1,738 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// nativeBackend carries ssh tunnels with the built-in client instead of
+// the ssh binary, so the manager owns the connection: it reconnects,
+// counts bytes and reports errors itself. It is picked per tunnel as the
+// "native" backend, or for every ssh tunnel with ssh_transport: native.
+const nativeBackend = "native"
+
+const (
+	nativeDialTimeout  = 15 * time.Second
+	nativeMaxBackoff   = 30 * time.Second
+	nativeCopyBufBytes = 32 << 10
+)
+
+// usesSSH reports whether tunnels on backend connect over SSH, through the
+// ssh binary or natively, and so take hosts from ~/.ssh/config.
+func usesSSH(backend string) bool {
+	return backend == "" || backend == nativeBackend
+}
+
+// nativeTransport is one tunnel's SSH connection and the forward it
+// carries. The connection is redialed with backoff when it drops; auth and
+// host key failures are final, as retrying cannot fix them.
+type nativeTransport struct {
+	spec        tunnelSpec
+	forwardPort string
+	ep          sshEndpoint
+	ln          net.Listener // local end, nil for remote forwards
+	log         func(string)
+	// ask gets a password, passphrase or host key decision from the
+	// user, see askpass.go. What it returns is kept for reconnects.
+	ask         func(prompt authPrompt) (string, bool)
+	password    string
+	unlocked    map[string]ssh.Signer // identity files by path
+	acceptedKey ssh.PublicKey         // an unknown host key accepted once
+
+	bytesIn    atomic.Uint64 // from the remote side to the local one
+	bytesOut   atomic.Uint64
+	conns      atomic.Int64
+	tuneWarned atomic.Bool
+
+	mu          sync.Mutex
+	client      *ssh.Client
+	connects    int       // connections made, the first one included
+	connectedAt time.Time // zero while not connected
+	state       string
+	fatal       error
+	closed      bool
+	done        chan struct{}
+}
+
+// newNativeTransport checks that the tunnel can be carried natively and
+// binds its local port, so that errors surface before the tunnel is added.
+// start connects.
+func newNativeTransport(spec tunnelSpec, forwardPort string, ep sshEndpoint, pol policy) (*nativeTransport, error) {
+	if len(pol.SSHOptions) > 0 {
+		return nil, fmt.Errorf("the policy sets ssh options, which only the ssh binary applies; use the ssh backend")
+	}
+	if len(spec.Forwards) > 0 {
+		return nil, fmt.Errorf("the native transport forwards a single port; use the ssh backend for additional forwards")
+	}
+	if ep.hostname == "" {
+		ep = resolveSSHEndpoint(spec.Host)
+	}
+	if ep.proxyJump != "" || ep.proxyCommand != "" {
+		return nil, fmt.Errorf("%s is reached through ProxyJump or ProxyCommand, which the native transport does not support; use the ssh backend", spec.Host)
+	}
+	if spec.IdentityFile != "" {
+		ep.identityFiles = []string{identityPath(spec.IdentityFile)}
+	}
+	if spec.compressed() {
+		return nil, fmt.Errorf("the native transport does not compress; use the ssh backend for compression")
+	}
+	if spec.forwarding() != "" {
+		return nil, fmt.Errorf("the native transport does not forward the agent or X11; use the ssh backend")
+	}
+
+	n := &nativeTransport{spec: spec, forwardPort: forwardPort, ep: ep, state: "connecting", done: make(chan struct{})}
+	if spec.Type != "remote" {
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", forwardPort))
+		if err != nil {
+			return nil, err
+		}
+		n.ln = ln
+	}
+	return n, nil
+}
+
+func (n *nativeTransport) start(log func(string)) {
+	n.log = log
+	go n.run()
+	if n.ln != nil {
+		go n.acceptLocal()
+	}
+}
+
+func (n *nativeTransport) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	close(n.done)
+	if n.ln != nil {
+		n.ln.Close()
+	}
+	if n.client != nil {
+		n.client.Close()
+	}
+}
+
+// status describes the connection for the detail panel.
+func (n *nativeTransport) status() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fatal != nil {
+		return "failed: " + n.fatal.Error()
+	}
+	return n.state
+}
+
+// failed reports whether the transport gave up for good.
+func (n *nativeTransport) failed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.fatal != nil
+}
+
+func (n *nativeTransport) setState(state string) {
+	n.mu.Lock()
+	n.state = state
+	n.mu.Unlock()
+}
+
+// setClient installs the live connection, or reports false when the
+// transport was closed while it was being dialed.
+func (n *nativeTransport) setClient(c *ssh.Client) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed && c != nil {
+		return false
+	}
+	n.client = c
+	if c != nil {
+		n.connects++
+		n.connectedAt = time.Now()
+	} else {
+		n.connectedAt = time.Time{}
+	}
+	return true
+}
+
+// connectedSince is when the current connection came up, zero between
+// connections.
+func (n *nativeTransport) connectedSince() time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connectedAt
+}
+
+// reconnects counts the connections made after the first.
+func (n *nativeTransport) reconnects() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return max(n.connects-1, 0)
+}
+
+func (n *nativeTransport) currentClient() *ssh.Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.client
+}
+
+func (n *nativeTransport) isClosed() bool {
+	select {
+	case <-n.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (n *nativeTransport) addr() string {
+	return net.JoinHostPort(n.ep.hostname, n.ep.port)
+}
+
+// run keeps the SSH connection up until the transport is closed or fails.
+func (n *nativeTransport) run() {
+	defer recoverPanic("native transport")
+	backoff := time.Second
+	for {
+		client, err := n.dial()
+		if n.isClosed() {
+			if client != nil {
+				client.Close()
+			}
+			return
+		}
+		if err != nil {
+			if isPermanentSSHError(err) {
+				n.fail(err)
+				return
+			}
+			n.log(fmt.Sprintf("Cannot connect to %s: %v (retrying in %s)", n.addr(), err, backoff))
+			n.setState("retrying: " + err.Error())
+			select {
+			case <-n.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, nativeMaxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		if !n.setClient(client) {
+			client.Close()
+			return
+		}
+		n.setState("connected (" + string(client.ServerVersion()) + ")")
+		n.log(fmt.Sprintf("Connected to %s@%s with the native client", n.ep.user, n.addr()))
+
+		if n.spec.Type == "remote" {
+			if err := n.listenRemote(client); err != nil {
+				// Like ExitOnForwardFailure: a forward that cannot bind is
+				// not a working tunnel
+				client.Close()
+				n.fail(fmt.Errorf("cannot open port %s on %s: %v", n.spec.RemotePort, n.spec.Host, err))
+				return
+			}
+		}
+
+		stop := make(chan struct{})
+		go n.keepalive(client, stop)
+		err = client.Wait()
+		close(stop)
+		n.setClient(nil)
+		if n.isClosed() {
+			return
+		}
+		n.log(fmt.Sprintf("Connection to %s closed: %v, reconnecting", n.addr(), err))
+		n.setState("reconnecting")
+	}
+}
+
+// fail gives up for good. The log line comes last: the tunnel is stopped
+// when it arrives.
+func (n *nativeTransport) fail(err error) {
+	n.mu.Lock()
+	n.fatal = err
+	n.mu.Unlock()
+	n.log("Native client gave up: " + err.Error())
+}
+
+// keepalive closes the connection when the server stops answering, which
+// wakes run up to reconnect. Like ssh's ServerAliveCountMax, it gives up
+// once CountMax checks in a row went unanswered, whether they failed or
+// are still waiting for a reply.
+func (n *nativeTransport) keepalive(client *ssh.Client, stop chan struct{}) {
+	k := defaultKeepalive
+	if n.spec.Keepalive != nil {
+		k = *n.spec.Keepalive
+	}
+	if k.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(k.Interval) * time.Second)
+	defer ticker.Stop()
+	var unanswered atomic.Int32
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if int(unanswered.Add(1)) > k.CountMax {
+				n.log(fmt.Sprintf("No answer to %d keepalives in a row, closing the connection", k.CountMax))
+				client.Close()
+				return
+			}
+			go func() {
+				if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+					unanswered.Store(0)
+				}
+			}()
+		}
+	}
+}
+
+func (n *nativeTransport) dial() (*ssh.Client, error) {
+	auth, closeAgent, err := n.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	hostKeys, err := knownhosts.New(existingFiles(n.ep.knownHosts)...)
+	if err != nil {
+		return nil, &hostKeyError{fmt.Errorf("cannot read known_hosts: %v", err)}
+	}
+	cfg := &ssh.ClientConfig{
+		User: n.ep.user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := hostKeys(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if n.ask != nil && errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+				return n.trustHostKey(hostname, key, err)
+			}
+			return err
+		},
+		Timeout: nativeDialTimeout,
+	}
+	if n.spec.Ciphers != "" {
+		cfg.Ciphers = strings.Split(n.spec.Ciphers, ",")
+	}
+
+	client, err := n.dialSSH(cfg)
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) && len(keyErr.Want) > 0 {
+		// The server may have offered a key type known_hosts has no entry
+		// for; ask for the known types before calling it a mismatch
+		cfg.HostKeyAlgorithms = hostKeyAlgorithms(keyErr.Want)
+		client, err = n.dialSSH(cfg)
+	}
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 && n.ask != nil {
+			return nil, &hostKeyError{fmt.Errorf("host key of %s is not in known_hosts and was not accepted", n.addr())}
+		}
+		if len(keyErr.Want) == 0 {
+			return nil, &hostKeyError{fmt.Errorf("host key of %s is not in known_hosts; connect once with ssh to check and accept it", n.addr())}
+		}
+		return nil, &hostKeyError{fmt.Errorf("HOST KEY MISMATCH for %s: it differs from known_hosts line %d of %s", n.addr(), keyErr.Want[0].Line, keyErr.Want[0].Filename)}
+	}
+	return client, err
+}
+
+// dialSSH is ssh.Dial with the tunnel's TCP tuning on the connection.
+func (n *nativeTransport) dialSSH(cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := n.dialTCP(n.addr(), cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, n.addr(), cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialTCP connects to addr with the tunnel's TCP tuning.
+func (n *nativeTransport) dialTCP(addr string, timeout time.Duration) (net.Conn, error) {
+	tcp := n.tcp()
+	d := net.Dialer{Timeout: timeout, KeepAlive: tcp.keepAlive()}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	n.tune(conn)
+	return conn, nil
+}
+
+func (n *nativeTransport) tcp() tcpTuning {
+	if n.spec.TCP != nil {
+		return *n.spec.TCP
+	}
+	return tcpTuning{}
+}
+
+// tune applies the tunnel's TCP tuning to conn. Options the system
+// refuses are logged once, as every connection would fail the same way.
+func (n *nativeTransport) tune(conn net.Conn) {
+	if err := n.tcp().apply(conn); err != nil && n.tuneWarned.CompareAndSwap(false, true) {
+		n.log(fmt.Sprintf("Cannot apply the TCP tuning: %v", err))
+	}
+}
+
+// trustHostKey asks whether to trust a key known_hosts has no entry for.
+// A key accepted once is trusted again on reconnects; one accepted for
+// good is added to the user's known_hosts, as ssh would.
+func (n *nativeTransport) trustHostKey(hostname string, key ssh.PublicKey, unknown error) error {
+	if n.acceptedKey != nil && bytes.Equal(n.acceptedKey.Marshal(), key.Marshal()) {
+		return nil
+	}
+	fingerprint := key.Type() + " " + ssh.FingerprintSHA256(key)
+	answer, ok := n.ask(authPrompt{hostKey: &hostKeyQuestion{host: hostname, fingerprint: fingerprint, once: true}})
+	if !ok {
+		return unknown
+	}
+	n.acceptedKey = key
+	if answer == "yes" {
+		if err := addKnownHost(n.ep, hostname, key); err != nil {
+			n.log(fmt.Sprintf("Cannot save the host key: %v", err))
+		} else {
+			n.log(fmt.Sprintf("Added %s to %s", fingerprint, n.ep.userKnownHosts))
+		}
+	}
+	return nil
+}
+
+// addKnownHost appends key to the user's known_hosts file, hashing the
+// host name when HashKnownHosts is set.
+func addKnownHost(ep sshEndpoint, hostname string, key ssh.PublicKey) error {
+	if ep.userKnownHosts == "" {
+		return errors.New("no known_hosts file to add it to")
+	}
+	host := knownhosts.Normalize(hostname)
+	if ep.hashKnownHosts {
+		host = knownhosts.HashHostname(host)
+	}
+	if err := os.MkdirAll(filepath.Dir(ep.userKnownHosts), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ep.userKnownHosts, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{host}, key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// authMethods offers the keys in ssh-agent, then the identity files that
+// have no passphrase, then those that do and finally a password, in the
+// order ssh tries them. Passphrases and passwords are asked for only when
+// it comes to them, and only once per tunnel.
+func (n *nativeTransport) authMethods() ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			signers := agent.NewClient(conn).Signers
+			if n.spec.IdentityFile != "" {
+				signers = pinnedAgentSigners(signers, n.ep.identityFiles[0]+".pub")
+			}
+			methods = append(methods, ssh.PublicKeysCallback(signers))
+			closeAgent = func() { conn.Close() }
+		} else if n.spec.Verbose {
+			n.log(fmt.Sprintf("ssh-agent unavailable: %v", err))
+		}
+	}
+
+	var signers []ssh.Signer
+	var locked []string
+	for _, path := range existingFiles(n.ep.identityFiles) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		switch {
+		case errors.As(err, &missing):
+			locked = append(locked, path)
+		case err != nil:
+			n.log(fmt.Sprintf("Skipping %s: %v", path, err))
+		default:
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if n.ask != nil {
+		if len(locked) > 0 {
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return n.unlockKeys(locked), nil
+			}))
+		}
+		methods = append(methods, ssh.KeyboardInteractive(n.answerChallenge))
+		tries := 0
+		methods = append(methods, ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+			tries++
+			return n.askPassword(tries > 1)
+		}), 3))
+	} else if len(locked) > 0 && n.spec.Verbose {
+		n.log(fmt.Sprintf("Skipping %s: it has a passphrase, add it to ssh-agent", strings.Join(locked, ", ")))
+	}
+
+	if len(methods) == 0 {
+		return nil, closeAgent, &authError{fmt.Errorf("no usable keys: run ssh-agent or configure an IdentityFile without a passphrase")}
+	}
+	return methods, closeAgent, nil
+}
+
+// unlockKeys asks for the passphrase of each locked identity file, with
+// three tries as ssh gives. A key the user cancels is skipped.
+func (n *nativeTransport) unlockKeys(paths []string) []ssh.Signer {
+	if n.unlocked == nil {
+		n.unlocked = map[string]ssh.Signer{}
+	}
+	var signers []ssh.Signer
+	for _, path := range paths {
+		if signer, ok := n.unlocked[path]; ok {
+			signers = append(signers, signer)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for try := 0; try < 3; try++ {
+			passphrase, ok := n.ask(authPrompt{text: fmt.Sprintf("Enter passphrase for key '%s':", path)})
+			if !ok {
+				break
+			}
+			signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+			if err == nil {
+				n.unlocked[path] = signer
+				signers = append(signers, signer)
+				break
+			}
+			n.log(fmt.Sprintf("Cannot unlock %s: %v", path, err))
+		}
+	}
+	return signers
+}
+
+// askPassword reuses the password from the last connection, unless it
+// was just refused.
+func (n *nativeTransport) askPassword(retry bool) (string, error) {
+	if n.password != "" && !retry {
+		return n.password, nil
+	}
+	password, ok := n.ask(authPrompt{text: fmt.Sprintf("%s@%s's password:", n.ep.user, n.ep.hostname)})
+	if !ok {
+		return "", errors.New("password prompt cancelled")
+	}
+	n.password = password
+	return password, nil
+}
+
+// answerChallenge passes keyboard-interactive questions (one-time codes,
+// PAM passwords) on to the user.
+func (n *nativeTransport) answerChallenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, q := range questions {
+		prompt := strings.TrimSpace(strings.Join([]string{name, instruction, q}, " "))
+		answer, ok := n.ask(authPrompt{text: prompt, echo: echos[i]})
+		if !ok {
+			return nil, errors.New("prompt cancelled")
+		}
+		answers[i] = answer
+	}
+	return answers, nil
+}
+
+// hostKeyError and authError are failures a retry cannot fix.
+type hostKeyError struct{ err error }
+
+func (e *hostKeyError) Error() string { return e.err.Error() }
+
+type authError struct{ err error }
+
+func (e *authError) Error() string { return e.err.Error() }
+
+func isPermanentSSHError(err error) bool {
+	var hk *hostKeyError
+	var auth *authError
+	return errors.As(err, &hk) || errors.As(err, &auth) || strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// hostKeyAlgorithms lists the algorithms that produce the known keys. RSA
+// keys sign with any of three.
+func hostKeyAlgorithms(known []knownhosts.KnownKey) []string {
+	var algos []string
+	for _, k := range known {
+		if k.Key.Type() == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		} else {
+			algos = append(algos, k.Key.Type())
+		}
+	}
+	return algos
+}
+
+func existingFiles(paths []string) []string {
+	var found []string
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// acceptLocal serves local and SOCKS forwards: each local connection gets
+// a channel over the current SSH connection.
+func (n *nativeTransport) acceptLocal() {
+	defer recoverPanic("native transport")
+	for {
+		conn, err := n.ln.Accept()
+		if err != nil {
+			return
+		}
+		n.tune(conn)
+		go n.forwardLocal(conn)
+	}
+}
+
+func (n *nativeTransport) forwardLocal(conn net.Conn) {
+	defer recoverPanic("native transport")
+	client := n.currentClient()
+	if client == nil {
+		n.log("Dropped a local connection: not connected to " + n.spec.Host)
+		conn.Close()
+		return
+	}
+
+	target := destination(n.spec.RemoteHost, n.spec.RemotePort)
+	if n.spec.Type == "socks" {
+		var err error
+		if target, err = socksHandshake(conn); err != nil {
+			if n.spec.Verbose {
+				n.log("SOCKS: " + err.Error())
+			}
+			conn.Close()
+			return
+		}
+	}
+
+	network := "tcp"
+	if isSocketPath(target) {
+		network = "unix"
+	}
+	remote, err := client.Dial(network, target)
+	if n.spec.Type == "socks" {
+		socksReply(conn, err)
+	}
+	if err != nil {
+		n.log(fmt.Sprintf("Cannot reach %s through %s: %v", target, n.spec.Host, err))
+		conn.Close()
+		return
+	}
+	n.pipe(conn, remote, target)
+}
+
+// listenRemote opens the remote forward's port on the host. The listener
+// goes away with the connection, so it is opened again on every reconnect.
+func (n *nativeTransport) listenRemote(client *ssh.Client) error {
+	ln, err := client.Listen("tcp", net.JoinHostPort("127.0.0.1", n.spec.RemotePort))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer recoverPanic("native transport")
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer recoverPanic("native transport")
+				target := net.JoinHostPort("127.0.0.1", n.forwardPort)
+				local, err := n.dialTCP(target, nativeDialTimeout)
+				if err != nil {
+					n.log(fmt.Sprintf("Cannot reach %s for a connection from %s: %v", target, n.spec.Host, err))
+					conn.Close()
+					return
+				}
+				n.pipe(local, conn, target)
+			}()
+		}
+	}()
+	return nil
+}
+
+// pipe copies both ways between the local and remote ends of one
+// forwarded connection, counting the bytes, until both sides are done.
+func (n *nativeTransport) pipe(local, remote net.Conn, target string) {
+	n.conns.Add(1)
+	defer n.conns.Add(-1)
+	if n.spec.Verbose {
+		n.log("Forwarding a connection to " + target)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		countedCopy(remote, local, &n.bytesOut)
+	}()
+	go func() {
+		defer wg.Done()
+		countedCopy(local, remote, &n.bytesIn)
+	}()
+	wg.Wait()
+	local.Close()
+	remote.Close()
+}
+
+// countedCopy copies until src is done, then half-closes dst so the other
+// direction can finish.
+func countedCopy(dst, src net.Conn, counter *atomic.Uint64) {
+	buf := make([]byte, nativeCopyBufBytes)
+	for {
+		nr, err := src.Read(buf)
+		if nr > 0 {
+			if _, werr := dst.Write(buf[:nr]); werr != nil {
+				break
+			}
+			counter.Add(uint64(nr))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// traffic is the detail panel's byte and connection count.
+func (n *nativeTransport) traffic() string {
+	return fmt.Sprintf("↓ %s ↑ %s • %d open", fmtBytes(n.bytesIn.Load()), fmtBytes(n.bytesOut.Load()), n.conns.Load())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// A note is free text kept with a tunnel, such as "read replica, ask Ops
+// before writes". e edits it in the status bar and the detail panel shows
+// it under the tag. It is the spec's note, so it is saved with the
+// tunnel's profile and comes back when the profile is started.
+
+// maxNoteLen is how many characters a note can have: a line or two.
+const maxNoteLen = 200
+
+// editNote asks for the selected tunnel's note, starting from the one it
+// has.
+func (m model) editNote() model {
+	if m.selectedGroup != "" || m.selectedTunnel >= len(m.tunnels) {
+		return m
+	}
+	m.noteEditing = true
+	m.noteInput = m.tunnels[m.selectedTunnel].note
+	m.notePrevStatus = m.statusMessage
+	m.statusMessage = m.notePrompt()
+	return m
+}
+
+func (m model) notePrompt() string {
+	return fmt.Sprintf("Note for %s: %s█ • Enter save, empty for none • Esc cancel", m.tunnels[m.selectedTunnel].tag, m.noteInput)
+}
+
+func (m model) handleNoteKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.noteEditing = false
+		m.statusMessage = m.notePrevStatus
+		return m, nil
+	case "enter":
+		m.noteEditing = false
+		m.saveNote(strings.Join(strings.Fields(m.noteInput), " "))
+		return m, nil
+	case "backspace":
+		if r := []rune(m.noteInput); len(r) > 0 {
+			m.noteInput = string(r[:len(r)-1])
+		}
+	case "ctrl+u":
+		m.noteInput = ""
+	case " ":
+		m.noteInput += " "
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.noteInput += string(msg.Runes)
+		}
+	}
+	if r := []rune(m.noteInput); len(r) > maxNoteLen {
+		m.noteInput = string(r[:maxNoteLen])
+	}
+	m.statusMessage = m.notePrompt()
+	return m, nil
+}
+
+// saveNote sets the selected tunnel's note and saves the tunnel as a
+// profile, replacing the one it has.
+func (m *model) saveNote(note string) {
+	t := m.tunnels[m.selectedTunnel]
+	spec := t.spec()
+	spec.Note = note
+	profiles, err := loadProfiles()
+	if err == nil {
+		err = saveProfiles(putProfile(profiles, spec))
+	}
+	if err != nil {
+		m.statusMessage = "Cannot save profile: " + err.Error()
+		return
+	}
+	t.note = note
+	slog.Info("tunnel note changed", append(t.logAttrs(), "note", note)...)
+	m.statusMessage = fmt.Sprintf("Saved the note of %s with its profile", t.tag)
+	if note == "" {
+		m.statusMessage = fmt.Sprintf("Removed the note of %s", t.tag)
+	}
+}
+
+// renderNote is the detail panel's note for t, wrapped to width.
+func renderNote(t *tunnel, width int) string {
+	if t.note == "" {
+		return ""
+	}
+	note := lipgloss.NewStyle().Width(width).Render("Note: " + t.note)
+	return degradedStyle.Render(note) + "\n"
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Desktop notifications for a tunnel that goes down, fails to reconnect
+// or comes back, for when the TUI is buried under other windows. They are
+// off unless notifications is set in the config, and use notify-send on
+// Linux, osascript on macOS and a toast through PowerShell on Windows.
+
+const (
+	notifyTitleEnv = "SSH_TUNNEL_MANAGER_NOTIFY_TITLE"
+	notifyBodyEnv  = "SSH_TUNNEL_MANAGER_NOTIFY_BODY"
+)
+
+// The text goes through the environment, so it needs no quoting.
+const (
+	osascriptNotify = `display notification (system attribute "` + notifyBodyEnv + `") with title (system attribute "` + notifyTitleEnv + `")`
+
+	powershellToast = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:` + notifyTitleEnv + `)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:` + notifyBodyEnv + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('SSH Tunnel Manager').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+)
+
+func sendNotification(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("notify-send", "--app-name=SSH Tunnel Manager", title, body)
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", osascriptNotify)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", powershellToast)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	cmd.Env = append(os.Environ(), notifyTitleEnv+"="+title, notifyBodyEnv+"="+body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// notify sends a notification when they are on. Demo tunnels drop all
+// the time, so they never notify. Either way the event shows in the
+// status bar.
+func (m *model) notify(title, body string) tea.Cmd {
+	m.recordEvent(title)
+	if !m.cfg.Notifications || m.demo {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := sendNotification(title, body); err != nil {
+			slog.Warn("desktop notification failed", "title", title, "err", err)
+		}
+		return nil
+	}
+}
+
+// watchNative notices the native client dropping its connection or
+// getting it back, which it does on its own. It runs as its log lines
+// arrive, since it logs both.
+func (m *model) watchNative(t *tunnel) tea.Cmd {
+	up := !t.native.connectedSince().IsZero()
+	switch {
+	case up && t.linkState != "up":
+		back := t.linkState == "down"
+		t.linkState = "up"
+		if t.connected() && !back {
+			m.recordEvent(t.tag + " connected")
+		}
+		if back {
+			return m.notify(t.tag+" reconnected", "The tunnel to "+t.host+" is back up")
+		}
+	case !up && t.linkState == "up":
+		t.linkState = "down"
+		t.disconnected()
+		return m.notify(t.tag+" dropped", "Lost the connection to "+t.host+", reconnecting")
+	}
+	return nil
+}
+
+// nativeGaveUp reports a native client that stopped trying.
+func (m *model) nativeGaveUp(t *tunnel) tea.Cmd {
+	if t.linkState == "down" {
+		return m.notify(t.tag+" could not reconnect", t.native.status())
+	}
+	return m.notify(t.tag+" is down", t.native.status())
+}
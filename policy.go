@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// policy is an admin-provided set of rules every new tunnel must satisfy,
+// read from a system-wide policy.json that users cannot override. A missing
+// file means no restrictions.
+type policy struct {
+	// AllowedHosts are shell-style patterns (e.g. "*.staging.corp") matched
+	// against the hostname ssh actually connects to. Empty allows any host.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+
+	// ForbiddenRemotePorts are single ports ("22") or ranges ("6000-6063").
+	ForbiddenRemotePorts []string `json:"forbidden_remote_ports,omitempty"`
+
+	// SSHOptions are passed to every tunnel's ssh as -o key=value, taking
+	// precedence over ~/.ssh/config.
+	SSHOptions map[string]string `json:"ssh_options,omitempty"`
+
+	// SharedDaemon is the socket of a daemon the users of this machine
+	// share, instead of one each in their config directory. DaemonUsers
+	// gives each user let in a role by name, "*" standing for the others
+	// (see users.go).
+	SharedDaemon string            `json:"shared_daemon,omitempty"`
+	DaemonUsers  map[string]string `json:"daemon_users,omitempty"`
+
+	ports [][2]int
+	users map[string]role
+}
+
+func policyPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("ProgramData"), appName, "policy.json")
+	case "darwin":
+		return filepath.Join("/Library/Application Support", appName, "policy.json")
+	}
+	return filepath.Join("/etc", appName, "policy.json")
+}
+
+// loadPolicy reads the system policy. A policy that exists but cannot be
+// parsed is an error rather than no policy, so a typo never lifts the rules.
+func loadPolicy() (policy, error) {
+	var p policy
+
+	file := policyPath()
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+
+	if err := decodeJSONFile(file, data, &p); err != nil {
+		return p, err
+	}
+
+	for _, pattern := range p.AllowedHosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return p, fmt.Errorf("%s: bad host pattern %q", file, pattern)
+		}
+	}
+	for _, spec := range p.ForbiddenRemotePorts {
+		lo, hi, ok := strings.Cut(spec, "-")
+		if !ok {
+			hi = lo
+		}
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || from > to {
+			return p, fmt.Errorf("%s: bad port or range %q", file, spec)
+		}
+		p.ports = append(p.ports, [2]int{from, to})
+	}
+	for key, value := range p.SSHOptions {
+		if strings.ContainsAny(key, " =") || value == "" {
+			return p, fmt.Errorf("%s: bad ssh option %q=%q", file, key, value)
+		}
+	}
+	if p.SharedDaemon != "" {
+		if !filepath.IsAbs(p.SharedDaemon) {
+			return p, fmt.Errorf("%s: shared_daemon must be an absolute path, got %q", file, p.SharedDaemon)
+		}
+		if runtime.GOOS != "linux" {
+			return p, fmt.Errorf("%s: shared_daemon is only supported on Linux", file)
+		}
+	}
+	if p.users, err = checkUsers(p.DaemonUsers); err != nil {
+		return p, fmt.Errorf("%s: %w", file, err)
+	}
+	return p, nil
+}
+
+// checkHost resolves host through ssh's config so an alias can't be used
+// to reach a hostname the policy does not allow.
+func (p policy) checkHost(host string) error {
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	hostname := resolveSSHEndpoint(host).hostname
+	for _, pattern := range p.AllowedHosts {
+		if ok, _ := path.Match(pattern, hostname); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("blocked by policy: %s is not an allowed host (allowed: %s)", hostname, strings.Join(p.AllowedHosts, ", "))
+}
+
+func (p policy) checkRemotePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return nil
+	}
+	for i, r := range p.ports {
+		if n >= r[0] && n <= r[1] && r[0] == r[1] {
+			return fmt.Errorf("blocked by policy: remote port %s is forbidden", port)
+		}
+		if n >= r[0] && n <= r[1] {
+			return fmt.Errorf("blocked by policy: remote port %s is in the forbidden range %s", port, p.ForbiddenRemotePorts[i])
+		}
+	}
+	return nil
+}
+
+func (p policy) check(spec tunnelSpec) error {
+	if err := p.checkHost(spec.Host); err != nil {
+		return err
+	}
+	if err := p.checkForwarding(spec); err != nil {
+		return err
+	}
+	for _, f := range spec.Forwards {
+		if err := p.checkRemotePort(f.RemotePort); err != nil {
+			return err
+		}
+	}
+	return p.checkRemotePort(spec.RemotePort)
+}
+
+// sshArgs are the mandatory options, in a stable order. ssh uses the first
+// value it sees for an option, so these must come before the host.
+func (p policy) sshArgs() []string {
+	keys := make([]string, 0, len(p.SSHOptions))
+	for key := range p.SSHOptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, "-o", key+"="+p.SSHOptions[key])
+	}
+	return args
+}
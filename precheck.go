@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	precheckTimeout = 3 * time.Second
+
+	// happyEyeballsDelay is how long an attempt gets before the next
+	// candidate address is dialed in parallel (RFC 8305 recommends 250ms).
+	happyEyeballsDelay = 250 * time.Millisecond
+)
+
+// sshEndpoint is the effective network target of an SSH host as resolved
+// by `ssh -G`, so aliases from ~/.ssh/config dial the right hostname/port.
+type sshEndpoint struct {
+	hostname     string
+	port         string
+	proxyJump    string
+	proxyCommand string
+	// via is how ssh gets to hostname through proxyJump or proxyCommand,
+	// hop by hop, with each jump host reached the way its own config says
+	via []routeHop
+
+	// Only the native transport uses these; ssh reads its config itself
+	user          string
+	identityFiles []string
+	knownHosts    []string
+	// userKnownHosts is where accepted host keys are added
+	userKnownHosts string
+	hashKnownHosts bool
+}
+
+type precheckMsg struct {
+	endpoint   sshEndpoint
+	addr       string // address that answered first
+	candidates int    // number of addresses the host resolved to
+	skipped    string // why the dial was not attempted, if it wasn't
+	err        error
+}
+
+// routeHop is a host ssh goes through on the way to an endpoint: a jump
+// host, as named in the config and the address it resolves to, or a
+// ProxyCommand that is not another ssh.
+type routeHop struct {
+	name    string
+	addr    string
+	command string
+}
+
+func (h routeHop) String() string {
+	switch {
+	case h.command != "":
+		return "ProxyCommand(" + h.command + ")"
+	case h.addr == "" || h.addr == h.name || strings.HasPrefix(h.addr, h.name+":"):
+		return orNone(h.addr, h.name)
+	}
+	return h.name + " (" + h.addr + ")"
+}
+
+// resolveSSHEndpoint asks ssh -G for host's effective config, and for the
+// jump hosts on its way there.
+func resolveSSHEndpoint(host string) sshEndpoint {
+	ep := lookupSSHEndpoint(host)
+	ep.via = ep.routeHops([]string{host})
+	return ep
+}
+
+func lookupSSHEndpoint(host string) sshEndpoint {
+	ep := defaultSSHEndpoint(host)
+	output, err := exec.Command("ssh", "-G", "--", host).Output()
+	if err != nil {
+		return ep
+	}
+
+	ep.identityFiles, ep.knownHosts = nil, nil
+	home, _ := os.UserHomeDir()
+	expand := func(path string) string {
+		if rest, ok := strings.CutPrefix(path, "~/"); ok && home != "" {
+			return filepath.Join(home, rest)
+		}
+		return path
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "hostname":
+			ep.hostname = value
+		case "port":
+			ep.port = value
+		case "proxyjump":
+			if value != "none" {
+				ep.proxyJump = value
+			}
+		case "proxycommand":
+			if value != "none" {
+				ep.proxyCommand = value
+			}
+		case "user":
+			ep.user = value
+		case "identityfile":
+			ep.identityFiles = append(ep.identityFiles, expand(value))
+		case "userknownhostsfile", "globalknownhostsfile":
+			for i, path := range strings.Fields(value) {
+				ep.knownHosts = append(ep.knownHosts, expand(path))
+				if i == 0 && key == "userknownhostsfile" {
+					ep.userKnownHosts = expand(path)
+				}
+			}
+		case "hashknownhosts":
+			ep.hashKnownHosts = value == "yes"
+		}
+	}
+	return ep
+}
+
+// defaultSSHEndpoint is what ssh would use for host without a config
+// file, for when the ssh binary is not there to ask.
+func defaultSSHEndpoint(host string) sshEndpoint {
+	ep := sshEndpoint{hostname: host, port: "22"}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		ep.user, ep.hostname = host[:i], host[i+1:]
+	} else if u, err := user.Current(); err == nil {
+		// On Windows this is DOMAIN\user; ssh logs in as user
+		ep.user = u.Username[strings.LastIndex(u.Username, `\`)+1:]
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"id_rsa", "id_ecdsa", "id_ed25519"} {
+			ep.identityFiles = append(ep.identityFiles, filepath.Join(home, ".ssh", name))
+		}
+		ep.userKnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		ep.knownHosts = append(ep.knownHosts, ep.userKnownHosts)
+	}
+	ep.knownHosts = append(ep.knownHosts, "/etc/ssh/ssh_known_hosts")
+	return ep
+}
+
+// route describes the hops ssh traverses to reach the endpoint, e.g.
+// "localhost → bastion (10.0.0.1:22) → db.internal:22". An upstream proxy
+// takes the place of the config's ProxyJump or ProxyCommand, as its
+// ProxyCommand on the command line comes first.
+func (ep sshEndpoint) route(proxy string) string {
+	hops := []string{"localhost"}
+	if proxy != "" {
+		hops = append(hops, proxy)
+	} else {
+		for _, h := range ep.via {
+			hops = append(hops, h.String())
+		}
+	}
+	hops = append(hops, net.JoinHostPort(ep.hostname, ep.port))
+	return strings.Join(hops, " → ")
+}
+
+// routeHops follows ep's ProxyJump, or a ProxyCommand of the form
+// ssh -W %h:%p bastion, to the hosts it goes through. ssh reaches the
+// first jump host by that host's own config, so its jumps come first; each
+// later one is reached through the one before it. path holds the hosts
+// already followed, so a config that goes around in a circle ends.
+func (ep sshEndpoint) routeHops(path []string) []routeHop {
+	var jumps []string
+	switch {
+	case ep.proxyJump != "":
+		jumps = strings.Split(ep.proxyJump, ",")
+	case ep.proxyCommand == "":
+		return nil
+	case sshProxyCommandJump(ep.proxyCommand) != "":
+		jumps = []string{sshProxyCommandJump(ep.proxyCommand)}
+	default:
+		return []routeHop{{command: ep.proxyCommand}}
+	}
+
+	var hops []routeHop
+	for i, jump := range jumps {
+		name, hop := lookupJump(jump)
+		if i == 0 && !slices.Contains(path, name) {
+			hops = append(hops, hop.routeHops(append(path, name))...)
+		}
+		hops = append(hops, routeHop{name: name, addr: net.JoinHostPort(hop.hostname, hop.port)})
+	}
+	return hops
+}
+
+// sshProxyCommandJump returns the host a ProxyCommand that runs
+// ssh -W %h:%p through goes through, as a ProxyJump would name it, or ""
+// for any other command.
+func sshProxyCommandJump(command string) string {
+	args := strings.Fields(command)
+	if len(args) == 0 || strings.TrimSuffix(filepath.Base(args[0]), ".exe") != "ssh" {
+		return ""
+	}
+	var host, port string
+	stdio := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if host == "" {
+				host = arg
+			}
+			continue
+		}
+		flag := arg[1:]
+		stdio = stdio || strings.HasPrefix(flag, "W")
+		// ssh's options that take an argument, as the next word when
+		// not attached
+		if len(flag) == 1 && strings.Contains("BbcDEeFIiJLlmOoPpQRSWw", flag) && i+1 < len(args) {
+			if flag == "p" {
+				port = args[i+1]
+			}
+			i++
+		}
+	}
+	if !stdio || host == "" {
+		return ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return host
+}
+
+// lookupJump resolves one ProxyJump hop, which may be [user@]host[:port]
+// as well as an ssh:// URI, which ssh -G understands on its own. name is
+// the hop without the user and port.
+func lookupJump(jump string) (string, sshEndpoint) {
+	host, port := jump, ""
+	if !strings.HasPrefix(jump, "ssh://") {
+		at := strings.LastIndex(jump, "@")
+		if i := strings.LastIndex(jump, ":"); i > at {
+			host, port = jump[:i], jump[i+1:]
+		}
+	}
+	hop := lookupSSHEndpoint(host)
+	if port != "" {
+		hop.port = port
+	}
+	name := strings.TrimPrefix(host, "ssh://")
+	return name[strings.LastIndex(name, "@")+1:], hop
+}
+
+// firstHop is the endpoint the local machine actually dials: the first
+// jump host when ProxyJump is in effect, the target itself otherwise.
+func (ep sshEndpoint) firstHop() sshEndpoint {
+	if ep.proxyJump == "" {
+		return ep
+	}
+	first, _, _ := strings.Cut(ep.proxyJump, ",")
+	_, hop := lookupJump(first)
+	return hop
+}
+
+// checkReachability does a plain TCP dial to the SSH endpoint so obvious
+// network problems are reported before ssh sits through its own timeout.
+func checkReachability(ep sshEndpoint) precheckMsg {
+	ctx, cancel := context.WithTimeout(context.Background(), precheckTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(ep.hostname, ep.port)
+	ips, err := resolveCandidates(ctx, ep.hostname)
+	if err != nil {
+		return precheckMsg{err: describeDialError(addr, err)}
+	}
+
+	conn, err := dialHappyEyeballs(ctx, ips, ep.port)
+	if err != nil {
+		return precheckMsg{candidates: len(ips), err: describeDialError(addr, err)}
+	}
+	defer conn.Close()
+
+	return precheckMsg{addr: conn.RemoteAddr().String(), candidates: len(ips)}
+}
+
+// resolveCandidates looks up every address of hostname and orders them
+// IPv6 first, alternating families so a broken stack can't stall the rest.
+func resolveCandidates(ctx context.Context, hostname string) ([]net.IP, error) {
+	if ip := net.ParseIP(hostname); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	var v4, v6 []net.IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a.IP)
+		} else {
+			v6 = append(v6, a.IP)
+		}
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			ips = append(ips, v6[i])
+		}
+		if i < len(v4) {
+			ips = append(ips, v4[i])
+		}
+	}
+	return ips, nil
+}
+
+// dialHappyEyeballs races connections to the candidate addresses. Attempts
+// start happyEyeballsDelay apart (or as soon as the previous one fails) and
+// the first connection to succeed wins; the others are abandoned.
+func dialHappyEyeballs(ctx context.Context, ips []net.IP, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+
+	var dialer net.Dialer
+	next := 0
+	launch := func() {
+		addr := net.JoinHostPort(ips[next].String(), port)
+		next++
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	launch()
+	pending := 1
+	timer := time.NewTimer(happyEyeballsDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close any loser that connected before the cancel landed
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				launch()
+				pending++
+				timer.Reset(happyEyeballsDelay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				launch()
+				pending++
+				timer.Reset(happyEyeballsDelay)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+func describeDialError(addr string, err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("cannot resolve %s", dnsErr.Name)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("connection refused by %s", addr)
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return fmt.Errorf("host unreachable: %s", addr)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("host unreachable: %s (no answer after %s)", addr, precheckTimeout)
+	}
+	return fmt.Errorf("cannot connect to %s: %v", addr, err)
+}
+
+// precheckCmd resolves the host's effective ssh config and, when dial is
+// set, checks the endpoint ssh will actually connect to first: the proxy
+// when one is configured, the first jump host under ProxyJump, otherwise
+// the host itself. Hosts behind a ProxyCommand can't be checked directly.
+func precheckCmd(host, proxy string, dial bool) tea.Cmd {
+	return func() tea.Msg {
+		ep := resolveSSHEndpoint(host)
+
+		var msg precheckMsg
+		switch p, err := parseProxy(proxy); {
+		case !dial:
+		case proxy != "" && err == nil:
+			msg = checkReachability(p.endpoint())
+		case ep.proxyCommand != "":
+			msg.skipped = "host is reached through a ProxyCommand"
+		default:
+			msg = checkReachability(ep.firstHop())
+		}
+
+		msg.endpoint = ep
+		return msg
+	}
+}
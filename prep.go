@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// prepTimeout bounds the remote preparation command so a hung service
+// start doesn't leave the wizard spinning forever.
+const prepTimeout = 2 * time.Minute
+
+type prepMsg struct {
+	output []string
+	err    error
+}
+
+// prepCmd runs the tunnel's preparation command on the remote host over a
+// separate ssh session. BatchMode keeps ssh from waiting on a prompt the
+// user can't see.
+func prepCmd(connectArgs []string, host, command string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), prepTimeout)
+		defer cancel()
+
+		args := append([]string{"-o", "BatchMode=yes"}, connectArgs...)
+		args = append(args, "--", host, command)
+		cmd := exec.CommandContext(ctx, "ssh", args...)
+		setProcessGroup(cmd)
+
+		out, err := cmd.CombinedOutput()
+
+		var lines []string
+		for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			err = fmt.Errorf("preparation command timed out after %s", prepTimeout)
+		case err != nil:
+			err = fmt.Errorf("preparation command failed: %v", err)
+			if len(lines) > 0 {
+				err = fmt.Errorf("%v: %s", err, lines[len(lines)-1])
+			}
+		}
+		return prepMsg{output: lines, err: err}
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// setProcessGroup starts the child in its own process group so helpers it
+// spawns (a ProxyCommand, the nested ssh of a ProxyJump) can be signalled
+// together with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// detachProcess starts the child in a session of its own, so it outlives
+// the terminal that started it. Like setProcessGroup, it leads its group.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether pid is still running.
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// terminateProcessGroup asks a detached child and its helpers to exit.
+func terminateProcessGroup(pid int) error {
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		return syscall.Kill(pid, syscall.SIGTERM)
+	}
+	return nil
+}
+
+// killProcessTree kills the child and everything in its process group.
+func killProcessTree(cmd *exec.Cmd) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// watchTerminalSize calls resized with the terminal's new size whenever it
+// changes, until stop is closed.
+func watchTerminalSize(fd int, stop <-chan struct{}, resized func(w, h int)) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-winch:
+			if w, h, err := term.GetSize(fd); err == nil {
+				resized(w, h)
+			}
+		}
+	}
+}
+
+// listSSHProcesses lists the running ssh processes with their arguments.
+// ps joins the arguments with spaces, so on Linux they are read back from
+// /proc, which keeps them apart.
+func listSSHProcesses() ([]process, error) {
+	out, err := exec.Command("ps", "-axww", "-o", "pid=,args=").Output()
+	if err != nil {
+		return nil, err
+	}
+	var procs []process
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isSSHBinary(fields[1]) {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		args := fields[1:]
+		if cmdline, err := os.ReadFile("/proc/" + fields[0] + "/cmdline"); err == nil {
+			args = strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		}
+		procs = append(procs, process{pid: pid, args: args})
+	}
+	return procs, nil
+}
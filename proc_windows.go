@@ -0,0 +1,105 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// stillActive is the exit code Windows reports for a running process.
+const stillActive = 259
+
+// setProcessGroup keeps console control events (Ctrl+C, Ctrl+Break) meant
+// for the manager away from the child, like its own group does on Unix.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// processAlive reports whether pid is still running. A process that has
+// exited can still be opened while a handle to it is around, so its exit
+// code decides.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// taskkill ends pid and every process it started: Windows has no process
+// groups to signal, and killing ssh.exe alone leaves a ProxyCommand or the
+// nested ssh of a ProxyJump running.
+func taskkill(pid int) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+}
+
+func terminateProcessGroup(pid int) error {
+	return taskkill(pid)
+}
+
+// killProcessTree kills the child and everything it started.
+func killProcessTree(cmd *exec.Cmd) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	if err := taskkill(cmd.Process.Pid); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// watchTerminalSize polls for size changes, as Windows consoles have no
+// SIGWINCH.
+func watchTerminalSize(fd int, stop <-chan struct{}, resized func(w, h int)) {
+	lastW, lastH, _ := term.GetSize(fd)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if w, h, err := term.GetSize(fd); err == nil && (w != lastW || h != lastH) {
+				lastW, lastH = w, h
+				resized(w, h)
+			}
+		}
+	}
+}
+
+// listSSHProcesses lists the running ssh.exe processes with their
+// arguments, which Windows keeps as a single command line.
+func listSSHProcesses() ([]process, error) {
+	script := `Get-CimInstance Win32_Process -Filter "Name='ssh.exe'" | ForEach-Object { "$($_.ProcessId) $($_.CommandLine)" }`
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return nil, err
+	}
+	var procs []process
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		args := fields[1:]
+		for i, arg := range args {
+			args[i] = strings.Trim(arg, `"`)
+		}
+		if pid, err := strconv.Atoi(fields[0]); err == nil && isSSHBinary(args[0]) {
+			procs = append(procs, process{pid: pid, args: args})
+		}
+	}
+	return procs, nil
+}
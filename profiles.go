@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	profileFetchTimeout = 15 * time.Second
+	maxProfileBundle    = 1 << 20
+)
+
+// A profile is a saved tunnelSpec, identified by its tag, that can be
+// started again without going through the wizard. Local profiles live in
+// profiles.json next to config.json; teams can publish bundles of them as
+// YAML (or JSON) and merge them in with import.
+type profileBundle struct {
+	Profiles []tunnelSpec `json:"profiles" yaml:"profiles"`
+}
+
+func profilesPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profiles.json"), nil
+}
+
+func loadProfiles() ([]tunnelSpec, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle profileBundle
+	if err := decodeJSONFile(path, data, &bundle); err != nil {
+		return nil, err
+	}
+	return bundle.Profiles, nil
+}
+
+func saveProfiles(profiles []tunnelSpec) error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(profileBundle{Profiles: profiles}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// putProfile adds spec, replacing any profile with the same tag.
+func putProfile(profiles []tunnelSpec, spec tunnelSpec) []tunnelSpec {
+	for i := range profiles {
+		if profiles[i].Tag == spec.Tag {
+			profiles[i] = spec
+			return profiles
+		}
+	}
+	return append(profiles, spec)
+}
+
+// fetchProfileBundle downloads a shared bundle and checks every profile in
+// it the way the wizard would, so a bad entry is reported before merging.
+func fetchProfileBundle(url string) ([]tunnelSpec, error) {
+	client := &http.Client{Timeout: profileFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProfileBundle))
+	if err != nil {
+		return nil, err
+	}
+	return parseProfileBundle(url, data)
+}
+
+// parseProfileBundle reads a bundle from source, a URL or file name for
+// errors, and checks its profiles.
+func parseProfileBundle(source string, data []byte) ([]tunnelSpec, error) {
+	// JSON is valid YAML, so one decoder covers both
+	var bundle profileBundle
+	if err := decodeYAML(source, data, &bundle); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i := range bundle.Profiles {
+		p := &bundle.Profiles[i]
+		if p.Tag == "" {
+			return nil, fmt.Errorf("%s: profile %d has no tag", source, i+1)
+		}
+		if seen[p.Tag] {
+			return nil, fmt.Errorf("%s: profile %s appears twice", source, p.Tag)
+		}
+		seen[p.Tag] = true
+		if err := p.normalize(); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %w", source, p.Tag, err)
+		}
+	}
+	return bundle.Profiles, nil
+}
+
+// profileChange is one incoming profile that is new or differs from the
+// local profile with the same tag.
+type profileChange struct {
+	incoming tunnelSpec
+	local    *tunnelSpec // nil when the profile is new
+}
+
+// diffProfiles lists what merging incoming would change. Local profiles the
+// bundle doesn't mention are kept as they are.
+func diffProfiles(local, incoming []tunnelSpec) []profileChange {
+	var changes []profileChange
+	for _, in := range incoming {
+		var existing *tunnelSpec
+		for i := range local {
+			if local[i].Tag == in.Tag {
+				existing = &local[i]
+				break
+			}
+		}
+		if existing == nil || !reflect.DeepEqual(*existing, in) {
+			changes = append(changes, profileChange{incoming: in, local: existing})
+		}
+	}
+	return changes
+}
+
+func mergeProfiles(local []tunnelSpec, changes []profileChange) []tunnelSpec {
+	merged := append([]tunnelSpec(nil), local...)
+	for _, c := range changes {
+		merged = putProfile(merged, c.incoming)
+	}
+	return merged
+}
+
+// describe renders the change as diff-style lines: the new profile, or
+// each field that differs from the local one.
+func (c profileChange) describe() []string {
+	in := c.incoming
+	if c.local == nil {
+		lines := []string{fmt.Sprintf("+ %s: %s %s → %s", in.Tag, in.Host, in.LocalPort, in.RemotePort)}
+		// Hooks run on this machine, so they are worth a look before merging
+		if in.OnConnect != "" {
+			lines = append(lines, fmt.Sprintf("    on_connect: %q", in.OnConnect))
+		}
+		if in.OnDisconnect != "" {
+			lines = append(lines, fmt.Sprintf("    on_disconnect: %q", in.OnDisconnect))
+		}
+		return lines
+	}
+
+	lines := []string{"~ " + in.Tag}
+	old, updated := c.local.fields(), in.fields()
+	for i := range old {
+		if old[i][1] != updated[i][1] {
+			lines = append(lines, fmt.Sprintf("    %s: %q → %q", old[i][0], old[i][1], updated[i][1]))
+		}
+	}
+	return lines
+}
+
+// fields lists the spec as name/value pairs for display.
+func (s tunnelSpec) fields() [][2]string {
+	return [][2]string{
+		{"host", s.Host},
+		{"local_port", s.LocalPort},
+		{"remote_port", s.RemotePort},
+		{"proxy", s.Proxy},
+		{"prep", s.Prep},
+		{"smoke_test", s.SmokeTest},
+		{"health_check", s.HealthCheck},
+		{"on_connect", s.OnConnect},
+		{"on_disconnect", s.OnDisconnect},
+		{"web", strconv.FormatBool(s.Web)},
+		{"web_url", s.WebURL},
+		{"note", s.Note},
+		{"color", s.Color},
+		{"tls_mode", s.TLSMode},
+		{"verbose", strconv.FormatBool(s.Verbose)},
+		{"keepalive", s.keepaliveSetting()},
+		{"tcp", s.tcpSetting()},
+		{"identity_file", s.IdentityFile},
+		{"control_path", s.ControlPath},
+		{"compression", s.compressionSetting()},
+		{"ciphers", s.Ciphers},
+		{"forward_agent", strconv.FormatBool(s.ForwardAgent)},
+		{"x11", s.X11},
+		{"close_after", strconv.Itoa(s.CloseAfter)},
+		{"close_idle", strconv.Itoa(s.CloseIdle)},
+		{"lazy", strconv.FormatBool(s.Lazy)},
+	}
+}
+
+type profileBundleMsg struct {
+	profiles []tunnelSpec
+	err      error
+}
+
+func fetchProfileBundleCmd(url string) tea.Cmd {
+	return func() tea.Msg {
+		profiles, err := fetchProfileBundle(url)
+		return profileBundleMsg{profiles: profiles, err: err}
+	}
+}
+
+// runImport implements `import --from-url URL`: it shows what the bundle
+// would change and merges it into the local profiles once confirmed.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	url := fs.String("from-url", "", "URL of a YAML or JSON profile bundle (defaults to profiles_url from the config)")
+	yes := fs.Bool("yes", false, "merge without asking for confirmation")
+	fs.Parse(args)
+
+	if *url == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		*url = cfg.ProfilesURL
+	}
+	if *url == "" {
+		return errors.New("no bundle given: use --from-url or set profiles_url in the config")
+	}
+
+	incoming, err := fetchProfileBundle(*url)
+	if err != nil {
+		return err
+	}
+	local, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	changes := diffProfiles(local, incoming)
+	if len(changes) == 0 {
+		fmt.Println("Local profiles are up to date.")
+		return nil
+	}
+	for _, c := range changes {
+		for _, line := range c.describe() {
+			fmt.Println(line)
+		}
+	}
+
+	if !*yes {
+		fmt.Printf("\nMerge %d profile(s)? [y/N] ", len(changes))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing changed.")
+			return nil
+		}
+	}
+
+	if err := saveProfiles(mergeProfiles(local, changes)); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d profile(s).\n", len(changes))
+	return nil
+}
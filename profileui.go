@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"time"
+)
+
+// uiProfiler times Update and View for --profile-ui. Bubbletea calls both
+// from its event loop, so it needs no locking.
+type uiProfiler struct {
+	update, view latencyStats
+
+	// Allocated during the last View, i.e. per rendered frame. The runtime
+	// counters are process-wide, so log goroutines add a little noise.
+	frameBytes, frameObjects uint64
+	maxFrameBytes            uint64
+
+	samples []metrics.Sample
+}
+
+type latencyStats struct {
+	last, max, total time.Duration
+	n                int
+}
+
+func (s *latencyStats) add(d time.Duration) {
+	s.last = d
+	s.max = max(s.max, d)
+	s.total += d
+	s.n++
+}
+
+func (s latencyStats) avg() time.Duration {
+	if s.n == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.n)
+}
+
+func newUIProfiler() *uiProfiler {
+	return &uiProfiler{samples: []metrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}}
+}
+
+type profSample struct {
+	at             time.Time
+	bytes, objects uint64
+}
+
+func (p *uiProfiler) sample() profSample {
+	metrics.Read(p.samples)
+	return profSample{at: time.Now(), bytes: p.samples[0].Value.Uint64(), objects: p.samples[1].Value.Uint64()}
+}
+
+func (p *uiProfiler) trackUpdate(start time.Time) {
+	p.update.add(time.Since(start))
+}
+
+func (p *uiProfiler) trackView(start profSample) {
+	end := p.sample()
+	p.view.add(end.at.Sub(start.at))
+	p.frameBytes = end.bytes - start.bytes
+	p.frameObjects = end.objects - start.objects
+	p.maxFrameBytes = max(p.maxFrameBytes, p.frameBytes)
+}
+
+// summary is the status bar text. It reports the previous frame, since the
+// current one is still being rendered.
+func (p *uiProfiler) summary() string {
+	return fmt.Sprintf("update %s (max %s) • view %s (avg %s, max %s) • frame %s, %d allocs",
+		fmtLatency(p.update.last), fmtLatency(p.update.max),
+		fmtLatency(p.view.last), fmtLatency(p.view.avg()), fmtLatency(p.view.max),
+		fmtBytes(p.frameBytes), p.frameObjects)
+}
+
+func (p *uiProfiler) logSummary() {
+	slog.Info("ui profile",
+		"updates", p.update.n, "update_avg", p.update.avg(), "update_max", p.update.max,
+		"frames", p.view.n, "view_avg", p.view.avg(), "view_max", p.view.max,
+		"frame_bytes_max", p.maxFrameBytes)
+}
+
+func fmtLatency(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+}
+
+func fmtBytes(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// startPprof writes a CPU profile of the whole session to dir/cpu.pprof.
+// The returned func stops it and adds a heap profile, dir/heap.pprof.
+func startPprof(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cpu, err := os.Create(filepath.Join(dir, "cpu.pprof"))
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		cpu.Close()
+		return nil, err
+	}
+
+	return func() {
+		pprof.StopCPUProfile()
+		cpu.Close()
+
+		heap, err := os.Create(filepath.Join(dir, "heap.pprof"))
+		if err != nil {
+			slog.Error("heap profile", "err", err)
+			return
+		}
+		defer heap.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(heap); err != nil {
+			slog.Error("heap profile", "err", err)
+		}
+	}, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const probeTimeout = time.Second
+
+// protocolNames are the long names shown in the detail panel for the short
+// labels used in the tunnel list.
+var protocolNames = map[string]string{
+	"http":  "HTTP",
+	"tls":   "TLS",
+	"pg":    "PostgreSQL",
+	"mysql": "MySQL",
+	"redis": "Redis",
+	"ssh":   "SSH",
+	"smtp":  "SMTP",
+	"ftp":   "FTP",
+	"socks": "SOCKS5",
+}
+
+type protocolMsg struct {
+	tunnelID  int
+	forward   int // 0 for the main forward, i+1 for the tunnel's forwards[i]
+	protocol  string
+	reachable bool
+}
+
+// postgresSSLRequest is the 8-byte message a Postgres client sends to ask
+// for TLS; servers answer with a single 'S' or 'N'.
+var postgresSSLRequest = []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+
+// socks5Greeting offers a SOCKS5 server the "no authentication" method; it
+// answers with the version and the method it picked.
+var socks5Greeting = []byte{0x05, 0x01, 0x00}
+
+// detectProtocol identifies the service behind a local port from how it
+// answers a few harmless probes, returning "" when nothing matches.
+// Server-first protocols are recognized from their banner; client-first
+// ones from their reply to a Postgres SSLRequest, a TLS handshake, an HTTP
+// HEAD, a Redis PING or a SOCKS5 greeting.
+func detectProtocol(localPort string) string {
+	addr := net.JoinHostPort("localhost", localPort)
+
+	if banner := probe(addr, nil); len(banner) > 0 {
+		switch {
+		case bytes.HasPrefix(banner, []byte("SSH-")):
+			return "ssh"
+		case len(banner) > 4 && banner[4] == 0x0a:
+			return "mysql" // protocol v10 handshake after the 4-byte header
+		case bytes.HasPrefix(banner, []byte("220")) && bytes.Contains(banner, []byte("FTP")):
+			return "ftp"
+		case bytes.HasPrefix(banner, []byte("220")):
+			return "smtp"
+		}
+		return ""
+	}
+
+	// Some HTTPS servers answer plaintext with an HTTP error, so TLS has
+	// to be ruled out before the HTTP probe
+	tlsChecked := false
+	for _, request := range [][]byte{
+		postgresSSLRequest,
+		[]byte("HEAD / HTTP/1.0\r\n\r\n"),
+		[]byte("PING\r\n"),
+		socks5Greeting,
+	} {
+		if !tlsChecked && !bytes.Equal(request, postgresSSLRequest) {
+			tlsChecked = true
+			if speaksTLS(addr) {
+				return "tls"
+			}
+		}
+
+		reply := probe(addr, request)
+		switch {
+		case len(reply) == 0:
+			continue
+		case len(reply) == 1 && bytes.Equal(request, postgresSSLRequest) && (reply[0] == 'S' || reply[0] == 'N'):
+			return "pg"
+		case len(reply) == 2 && bytes.Equal(request, socks5Greeting) && reply[0] == 0x05:
+			return "socks"
+		case bytes.HasPrefix(reply, []byte("HTTP/")):
+			return "http"
+		case reply[0] == '+' || bytes.HasPrefix(reply, []byte("-ERR")) || bytes.HasPrefix(reply, []byte("-NOAUTH")):
+			return "redis"
+		case reply[0] == 0x15 && len(reply) > 1 && reply[1] == 0x03:
+			return "tls" // TLS alert record in answer to plaintext
+		}
+	}
+
+	return ""
+}
+
+func speaksTLS(addr string) bool {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: probeTimeout}, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// probe connects to addr, sends request (if any) and returns whatever the
+// server says within probeTimeout.
+func probe(addr string, request []byte) []byte {
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+	if request != nil {
+		if _, err := conn.Write(request); err != nil {
+			return nil
+		}
+	}
+
+	buf := make([]byte, 256)
+	n, _ := conn.Read(buf)
+	return buf[:n]
+}
+
+func detectProtocolCmd(tunnelID int, localPort string) tea.Cmd {
+	return func() tea.Msg {
+		if !waitForLocalPort(localPort, smokeReadyWait) {
+			return protocolMsg{tunnelID: tunnelID}
+		}
+		return protocolMsg{tunnelID: tunnelID, protocol: detectProtocol(localPort), reachable: true}
+	}
+}
+
+// detectForwardCmd checks one of a tunnel's additional forwards.
+func detectForwardCmd(tunnelID, forward int, localPort string) tea.Cmd {
+	return func() tea.Msg {
+		msg := detectProtocolCmd(tunnelID, localPort)().(protocolMsg)
+		msg.forward = forward
+		return msg
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// proxySpec is an upstream proxy that ssh reaches the host through, for
+// networks where outbound port 22 is blocked.
+type proxySpec struct {
+	scheme string // socks5, socks4 or http
+	addr   string // host:port of the proxy
+}
+
+func parseProxy(raw string) (proxySpec, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return proxySpec{}, fmt.Errorf("invalid proxy %q (expected scheme://host:port)", raw)
+	}
+
+	scheme := u.Scheme
+	switch scheme {
+	case "socks", "socks5", "socks5h":
+		scheme = "socks5"
+	case "socks4", "http":
+	default:
+		return proxySpec{}, fmt.Errorf("unsupported proxy scheme %q (use socks5, socks4 or http)", u.Scheme)
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return proxySpec{}, fmt.Errorf("proxy %q needs a port", raw)
+	}
+	// The address ends up in a ProxyCommand, which ssh runs through the
+	// shell, so nothing but a hostname or an address gets through
+	if !destinationHostRe.MatchString(host) || strings.HasPrefix(host, "-") {
+		return proxySpec{}, fmt.Errorf("invalid proxy host %q", host)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return proxySpec{}, fmt.Errorf("invalid proxy port %q", port)
+	}
+	return proxySpec{scheme: scheme, addr: u.Host}, nil
+}
+
+// sshArgs routes the connection through the proxy with a netcat
+// ProxyCommand, which is available on every platform OpenSSH ships on.
+func (p proxySpec) sshArgs() []string {
+	mode := "connect"
+	switch p.scheme {
+	case "socks5":
+		mode = "5"
+	case "socks4":
+		mode = "4"
+	}
+	return []string{"-o", fmt.Sprintf("ProxyCommand=nc -X %s -x %s %%h %%p", mode, p.addr)}
+}
+
+// endpoint is what the reachability pre-check dials when a proxy is set,
+// since the host itself is usually not directly reachable.
+func (p proxySpec) endpoint() sshEndpoint {
+	host, port, _ := net.SplitHostPort(p.addr)
+	return sshEndpoint{hostname: host, port: port}
+}
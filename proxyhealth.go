@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A SOCKS tunnel's detail panel shows where the proxy listens, how many
+// connections go through it and the result of the proxy test: t fetches
+// proxyTestURL through it, as a browser set up to use it would. The native
+// client counts the connections it relays; for ssh they are the
+// established connections to the local port, read from /proc/net/tcp on
+// Linux and netstat elsewhere every proxyConnsInterval.
+
+const (
+	proxyTestURL       = "https://example.com"
+	proxyTestTimeout   = 10 * time.Second
+	proxyConnsInterval = 3 * time.Second
+)
+
+type proxyTestMsg struct {
+	tunnelID int
+	result   smokeResult
+}
+
+// proxyTestCmd fetches proxyTestURL through the SOCKS proxy on localPort.
+// The demo's stand-in only answers the greeting, so it pretends.
+func proxyTestCmd(tunnelID int, localPort string, demo bool) tea.Cmd {
+	return func() tea.Msg {
+		res := smokeResult{at: time.Now()}
+		if demo {
+			res.ok, res.detail = true, fmt.Sprintf("%s answered 200 in 120ms (demo)", proxyTestURL)
+			return proxyTestMsg{tunnelID: tunnelID, result: res}
+		}
+		// Go's SOCKS client sends the hostname, so DNS goes through the
+		// proxy as with socks5h
+		proxy := &url.URL{Scheme: "socks5", Host: "localhost:" + localPort}
+		client := http.Client{
+			Timeout:   proxyTestTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyURL(proxy)},
+		}
+		start := time.Now()
+		resp, err := client.Get(proxyTestURL)
+		if err != nil {
+			res.detail = err.Error()
+			return proxyTestMsg{tunnelID: tunnelID, result: res}
+		}
+		resp.Body.Close()
+		elapsed := time.Since(start).Round(time.Millisecond)
+		res.ok = resp.StatusCode < 400
+		res.detail = fmt.Sprintf("%s answered %d in %s", proxyTestURL, resp.StatusCode, elapsed)
+		return proxyTestMsg{tunnelID: tunnelID, result: res}
+	}
+}
+
+type proxyConnsMsg struct {
+	counts map[int]int // by tunnel id, for those that could be counted
+}
+
+// proxyConnsCmd waits an interval, then counts the connections to the
+// local ports of ports, SOCKS tunnels carried by ssh by id.
+func proxyConnsCmd(ports map[int]string) tea.Cmd {
+	return tea.Tick(proxyConnsInterval, func(time.Time) tea.Msg {
+		counts := make(map[int]int, len(ports))
+		for id, port := range ports {
+			if n, ok := establishedConns(port); ok {
+				counts[id] = n
+			}
+		}
+		return proxyConnsMsg{counts: counts}
+	})
+}
+
+// proxyConnsCounted records the counts and schedules the next ones, until
+// no SOCKS tunnel carried by ssh is up; startTunnel starts counting again.
+func (m *model) proxyConnsCounted(msg proxyConnsMsg) tea.Cmd {
+	ports := make(map[int]string)
+	for _, t := range m.tunnels {
+		n, ok := msg.counts[t.id]
+		t.proxyConns, t.proxyConnsKnown = n, ok
+		if t.tunnelType == "socks" && t.native == nil && t.active {
+			ports[t.id] = t.localPort
+		}
+	}
+	if len(ports) == 0 {
+		m.proxyConnsCounting = false
+		return nil
+	}
+	return proxyConnsCmd(ports)
+}
+
+// proxyConnsStatus is the detail panel's count of proxied connections.
+func (t *tunnel) proxyConnsStatus() string {
+	switch {
+	case !t.active:
+		return subtleStyle.Render("none, the tunnel is down")
+	case t.native != nil:
+		return selectedStyle.Render(strconv.FormatInt(t.native.conns.Load(), 10))
+	case t.proxyConnsKnown:
+		return selectedStyle.Render(strconv.Itoa(t.proxyConns))
+	}
+	return subtleStyle.Render("counting...")
+}
+
+// proxyTestStatus is the detail panel's line for the proxy test.
+func (t *tunnel) proxyTestStatus(k keyMap) string {
+	if t.proxyTest.at.IsZero() {
+		return subtleStyle.Render(fmt.Sprintf("%s to fetch %s through it", k.SmokeTest.Help().Key, proxyTestURL))
+	}
+	result := inactiveStyle.Render("❌ " + t.proxyTest.detail)
+	if t.proxyTest.ok {
+		result = activeStyle.Render("✅ " + t.proxyTest.detail)
+	}
+	return result + subtleStyle.Render(" at "+t.proxyTest.at.Format("15:04:05"))
+}
+
+// establishedConns counts the established TCP connections whose local end
+// is port, reporting false when they cannot be listed.
+func establishedConns(port string) (int, bool) {
+	if n, ok := procEstablished(port); ok {
+		return n, true
+	}
+	return netstatEstablished(port)
+}
+
+// procEstablished reads Linux's socket tables, where ports are in hex and
+// state 01 is established.
+func procEstablished(port string) (int, bool) {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return 0, false
+	}
+	suffix := fmt.Sprintf(":%04X", p)
+	count, read := 0, false
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		read = true
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) > 3 && strings.HasSuffix(fields[1], suffix) && fields[3] == "01" {
+				count++
+			}
+		}
+		f.Close()
+	}
+	return count, read
+}
+
+// netstatEstablished parses netstat -an, which writes the local address
+// first: 127.0.0.1.1080 on macOS and the BSDs, 127.0.0.1:1080 on Windows.
+func netstatEstablished(port string) (int, bool) {
+	out, err := exec.Command("netstat", "-an").Output()
+	if err != nil {
+		return 0, false
+	}
+	count := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.Contains(line, "ESTABLISHED") {
+			continue
+		}
+		for _, f := range strings.Fields(line) {
+			if strings.ContainsAny(f, ".:") {
+				if strings.HasSuffix(f, "."+port) || strings.HasSuffix(f, ":"+port) {
+					count++
+				}
+				break
+			}
+		}
+	}
+	return count, true
+}
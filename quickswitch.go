@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Quick switch: 1 to 9 select the first nine tunnels of the list as it is
+// shown, leaving out group headings and folded groups, and the list puts
+// each of them next to its tag. In the dashboard they select the table's
+// first nine rows. Either way they work from both panels. The keys are
+// the quick_switch binding's, as many tunnels as it has keys; with it
+// unbound the list shows none.
+
+// quickKeys are the quick-switch keys in order, none when unbound.
+func (k keyMap) quickKeys() []string {
+	if !k.QuickSwitch.Enabled() {
+		return nil
+	}
+	return k.QuickSwitch.Keys()
+}
+
+// numberTunnels gives the first tunnels of the list their keys.
+func (m *model) numberTunnels() {
+	for _, t := range m.tunnels {
+		t.quick = ""
+	}
+	keys := m.keys.quickKeys()
+	n := 0
+	for _, i := range m.listRows {
+		if i < 0 {
+			continue
+		}
+		if n == len(keys) {
+			return
+		}
+		m.tunnels[i].quick = keyLabel(keys[n : n+1])
+		n++
+	}
+}
+
+// quickSwitch selects the tunnel with the nth quick-switch key, counting
+// from 1.
+func (m model) quickSwitch(n int) (tea.Model, tea.Cmd) {
+	if m.dashboard {
+		if order := m.dashboardOrder(); n <= len(order) {
+			m.selectedTunnel = order[n-1]
+			m.moveDashboard(0)
+		}
+		return m, nil
+	}
+	label := keyLabel(m.keys.QuickSwitch.Keys()[n-1 : n])
+	if i := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.quick == label }); i >= 0 {
+		m.selectTunnel(i)
+		m.logScroll = 0
+	}
+	return m, nil
+}
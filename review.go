@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The review step closes the wizard: it lists what was entered and the
+// command that will run, and any field can be changed from there. Editing
+// jumps back to that field's step; once the step is done, only the field
+// it owns is kept and the wizard returns to the review, so the steps after
+// it are not walked through again.
+
+// reviewField is one line of the review step and the wizard step that
+// sets it.
+type reviewField struct {
+	label string
+	value string
+	step  tunnelStep
+	input string                                // what the step's input starts with
+	apply func(dst *tunnelSpec, src tunnelSpec) // copies what the step set
+}
+
+// reviewFields lists the fields of s that the wizard asked for.
+func (m model) reviewFields(s tunnelSpec) []reviewField {
+	hostLabel := "Host"
+	if s.Backend == teleportBackend {
+		hostLabel = "Node"
+	} else if !usesSSH(s.Backend) {
+		hostLabel = "Target"
+	}
+	fields := []reviewField{{hostLabel, s.Host, stepManualHost, s.Host,
+		func(dst *tunnelSpec, src tunnelSpec) { dst.Host = src.Host }}}
+	if s.Type == "" && usesSSH(s.Backend) {
+		fields = append(fields, reviewField{"Destination", orNone(s.RemoteHost, "localhost"), stepRemoteHost, orNone(s.RemoteHost, "localhost"),
+			func(dst *tunnelSpec, src tunnelSpec) { dst.RemoteHost = src.RemoteHost }})
+	}
+	if s.Type != "socks" {
+		fields = append(fields, reviewField{"Remote port", s.RemotePort, stepRemotePort, s.RemotePort,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.RemotePort = src.RemotePort }})
+	}
+	fields = append(fields, reviewField{"Local port", s.LocalPort, stepLocalPort, s.LocalPort,
+		func(dst *tunnelSpec, src tunnelSpec) { dst.LocalPort = src.LocalPort }})
+	if s.Backend == "" && m.cfg.SSHTransport != nativeBackend {
+		forwards := make([]string, len(s.Forwards))
+		for i, f := range s.Forwards {
+			forwards[i] = f.String()
+		}
+		fields = append(fields, reviewField{"More forwards", orNone(strings.Join(forwards, ", "), "none"), stepForwards, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Forwards = src.Forwards }})
+	}
+	fields = append(fields, reviewField{"Tag", s.Tag, stepTag, s.Tag,
+		func(dst *tunnelSpec, src tunnelSpec) { dst.Tag = src.Tag }},
+		reviewField{"Color", orNone(s.Color, "none"), stepColor, s.Color,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Color = src.Color }})
+	if usesSSH(s.Backend) {
+		fields = append(fields, reviewField{"Key", orNone(s.IdentityFile, "any key"), stepIdentity, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.IdentityFile = src.IdentityFile }})
+	}
+	if s.Backend == "" {
+		fields = append(fields,
+			reviewField{"Proxy", orNone(s.Proxy, "direct"), stepProxy, s.Proxy,
+				func(dst *tunnelSpec, src tunnelSpec) { dst.Proxy = src.Proxy }},
+			reviewField{"Prep command", orNone(s.Prep, "none"), stepPrepCommand, s.Prep,
+				func(dst *tunnelSpec, src tunnelSpec) { dst.Prep = src.Prep }})
+	}
+	fields = append(fields,
+		reviewField{"Smoke test", orNone(s.SmokeTest, "none"), stepSmokeTest, s.SmokeTest,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.SmokeTest = src.SmokeTest }},
+		reviewField{"Health check", orNone(s.HealthCheck, "none"), stepHealthCheck, s.HealthCheck,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.HealthCheck = src.HealthCheck }})
+	if s.Type == "" {
+		fields = append(fields, reviewField{"Local TLS", orNone(s.TLSMode, "none"), stepTLSMode, s.TLSMode,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.TLSMode = src.TLSMode }})
+	}
+	if usesSSH(s.Backend) {
+		verbose := "no"
+		if s.Verbose {
+			verbose = "yes"
+		}
+		fields = append(fields, reviewField{"Verbose logs", verbose, stepVerbose, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Verbose = src.Verbose }})
+	}
+	if s.Backend == "" && m.cfg.SSHTransport != nativeBackend {
+		compression := s.compressionSetting()
+		if s.Compression == nil && m.cfg.Compression {
+			compression = "default (on)"
+		}
+		fields = append(fields, reviewField{"Compression", compression, stepCompression, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Compression = src.Compression }})
+	}
+	if usesSSH(s.Backend) {
+		fields = append(fields, reviewField{"Ciphers", orNone(strings.ReplaceAll(s.Ciphers, ",", ", "), "default"), stepCiphers, s.Ciphers,
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Ciphers = src.Ciphers }})
+	}
+	if s.Backend == "" && m.cfg.SSHTransport != nativeBackend {
+		fields = append(fields, reviewField{"Forwarding", orNone(s.forwarding(), "none"), stepAdvanced, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.ForwardAgent, dst.X11 = src.ForwardAgent, src.X11 }})
+	}
+	fields = append(fields, reviewField{"Close", closeSetting(s.CloseAfter, false), stepCloseAfter, minutesInput(s.CloseAfter),
+		func(dst *tunnelSpec, src tunnelSpec) { dst.CloseAfter = src.CloseAfter }})
+	if s.Type != "remote" {
+		fields = append(fields, reviewField{"Close idle", closeSetting(s.CloseIdle, true), stepCloseIdle, minutesInput(s.CloseIdle),
+			func(dst *tunnelSpec, src tunnelSpec) { dst.CloseIdle = src.CloseIdle }})
+	}
+	if s.canBeLazy() {
+		lazy := "no"
+		if s.Lazy {
+			lazy = "yes"
+		}
+		fields = append(fields, reviewField{"On demand", lazy, stepLazy, "",
+			func(dst *tunnelSpec, src tunnelSpec) { dst.Lazy = src.Lazy }})
+	}
+	return fields
+}
+
+func orNone(s, none string) string {
+	if s == "" {
+		return none
+	}
+	return s
+}
+
+// toReview ends the wizard's questions on the review step.
+func (m *model) toReview() {
+	m.step = stepReview
+	m.reviewIndex = 0
+	m.setInput("")
+	m.err = nil
+}
+
+func (m model) handleReviewKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	fields := m.reviewFields(m.tempSpec())
+	switch msg.String() {
+	case "esc":
+		m.view = viewMain
+	case "up", "k":
+		if m.reviewIndex > 0 {
+			m.reviewIndex--
+		}
+	case "down", "j":
+		if m.reviewIndex < len(fields)-1 {
+			m.reviewIndex++
+		}
+	case "e", "right":
+		return m.editReviewField(fields[m.reviewIndex])
+	case "enter":
+		return m.startConnecting()
+	}
+	return m, nil
+}
+
+// editReviewField goes back to the step that sets f.
+func (m model) editReviewField(f reviewField) (tea.Model, tea.Cmd) {
+	m.reviewSaved = m.tempSpec()
+	m.reviewEditing = true
+	m.setInput(f.input)
+	m.err = nil
+	m.step = f.step
+	if f.step != stepIdentity {
+		return m, nil
+	}
+	next, cmd := m.toIdentityStep()
+	if nm := next.(model); nm.step != stepIdentity {
+		// No key pairs to pick from
+		m.step = stepReview
+		m.reviewEditing = false
+		m.err = fmt.Errorf("no key pairs in ~/.ssh to pick from")
+		return m, nil
+	}
+	return next, cmd
+}
+
+// updateReviewEdit runs the step being edited from the review and returns
+// there once the step is done. Esc drops the change.
+func (m model) updateReviewEdit(msg tea.Msg) (tea.Model, tea.Cmd) {
+	fields := m.reviewFields(m.reviewSaved)
+	f := fields[m.reviewIndex]
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "esc" && m.step == f.step {
+		m.setTemp(m.reviewSaved)
+		m.reviewEditing = false
+		m.step = stepReview
+		m.setInput("")
+		m.err = nil
+		return m, nil
+	}
+
+	m.reviewEditing = false
+	next, cmd := m.Update(msg)
+	nm, ok := next.(model)
+	if p, isPtr := next.(*model); isPtr {
+		nm, ok = *p, true
+	}
+	if !ok || nm.view != viewNewTunnel {
+		return next, cmd
+	}
+	if nm.step == f.step || nm.step == stepRemotePortPick {
+		nm.reviewEditing = true
+		return nm, cmd
+	}
+	spec := nm.reviewSaved
+	f.apply(&spec, nm.tempSpec())
+	nm.setTemp(spec)
+	nm.step = stepReview
+	nm.setInput("")
+	nm.err = nil
+	return nm, cmd
+}
+
+// resolveRouteCmd asks ssh -G how the wizard's host is reached, unless
+// that is known already, so the review can show the route.
+func (m model) resolveRouteCmd() tea.Cmd {
+	if _, ok := m.hostEndpoints[m.tempHost]; ok || m.demo || m.tempBackend != "" {
+		return nil
+	}
+	return resolveSSHHostsCmd([]string{m.tempHost})
+}
+
+// reviewRoute is the route of a tunnel that goes through jump hosts, a
+// ProxyCommand or an upstream proxy, for the ssh binary; the built-in
+// client does neither.
+func (m model) reviewRoute(s tunnelSpec) string {
+	ep, ok := m.hostEndpoints[s.Host]
+	if s.Backend != "" || m.cfg.SSHTransport == nativeBackend {
+		return ""
+	}
+	if s.Proxy == "" && (!ok || ep.proxyJump == "" && ep.proxyCommand == "") {
+		return ""
+	}
+	if !ok {
+		ep = defaultSSHEndpoint(s.Host)
+	}
+	return ep.route(s.Proxy)
+}
+
+func (m model) renderReview() string {
+	spec := m.tempSpec()
+	content := lipgloss.NewStyle().Bold(true).Render("Review tunnel:") + "\n\n"
+	fields := m.reviewFields(spec)
+	for i, f := range fields {
+		line := fmt.Sprintf("%-15s%s", f.label, f.value)
+		if i == m.reviewIndex {
+			content += selectedStyle.Render("  ▶  " + line)
+		} else {
+			content += "     " + line
+		}
+		content += "\n"
+	}
+
+	if route := m.reviewRoute(spec); route != "" {
+		content += "\n" + lipgloss.NewStyle().Bold(true).Render("Route:") + "\n" + route + "\n"
+	}
+	switch cmd, err := m.specCommandLine(spec); {
+	case err != nil:
+		content += "\n" + errorStyle.Render("❌ "+err.Error())
+	case spec.Backend == nativeBackend || (spec.Backend == "" && m.cfg.SSHTransport == nativeBackend):
+		content += "\n" + lipgloss.NewStyle().Bold(true).Render("Built-in client, the same as:") + "\n" + cmd
+	case m.multiplexed(spec):
+		content += "\n" + lipgloss.NewStyle().Bold(true).Render("Shares an ssh master connection, the same as:") + "\n" + cmd
+	default:
+		content += "\n" + lipgloss.NewStyle().Bold(true).Render("Runs:") + "\n" + cmd
+	}
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render("❌ "+m.err.Error())
+	}
+	content += "\n\n" + subtleStyle.Render("↑/↓ and e to edit • Enter to connect • Esc to cancel")
+	return content
+}
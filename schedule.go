@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Schedules start a saved profile and stop it again at set times, e.g. a
+// database tunnel for office hours, from cron expressions in the config:
+//
+//	"schedules": [{"profile": "pg-prod", "start": "0 9 * * 1-5", "stop": "0 18 * * 1-5"}]
+//
+// The expressions have cron's five fields (minute, hour, day of the month,
+// month, day of the week) in local time. A scheduled profile is in the
+// list from the start, down until its next start, and a manager started
+// between a start and the following stop starts it right away. Starting or
+// stopping it by hand holds until its next scheduled change. A start that
+// falls due while a dialog or the wizard is open waits until it is closed.
+
+type scheduleConfig struct {
+	Profile string `json:"profile"`
+	Start   string `json:"start,omitempty"`
+	Stop    string `json:"stop,omitempty"`
+}
+
+func (s scheduleConfig) check() error {
+	if s.Profile == "" {
+		return fmt.Errorf("needs the tag of a profile")
+	}
+	if s.Start == "" && s.Stop == "" {
+		return fmt.Errorf("%s: needs a start or a stop", s.Profile)
+	}
+	for _, expr := range []string{s.Start, s.Stop} {
+		if expr == "" {
+			continue
+		}
+		c, err := parseCron(expr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Profile, err)
+		}
+		if c.next(time.Now()).IsZero() {
+			return fmt.Errorf("%s: cron expression %q never comes", s.Profile, expr)
+		}
+	}
+	return nil
+}
+
+// cronSpec is a parsed cron expression, with the values each field allows
+// as bits.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set for a field that starts with *: cron runs
+	// on the days either field allows only when both are restricted
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // for min, min+1, ...
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parseCron reads a five-field cron expression. Fields take *, numbers,
+// ranges (1-5), steps (*/15, 8-18/2), lists of those, and names for
+// months and days (jan, mon-fri).
+func parseCron(expr string) (cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := cronFields[i].parse(field)
+		if err != nil {
+			return cronSpec{}, fmt.Errorf("cron expression %q: %s: %v", expr, cronFields[i].name, err)
+		}
+		bits[i] = b
+	}
+	// 7 is Sunday too
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return cronSpec{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		values, stepText, hasStep := strings.Cut(part, "/")
+		lo, hi := f.min, f.max
+		if values != "*" {
+			from, to, isRange := strings.Cut(values, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// 5/15 is every 15 from 5 on
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%q runs backwards", values)
+			}
+		}
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("%q is not a step", stepText)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if i := slices.Index(f.names, strings.ToLower(s)); i >= 0 {
+		return f.min + i, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%q is not from %d to %d", s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// next is the first minute after t that c allows, or the zero time if
+// none comes within five years (e.g. for February 30).
+func (c cronSpec) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// schedule is a scheduleConfig with its next start and stop, zero when it
+// has none.
+type schedule struct {
+	scheduleConfig
+	start, stop         *cronSpec
+	nextStart, nextStop time.Time
+}
+
+// newSchedules parses the config's schedules, which loading it checked.
+// One that is between a start and its stop at now is due to start.
+func newSchedules(configs []scheduleConfig, now time.Time) []*schedule {
+	var schedules []*schedule
+	for _, c := range configs {
+		s := &schedule{scheduleConfig: c}
+		if c.Start != "" {
+			start, _ := parseCron(c.Start)
+			s.start, s.nextStart = &start, start.next(now)
+		}
+		if c.Stop != "" {
+			stop, _ := parseCron(c.Stop)
+			s.stop, s.nextStop = &stop, stop.next(now)
+		}
+		if s.start != nil && s.stop != nil && s.nextStop.Before(s.nextStart) {
+			s.nextStart = now
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules
+}
+
+func (m model) scheduleFor(tag string) *schedule {
+	for _, s := range m.schedules {
+		if s.Profile == tag {
+			return s
+		}
+	}
+	return nil
+}
+
+// String shows the schedule, e.g. "start 0 9 * * 1-5, stop 0 18 * * 1-5".
+func (s *schedule) String() string {
+	var parts []string
+	if s.start != nil {
+		parts = append(parts, "start "+s.Start)
+	}
+	if s.stop != nil {
+		parts = append(parts, "stop "+s.Stop)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// upcoming shows the schedule's next start and stop, e.g.
+// " (next start Mon 09:00, stop Mon 18:00)".
+func (s *schedule) upcoming() string {
+	var parts []string
+	if !s.nextStart.IsZero() {
+		parts = append(parts, "start "+s.nextStart.Format("Mon 15:04"))
+	}
+	if !s.nextStop.IsZero() {
+		parts = append(parts, "stop "+s.nextStop.Format("Mon 15:04"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (next " + strings.Join(parts, ", ") + ")"
+}
+
+type scheduleTickMsg struct{ at time.Time }
+
+// scheduleTickCmd ticks at the start of the next minute, cron's step.
+func scheduleTickCmd() tea.Cmd {
+	now := time.Now()
+	return tea.Tick(now.Truncate(time.Minute).Add(time.Minute).Sub(now), func(at time.Time) tea.Msg {
+		return scheduleTickMsg{at: at}
+	})
+}
+
+// schedulesLoadedMsg carries the saved profiles, for the scheduled ones to
+// be listed.
+type schedulesLoadedMsg struct {
+	profiles []tunnelSpec
+	err      error
+}
+
+func loadSchedulesCmd() tea.Cmd {
+	return func() tea.Msg {
+		profiles, err := loadProfiles()
+		return schedulesLoadedMsg{profiles: profiles, err: err}
+	}
+}
+
+// schedulesLoaded lists each scheduled profile as a stopped tunnel, then
+// starts the ones that are due.
+func (m model) schedulesLoaded(msg schedulesLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		slog.Warn("cannot load profiles for the schedules", "err", msg.err)
+		m.statusMessage = "Cannot load the scheduled profiles: " + msg.err.Error()
+	}
+	var missing []string
+	for _, s := range m.schedules {
+		if slices.ContainsFunc(m.tunnels, func(t *tunnel) bool { return t.tag == s.Profile }) {
+			continue
+		}
+		i := slices.IndexFunc(msg.profiles, func(p tunnelSpec) bool { return p.Tag == s.Profile })
+		if i < 0 {
+			missing = append(missing, s.Profile)
+			continue
+		}
+		t := newTunnel(m.nextTunnelID, msg.profiles[i])
+		m.nextTunnelID++
+		t.logs = newLogRing(m.cfg.logLines())
+		t.appendLog(fmt.Sprintf("Scheduled: %s", s))
+		m.tunnels = append(m.tunnels, t)
+	}
+	if len(missing) > 0 {
+		slog.Warn("scheduled profiles not found", "profiles", missing)
+		m.statusMessage = "No profile for the schedule of " + strings.Join(missing, ", ")
+	}
+	m.updateTunnelList()
+	return m.runSchedules(time.Now())
+}
+
+// runSchedules stops the scheduled tunnels whose stop is due and queues
+// those whose start is, then ticks again next minute.
+func (m model) runSchedules(now time.Time) (tea.Model, tea.Cmd) {
+	var ids []int
+	for _, s := range m.schedules {
+		idx := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.tag == s.Profile })
+		if s.stop != nil && !s.nextStop.IsZero() && !now.Before(s.nextStop) {
+			s.nextStop = s.stop.next(now)
+			if idx >= 0 && m.tagUp(s.Profile) {
+				t := m.tunnels[idx]
+				slog.Info("scheduled stop", t.logAttrs()...)
+				t.restarting = false
+				t.stop()
+				t.appendLog(fmt.Sprintf("Stopped on schedule (%s)", s.Stop))
+				m.statusMessage = fmt.Sprintf("Stopped %s on schedule", t.tag)
+			}
+		}
+		if s.start != nil && !s.nextStart.IsZero() && !now.Before(s.nextStart) && idx >= 0 && m.view == viewMain {
+			s.nextStart = s.start.next(now)
+			if !m.tagUp(s.Profile) {
+				slog.Info("scheduled start", m.tunnels[idx].logAttrs()...)
+				m.tunnels[idx].appendLog(fmt.Sprintf("Starting on schedule (%s)", s.Start))
+				ids = append(ids, m.tunnels[idx].id)
+			}
+		}
+		if idx >= 0 && s.start != nil {
+			m.tunnels[idx].nextStart = s.nextStart
+		}
+	}
+	m.updateTunnelList()
+	if len(ids) == 0 {
+		return m, scheduleTickCmd()
+	}
+	m.pendingStarts = append(m.pendingStarts, ids...)
+	next, cmd := m.startNext()
+	return next, tea.Batch(cmd, scheduleTickCmd())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The settings screen (o) edits the global settings that are worth
+// changing without opening config.json, and saves them there.
+
+var settingsFields = []struct {
+	label, hint string
+}{
+	{"Keepalive interval", "seconds between checks of an idle connection, 0 for none"},
+	{"Keepalive count max", "unanswered checks before the connection is dropped"},
+}
+
+func (m model) openSettings() model {
+	k := m.cfg.keepalive()
+	m.settingsInputs = []string{strconv.Itoa(k.Interval), strconv.Itoa(k.CountMax)}
+	m.settingsIndex = 0
+	m.err = nil
+	m.view = viewSettings
+	return m
+}
+
+func (m model) handleSettingsKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.err = nil
+		m.view = viewMain
+	case "up", "shift+tab":
+		m.settingsIndex = (m.settingsIndex + len(settingsFields) - 1) % len(settingsFields)
+	case "down", "tab":
+		m.settingsIndex = (m.settingsIndex + 1) % len(settingsFields)
+	case "backspace":
+		if in := m.settingsInputs[m.settingsIndex]; in != "" {
+			m.settingsInputs[m.settingsIndex] = in[:len(in)-1]
+		}
+	case "enter":
+		k, err := parseKeepalive(m.settingsInputs[0] + "," + m.settingsInputs[1])
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		cfg := m.cfg
+		cfg.Keepalive = &k
+		if err := saveConfig(cfg); err != nil {
+			m.err = fmt.Errorf("cannot save the config: %v", err)
+			return m, nil
+		}
+		slog.Info("settings saved", "keepalive_interval", k.Interval, "keepalive_count_max", k.CountMax)
+		m.cfg = cfg
+		m.err = nil
+		m.view = viewMain
+		m.statusMessage = "Keepalive " + k.String() + " • applies to tunnels started from now on"
+	default:
+		if c := msg.String(); len(c) == 1 && c[0] >= '0' && c[0] <= '9' && len(m.settingsInputs[m.settingsIndex]) < 4 {
+			m.settingsInputs[m.settingsIndex] += c
+		}
+	}
+	return m, nil
+}
+
+func (m model) renderSettings() string {
+	content := lipgloss.NewStyle().Bold(true).Render("Settings") + "\n\n"
+	for i, f := range settingsFields {
+		value := m.settingsInputs[i]
+		if i == m.settingsIndex {
+			content += selectedStyle.Render(fmt.Sprintf("  ▶  %-20s %s█", f.label, value))
+		} else {
+			content += fmt.Sprintf("     %-20s %s", f.label, value)
+		}
+		content += "\n" + subtleStyle.Render("     "+f.hint) + "\n"
+	}
+	content += "\n" + subtleStyle.Render("Applies to tunnels started from now on, unless they set their own.")
+	if m.err != nil {
+		content += "\n\n" + errorStyle.Render(m.err.Error())
+	}
+	content += "\n\n" + subtleStyle.Render("↑/↓: field • Enter: save to config.json • Esc: cancel")
+
+	modal := panelStyle.Width(70).Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// O (the shell key) opens an interactive ssh session on the selected
+// tunnel's host, e.g. to look at the service behind it. The TUI is
+// suspended until the session ends; the tunnels keep running meanwhile,
+// and their news is shown on return. The session connects the way the
+// tunnel does (proxy, policy options, keepalive, ciphers, key), with the
+// system's
+// ssh even for a tunnel on the native client.
+
+type shellExitMsg struct {
+	tunnelID int
+	host     string
+	err      error
+	stderr   string // ssh's own messages; the session itself goes through the terminal
+}
+
+// shellCommand is the ssh that logs in to the host of spec.
+func shellCommand(spec tunnelSpec, pol policy) *exec.Cmd {
+	args := sshConnectArgs(spec.Proxy, precheckMsg{}, pol)
+	if spec.Keepalive != nil {
+		args = append(args, spec.Keepalive.sshArgs()...)
+	}
+	args = append(args, spec.linkArgs()...)
+	args = append(args, spec.forwardingArgs()...)
+	if spec.IdentityFile != "" {
+		args = append(args, "-i", identityPath(spec.IdentityFile), "-o", "IdentitiesOnly=yes")
+	}
+	return exec.Command("ssh", append(args, "--", spec.Host)...)
+}
+
+// openShell hands the terminal to an ssh session on t's host.
+func (m model) openShell(t *tunnel) (tea.Model, tea.Cmd) {
+	switch {
+	case m.demo:
+		m.statusMessage = fmt.Sprintf("%s is played by a local stand-in in the demo; there is no host to log in to", t.host)
+		return m, nil
+	case !usesSSH(t.backend):
+		m.statusMessage = "A shell needs the ssh or native backend"
+		return m, nil
+	case m.daemon != nil:
+		// The daemon has no terminal to hand over
+		m.statusMessage = fmt.Sprintf("No shell under attach; run ssh %s in another terminal", t.host)
+		return m, nil
+	}
+	cmd := shellCommand(m.cfg.withDefaults(t.spec()), m.policy)
+	slog.Info("opening shell", append(t.logAttrs(), "args", cmd.Args)...)
+	t.appendLog(fmt.Sprintf("Opened a shell on %s", t.host))
+	// Kept for the status bar, as the TUI covers the terminal again
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	id, host := t.id, t.host
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return shellExitMsg{tunnelID: id, host: host, err: err, stderr: stderr.String()}
+	})
+}
+
+// shellExited reports how the session ended. ssh exits with the status of
+// the last command run in it, so only 255, its own failure, is an error.
+func (m *model) shellExited(msg shellExitMsg) {
+	var exitErr *exec.ExitError
+	switch {
+	case msg.err == nil || errors.As(msg.err, &exitErr) && exitErr.ExitCode() != 255:
+		m.statusMessage = fmt.Sprintf("Back from the shell on %s", msg.host)
+	case exitErr != nil:
+		lines := strings.Split(strings.TrimSpace(msg.stderr), "\n")
+		m.statusMessage = fmt.Sprintf("ssh to %s failed: %s", msg.host, orNone(strings.TrimSpace(lines[len(lines)-1]), "exit status 255"))
+	default:
+		m.statusMessage = fmt.Sprintf("Cannot open a shell on %s: %v", msg.host, msg.err)
+	}
+	if t := m.tunnelByID(msg.tunnelID); t != nil {
+		t.appendLog(fmt.Sprintf("Shell on %s closed", msg.host))
+	}
+	slog.Info("shell closed", "tunnel", msg.tunnelID, "host", msg.host, "err", msg.err)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SIGTERM and SIGHUP (the terminal closing) end the manager the way
+// confirming a quit does: every tunnel is stopped first, killing its ssh
+// with its whole process group, so no port stays bound by an orphan. On
+// Windows, closing the console window arrives as SIGTERM. Should the UI be
+// stuck, the processes are killed from the signal handler itself after
+// shutdownGrace.
+
+const shutdownGrace = 3 * time.Second
+
+type shutdownMsg struct{}
+
+// handleShutdownSignals turns the signals into a shutdownMsg for p. It
+// returns a function that stops listening. Bubble Tea quits on SIGTERM and
+// SIGINT by itself too, so main stops the tunnels again once it has.
+func handleShutdownSignals(p *tea.Program) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		defer recoverPanic("signal handler")
+		select {
+		case sig := <-sigs:
+			slog.Info("shutting down", "signal", sig.String())
+			p.Send(shutdownMsg{})
+		case <-done:
+			return
+		}
+		select {
+		case <-time.After(shutdownGrace):
+			slog.Warn("UI did not stop in time, killing tunnels", "grace", shutdownGrace)
+			killRecordedTunnels()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// stopTunnels stops every tunnel, as quitting does.
+func (m *model) stopTunnels() {
+	for i := range m.tunnels {
+		m.tunnels[i].stop()
+	}
+	m.updateTunnelList()
+}
+
+// killRecordedTunnels kills the ssh of every tunnel that was up at the
+// last change to the list, without the model.
+func killRecordedTunnels() {
+	crashState.Lock()
+	defer crashState.Unlock()
+	for _, t := range crashState.tunnels {
+		if t.cmd != nil {
+			killProcessTree(t.cmd)
+		}
+	}
+}
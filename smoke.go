@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	smokeTimeout = 5 * time.Second
+
+	// smokeReadyWait is how long a fresh tunnel gets to start accepting
+	// connections on its local port before the smoke test runs anyway.
+	smokeReadyWait = 10 * time.Second
+)
+
+// smokeTest is a quick check run against a tunnel's local port. Specs are
+// written as one of:
+//
+//	tcp                   the port accepts connections
+//	http [/path] [status] GET returns the status (default / and 200)
+//	banner <regex>        the first bytes sent by the server match
+type smokeTest struct {
+	kind   string
+	path   string
+	status int
+	banner *regexp.Regexp
+}
+
+type smokeResult struct {
+	ok     bool
+	detail string
+	at     time.Time
+}
+
+type smokeMsg struct {
+	tunnelID int
+	result   smokeResult
+}
+
+func parseSmokeTest(spec string) (smokeTest, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return smokeTest{}, fmt.Errorf("empty smoke test")
+	}
+
+	st := smokeTest{kind: strings.ToLower(fields[0])}
+	switch st.kind {
+	case "tcp":
+		if len(fields) > 1 {
+			return st, fmt.Errorf("tcp takes no arguments")
+		}
+	case "http":
+		st.path, st.status = "/", http.StatusOK
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "/") {
+				st.path = f
+			} else if code, err := strconv.Atoi(f); err == nil && code >= 100 && code <= 599 {
+				st.status = code
+			} else {
+				return st, fmt.Errorf("http: expected a /path or a status code, got %q", f)
+			}
+		}
+	case "banner":
+		pattern := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(spec), fields[0]))
+		if pattern == "" {
+			return st, fmt.Errorf("banner needs a regular expression")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return st, fmt.Errorf("banner: %v", err)
+		}
+		st.banner = re
+	default:
+		return st, fmt.Errorf("unknown smoke test %q (use tcp, http or banner)", fields[0])
+	}
+	return st, nil
+}
+
+// checkSocksSmokeTest rejects smoke tests a SOCKS proxy cannot pass. It
+// only speaks SOCKS, so just tcp applies.
+func checkSocksSmokeTest(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	st, err := parseSmokeTest(spec)
+	if err != nil {
+		return err
+	}
+	if st.kind != "tcp" {
+		return fmt.Errorf("a SOCKS proxy only supports the tcp smoke test")
+	}
+	return nil
+}
+
+func (st smokeTest) run(localPort string) smokeResult {
+	addr := net.JoinHostPort("localhost", localPort)
+	res := smokeResult{at: time.Now()}
+
+	switch st.kind {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", addr, smokeTimeout)
+		if err != nil {
+			res.detail = err.Error()
+			return res
+		}
+		conn.Close()
+		res.ok, res.detail = true, "port accepts connections"
+
+	case "http":
+		client := http.Client{Timeout: smokeTimeout}
+		resp, err := client.Get("http://" + addr + st.path)
+		if err != nil {
+			res.detail = err.Error()
+			return res
+		}
+		resp.Body.Close()
+		res.ok = resp.StatusCode == st.status
+		res.detail = fmt.Sprintf("GET %s → %d (want %d)", st.path, resp.StatusCode, st.status)
+
+	case "banner":
+		conn, err := net.DialTimeout("tcp", addr, smokeTimeout)
+		if err != nil {
+			res.detail = err.Error()
+			return res
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(smokeTimeout))
+		buf := make([]byte, 512)
+		n, _ := conn.Read(buf)
+		banner := strings.TrimSpace(string(buf[:n]))
+		res.ok = st.banner.MatchString(banner)
+		if banner == "" {
+			banner = "(nothing received)"
+		}
+		res.detail = fmt.Sprintf("banner %q", banner)
+	}
+	return res
+}
+
+// waitForLocalPort polls until ssh has bound the forward's local port,
+// reporting whether it did so within timeout.
+func waitForLocalPort(localPort string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", localPort), time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return false
+}
+
+// smokeTestCmd runs the tunnel's smoke test, first giving a freshly started
+// tunnel time to come up when waitReady is set.
+func smokeTestCmd(tunnelID int, spec, localPort string, waitReady bool) tea.Cmd {
+	return func() tea.Msg {
+		st, err := parseSmokeTest(spec)
+		if err != nil {
+			return smokeMsg{tunnelID: tunnelID, result: smokeResult{detail: err.Error(), at: time.Now()}}
+		}
+		if waitReady {
+			waitForLocalPort(localPort, smokeReadyWait)
+		}
+		return smokeMsg{tunnelID: tunnelID, result: st.run(localPort)}
+	}
+}
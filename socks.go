@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// socksHandshake reads a SOCKS5 greeting and CONNECT request from a client
+// of a native SOCKS tunnel and returns the requested host:port. Only the
+// "no authentication" method is offered: the port is bound to loopback.
+func socksHandshake(conn net.Conn) (string, error) {
+	conn.SetDeadline(time.Now().Add(nativeDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return "", err
+	}
+	if head[0] != 0x05 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	if !bytesContain(methods, 0x00) {
+		conn.Write([]byte{0x05, 0xff})
+		return "", errors.New("client requires authentication")
+	}
+	conn.Write([]byte{0x05, 0x00})
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return "", err
+	}
+	if req[1] != 0x01 {
+		conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 0x01, 0x04:
+		ip := make([]byte, 4)
+		if req[3] == 0x04 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		conn.Write([]byte{0x05, 0x08, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+// socksReply tells the client whether its CONNECT went through. The bound
+// address is not meaningful for a tunnel, so it is left zero.
+func socksReply(conn net.Conn, err error) {
+	code := byte(0x00)
+	if err != nil {
+		code = 0x05 // connection refused
+	}
+	conn.Write([]byte{0x05, code, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+}
+
+func bytesContain(b []byte, c byte) bool {
+	for _, x := range b {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moby/moby/pkg/namesgenerator"
+)
+
+// tunnelSpec is everything needed to create a tunnel, independent of how
+// it was entered (wizard, control API, ...).
+type tunnelSpec struct {
+	Tag         string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Host        string `json:"host" yaml:"host"`
+	LocalPort   string `json:"local_port" yaml:"local_port"`
+	RemotePort  string `json:"remote_port" yaml:"remote_port"`
+	RemoteHost  string `json:"remote_host,omitempty" yaml:"remote_host,omitempty"` // destination as seen from Host, for local forwards (default localhost)
+	Proxy       string `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	Prep        string `json:"prep,omitempty" yaml:"prep,omitempty"`
+	SmokeTest   string `json:"smoke_test,omitempty" yaml:"smoke_test,omitempty"`
+	HealthCheck string `json:"health_check,omitempty" yaml:"health_check,omitempty"` // a smoke test repeated while the tunnel is up
+	TLSMode     string `json:"tls_mode,omitempty" yaml:"tls_mode,omitempty"`
+	Verbose     bool   `json:"verbose,omitempty" yaml:"verbose,omitempty"`
+	Backend     string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"` // "" (local), "remote" or "socks"
+
+	// Keepalive overrides the config's for this tunnel (ssh and native)
+	Keepalive *keepalive `json:"keepalive,omitempty" yaml:"keepalive,omitempty"`
+	// TCP overrides the config's socket tuning for this tunnel (native,
+	// and its keepalive for ssh), see tcptune.go
+	TCP *tcpTuning `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	// IdentityFile is the only key offered (ssh and native), see identity.go
+	IdentityFile string `json:"identity_file,omitempty" yaml:"identity_file,omitempty"`
+	// ControlPath is an ssh master's socket to carry the tunnel over, or
+	// "none" for a connection of its own (ssh), see mux.go
+	ControlPath string `json:"control_path,omitempty" yaml:"control_path,omitempty"`
+	// Compression (ssh) and Ciphers (ssh and native) override the
+	// config's for this tunnel, see link.go
+	Compression *bool  `json:"compression,omitempty" yaml:"compression,omitempty"`
+	Ciphers     string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	// ForwardAgent (-A) and X11 ("untrusted" for -X, "trusted" for -Y)
+	// reach the sessions on the host, see advanced.go (ssh)
+	ForwardAgent bool   `json:"forward_agent,omitempty" yaml:"forward_agent,omitempty"`
+	X11          string `json:"x11,omitempty" yaml:"x11,omitempty"`
+	// CloseAfter and CloseIdle stop the tunnel after so many minutes, or
+	// so many without traffic, see autoclose.go
+	CloseAfter int `json:"close_after,omitempty" yaml:"close_after,omitempty"`
+	CloseIdle  int `json:"close_idle,omitempty" yaml:"close_idle,omitempty"`
+	// Lazy connects on the first client and disconnects when idle, see
+	// lazy.go
+	Lazy bool `json:"lazy,omitempty" yaml:"lazy,omitempty"`
+
+	// Forwards are more ports forwarded over the same SSH connection
+	Forwards []forwardSpec `json:"forwards,omitempty" yaml:"forwards,omitempty"`
+
+	// OnConnect and OnDisconnect run on this machine, see hooks.go
+	OnConnect    string `json:"on_connect,omitempty" yaml:"on_connect,omitempty"`
+	OnDisconnect string `json:"on_disconnect,omitempty" yaml:"on_disconnect,omitempty"`
+
+	// Web marks a web app for b to open, at WebURL if set; see browser.go
+	Web    bool   `json:"web,omitempty" yaml:"web,omitempty"`
+	WebURL string `json:"web_url,omitempty" yaml:"web_url,omitempty"`
+
+	// Note is free text shown in the detail panel, see notes.go
+	Note string `json:"note,omitempty" yaml:"note,omitempty"`
+	// Color labels the tunnel in the list, see colors.go
+	Color string `json:"color,omitempty" yaml:"color,omitempty"`
+}
+
+// forwardSpec is a port forwarded in addition to a tunnel's main one.
+type forwardSpec struct {
+	Type       string `json:"type,omitempty" yaml:"type,omitempty"` // "" (local), "remote" or "socks"
+	LocalPort  string `json:"local_port" yaml:"local_port"`
+	RemotePort string `json:"remote_port,omitempty" yaml:"remote_port,omitempty"`
+	RemoteHost string `json:"remote_host,omitempty" yaml:"remote_host,omitempty"`
+}
+
+// destinationHostRe matches what ssh accepts as a forward's destination:
+// a hostname or an IPv4/IPv6 address.
+var destinationHostRe = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// checkDestinationHost validates a local forward's destination and drops
+// the default, localhost.
+func checkDestinationHost(host *string) error {
+	*host = strings.Trim(strings.TrimSpace(*host), "[]")
+	if *host == "localhost" {
+		*host = ""
+	}
+	if *host != "" && !destinationHostRe.MatchString(*host) {
+		return fmt.Errorf("invalid destination host %q", *host)
+	}
+	return nil
+}
+
+// socketPathRe matches a unix socket on the host that a local forward
+// can reach instead of a port, e.g. /var/run/docker.sock. ssh's -L takes
+// it as 2375:/var/run/docker.sock, so it cannot hold a colon.
+var socketPathRe = regexp.MustCompile(`^/[A-Za-z0-9._/@+-]+$`)
+
+// isSocketPath reports whether a remote port is a unix socket's path.
+func isSocketPath(port string) bool {
+	return strings.HasPrefix(port, "/")
+}
+
+// destination is where a local forward's connections go, as ssh's -L and
+// the native client's direct-tcpip channels name it.
+func destination(host, port string) string {
+	if isSocketPath(port) {
+		return port
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// remoteEnd shows a forward's remote port, with the destination host when
+// it is not the SSH host itself.
+func remoteEnd(host, port string) string {
+	if host == "" {
+		return port
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// parseForward reads a forward in ssh's own notation: "-L 16379:6379" or
+// "-L 15432:db.internal:5432" (local port first), "-R 9000:3000" (remote
+// port first) or "-D 1080". Without a flag it is a local forward, and a
+// single port is used on both ends.
+func parseForward(s string) (forwardSpec, error) {
+	fields := strings.Fields(s)
+	flag := "-L"
+	if len(fields) == 2 {
+		flag = "-" + strings.ToUpper(strings.TrimPrefix(fields[0], "-"))
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return forwardSpec{}, fmt.Errorf("expected e.g. -L 16379:6379, -R 9000:3000 or -D 1080, got %q", s)
+	}
+	first, second, pair := strings.Cut(fields[0], ":")
+	if !pair {
+		second = first
+	}
+	var host string
+	if i := strings.LastIndex(second, ":"); i >= 0 {
+		host, second = second[:i], second[i+1:]
+	}
+	if host != "" && flag != "-L" {
+		return forwardSpec{}, fmt.Errorf("only -L forwards take a destination host")
+	}
+	var f forwardSpec
+	switch flag {
+	case "-L":
+		f = forwardSpec{LocalPort: first, RemotePort: second, RemoteHost: host}
+	case "-R":
+		f = forwardSpec{Type: "remote", LocalPort: second, RemotePort: first}
+	case "-D":
+		if pair {
+			return forwardSpec{}, fmt.Errorf("-D takes a single local port")
+		}
+		f = forwardSpec{Type: "socks", LocalPort: first}
+	default:
+		return forwardSpec{}, fmt.Errorf("unknown forward %s (use -L, -R or -D)", flag)
+	}
+	return f, f.normalize()
+}
+
+// String shows the forward in the notation parseForward reads.
+func (f forwardSpec) String() string {
+	switch f.Type {
+	case "remote":
+		return "-R " + f.RemotePort + ":" + f.LocalPort
+	case "socks":
+		return "-D " + f.LocalPort
+	}
+	if f.RemoteHost != "" {
+		return "-L " + f.LocalPort + ":" + destination(f.RemoteHost, f.RemotePort)
+	}
+	return "-L " + f.LocalPort + ":" + f.RemotePort
+}
+
+func (f *forwardSpec) normalize() error {
+	ports := map[string]string{"local_port": f.LocalPort, "remote_port": f.RemotePort}
+	switch f.Type {
+	case "", "local":
+		f.Type = ""
+	case "remote":
+	case "socks":
+		f.RemotePort = ""
+		delete(ports, "remote_port")
+	default:
+		return fmt.Errorf("unknown forward type %q (use local, remote or socks)", f.Type)
+	}
+	if err := checkDestinationHost(&f.RemoteHost); err != nil {
+		return err
+	}
+	if f.RemoteHost != "" && f.Type != "" {
+		return fmt.Errorf("only local forwards take a destination host")
+	}
+	for name, port := range ports {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%s must be a port number, got %q", name, port)
+		}
+	}
+	return nil
+}
+
+// localPorts are the ports the tunnel listens on here. Remote forwards
+// connect to their local port rather than bind it.
+func (s tunnelSpec) localPorts() []string {
+	var ports []string
+	if s.Type != "remote" {
+		ports = append(ports, s.LocalPort)
+	}
+	for _, f := range s.Forwards {
+		if f.Type != "remote" {
+			ports = append(ports, f.LocalPort)
+		}
+	}
+	return ports
+}
+
+// forwardPorts shows a tunnel's ports with an arrow pointing the way
+// connections travel: from the local port to the remote one for local
+// forwards, the other way for remote forwards. A SOCKS proxy has only its
+// local port.
+func forwardPorts(tunnelType, localPort, remotePort string) string {
+	switch tunnelType {
+	case "remote":
+		return localPort + " ← " + remotePort
+	case "socks":
+		return "🧦 " + localPort
+	}
+	return localPort + " → " + remotePort
+}
+
+// ports shows every forward of the tunnel, the main one first.
+func (s tunnelSpec) ports() string {
+	out := forwardPorts(s.Type, s.LocalPort, remoteEnd(s.RemoteHost, s.RemotePort))
+	for _, f := range s.Forwards {
+		out += ", " + forwardPorts(f.Type, f.LocalPort, remoteEnd(f.RemoteHost, f.RemotePort))
+	}
+	return out
+}
+
+// tunnelTypes are the choices of the wizard's tunnel type step.
+var tunnelTypes = []struct {
+	value, label, hint string
+}{
+	{"", "Local forward (-L)", "reach a port on the host from a local port"},
+	{"remote", "Remote forward (-R)", "expose a local port on the host"},
+	{"socks", "SOCKS proxy (-D)", "browse through the host from a local port"},
+}
+
+// normalize fills defaults and checks the spec the same way the wizard
+// checks each field as it is entered.
+func (s *tunnelSpec) normalize() error {
+	s.Host = strings.TrimSpace(s.Host)
+	if s.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if strings.HasPrefix(s.Host, "-") {
+		// ssh would take it for an option (see checkHostSyntax)
+		return fmt.Errorf("a host cannot start with -")
+	}
+	s.Note = strings.Join(strings.Fields(s.Note), " ")
+	s.Color = strings.ToLower(strings.TrimSpace(s.Color))
+	if err := checkColor(s.Color); err != nil {
+		return err
+	}
+	if len([]rune(s.Note)) > maxNoteLen {
+		return fmt.Errorf("note is longer than %d characters", maxNoteLen)
+	}
+	ports := map[string]string{"local_port": s.LocalPort, "remote_port": s.RemotePort}
+	if s.Type == "socks" {
+		// The destination is picked per connection by the SOCKS client
+		s.RemotePort = ""
+		delete(ports, "remote_port")
+	}
+	if isSocketPath(s.RemotePort) {
+		if !socketPathRe.MatchString(s.RemotePort) {
+			return fmt.Errorf("invalid socket path %q", s.RemotePort)
+		}
+		delete(ports, "remote_port")
+	}
+	for name, port := range ports {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%s must be a port number, got %q", name, port)
+		}
+	}
+
+	if s.Tag == "" {
+		s.Tag = namesgenerator.GetRandomName(0)
+	} else if sanitizeTag(s.Tag) != s.Tag {
+		return fmt.Errorf("tag %q may only contain a-z, 0-9, '-' and '_'", s.Tag)
+	}
+
+	if s.Proxy != "" {
+		if _, err := parseProxy(s.Proxy); err != nil {
+			return err
+		}
+	}
+	if s.SmokeTest != "" {
+		if _, err := parseSmokeTest(s.SmokeTest); err != nil {
+			return err
+		}
+	}
+	if s.HealthCheck != "" {
+		if _, err := parseSmokeTest(s.HealthCheck); err != nil {
+			return fmt.Errorf("health check: %v", err)
+		}
+	}
+	if s.Backend == "ssh" {
+		s.Backend = ""
+	}
+	if s.Backend == kubectlBackend {
+		if _, err := parseKubeTarget(s.Host); err != nil {
+			return err
+		}
+	}
+	if s.Backend != "" && (s.Proxy != "" || s.Prep != "") {
+		return fmt.Errorf("proxy and prep are only supported by the ssh backend")
+	}
+	if err := checkDestinationHost(&s.RemoteHost); err != nil {
+		return err
+	}
+	if s.Keepalive != nil {
+		if !usesSSH(s.Backend) {
+			return fmt.Errorf("keepalive is only supported by the ssh and native backends")
+		}
+		if err := s.Keepalive.check(); err != nil {
+			return err
+		}
+	}
+	if s.TCP != nil {
+		if !usesSSH(s.Backend) {
+			return fmt.Errorf("tcp tuning is only supported by the ssh and native backends")
+		}
+		if err := s.TCP.check(); err != nil {
+			return err
+		}
+	}
+	if s.IdentityFile != "" && !usesSSH(s.Backend) {
+		return fmt.Errorf("identity_file is only supported by the ssh and native backends")
+	}
+	if s.ControlPath != "" && s.Backend != "" {
+		return fmt.Errorf("control_path is only supported by the ssh backend")
+	}
+	if s.Compression != nil && s.Backend != "" {
+		return fmt.Errorf("compression is only supported by the ssh backend")
+	}
+	if (s.ForwardAgent || s.X11 != "") && s.Backend != "" {
+		return fmt.Errorf("agent and X11 forwarding are only supported by the ssh backend")
+	}
+	if err := checkX11(s.X11); err != nil {
+		return err
+	}
+	if err := s.checkClose(); err != nil {
+		return err
+	}
+	if err := s.checkLazy(); err != nil {
+		return err
+	}
+	if s.Ciphers != "" {
+		if !usesSSH(s.Backend) {
+			return fmt.Errorf("ciphers are only supported by the ssh and native backends")
+		}
+		ciphers, err := parseCiphers(s.Ciphers)
+		if err != nil {
+			return err
+		}
+		s.Ciphers = ciphers
+	}
+	switch s.Type {
+	case "", "local":
+		s.Type = ""
+	case "remote":
+		if !usesSSH(s.Backend) {
+			return fmt.Errorf("remote forwards are only supported by the ssh and native backends")
+		}
+		if s.TLSMode != "" {
+			return fmt.Errorf("local TLS only applies to local forwards")
+		}
+	case "socks":
+		if !usesSSH(s.Backend) {
+			return fmt.Errorf("SOCKS proxies are only supported by the ssh and native backends")
+		}
+		if s.TLSMode != "" {
+			return fmt.Errorf("local TLS only applies to local forwards")
+		}
+		if err := checkSocksSmokeTest(s.SmokeTest); err != nil {
+			return err
+		}
+		if err := checkSocksSmokeTest(s.HealthCheck); err != nil {
+			return fmt.Errorf("health check: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown tunnel type %q (use local, remote or socks)", s.Type)
+	}
+	if s.RemoteHost != "" && (s.Type != "" || !usesSSH(s.Backend)) {
+		return fmt.Errorf("a destination host is only supported for local forwards with the ssh and native backends")
+	}
+	if isSocketPath(s.RemotePort) && (s.Type != "" || !usesSSH(s.Backend) || s.RemoteHost != "") {
+		return fmt.Errorf("a socket path is only supported for local forwards to the host itself with the ssh and native backends")
+	}
+	if len(s.Forwards) > 0 && s.Backend != "" {
+		return fmt.Errorf("additional forwards are only supported by the ssh backend")
+	}
+	seen := map[string]bool{}
+	for i := range s.Forwards {
+		if err := s.Forwards[i].normalize(); err != nil {
+			return fmt.Errorf("forward %d: %v", i+1, err)
+		}
+	}
+	for _, port := range s.localPorts() {
+		if seen[port] {
+			return fmt.Errorf("local port %s is forwarded twice", port)
+		}
+		seen[port] = true
+	}
+	mode, err := parseTLSMode(s.TLSMode)
+	if err != nil {
+		return err
+	}
+	s.TLSMode = mode
+	if s.WebURL != "" {
+		if err := checkWebURL(s.WebURL); err != nil {
+			return err
+		}
+		s.Web = true
+	}
+	if s.Web && s.Type != "" {
+		return fmt.Errorf("web only applies to local forwards")
+	}
+	return nil
+}
+
+func (t *tunnel) spec() tunnelSpec {
+	return tunnelSpec{
+		Tag:          t.tag,
+		Host:         t.host,
+		LocalPort:    t.localPort,
+		RemotePort:   t.remotePort,
+		RemoteHost:   t.remoteHost,
+		Proxy:        t.proxy,
+		Prep:         t.prep,
+		SmokeTest:    t.smokeTest,
+		HealthCheck:  t.healthCheck,
+		TLSMode:      t.tlsMode,
+		Verbose:      t.verbose,
+		Backend:      t.backend,
+		Type:         t.tunnelType,
+		Keepalive:    t.keepalive,
+		TCP:          t.tcp,
+		IdentityFile: t.identity,
+		ControlPath:  t.controlPath,
+		Compression:  t.compression,
+		Ciphers:      t.ciphers,
+		ForwardAgent: t.forwardAgent,
+		X11:          t.x11,
+		CloseAfter:   t.closeAfter,
+		CloseIdle:    t.closeIdle,
+		Lazy:         t.lazyMode,
+		Forwards:     t.forwardSpecs(),
+		OnConnect:    t.onConnect,
+		OnDisconnect: t.onDisconnect,
+		Web:          t.web,
+		WebURL:       t.webLink,
+		Note:         t.note,
+		Color:        t.color,
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// sshConfigMaxDepth is how deep ssh itself follows Include directives.
+	sshConfigMaxDepth = 16
+
+	// sshResolveWorkers bounds the ssh -G processes run at once.
+	sshResolveWorkers = 8
+)
+
+// sshConfigPath is where ssh reads the user's config: ~/.ssh/config, which
+// on Windows is under %USERPROFILE%.
+func sshConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// getSSHHosts lists the aliases of the user's ssh config, following
+// Include directives the way ssh does. Patterns (web-*, !bastion) cannot
+// be listed; what they set shows up when the aliases are resolved.
+func getSSHHosts() []string {
+	var hosts []string
+	readSSHConfig(sshConfigPath(), 0, map[string]bool{}, &hosts)
+	return hosts
+}
+
+func readSSHConfig(path string, depth int, seen map[string]bool, hosts *[]string) {
+	if depth > sshConfigMaxDepth {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, args := splitSSHConfigLine(scanner.Text())
+		switch strings.ToLower(key) {
+		case "host":
+			for _, pattern := range args {
+				if pattern == "" || strings.ContainsAny(pattern, "*?! \t") || seen[pattern] {
+					continue
+				}
+				seen[pattern] = true
+				*hosts = append(*hosts, pattern)
+			}
+		case "include":
+			for _, arg := range args {
+				matches, _ := filepath.Glob(sshIncludePath(arg))
+				for _, match := range matches {
+					readSSHConfig(match, depth+1, seen, hosts)
+				}
+			}
+		}
+	}
+}
+
+// sshIncludePath expands ~ in an Include argument; relative ones are taken
+// from ~/.ssh, as for the user's config.
+func sshIncludePath(arg string) string {
+	home, _ := os.UserHomeDir()
+	if rest, ok := strings.CutPrefix(arg, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	if filepath.IsAbs(arg) {
+		return arg
+	}
+	return filepath.Join(home, ".ssh", arg)
+}
+
+// splitSSHConfigLine splits a config line into its keyword and arguments.
+// The keyword may be followed by whitespace or "=", and arguments may be
+// double-quoted.
+func splitSSHConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return line, nil
+	}
+	key, rest := line[:end], strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			arg, rest, _ = strings.Cut(rest[1:], `"`)
+		} else if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			arg, rest = rest[:i], rest[i:]
+		} else {
+			arg, rest = rest, ""
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return key, args
+}
+
+type sshHostsResolvedMsg struct {
+	endpoints map[string]sshEndpoint
+}
+
+// resolveSSHHostsCmd asks ssh -G what each alias resolves to, so Match
+// blocks, wildcard Host blocks and includes are applied exactly as when
+// connecting.
+func resolveSSHHostsCmd(hosts []string) tea.Cmd {
+	if len(hosts) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		endpoints := make([]sshEndpoint, len(hosts))
+		sem := make(chan struct{}, sshResolveWorkers)
+		done := make(chan struct{})
+		for i, host := range hosts {
+			go func() {
+				sem <- struct{}{}
+				endpoints[i] = resolveSSHEndpoint(host)
+				<-sem
+				done <- struct{}{}
+			}()
+		}
+		for range hosts {
+			<-done
+		}
+
+		msg := sshHostsResolvedMsg{endpoints: make(map[string]sshEndpoint, len(hosts))}
+		for i, host := range hosts {
+			msg.endpoints[host] = endpoints[i]
+		}
+		return msg
+	}
+}
+
+// hostDetail shows where an alias connects to, as user@hostname:port,
+// and the jump hosts it goes through.
+func hostDetail(ep sshEndpoint) string {
+	detail := ep.hostname
+	if ep.user != "" {
+		detail = ep.user + "@" + detail
+	}
+	if ep.port != "" {
+		detail += ":" + ep.port
+	}
+	if len(ep.via) > 0 {
+		names := make([]string, len(ep.via))
+		for i, h := range ep.via {
+			names[i] = orNone(h.name, "ProxyCommand")
+		}
+		detail += " via " + strings.Join(names, " → ")
+	}
+	return detail
+}
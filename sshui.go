@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/crypto/ssh"
+)
+
+// The daemon can serve its TUI over SSH as well, on the ssh_ui address,
+// so the tunnels running on one machine can be managed from another with
+// a plain "ssh -p <port> <host>". Each session is one more attached
+// terminal, next to those on the socket: the same screen, sized to fit the
+// smallest, and q d detaches the session that typed it. Keys listed in
+// ssh_ui_authorized_keys (~/.ssh/authorized_keys by default) may log in,
+// under any user name; passwords are not accepted. The host key is
+// generated on first use and kept in the config directory.
+//
+// Sessions get the UI only: no commands, subsystems or forwarding.
+
+const (
+	sshUIHostKeyFile  = "ssh-ui-host-key"
+	sshUIWriteTimeout = 5 * time.Second
+	sshUICloseWait    = time.Second
+)
+
+// sshUI is the SSH server of a daemon.
+type sshUI struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	sessions sync.WaitGroup
+}
+
+// listenSSHUI binds addr right away, so a taken port or a missing key is
+// reported at startup. Sessions are only served once the daemon serves.
+func listenSSHUI(addr, authorizedKeys string) (*sshUI, error) {
+	allowed, err := readAuthorizedKeys(authorizedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("SSH UI: %w", err)
+	}
+	hostKey, err := sshUIHostKey()
+	if err != nil {
+		return nil, fmt.Errorf("SSH UI host key: %w", err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !allowed[string(key.Marshal())] {
+				return nil, errors.New("key not authorized")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"key": ssh.FingerprintSHA256(key)}}, nil
+		},
+		ServerVersion: "SSH-2.0-" + appName,
+	}
+	cfg.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("SSH UI: %w", err)
+	}
+	slog.Info("SSH UI listening", "addr", ln.Addr(), "host_key", ssh.FingerprintSHA256(hostKey.PublicKey()), "authorized_keys", len(allowed))
+	return &sshUI{listener: ln, config: cfg}, nil
+}
+
+// readAuthorizedKeys reads the keys in an authorized_keys file, refusing
+// one that has none: nobody could log in.
+func readAuthorizedKeys(path string) (map[string]bool, error) {
+	if path == "" {
+		path = "~/.ssh/authorized_keys"
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break // only blank lines and comments are left
+		}
+		keys[string(key.Marshal())] = true
+		data = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", path)
+	}
+	return keys, nil
+}
+
+// sshUIHostKey loads the host key, generating an ed25519 one the first
+// time.
+func sshUIHostKey() (ssh.Signer, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, sshUIHostKeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return ssh.ParsePrivateKey(data)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, appName+" SSH UI")
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, err
+	}
+	// For checking the fingerprint ssh shows on the first login
+	os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0o644)
+	return signer, nil
+}
+
+// serve accepts connections for d until Close.
+func (s *sshUI) serve(d *daemonServer) {
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn, d)
+		}
+	}()
+}
+
+func (s *sshUI) handle(conn net.Conn, d *daemonServer) {
+	defer recoverPanic("SSH UI")
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		slog.Info("SSH UI login failed", "addr", conn.RemoteAddr(), "err", err)
+		conn.Close()
+		return
+	}
+	slog.Info("SSH UI login", "addr", sconn.RemoteAddr(), "user", sconn.User(), "key", sconn.Permissions.Extensions["key"])
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions are served")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		s.sessions.Add(1)
+		go s.session(&sshClient{ch: ch, conn: sconn, done: s.sessions.Done}, requests, d)
+	}
+}
+
+// session runs one session channel: a pty, then a shell, which gets the UI.
+func (s *sshUI) session(c *sshClient, requests <-chan *ssh.Request, d *daemonServer) {
+	var pty struct {
+		Term                 string
+		Cols, Rows, PxW, PxH uint32
+		Modes                string
+	}
+	hasPty := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			hasPty = ssh.Unmarshal(req.Payload, &pty) == nil
+			req.Reply(hasPty, nil)
+		case "window-change":
+			var size struct{ Cols, Rows, PxW, PxH uint32 }
+			if ssh.Unmarshal(req.Payload, &size) == nil && c.attached.Load() {
+				d.setSize(c, int(size.Cols), int(size.Rows))
+			}
+		case "shell":
+			if c.attached.Load() {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			if !hasPty {
+				fmt.Fprintln(c.ch.Stderr(), "The UI needs a terminal; connect with ssh -t.")
+				c.exit(1)
+				continue
+			}
+			c.attached.Store(true)
+			// SSH does not tell the background; the daemon's guess stands
+			d.setColors(termProfile(pty.Term), lipgloss.HasDarkBackground())
+			d.attach(c, int(pty.Cols), int(pty.Rows))
+			go func() {
+				buf := make([]byte, 4096)
+				for {
+					n, err := c.ch.Read(buf)
+					if err != nil {
+						break
+					}
+					d.type_(c, buf[:n])
+				}
+				d.drop(c)
+			}()
+		default:
+			// exec, subsystem, env, agent and X11 forwarding...
+			req.Reply(false, nil)
+		}
+	}
+	if !c.attached.Load() {
+		c.exit(0)
+	}
+}
+
+// termProfile guesses the color profile of a terminal from its TERM, as
+// there is no asking it over SSH.
+func termProfile(term string) termenv.Profile {
+	switch {
+	case term == "" || term == "dumb":
+		return termenv.Ascii
+	case strings.Contains(term, "truecolor") || strings.Contains(term, "direct"):
+		return termenv.TrueColor
+	case strings.Contains(term, "256color"):
+		return termenv.ANSI256
+	}
+	return termenv.ANSI
+}
+
+// Close stops accepting connections and waits a moment for the sessions
+// to restore their terminals.
+func (s *sshUI) Close() {
+	s.listener.Close()
+	done := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(sshUICloseWait):
+	}
+}
+
+// sshClient is a session attached to the daemon.
+type sshClient struct {
+	ch       ssh.Channel
+	conn     ssh.Conn
+	done     func()
+	once     sync.Once
+	attached atomic.Bool // set by the session, read by exit from the daemon
+}
+
+// Write gives up on a session that takes more than sshUIWriteTimeout, as
+// a socket client's write deadline does, so a stalled link cannot hold up
+// the others.
+func (c *sshClient) Write(b []byte) (int, error) {
+	b = bytes.Clone(b) // still read by the write below after a timeout
+	written := make(chan error, 1)
+	go func() {
+		_, err := c.ch.Write(b)
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	case <-time.After(sshUIWriteTimeout):
+		c.conn.Close()
+		return 0, errors.New("SSH UI session stalled")
+	}
+}
+
+// Close restores the terminal and ends the session, in the background:
+// the daemon closes clients while holding its lock.
+func (c *sshClient) Close() error {
+	go c.exit(0)
+	return nil
+}
+
+// exit ends the session with status, restoring the terminal if the UI
+// had it.
+func (c *sshClient) exit(status uint32) {
+	c.once.Do(func() {
+		defer c.done()
+		if c.attached.Load() {
+			c.Write([]byte(detachScreen))
+		}
+		c.ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		c.ch.Close()
+	})
+}
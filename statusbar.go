@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Next to its message, the status bar shows what is going on: how many
+// tunnels are up, how many failed and how many are marked, the latest
+// event ("db-prod reconnected 2m ago"), the log search, the list filter
+// and the config file in use. What does not fit is left out, the config
+// file first. Events are the ones that send notifications, plus tunnels
+// connecting; the time is in minutes, like the uptimes, so the screen
+// still only redraws when something happens or once a minute.
+
+type statusEvent struct {
+	text string
+	at   time.Time
+}
+
+func (m *model) recordEvent(text string) {
+	m.lastEvent = statusEvent{text: text, at: time.Now()}
+}
+
+// markFailed records a tunnel that went down on its own, for the count in
+// the status bar and the history.
+func (m *model) markFailed(t *tunnel, reason string) {
+	t.failed = true
+	m.retire(t, reason)
+}
+
+// configLabel is the config file in use, with the home directory as ~.
+func configLabel(demo bool) string {
+	if demo {
+		return "demo, no config"
+	}
+	path, err := configPath()
+	if err != nil {
+		return "default config"
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return "default config, no " + filepath.Base(path)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if rest, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+			return filepath.Join("~", rest)
+		}
+	}
+	return path
+}
+
+// liveStatus is what the status bar shows besides the message, most
+// important first.
+func (m model) liveStatus() []string {
+	active, degraded, failed := 0, 0, 0
+	for _, t := range m.tunnels {
+		switch {
+		case t.degraded():
+			degraded++
+		case t.active:
+			active++
+		case t.failed:
+			failed++
+		}
+	}
+	counts := fmt.Sprintf("%d/%d active", active, len(m.tunnels))
+	if degraded > 0 {
+		counts += fmt.Sprintf(", %d degraded", degraded)
+	}
+	if failed > 0 {
+		counts += fmt.Sprintf(", %d failed", failed)
+	}
+	parts := []string{counts}
+	if marked := len(m.marked()); marked > 0 {
+		parts = append(parts, fmt.Sprintf("%d marked", marked))
+	}
+	if e := m.lastEvent; e.text != "" {
+		ago := "just now"
+		if d := time.Since(e.at); d >= time.Minute {
+			ago = fmtUptime(d) + " ago"
+		}
+		parts = append(parts, e.text+" "+ago)
+	}
+	if m.logQuery != "" {
+		filter := "search /" + m.logQuery
+		if m.logFilterOnly {
+			filter += " (matches only)"
+		}
+		parts = append(parts, filter)
+	}
+	if m.listFilter != "" {
+		parts = append(parts, "list /"+m.listFilter)
+	}
+	if agent := m.agent.label(); agent != "" {
+		parts = append(parts, agent)
+	}
+	return append(parts, m.configLabel)
+}
+
+// statusLine puts the live status right-aligned after message, leaving
+// out the least important parts until it fits in width.
+func (m model) statusLine(message string, width int) string {
+	parts := m.liveStatus()
+	for len(parts) > 0 {
+		live := strings.Join(parts, " • ")
+		if gap := width - lipgloss.Width(message) - lipgloss.Width(live); gap >= 2 {
+			return message + strings.Repeat(" ", gap) + live
+		}
+		parts = parts[:len(parts)-1]
+	}
+	return message
+}
@@ -2,85 +2,139 @@ package main
 
 import "github.com/charmbracelet/lipgloss"
 
+// The styles are built from the theme's colors (see theme.go), once at
+// startup before the UI draws.
 var (
+	titleStyle         lipgloss.Style
+	errorStyle         lipgloss.Style
+	successStyle       lipgloss.Style
+	selectedStyle      lipgloss.Style
+	subtleStyle        lipgloss.Style
+	activeStyle        lipgloss.Style
+	inactiveStyle      lipgloss.Style
+	highlightStyle     lipgloss.Style
+	panelStyle         lipgloss.Style
+	selectedPanelStyle lipgloss.Style
+	statusBarStyle     lipgloss.Style
+	helpOverlayStyle   lipgloss.Style
+	helpTitleStyle     lipgloss.Style
+	helpKeyStyle       lipgloss.Style
+	helpDescStyle      lipgloss.Style
+	toastStyle         lipgloss.Style
+	toastSuccessStyle  lipgloss.Style
+	inputStyle         lipgloss.Style
+	spinnerStyle       lipgloss.Style
+	logTimeStyle       lipgloss.Style
+	degradedStyle      lipgloss.Style
+	logMatchStyle      lipgloss.Style
+	tableHeaderStyle   lipgloss.Style
+	hopStyle           lipgloss.Style
+)
+
+func init() {
+	applyTheme(themes[defaultTheme])
+}
+
+// applyTheme rebuilds every style from t.
+func applyTheme(t theme) {
 	titleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("#61AFEF"))
+		Bold(true).
+		Foreground(t.Accent)
 
 	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E06C75")).
-			Bold(true)
+		Foreground(t.Error).
+		Bold(true)
 
 	successStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#98C379")).
-			Bold(true)
+		Foreground(t.Success).
+		Bold(true)
 
 	selectedStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E5C07B")).
-			Bold(true)
+		Foreground(t.Warning).
+		Bold(true)
 
 	subtleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#5C6370"))
+		Foreground(t.Muted)
 
 	activeStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#98C379"))
+		Foreground(t.Success)
 
 	inactiveStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E06C75"))
+		Foreground(t.Error)
 
 	highlightStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#D19A66"))
+		Foreground(t.Key)
 
 	panelStyle = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("#5C6370")).
-			Padding(1, 2)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Muted).
+		Padding(1, 2)
 
 	selectedPanelStyle = lipgloss.NewStyle().
-				Border(lipgloss.RoundedBorder()).
-				BorderForeground(lipgloss.Color("#C678DD")).
-				Padding(1, 2)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Focus).
+		Padding(1, 2)
 
 	statusBarStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#ABB2BF")).
-			Background(lipgloss.Color("#282C34")).
-			Padding(0, 1)
+		Foreground(t.Text).
+		Background(t.Surface).
+		Padding(0, 1)
 
 	helpOverlayStyle = lipgloss.NewStyle().
-				Background(lipgloss.Color("#1E2127")).
-				Foreground(lipgloss.Color("#ABB2BF")).
-				Padding(1, 2)
+		Background(t.Overlay).
+		Foreground(t.Text).
+		Padding(1, 2)
 
 	helpTitleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#61AFEF")).
-			Bold(true).
-			Padding(0, 0, 1, 0)
+		Foreground(t.Accent).
+		Bold(true).
+		Padding(0, 0, 1, 0)
 
 	helpKeyStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#D19A66"))
+		Foreground(t.Key)
 
 	helpDescStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#5C6370"))
+		Foreground(t.Muted)
 
 	toastStyle = lipgloss.NewStyle().
-			Background(lipgloss.Color("#E06C75")).
-			Foreground(lipgloss.Color("#FFFFFF")).
-			Padding(0, 1).
-			Margin(1)
+		Background(t.Error).
+		Foreground(t.OnColor).
+		Padding(0, 1).
+		Margin(1)
 
 	toastSuccessStyle = lipgloss.NewStyle().
-				Background(lipgloss.Color("#98C379")).
-				Foreground(lipgloss.Color("#FFFFFF")).
-				Padding(0, 1).
-				Margin(1)
+		Background(t.Success).
+		Foreground(t.OnColor).
+		Padding(0, 1).
+		Margin(1)
 
 	inputStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E5C07B")).
-			Bold(true)
+		Foreground(t.Warning).
+		Bold(true)
 
 	spinnerStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#C678DD"))
+		Foreground(t.Focus)
 
 	logTimeStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#5C6370"))
-)
+		Foreground(t.Muted)
+
+	degradedStyle = lipgloss.NewStyle().
+		Foreground(t.Warning)
+
+	logMatchStyle = lipgloss.NewStyle().
+		Foreground(t.Surface).
+		Background(t.Warning)
+
+	tableHeaderStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(t.Accent).
+		Padding(0, 1).
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderBottom(true).
+		BorderForeground(t.Muted)
+
+	hopStyle = lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Muted).
+		Padding(0, 1)
+}
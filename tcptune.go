@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TCP tuning sets the socket options of a tunnel's connections, for
+// latency-sensitive protocols over a WAN: how often TCP keepalive probes
+// go out, whether small writes wait to be batched (Nagle's algorithm,
+// which no_delay turns off) and the kernel's buffer sizes, which bound
+// how much can be in flight on a long fat link. The native client applies
+// all of them, to its connection to the SSH server and to each forwarded
+// connection on this machine. The ssh binary only has TCPKeepAlive, so it
+// takes whether probes are sent and leaves the rest to the system. The
+// config sets the defaults, a tunnel its own.
+
+// tcpMaxBuffer caps the buffer sizes; the kernel caps them lower still.
+const tcpMaxBuffer = 64 << 20
+
+type tcpTuning struct {
+	// KeepAlive is the seconds between TCP keepalive probes, -1 to send
+	// none and 0 for the system's default.
+	KeepAlive int `json:"keepalive,omitempty" yaml:"keepalive,omitempty"`
+	// NoDelay sends small writes at once, as Go does unless it is false.
+	NoDelay *bool `json:"no_delay,omitempty" yaml:"no_delay,omitempty"`
+	// ReadBuffer and WriteBuffer size the socket buffers in bytes, 0 for
+	// the system's default.
+	ReadBuffer  int `json:"read_buffer,omitempty" yaml:"read_buffer,omitempty"`
+	WriteBuffer int `json:"write_buffer,omitempty" yaml:"write_buffer,omitempty"`
+}
+
+func (t tcpTuning) check() error {
+	if t.KeepAlive < -1 || t.KeepAlive > 7200 {
+		return fmt.Errorf("tcp keepalive must be from 1 to 7200 seconds, or -1 for none, got %d", t.KeepAlive)
+	}
+	for name, n := range map[string]int{"read_buffer": t.ReadBuffer, "write_buffer": t.WriteBuffer} {
+		if n < 0 || n > tcpMaxBuffer {
+			return fmt.Errorf("tcp %s must be from 0 to %d bytes, got %d", name, tcpMaxBuffer, n)
+		}
+	}
+	return nil
+}
+
+// nativeOnly reports whether the tuning sets what the ssh binary cannot.
+func (t tcpTuning) nativeOnly() bool {
+	return t.NoDelay != nil || t.ReadBuffer > 0 || t.WriteBuffer > 0
+}
+
+// keepAlive is the probe interval for a net.Dialer: negative for none,
+// zero for Go's default.
+func (t tcpTuning) keepAlive() time.Duration {
+	if t.KeepAlive < 0 {
+		return -1
+	}
+	return time.Duration(t.KeepAlive) * time.Second
+}
+
+// apply sets the options on conn, if it is a TCP connection.
+func (t tcpTuning) apply(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	switch {
+	case t.KeepAlive > 0:
+		errs = append(errs, tc.SetKeepAlive(true), tc.SetKeepAlivePeriod(t.keepAlive()))
+	case t.KeepAlive < 0:
+		errs = append(errs, tc.SetKeepAlive(false))
+	}
+	if t.NoDelay != nil {
+		errs = append(errs, tc.SetNoDelay(*t.NoDelay))
+	}
+	if t.ReadBuffer > 0 {
+		errs = append(errs, tc.SetReadBuffer(t.ReadBuffer))
+	}
+	if t.WriteBuffer > 0 {
+		errs = append(errs, tc.SetWriteBuffer(t.WriteBuffer))
+	}
+	return errors.Join(errs...)
+}
+
+// sshArgs are ssh's options for the tuning: TCPKeepAlive, whose interval
+// is the system's.
+func (t tcpTuning) sshArgs() []string {
+	switch {
+	case t.KeepAlive > 0:
+		return []string{"-o", "TCPKeepAlive=yes"}
+	case t.KeepAlive < 0:
+		return []string{"-o", "TCPKeepAlive=no"}
+	}
+	return nil
+}
+
+func (t tcpTuning) String() string {
+	var parts []string
+	switch {
+	case t.KeepAlive > 0:
+		parts = append(parts, fmt.Sprintf("keepalive every %ds", t.KeepAlive))
+	case t.KeepAlive < 0:
+		parts = append(parts, "no keepalive")
+	}
+	if t.NoDelay != nil && *t.NoDelay {
+		parts = append(parts, "no delay")
+	} else if t.NoDelay != nil {
+		parts = append(parts, "writes batched (Nagle)")
+	}
+	if t.ReadBuffer > 0 {
+		parts = append(parts, "read buffer "+fmtBytes(uint64(t.ReadBuffer)))
+	}
+	if t.WriteBuffer > 0 {
+		parts = append(parts, "write buffer "+fmtBytes(uint64(t.WriteBuffer)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tcp is the tuning a tunnel runs with: its own, else the config's.
+func (c config) tcp(spec tunnelSpec) tcpTuning {
+	if spec.TCP != nil {
+		return *spec.TCP
+	}
+	if c.TCP != nil {
+		return *c.TCP
+	}
+	return tcpTuning{}
+}
+
+// tcpSetting shows the spec's own tuning, if any.
+func (s tunnelSpec) tcpSetting() string {
+	if s.TCP == nil {
+		return "default"
+	}
+	return s.TCP.String()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The tsh backend carries tunnels over Teleport with tsh ssh -N -L,
+// through the proxy tsh is logged in to, and its host picker lists the
+// nodes tsh ls finds, searchable by their labels, instead of the ssh
+// config. Teleport logins expire, 12 hours after tsh login by default.
+// Rather than a tunnel failing with whatever tsh prints, the login is
+// checked before a tsh tunnel starts and when one exits, and an expired
+// login is shown as such, with tsh login one key away. tsh login takes
+// over the terminal the way the shell key does.
+const teleportBackend = "tsh"
+
+const tshTimeout = 15 * time.Second
+
+// errTshLogin means tsh has no login to use: it expired, or there never
+// was one.
+var errTshLogin = errors.New("the Teleport login has expired, or tsh is not logged in")
+
+type tshPortForward struct{}
+
+func (tshPortForward) Name() string { return teleportBackend }
+
+func (tshPortForward) Command(spec tunnelSpec, forwardPort string, pre precheckMsg, pol policy) *exec.Cmd {
+	return exec.Command("tsh", "ssh", "-N", "-L", forwardPort+":"+destination("", spec.RemotePort), spec.Host)
+}
+
+// runTsh runs a tsh command that answers right away, with what it printed
+// as ERROR: as the error.
+func runTsh(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tshTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "tsh", args...).Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("tsh %s: no answer within %s", args[0], tshTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if line := lastLine(string(exitErr.Stderr)); line != "" {
+			err = fmt.Errorf("tsh %s: %s", args[0], strings.TrimPrefix(line, "ERROR: "))
+		}
+	}
+	return out, err
+}
+
+// checkTshLogin returns errTshLogin unless tsh has a login that is still
+// valid.
+func checkTshLogin() error {
+	out, err := runTsh("status", "--format=json")
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "not logged in") {
+			return errTshLogin
+		}
+		return err
+	}
+	var status struct {
+		Active *struct {
+			ValidUntil time.Time `json:"valid_until"`
+		} `json:"active"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return fmt.Errorf("tsh status: %v", err)
+	}
+	if status.Active == nil || !status.Active.ValidUntil.After(time.Now()) {
+		return errTshLogin
+	}
+	return nil
+}
+
+// tshLoginCheckedMsg reports the login check made before starting a tsh
+// tunnel (tunnelID 0) or after the tsh of tunnelID exited.
+type tshLoginCheckedMsg struct {
+	tunnelID int
+	err      error
+}
+
+func checkTshLoginCmd(tunnelID int) tea.Cmd {
+	return func() tea.Msg {
+		return tshLoginCheckedMsg{tunnelID: tunnelID, err: checkTshLogin()}
+	}
+}
+
+// tshNodesMsg carries the nodes tsh ls found, with their labels as
+// "env=prod team=db" for the picker to show and search.
+type tshNodesMsg struct {
+	nodes  []string
+	labels map[string]string
+	err    error
+}
+
+func listTshNodesCmd() tea.Cmd {
+	return func() tea.Msg {
+		out, err := runTsh("ls", "--format=json")
+		if err != nil {
+			// tsh ls words an expired login differently across versions
+			if checkTshLogin() == errTshLogin {
+				err = errTshLogin
+			}
+			return tshNodesMsg{err: err}
+		}
+		var nodes []struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Spec struct {
+				Hostname string `json:"hostname"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(out, &nodes); err != nil {
+			return tshNodesMsg{err: fmt.Errorf("tsh ls: %v", err)}
+		}
+		msg := tshNodesMsg{labels: make(map[string]string)}
+		for _, n := range nodes {
+			name := n.Spec.Hostname
+			if name == "" || strings.ContainsAny(name, " \t") || slices.Contains(msg.nodes, name) {
+				continue
+			}
+			msg.nodes = append(msg.nodes, name)
+			var labels []string
+			for k, v := range n.Metadata.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			slices.Sort(labels)
+			msg.labels[name] = strings.Join(labels, " ")
+		}
+		return msg
+	}
+}
+
+// startTeleport opens the node picker after the tsh backend was picked.
+// tsh tunnels are local forwards. The demo lists its own hosts as nodes.
+func (m model) startTeleport() (tea.Model, tea.Cmd) {
+	if _, err := exec.LookPath("tsh"); err != nil && !m.demo {
+		m.err = fmt.Errorf("the tsh backend needs tsh, Teleport's client, on the PATH")
+		return m, nil
+	}
+	m.tempBackend = teleportBackend
+	m.tempType = ""
+	m.step = stepHost
+	m.hostFilter, m.cursor, m.hostScroll = "", 0, 0
+	m.err = nil
+	m.tshNodes, m.tshLabels, m.tshErr = nil, nil, nil
+	if m.demo {
+		for _, h := range m.hosts {
+			m.tshNodes = append(m.tshNodes, strings.Fields(h)[0])
+		}
+		return m, nil
+	}
+	m.tshListing = true
+	return m, listTshNodesCmd()
+}
+
+// pickerHosts is what the host picker lists: the Teleport nodes for the
+// tsh backend, the ssh config and host providers otherwise.
+func (m model) pickerHosts() []string {
+	if m.tempBackend == teleportBackend {
+		return m.tshNodes
+	}
+	return m.hosts
+}
+
+// tshPickerNote explains an empty node list.
+func (m model) tshPickerNote() string {
+	switch {
+	case m.tshListing:
+		return "Asking tsh for nodes..."
+	case errors.Is(m.tshErr, errTshLogin) && m.daemon != nil:
+		return "The Teleport login has expired; run tsh login in another terminal, then n again"
+	case errors.Is(m.tshErr, errTshLogin):
+		return "The Teleport login has expired, Enter to log in again with tsh login"
+	case m.tshErr != nil:
+		return m.tshErr.Error()
+	}
+	return ""
+}
+
+type tshLoginMsg struct{ err error }
+
+// tshLogin hands the terminal to tsh login, which may ask for a password
+// and second factor or open a browser for SSO. The daemon has no terminal
+// to hand over.
+func (m model) tshLogin() (tea.Model, tea.Cmd) {
+	if m.daemon != nil {
+		m.statusMessage = "No tsh login under attach; run it in another terminal"
+		return m, nil
+	}
+	slog.Info("running tsh login")
+	return m, tea.ExecProcess(exec.Command("tsh", "login"), func(err error) tea.Msg {
+		return tshLoginMsg{err: err}
+	})
+}
+
+// tshLoggedIn carries on with what the login was for: the node list or
+// the tunnel being started.
+func (m model) tshLoggedIn(msg tshLoginMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		slog.Warn("tsh login failed", "err", msg.err)
+		m.statusMessage = fmt.Sprintf("tsh login failed: %v", msg.err)
+		return m, nil
+	}
+	m.statusMessage = "Logged in to Teleport"
+	switch {
+	case m.view != viewNewTunnel:
+	case m.step == stepConnecting:
+		m.err = nil
+		return m.startConnecting()
+	case m.step == stepHost && m.tempBackend == teleportBackend:
+		m.tshErr, m.tshListing = nil, true
+		return m, listTshNodesCmd()
+	}
+	return m, nil
+}
+
+// tshLoginChecked starts the tunnel when the login is good, or marks a
+// tunnel whose tsh exited as down for its login.
+func (m model) tshLoginChecked(msg tshLoginCheckedMsg) (tea.Model, tea.Cmd) {
+	if msg.tunnelID == 0 {
+		if m.view != viewNewTunnel || m.step != stepConnecting || m.err != nil || m.tempBackend != teleportBackend {
+			return m, nil
+		}
+		if msg.err != nil {
+			slog.Warn("teleport login check failed", "host", m.tempHost, "err", msg.err)
+			m.err = msg.err
+			return m, nil
+		}
+		if t := m.tunnelByID(m.tempResume); t != nil {
+			t.loginExpired = false
+		}
+		return m.finalizeTunnel()
+	}
+
+	t := m.tunnelByID(msg.tunnelID)
+	if t == nil || t.active || !errors.Is(msg.err, errTshLogin) {
+		return m, nil
+	}
+	t.loginExpired = true
+	slog.Warn("teleport login expired", t.logAttrs()...)
+	t.appendLog(fmt.Sprintf("The Teleport login has expired; %s logs in again and starts the tunnel", m.keys.StartStop.Help().Key))
+	m.statusMessage = fmt.Sprintf("%s is down: the Teleport login has expired • %s to log in again", t.tag, m.keys.StartStop.Help().Key)
+	return m, nil
+}
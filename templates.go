@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tunnelTemplate is a preset for a common service. Picking one after the
+// host fills in the ports, tag and smoke test and connects right away.
+type tunnelTemplate struct {
+	Name       string `json:"name"`
+	RemotePort string `json:"remote_port"`
+	// LocalPort defaults to RemotePort. When it is taken, the next free
+	// port above it is used.
+	LocalPort string `json:"local_port,omitempty"`
+	// Tag may contain {host}, the short name of the picked host. It
+	// defaults to {host}-<name>.
+	Tag       string `json:"tag,omitempty"`
+	SmokeTest string `json:"smoke_test,omitempty"`
+	// Web and WebURL mark the service as a web app, see browser.go
+	Web    bool   `json:"web,omitempty"`
+	WebURL string `json:"web_url,omitempty"`
+}
+
+var builtinTemplates = []tunnelTemplate{
+	{Name: "PostgreSQL", RemotePort: "5432", Tag: "{host}-postgres", SmokeTest: "tcp"},
+	{Name: "MySQL", RemotePort: "3306", Tag: "{host}-mysql", SmokeTest: "tcp"},
+	{Name: "Redis", RemotePort: "6379", Tag: "{host}-redis", SmokeTest: "tcp"},
+	{Name: "MongoDB", RemotePort: "27017", Tag: "{host}-mongo", SmokeTest: "tcp"},
+	{Name: "Elasticsearch", RemotePort: "9200", Tag: "{host}-es", SmokeTest: "http /"},
+	{Name: "K8s API", RemotePort: "6443", Tag: "{host}-k8s", SmokeTest: "tcp"},
+	{Name: "Remote Docker", RemotePort: "/var/run/docker.sock", LocalPort: "2375", Tag: "{host}-docker", SmokeTest: "http /_ping"},
+}
+
+// templates lists the built-in templates followed by the user's. A user
+// template with a built-in's name replaces it.
+func (c config) templates() []tunnelTemplate {
+	out := append([]tunnelTemplate(nil), builtinTemplates...)
+	for _, t := range c.Templates {
+		replaced := false
+		for i := range out {
+			if strings.EqualFold(out[i].Name, t.Name) {
+				out[i], replaced = t, true
+			}
+		}
+		if !replaced {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (t tunnelTemplate) localPort() string {
+	if t.LocalPort != "" {
+		return t.LocalPort
+	}
+	return t.RemotePort
+}
+
+// tag names a tunnel from this template to host, e.g. db-1-postgres for
+// deploy@db-1.internal.
+func (t tunnelTemplate) tag(host string) string {
+	host = host[strings.LastIndex(host, "@")+1:]
+	if dot := strings.IndexByte(host, '.'); dot > 0 && net.ParseIP(host) == nil {
+		host = host[:dot]
+	}
+	pattern := t.Tag
+	if pattern == "" {
+		pattern = "{host}-" + t.Name
+	}
+	return strings.Trim(sanitizeTag(strings.ReplaceAll(pattern, "{host}", host)), "-")
+}
+
+// check validates a template from the config.
+func (t tunnelTemplate) check() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	spec := tunnelSpec{Host: "template", LocalPort: t.localPort(), RemotePort: t.RemotePort, SmokeTest: t.SmokeTest, Web: t.Web, WebURL: t.WebURL}
+	if err := spec.normalize(); err != nil {
+		return err
+	}
+	if t.tag("host") == "" {
+		return fmt.Errorf("tag %q is empty once {host} is filled in", t.Tag)
+	}
+	return nil
+}
+
+func (t tunnelTemplate) label() string {
+	return fmt.Sprintf("%s (%s)", t.Name, t.RemotePort)
+}
+
+// applyTemplate fills the wizard from the template at idx and connects
+// with the defaults of the remaining steps.
+func (m model) applyTemplate(idx int) (tea.Model, tea.Cmd) {
+	t := m.cfg.templates()[idx]
+	if err := m.policy.checkRemotePort(t.RemotePort); err != nil {
+		m.err = err
+		return m, nil
+	}
+	local, err := m.freeLocalPort(t.localPort())
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	if local != t.localPort() {
+		m.statusMessage = fmt.Sprintf("Local port %s is taken, using %s", t.localPort(), local)
+	}
+
+	m.tempRemote = t.RemotePort
+	m.tempRemoteHost = ""
+	m.tempLocal = local
+	m.tempForwards = nil
+	m.tempKeepalive = nil
+	m.tempIdentity = ""
+	m.tempControlPath = ""
+	m.tempCompression, m.tempCiphers = nil, ""
+	m.tempAgent, m.tempX11 = false, ""
+	m.tempCloseAfter, m.tempCloseIdle = 0, 0
+	m.tempLazy = false
+	m.tempOnConnect, m.tempOnDisc = "", ""
+	m.tempWeb, m.tempWebURL = t.Web || t.WebURL != "", t.WebURL
+	m.tempTag = t.tag(m.tempHost)
+	m.tempProxy = ""
+	if m.tempBackend == "" {
+		m.tempProxy = m.cfg.Proxy
+	}
+	m.tempPrep = ""
+	m.tempSmoke = t.SmokeTest
+	m.tempHealth = ""
+	m.tempTLS = ""
+	m.tempVerbose = false
+	return m.startConnecting()
+}
+
+// freeLocalPort returns port, or the next one above it that is free.
+func (m *model) freeLocalPort(port string) (string, error) {
+	n, _ := strconv.Atoi(port)
+	for p := n; p < n+100 && p <= 65535; p++ {
+		if m.checkLocalPort(strconv.Itoa(p)) == nil {
+			return strconv.Itoa(p), nil
+		}
+	}
+	return "", fmt.Errorf("no free local port from %s to %d", port, min(n+99, 65535))
+}
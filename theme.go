@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// A theme is the palette styles.go builds every style from. The config
+// picks one by name and can override single colors:
+//
+//	"theme": "light",
+//	"colors": {"accent": "#0055CC", "muted": "244"}
+
+const defaultTheme = "dark"
+
+type theme struct {
+	Accent  lipgloss.Color // titles
+	Error   lipgloss.Color // errors, stopped tunnels
+	Success lipgloss.Color // active tunnels
+	Warning lipgloss.Color // the selection, degraded tunnels, search matches
+	Muted   lipgloss.Color // secondary text, borders
+	Key     lipgloss.Color // keys in the help and footer
+	Focus   lipgloss.Color // the focused panel, the spinner
+	Text    lipgloss.Color // the status bar and help text
+	Surface lipgloss.Color // the status bar background
+	Overlay lipgloss.Color // the help background
+	OnColor lipgloss.Color // text on error and success toasts
+}
+
+var themes = map[string]theme{
+	// One Dark
+	"dark": {
+		Accent:  "#61AFEF",
+		Error:   "#E06C75",
+		Success: "#98C379",
+		Warning: "#E5C07B",
+		Muted:   "#5C6370",
+		Key:     "#D19A66",
+		Focus:   "#C678DD",
+		Text:    "#ABB2BF",
+		Surface: "#282C34",
+		Overlay: "#1E2127",
+		OnColor: "#FFFFFF",
+	},
+	// One Light, with darker secondary text so it reads on white
+	"light": {
+		Accent:  "#4078F2",
+		Error:   "#CA1243",
+		Success: "#50A14F",
+		Warning: "#C18401",
+		Muted:   "#696C77",
+		Key:     "#986801",
+		Focus:   "#A626A4",
+		Text:    "#383A42",
+		Surface: "#E5E5E6",
+		Overlay: "#F0F0F1",
+		OnColor: "#FFFFFF",
+	},
+	// Bright colors on black, for low vision or washed-out screens
+	"high-contrast": {
+		Accent:  "#00D7FF",
+		Error:   "#FF5F5F",
+		Success: "#5FFF5F",
+		Warning: "#FFFF00",
+		Muted:   "#D0D0D0",
+		Key:     "#FFAF00",
+		Focus:   "#FF5FFF",
+		Text:    "#FFFFFF",
+		Surface: "#000000",
+		Overlay: "#000000",
+		OnColor: "#000000",
+	},
+}
+
+// colors names t's colors the way the config does.
+func (t *theme) colors() map[string]*lipgloss.Color {
+	return map[string]*lipgloss.Color{
+		"accent":   &t.Accent,
+		"error":    &t.Error,
+		"success":  &t.Success,
+		"warning":  &t.Warning,
+		"muted":    &t.Muted,
+		"key":      &t.Key,
+		"focus":    &t.Focus,
+		"text":     &t.Text,
+		"surface":  &t.Surface,
+		"overlay":  &t.Overlay,
+		"on_color": &t.OnColor,
+	}
+}
+
+var hexColorRe = regexp.MustCompile(`^#([0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// theme is the config's theme with its color overrides applied.
+func (c config) theme() (theme, error) {
+	name := c.Theme
+	if name == "" {
+		name = defaultTheme
+	}
+	t, ok := themes[name]
+	if !ok {
+		names := slices.Sorted(maps.Keys(themes))
+		return t, fmt.Errorf("theme: unknown theme %q (have %s)", name, strings.Join(names, ", "))
+	}
+	colors := t.colors()
+	for name, value := range c.Colors {
+		color, ok := colors[name]
+		if !ok {
+			names := slices.Sorted(maps.Keys(colors))
+			return t, fmt.Errorf("colors: unknown color %q (have %s)", name, strings.Join(names, ", "))
+		}
+		if n, err := strconv.Atoi(value); !hexColorRe.MatchString(value) && (err != nil || n < 0 || n > 255) {
+			return t, fmt.Errorf("colors: %s: want #RRGGBB or an ANSI color number (0-255), got %q", name, value)
+		}
+		*color = lipgloss.Color(value)
+	}
+	return t, nil
+}
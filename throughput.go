@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Throughput: once a second the traffic counters of the tunnels that have
+// them are read (see trafficBytes), and the detail panel draws the last
+// minute as a sparkline with the current rate, down and up apart for the
+// built-in client and both ways together for the ports the manager relays.
+// A large copy shows as a steady bar, a stalled one as a flat line. The
+// counters are read only while the detail panel shows a tunnel that has
+// them, so the screen is not redrawn every second for nothing.
+
+// throughputSamples is how many seconds the sparkline covers.
+const throughputSamples = 60
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+type throughputTickMsg struct{}
+
+func throughputTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return throughputTickMsg{} })
+}
+
+// throughput is what a tunnel carried each second of the last minute,
+// oldest first.
+type throughput struct {
+	in, out         []uint64 // out stays empty when counted both ways together
+	lastIn, lastOut uint64
+	split           bool
+	read            bool // the counters were read once, so the next read has a delta
+}
+
+// sampleThroughput reads the tunnel's counters and notes what moved since
+// the last read.
+func (t *tunnel) sampleThroughput() {
+	var in, out uint64
+	split := t.native != nil
+	if split {
+		in, out = t.native.bytesIn.Load(), t.native.bytesOut.Load()
+	} else if n, ok := t.trafficBytes(); ok {
+		in = n
+	} else {
+		t.rate = throughput{}
+		return
+	}
+	r := &t.rate
+	if r.split != split {
+		*r = throughput{split: split}
+	}
+	if r.read {
+		r.in = appendSample(r.in, delta(in, r.lastIn))
+		if split {
+			r.out = appendSample(r.out, delta(out, r.lastOut))
+		}
+	}
+	r.lastIn, r.lastOut, r.read = in, out, true
+}
+
+// delta is how far a counter moved, all of it when it started again from
+// zero, as it does when the tunnel is restarted.
+func delta(n, last uint64) uint64 {
+	if n < last {
+		return n
+	}
+	return n - last
+}
+
+func appendSample(samples []uint64, n uint64) []uint64 {
+	samples = append(samples, n)
+	if len(samples) > throughputSamples {
+		samples = samples[len(samples)-throughputSamples:]
+	}
+	return samples
+}
+
+// sparkline draws the last width samples, scaled to the largest of them,
+// padded on the left so the newest is always at the right end. Seconds
+// without traffic are blank.
+func sparkline(samples []uint64, width int) string {
+	samples = samples[max(len(samples)-width, 0):]
+	peak := uint64(0)
+	for _, n := range samples {
+		peak = max(peak, n)
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(samples)))
+	for _, n := range samples {
+		if n == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(sparkBlocks[(n*uint64(len(sparkBlocks))-1)/peak])
+	}
+	return b.String()
+}
+
+// throughputLines is the detail panel's lines for the tunnel's throughput,
+// none until there is a second to show.
+func (t *tunnel) throughputLines(width int) []string {
+	r := t.rate
+	if len(r.in) == 0 {
+		return nil
+	}
+	line := func(label string, samples []uint64) string {
+		rate := fmtBytes(samples[len(samples)-1]) + "/s"
+		spark := sparkline(samples, max(min(throughputSamples, width-len(label)-17), 10))
+		return fmt.Sprintf("%-6s%s %s", label+":", highlightStyle.Render(spark), selectedStyle.Render(rate))
+	}
+	if !r.split {
+		return []string{line("Throughput", r.in)}
+	}
+	return []string{line("Down", r.in), line("Up", r.out)}
+}
+
+// showsThroughput reports whether the detail panel shows a tunnel whose
+// traffic is counted.
+func (m model) showsThroughput() bool {
+	if m.view == viewLogs || m.dashboard || m.selectedGroup != "" || m.selectedTunnel >= len(m.tunnels) {
+		return false
+	}
+	t := m.tunnels[m.selectedTunnel]
+	_, counted := t.trafficBytes()
+	return counted
+}
+
+// startThroughputTick starts sampling when the detail panel comes to show
+// counted traffic. What was sampled before has a gap and is dropped.
+func (m *model) startThroughputTick() tea.Cmd {
+	if m.throughputTicking || !m.showsThroughput() {
+		return nil
+	}
+	for _, t := range m.tunnels {
+		t.rate = throughput{}
+	}
+	m.throughputTicking = true
+	return throughputTickCmd()
+}
+
+// sampleThroughputs reads every tunnel's counters, then ticks again while
+// the detail panel shows them.
+func (m model) sampleThroughputs() (tea.Model, tea.Cmd) {
+	if !m.showsThroughput() {
+		m.throughputTicking = false
+		return m, nil
+	}
+	for _, t := range m.tunnels {
+		t.sampleThroughput()
+	}
+	return m, throughputTickCmd()
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TLS modes for the local end of a tunnel. With "wrap" the manager serves
+// TLS on the local port and forwards plaintext, for tools that insist on
+// https://localhost. With "unwrap" it serves plaintext locally and speaks
+// TLS to the remote service, for poking at TLS-only services.
+const (
+	tlsWrap   = "wrap"
+	tlsUnwrap = "unwrap"
+)
+
+func parseTLSMode(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none", "off":
+		return "", nil
+	case tlsWrap:
+		return tlsWrap, nil
+	case tlsUnwrap:
+		return tlsUnwrap, nil
+	}
+	return "", fmt.Errorf("unknown TLS mode %q (use wrap, unwrap or leave empty)", s)
+}
+
+// tlsProxy sits on the tunnel's local port and relays connections to the
+// internal port ssh forwards, adding or removing TLS on the way, or with
+// no mode neither, counting the bytes for the idle close (see
+// autoclose.go).
+type tlsProxy struct {
+	ln    net.Listener
+	bytes atomic.Uint64
+}
+
+func (p *tlsProxy) Close() error {
+	return p.ln.Close()
+}
+
+// freeLocalPort asks the kernel for an unused loopback port for ssh to
+// forward to when the manager itself owns the user-facing port.
+func freeLocalPort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port, nil
+}
+
+func startTLSProxy(mode, localPort, upstreamPort string, logf func(string)) (*tlsProxy, error) {
+	listenAddr := net.JoinHostPort("127.0.0.1", localPort)
+	upstreamAddr := net.JoinHostPort("127.0.0.1", upstreamPort)
+
+	var ln net.Listener
+	var err error
+	switch mode {
+	case tlsWrap:
+		cert, issuer, certErr := localhostCertificate()
+		if certErr != nil {
+			return nil, fmt.Errorf("cannot create TLS certificate: %v", certErr)
+		}
+		ln, err = tls.Listen("tcp", listenAddr, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err == nil {
+			logf(fmt.Sprintf("Serving TLS on %s (certificate signed by %s)", listenAddr, issuer))
+		}
+	case tlsUnwrap:
+		ln, err = net.Listen("tcp", listenAddr)
+		if err == nil {
+			logf(fmt.Sprintf("Serving plaintext on %s, speaking TLS to the remote (certificate not verified)", listenAddr))
+		}
+	default:
+		ln, err = net.Listen("tcp", listenAddr)
+		if err == nil {
+			logf(fmt.Sprintf("Relaying %s to count its traffic", listenAddr))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &tlsProxy{ln: ln}
+	go func() {
+		defer recoverPanic("TLS proxy")
+		for {
+			client, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.relay(mode, client, upstreamAddr, logf)
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *tlsProxy) relay(mode string, client net.Conn, upstreamAddr string, logf func(string)) {
+	defer recoverPanic("TLS relay")
+	defer client.Close()
+
+	var upstream net.Conn
+	var err error
+	if mode == tlsUnwrap {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		upstream, err = tls.DialWithDialer(dialer, "tcp", upstreamAddr, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		upstream, err = net.DialTimeout("tcp", upstreamAddr, 10*time.Second)
+	}
+	if err != nil {
+		logf(fmt.Sprintf("TLS relay: %v", err))
+		return
+	}
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		countedCopy(upstream, client, &p.bytes)
+		wg.Done()
+	}()
+	go func() {
+		countedCopy(client, upstream, &p.bytes)
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+// localhostCertificate issues a short-lived certificate for localhost from
+// a local CA: mkcert's when it is installed (so browsers already trust it),
+// otherwise one kept in the config directory that the user can trust once.
+func localhostCertificate() (tls.Certificate, string, error) {
+	caCert, caKey, issuer, err := loadLocalCA()
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{appName}, CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der, caCert.Raw}, PrivateKey: key}, issuer, nil
+}
+
+func loadLocalCA() (*x509.Certificate, crypto.Signer, string, error) {
+	if out, err := exec.Command("mkcert", "-CAROOT").Output(); err == nil {
+		dir := strings.TrimSpace(string(out))
+		certFile := filepath.Join(dir, "rootCA.pem")
+		cert, key, err := readCA(certFile, filepath.Join(dir, "rootCA-key.pem"))
+		if err == nil {
+			return cert, key, "mkcert CA " + certFile, nil
+		}
+	}
+
+	dir, err := configDir()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	certFile := filepath.Join(dir, "tls", "ca.pem")
+	keyFile := filepath.Join(dir, "tls", "ca-key.pem")
+
+	cert, key, err := readCA(certFile, keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		cert, key, err = createCA(certFile, keyFile)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return cert, key, "local CA " + certFile, nil
+}
+
+func readCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("malformed PEM in %s", filepath.Dir(certFile))
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported CA key type in %s", keyFile)
+	}
+	return cert, signer, nil
+}
+
+func createCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	if err := os.MkdirAll(filepath.Dir(certFile), 0o700); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{appName}, CommonName: appName + " local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The topology view draws the way the selected tunnel's connections go,
+// hop by hop: this machine, the upstream proxy or jump hosts, the SSH host
+// and where the forward ends up, with how each hop reaches the next. It
+// reads the route ssh -G gave when the tunnel started, as the detail
+// panel's Route line does. The hops go across when they fit and down the
+// screen when they don't.
+
+// topologyNode is a box in the diagram.
+type topologyNode struct {
+	name   string
+	detail string
+}
+
+// topology is the tunnel's path as boxes and, between each box and the
+// next, the link that joins them.
+func (t *tunnel) topology() (nodes []topologyNode, links []string) {
+	here := topologyNode{name: "this machine"}
+	switch t.tunnelType {
+	case "remote":
+		here.detail = "connections end at localhost:" + t.localPort
+	case "socks":
+		here.detail = "SOCKS proxy on localhost:" + t.localPort
+	default:
+		here.detail = "listens on localhost:" + t.localPort
+	}
+	nodes = append(nodes, here)
+
+	switch t.backend {
+	case kubectlBackend:
+		nodes = append(nodes, topologyNode{t.host, "through the cluster's API server"})
+		links = append(links, "kubectl port-forward")
+		return append(nodes, topologyNode{"port " + t.remotePort, "of the pod"}), append(links, "TCP")
+	case teleportBackend:
+		links = append(links, "tsh ssh, through the Teleport proxy")
+	case "", nativeBackend:
+		switch {
+		case t.native != nil || t.backend == nativeBackend:
+			links = append(links, "ssh, built-in client")
+		case t.mux != nil:
+			links = append(links, "ssh master at "+t.mux.socket)
+		default:
+			links = append(links, "ssh")
+		}
+	default:
+		links = append(links, "backend "+t.backend)
+	}
+
+	ep := t.endpoint
+	if t.proxy != "" {
+		// The proxy takes the place of the config's jumps, see route
+		nodes = append(nodes, topologyNode{t.proxy, "upstream proxy"})
+		links = append(links, "ssh")
+	} else {
+		for _, h := range ep.via {
+			if h.command != "" {
+				nodes = append(nodes, topologyNode{"ProxyCommand", h.command})
+				links = append(links, "ssh over its stdio")
+			} else {
+				nodes = append(nodes, topologyNode{h.name, h.addr})
+				links = append(links, "ssh -J")
+			}
+		}
+	}
+
+	target := topologyNode{name: t.host}
+	if ep.hostname != "" && ep.hostname != t.host {
+		target.detail = net.JoinHostPort(ep.hostname, ep.port)
+	}
+	switch t.tunnelType {
+	case "remote":
+		target.detail = strings.TrimSpace(target.detail + " listens on port " + t.remotePort)
+		return append(nodes, target), links
+	case "socks":
+		nodes = append(nodes, target, topologyNode{"any host", "chosen per connection"})
+		return nodes, append(links, "TCP")
+	}
+	dest := topologyNode{remoteEnd(orNone(t.remoteHost, "localhost"), t.remotePort), "as seen from " + t.host}
+	if t.remoteHost == "" {
+		dest = topologyNode{"port " + t.remotePort, "on " + t.host + " itself"}
+	}
+	nodes = append(nodes, target, dest)
+	return nodes, append(links, "TCP")
+}
+
+func (m model) openTopology() model {
+	if m.selectedTunnel < len(m.tunnels) {
+		m.view = viewTopology
+	}
+	return m
+}
+
+func (m model) handleTopologyKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if s := msg.String(); s == "esc" || s == "q" || s == "enter" || key.Matches(msg, m.keys.Topology) {
+		m.view = viewMain
+	}
+	return m, nil
+}
+
+func topologyBox(n topologyNode) string {
+	content := highlightStyle.Render(n.name)
+	if n.detail != "" {
+		content += "\n" + subtleStyle.Render(n.detail)
+	}
+	return hopStyle.Render(content)
+}
+
+// topologyAcross lays the boxes out left to right.
+func topologyAcross(nodes []topologyNode, links []string) string {
+	var parts []string
+	for i, n := range nodes {
+		parts = append(parts, topologyBox(n))
+		if i < len(links) {
+			width := lipgloss.Width(links[i]) + 2
+			arrow := " " + subtleStyle.Render(links[i]) + " \n" + strings.Repeat("─", width) + "▶"
+			parts = append(parts, lipgloss.NewStyle().Padding(0, 1).Render(arrow))
+		}
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Center, parts...)
+}
+
+// topologyDown lays the boxes out top to bottom.
+func topologyDown(nodes []topologyNode, links []string) string {
+	var parts []string
+	for i, n := range nodes {
+		parts = append(parts, topologyBox(n))
+		if i < len(links) {
+			parts = append(parts, "  │ "+subtleStyle.Render(links[i])+"\n  ▼")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m model) renderTopology() string {
+	t := m.tunnels[m.selectedTunnel]
+	content := lipgloss.NewStyle().Bold(true).Render("Topology of "+t.tag) + "\n\n"
+	nodes, links := t.topology()
+	diagram := topologyAcross(nodes, links)
+	if lipgloss.Width(diagram) > m.width-8 {
+		diagram = topologyDown(nodes, links)
+	}
+	content += diagram
+	if len(t.forwards) > 0 {
+		content += "\n\n" + subtleStyle.Render("Also over the same connection: "+strings.Join(strings.Split(t.spec().ports(), ", ")[1:], ", "))
+	}
+	if t.endpoint.hostname == "" && usesSSH(t.backend) {
+		content += "\n\n" + subtleStyle.Render("The route is known once the tunnel has started")
+	}
+	content += "\n\n" + subtleStyle.Render("Esc to close")
+	modal := panelStyle.Render(content)
+	return lipgloss.Place(m.width, m.height-4, lipgloss.Center, lipgloss.Center, modal)
+}
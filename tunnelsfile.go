@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// A tunnels file lists the forwards a project needs, in the profile
+// bundle format, so a team can check it in next to the code:
+//
+//	profiles:
+//	  - tag: api-db
+//	    host: staging
+//	    local_port: 5432
+//	    remote_port: 5432
+//
+// --from-file starts every tunnel in it when the manager opens, and I asks
+// for a file to do the same. Tunnels already up under the same tag are
+// left alone; the others start one after another, like a group's.
+
+// readTunnelsFile reads and checks the tunnels file at path.
+func readTunnelsFile(path string) ([]tunnelSpec, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := parseProfileBundle(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s: no tunnels under profiles", path)
+	}
+	return specs, nil
+}
+
+type tunnelsFileMsg struct {
+	path  string
+	specs []tunnelSpec
+	err   error
+}
+
+func readTunnelsFileCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		specs, err := readTunnelsFile(path)
+		return tunnelsFileMsg{path: path, specs: specs, err: err}
+	}
+}
+
+// startTunnelsFile starts the tunnels from path that are not up yet.
+// Stopped ones already in the list are started again as they are.
+func (m model) startTunnelsFile(path string, specs []tunnelSpec) (tea.Model, tea.Cmd) {
+	m.pendingStarts, m.pendingProfiles = nil, nil
+	up := 0
+	for _, s := range specs {
+		if m.tagUp(s.Tag) {
+			up++
+		} else if i := slices.IndexFunc(m.tunnels, func(t *tunnel) bool { return t.tag == s.Tag }); i >= 0 {
+			m.pendingStarts = append(m.pendingStarts, m.tunnels[i].id)
+		} else {
+			m.pendingProfiles = append(m.pendingProfiles, s)
+		}
+	}
+	starting := len(m.pendingStarts) + len(m.pendingProfiles)
+	slog.Info("starting tunnels file", "path", path, "count", starting, "up", up)
+	m.statusMessage = fmt.Sprintf("Starting %d tunnel(s) from %s", starting, filepath.Base(path))
+	switch {
+	case starting == 0:
+		m.statusMessage = fmt.Sprintf("The tunnels from %s are already up", filepath.Base(path))
+	case up > 0:
+		m.statusMessage += fmt.Sprintf(" • %d already up", up)
+	}
+	return m.startNext()
+}
+
+// The I key asks for the file in the status bar.
+
+func (m model) editTunnelsFile() model {
+	m.fileEditing = true
+	m.fileInput = m.tunnelsFile
+	m.filePrevStatus = m.statusMessage
+	m.statusMessage = m.tunnelsFilePrompt()
+	return m
+}
+
+func (m model) tunnelsFilePrompt() string {
+	return fmt.Sprintf("Start tunnels from file: %s█ • Enter start • Esc cancel", m.fileInput)
+}
+
+func (m model) handleTunnelsFileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.fileEditing = false
+		m.statusMessage = m.filePrevStatus
+		return m, nil
+	case "enter":
+		if m.fileInput == "" {
+			return m, nil
+		}
+		m.fileEditing = false
+		m.tunnelsFile = m.fileInput
+		m.statusMessage = "Reading " + m.fileInput + "..."
+		return m, readTunnelsFileCmd(m.fileInput)
+	case "backspace":
+		if r := []rune(m.fileInput); len(r) > 0 {
+			m.fileInput = string(r[:len(r)-1])
+		}
+	case " ":
+		m.fileInput += " "
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.fileInput += string(msg.Runes)
+		}
+	}
+	m.statusMessage = m.tunnelsFilePrompt()
+	return m, nil
+}
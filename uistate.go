@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// uiState is the layout the manager reopens with, kept in state.json in
+// the config directory. Unlike config.json it is written by the app on
+// exit, so a damaged file is ignored rather than reported.
+type uiState struct {
+	SelectedPanel  int    `json:"selected_panel"`
+	SelectedTunnel string `json:"selected_tunnel,omitempty"` // tag, selected again once it is started
+	SidebarWidth   int    `json:"sidebar_width,omitempty"`
+	Sort           string `json:"sort,omitempty"` // the tunnel list's sort mode
+	Compact        bool   `json:"compact,omitempty"`
+
+	CollapsedGroups []string `json:"collapsed_groups,omitempty"`
+}
+
+const (
+	defaultSidebarWidth = 40
+	minSidebarWidth     = 20
+	minBodyWidth        = 30 // what < and > leave to the logs
+	sidebarStep         = 4  // columns per < or >
+)
+
+func uiStatePath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+func loadUIState() uiState {
+	st := uiState{SidebarWidth: defaultSidebarWidth}
+	path, err := uiStatePath()
+	if err != nil {
+		return st
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		slog.Warn("ignoring unreadable ui state", "path", path, "err", err)
+		return uiState{SidebarWidth: defaultSidebarWidth}
+	}
+	if st.SelectedPanel < 0 || st.SelectedPanel > 1 {
+		st.SelectedPanel = 0
+	}
+	if st.SidebarWidth < minSidebarWidth {
+		st.SidebarWidth = defaultSidebarWidth
+	}
+	return st
+}
+
+func saveUIState(st uiState) error {
+	path, err := uiStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// uiState captures the current layout for the next start.
+func (m model) uiState() uiState {
+	st := uiState{SelectedPanel: m.selectedPanel, SidebarWidth: m.sidebarWidth, Compact: m.compact}
+	if m.listSort != sortCreated {
+		st.Sort = m.listSort.String()
+	}
+	for name := range m.collapsed {
+		st.CollapsedGroups = append(st.CollapsedGroups, name)
+	}
+	sort.Strings(st.CollapsedGroups)
+	if m.selectedTunnel < len(m.tunnels) {
+		st.SelectedTunnel = m.tunnels[m.selectedTunnel].tag
+	} else {
+		st.SelectedTunnel = m.restoreTunnel
+	}
+	return st
+}
+
+func (st uiState) collapsedGroups() map[string]bool {
+	collapsed := map[string]bool{}
+	for _, name := range st.CollapsedGroups {
+		collapsed[name] = true
+	}
+	return collapsed
+}
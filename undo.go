@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The last few deleted tunnels are kept for this session, logs and all, so
+// that u can put back one deleted by mistake: the latest goes back where
+// it was in the list, and is started again if it was running. Undoing a
+// delete also drops it from the history (see closed.go).
+
+const maxUndo = 5
+
+type deletedTunnel struct {
+	t        *tunnel
+	idx      int  // where it was in the list
+	running  bool // it was active when deleted
+	recorded bool // the delete added it to the history
+}
+
+// pushDeleted keeps the just deleted t for undo.
+func (m *model) pushDeleted(d deletedTunnel) {
+	m.deleted = append(m.deleted, d)
+	if len(m.deleted) > maxUndo {
+		m.deleted = m.deleted[1:]
+	}
+}
+
+// undoDelete puts the latest deleted tunnel back in the list.
+func (m model) undoDelete() (tea.Model, tea.Cmd) {
+	if len(m.deleted) == 0 {
+		m.statusMessage = "Nothing to undo"
+		return m, nil
+	}
+	d := m.deleted[len(m.deleted)-1]
+	m.deleted = m.deleted[:len(m.deleted)-1]
+	t := d.t
+	if d.recorded {
+		m.forgetDeleted(t)
+	}
+	idx := min(d.idx, len(m.tunnels))
+	m.tunnels = slices.Insert(m.tunnels, idx, t)
+	slog.Info("tunnel restored", t.logAttrs()...)
+	t.appendLog("Restored after being deleted")
+	m.updateTunnelList()
+	m.selectTunnel(idx)
+	if !d.running {
+		m.statusMessage = fmt.Sprintf("Restored %s", t.tag)
+		return m, nil
+	}
+	m.statusMessage = fmt.Sprintf("Restored %s, starting it again", t.tag)
+	return m.resumeTunnel(idx)
+}
+
+// forgetDeleted takes t's delete back out of the history.
+func (m *model) forgetDeleted(t *tunnel) {
+	t.retired = false
+	spec := t.spec()
+	i := slices.IndexFunc(m.closed, func(c closedTunnel) bool {
+		return c.Reason == deletedReason && c.Spec.Tag == spec.Tag && sameSetup(c.Spec, spec)
+	})
+	if i < 0 {
+		return
+	}
+	m.closed = slices.Delete(m.closed, i, i+1)
+	if m.demo {
+		return
+	}
+	if err := saveClosed(m.closed); err != nil {
+		slog.Warn("cannot save closed tunnels", "err", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Uptime and reconnects, shown under each tunnel in the list so that a
+// flaky connection stands out: one that keeps dropping has a short uptime
+// and a growing reconnect count. A reconnect is any time a tunnel came
+// back up after going down, whether started again by hand or reconnected
+// by the native client or the demo.
+
+type uptimeTickMsg struct{}
+
+// uptimeTickCmd redraws once a minute, as uptimes are shown in minutes
+// and nothing else may happen in between.
+func uptimeTickCmd() tea.Cmd {
+	return tea.Tick(time.Minute, func(time.Time) tea.Msg { return uptimeTickMsg{} })
+}
+
+// markDown ends the current stretch of uptime.
+func (t *tunnel) markDown() {
+	if t.native != nil {
+		t.reconnects += t.native.reconnects()
+	}
+	if !t.startedAt.IsZero() {
+		t.upTotal += time.Since(t.startedAt)
+		t.startedAt = time.Time{}
+	}
+}
+
+// markReconnected starts a new stretch after the tunnel came back.
+func (t *tunnel) markReconnected() {
+	t.startedAt = time.Now()
+	t.reconnects++
+}
+
+// upSince is when the tunnel's connection last came up, zero while it is
+// down. The native client reconnects on its own, so its connection knows.
+func (t *tunnel) upSince() time.Time {
+	if t.native != nil && !t.startedAt.IsZero() {
+		return t.native.connectedSince()
+	}
+	return t.startedAt
+}
+
+func (t *tunnel) reconnectCount() int {
+	n := t.reconnects
+	if t.native != nil {
+		n += t.native.reconnects()
+	}
+	return n
+}
+
+// totalUptime adds up every stretch the tunnel was up.
+func (t *tunnel) totalUptime() time.Duration {
+	if t.startedAt.IsZero() {
+		return t.upTotal
+	}
+	return t.upTotal + time.Since(t.startedAt)
+}
+
+// uptimeLabel is the list's line, e.g. "up 2h13m, 1 reconnect".
+func (t *tunnel) uptimeLabel() string {
+	var parts []string
+	switch since := t.upSince(); {
+	case !since.IsZero():
+		parts = append(parts, "up "+fmtUptime(time.Since(since)))
+	case t.sleeping:
+		parts = append(parts, "waiting for a client")
+	case t.active || t.demo != nil:
+		parts = append(parts, "reconnecting")
+	case t.upTotal > 0:
+		parts = append(parts, "was up "+fmtUptime(t.upTotal))
+	}
+	switch n := t.reconnectCount(); n {
+	case 0:
+	case 1:
+		parts = append(parts, "1 reconnect")
+	default:
+		parts = append(parts, fmt.Sprintf("%d reconnects", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// uptimeDetail is the detail panel's line, which adds the total.
+func (t *tunnel) uptimeDetail() string {
+	label := t.uptimeLabel()
+	if total := t.totalUptime(); t.reconnectCount() > 0 && total > 0 {
+		label += fmt.Sprintf(" (%s in total)", fmtUptime(total))
+	}
+	return label
+}
+
+// fmtUptime shows d in minutes, e.g. 45m, 2h13m or 3d4h.
+func fmtUptime(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+}
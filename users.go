@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// On a shared machine such as a bastion, the policy can name a daemon's
+// socket as shared_daemon, outside anyone's config directory. The daemon
+// is started by one user, its owner, and its socket is open to all, who
+// attach to it as to their own. Each client is told apart by the user id
+// the kernel reports for the socket's peer, and gets the role daemon_users
+// gives the user's name, or "*" any user not listed; the others are
+// refused. The owner, and whoever logs in over the SSH UI with the owner's
+// keys, is an admin.
+//
+// Everyone shares one screen, so the role that counts is that of whoever
+// typed the key: the daemon tells the model who is typing before handing
+// on their keys (see type_ in daemon.go). Tunnels record who started
+// them, shown in the list and the detail panel.
+
+type role string
+
+const (
+	// roleAdmin may do anything the owner can.
+	roleAdmin role = "admin"
+	// roleOperator starts tunnels, and stops, restarts, deletes and
+	// annotates the ones they started.
+	roleOperator role = "operator"
+	// roleViewer looks: moving around, logs, searching, copying.
+	roleViewer role = "viewer"
+)
+
+var roles = []role{roleAdmin, roleOperator, roleViewer}
+
+// daemonUser is who a client of a shared daemon is.
+type daemonUser struct {
+	name string
+	role role
+}
+
+// daemonInputMsg comes before what a user of a shared daemon typed.
+type daemonInputMsg struct {
+	user daemonUser
+}
+
+// ownerUser is the user the manager runs as.
+var ownerUser = sync.OnceValue(func() daemonUser {
+	name := strconv.Itoa(os.Getuid())
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return daemonUser{name: name, role: roleAdmin}
+})
+
+// checkUsers checks the roles of daemon_users.
+func checkUsers(users map[string]string) (map[string]role, error) {
+	checked := make(map[string]role, len(users))
+	for name, r := range users {
+		if !slices.Contains(roles, role(r)) {
+			return nil, fmt.Errorf("daemon user %q has the unknown role %q (admin, operator or viewer)", name, r)
+		}
+		checked[name] = role(r)
+	}
+	return checked, nil
+}
+
+// identify tells who is at the other end of conn, refusing users the
+// policy does not let in.
+func (d *daemonServer) identify(conn net.Conn) (daemonUser, error) {
+	uid, err := peerUID(conn)
+	if err != nil {
+		return daemonUser{}, err
+	}
+	if uid == os.Getuid() {
+		return ownerUser(), nil
+	}
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return daemonUser{}, fmt.Errorf("user %d: %w", uid, err)
+	}
+	r, ok := d.users[u.Username]
+	if !ok {
+		r, ok = d.users["*"]
+	}
+	if !ok {
+		return daemonUser{}, fmt.Errorf("%s may not use this daemon", u.Username)
+	}
+	return daemonUser{name: u.Username, role: r}, nil
+}
+
+// admin reports whether the user who typed last may do anything, as
+// everyone may outside a shared daemon.
+func (m model) admin() bool {
+	return m.user.role == "" || m.user.role == roleAdmin
+}
+
+// mayChange reports whether the user who typed last may stop, restart,
+// delete or annotate t.
+func (m model) mayChange(t *tunnel) bool {
+	return m.admin() || m.user.role == roleOperator && t.owner == m.user.name
+}
+
+// denied says why the user who typed msg may not do what it is bound to
+// on the main screen, or "" when they may.
+func (m model) denied(msg tea.KeyMsg) string {
+	if m.admin() {
+		return ""
+	}
+	k := m.keys
+	inLogPanel := m.selectedPanel == 1
+	matches := func(bindings ...key.Binding) bool { return key.Matches(msg, bindings...) }
+	refuse := m.refusal
+
+	// What acts on the owner's files and settings, or runs as the owner
+	switch {
+	case matches(k.Settings):
+		return refuse("change the settings")
+	case matches(k.Shell):
+		return refuse("open a shell")
+	case matches(k.Inspect):
+		return refuse("inspect the remote port")
+	case matches(k.FromFile):
+		return refuse("read tunnels files")
+	case matches(k.Export):
+		return refuse("export")
+	case matches(k.SaveProfile):
+		return refuse("save profiles")
+	case matches(k.Group):
+		return refuse("edit groups")
+	case matches(k.All):
+		return refuse("act on all tunnels")
+	case matches(k.StartStop) && m.selectedGroup != "":
+		return refuse("start or stop groups")
+	}
+
+	var targets []*tunnel
+	switch {
+	case matches(k.StartStop), matches(k.Note):
+		if m.selectedTunnel < len(m.tunnels) {
+			targets = []*tunnel{m.tunnels[m.selectedTunnel]}
+		}
+	case matches(k.Restart), !inLogPanel && matches(k.Delete):
+		targets = m.targets()
+	case matches(k.Undo) && len(m.deleted) > 0:
+		targets = []*tunnel{m.deleted[len(m.deleted)-1].t}
+	case !inLogPanel && matches(k.New), matches(k.Profiles):
+		return m.deniedStart(-1)
+	}
+	for _, t := range targets {
+		if reason := m.deniedChange(t); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// deniedStart says why the user who typed last may not start a tunnel, or
+// the stopped tunnel i when i >= 0, or "" when they may.
+func (m model) deniedStart(i int) string {
+	if m.user.role == roleViewer {
+		return m.refusal("start tunnels")
+	}
+	if i >= 0 {
+		return m.deniedChange(m.tunnels[i])
+	}
+	return ""
+}
+
+// deniedChange says why the user who typed last may not change t, or ""
+// when they may.
+func (m model) deniedChange(t *tunnel) string {
+	switch {
+	case m.mayChange(t):
+		return ""
+	case t.owner == "":
+		return m.refusal("change " + t.tag)
+	}
+	return m.refusal(fmt.Sprintf("change %s, started by %s", t.tag, t.owner))
+}
+
+func (m model) refusal(what string) string {
+	return fmt.Sprintf("%s (%s) may not %s", m.user.name, m.user.role, what)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The control API lets code outside the Bubbletea loop (the web UI) read
+// and change tunnels. Every request is handed to the loop as a message
+// carrying a reply channel, so the model stays the single owner of state.
+
+const (
+	apiReadTimeout = 5 * time.Second
+
+	// apiStartTimeout covers the reachability check plus a preparation
+	// command, which run before a created tunnel is reported back.
+	apiStartTimeout = precheckTimeout + prepTimeout + 10*time.Second
+)
+
+// tunnelStatus is a tunnel as reported by the control API.
+type tunnelStatus struct {
+	ID int `json:"id"`
+	tunnelSummary
+	Logs []string `json:"logs"`
+}
+
+type apiListMsg struct {
+	reply chan []tunnelStatus
+}
+
+type apiCreateMsg struct {
+	spec  tunnelSpec
+	reply chan error
+}
+
+type apiDeleteMsg struct {
+	id    int
+	reply chan error
+}
+
+// apiStartMsg arrives once a tunnel created through the API has passed its
+// reachability check and preparation command (or failed them).
+type apiStartMsg struct {
+	spec     tunnelSpec
+	precheck precheckMsg
+	prepLogs []string
+	err      error
+	reply    chan error
+}
+
+// apiStartCmd runs the same checks the wizard's connecting step does, in
+// the background, before the tunnel is started.
+func apiStartCmd(spec tunnelSpec, dial bool, pol policy, reply chan error) tea.Cmd {
+	return func() tea.Msg {
+		msg := apiStartMsg{spec: spec, reply: reply}
+		if !usesSSH(spec.Backend) {
+			// Only ssh has an endpoint to check or a host to prepare
+			return msg
+		}
+
+		msg.precheck = precheckCmd(spec.Host, spec.Proxy, dial)().(precheckMsg)
+		if msg.precheck.err != nil {
+			msg.err = msg.precheck.err
+			return msg
+		}
+
+		if spec.Prep != "" {
+			prep := prepCmd(sshConnectArgs(spec.Proxy, msg.precheck, pol), spec.Host, spec.Prep)().(prepMsg)
+			msg.prepLogs, msg.err = prep.output, prep.err
+		}
+		return msg
+	}
+}
+
+// webUI serves the browser front end and the JSON control API behind it.
+type webUI struct {
+	token   string
+	program *tea.Program
+}
+
+// serveWebUI binds addr right away, so a taken port is reported at startup.
+// Requests are only served once the program is attached.
+func serveWebUI(addr, token string) (func(*tea.Program), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("web UI: %w", err)
+	}
+
+	ui := &webUI{token: token}
+	attach := func(p *tea.Program) {
+		ui.program = p
+		go http.Serve(ln, ui.routes())
+	}
+	return attach, nil
+}
+
+func (ui *webUI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ui.handleIndex)
+	mux.HandleFunc("GET /api/tunnels", ui.authorized(ui.handleList))
+	mux.HandleFunc("POST /api/tunnels", ui.authorized(ui.handleCreate))
+	mux.HandleFunc("DELETE /api/tunnels/{id}", ui.authorized(ui.handleDelete))
+	return mux
+}
+
+func (ui *webUI) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ui.token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (ui *webUI) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	webUITemplate.Execute(w, struct{ Version string }{Version})
+}
+
+func (ui *webUI) handleList(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan []tunnelStatus, 1)
+	ui.program.Send(apiListMsg{reply: reply})
+
+	select {
+	case tunnels := <-reply:
+		writeJSON(w, http.StatusOK, tunnels)
+	case <-time.After(apiReadTimeout):
+		writeJSONError(w, http.StatusServiceUnavailable, errors.New("manager did not respond"))
+	}
+}
+
+func (ui *webUI) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var spec tunnelSpec
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if spec.OnConnect != "" || spec.OnDisconnect != "" {
+		// They would run here, unlike prep, which runs on the host
+		writeJSONError(w, http.StatusUnprocessableEntity, errors.New("hooks run commands on this machine, so they can only be set in profiles and tunnels files"))
+		return
+	}
+	// The host and proxy end up on ssh's command line and in its
+	// ProxyCommand, so they must not be able to run anything here either
+	if err := checkAPIHost(spec.Host); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if spec.Proxy != "" {
+		if _, err := parseProxy(spec.Proxy); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	reply := make(chan error, 1)
+	ui.program.Send(apiCreateMsg{spec: spec, reply: reply})
+
+	select {
+	case err := <-reply:
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "started"})
+	case <-time.After(apiStartTimeout):
+		writeJSONError(w, http.StatusGatewayTimeout, errors.New("tunnel did not start in time"))
+	}
+}
+
+func (ui *webUI) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid tunnel id %q", r.PathValue("id")))
+		return
+	}
+
+	reply := make(chan error, 1)
+	ui.program.Send(apiDeleteMsg{id: id, reply: reply})
+
+	select {
+	case err := <-reply:
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case <-time.After(apiReadTimeout):
+		writeJSONError(w, http.StatusServiceUnavailable, errors.New("manager did not respond"))
+	}
+}
+
+// apiHostRe matches the hosts the API takes: an ssh alias or hostname,
+// with a user, or a kubectl target such as shop/svc/postgres@prod.
+var apiHostRe = regexp.MustCompile(`^[A-Za-z0-9._@%:/\[\]-]+$`)
+
+func checkAPIHost(host string) error {
+	host = strings.TrimSpace(host)
+	if !apiHostRe.MatchString(host) || strings.HasPrefix(host, "-") {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// webUIToken returns the configured token, or one generated on first use
+// and kept in the config directory so bookmarks keep working.
+func webUIToken(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "webui-token")
+
+	if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+var webUITemplate = template.Must(template.New("webui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SSH Tunnel Manager</title>
+<style>
+  body { background: #282C34; color: #ABB2BF; font-family: ui-monospace, monospace; margin: 2em; }
+  h1 { color: #61AFEF; font-size: 1.2em; }
+  h2 { color: #C678DD; font-size: 1em; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  th { color: #5C6370; text-align: left; }
+  th, td { padding: .4em 1em; border-bottom: 1px solid #3E4451; vertical-align: top; }
+  input { background: #1E2127; color: #E5C07B; border: 1px solid #3E4451; padding: .3em; margin: .2em; }
+  button { background: #3E4451; color: #ABB2BF; border: 0; padding: .3em .8em; cursor: pointer; }
+  .active { color: #98C379; } .inactive { color: #E06C75; } .degraded { color: #E5C07B; } .error { color: #E06C75; }
+  pre { color: #5C6370; max-height: 12em; overflow: auto; margin: 0; }
+</style>
+</head>
+<body>
+<h1>SSH TUNNEL MANAGER <small>v{{.Version}}</small></h1>
+<div id="auth" hidden>
+  <input id="token" type="password" placeholder="access token" size="40">
+  <button onclick="saveToken()">Sign in</button>
+</div>
+<div id="app" hidden>
+  <table>
+    <thead><tr><th>Tag</th><th>Host</th><th>Ports</th><th>Status</th><th>Logs</th><th></th></tr></thead>
+    <tbody id="tunnels"></tbody>
+  </table>
+  <h2>New tunnel</h2>
+  <form id="create" onsubmit="createTunnel(event)">
+    <select name="type" onchange="typeChanged(this.form)"><option value="">local (-L)</option><option value="remote">remote (-R)</option><option value="socks">SOCKS proxy (-D)</option></select>
+    <input name="host" placeholder="host" required>
+    <input name="remote_host" placeholder="destination (default localhost)">
+    <input name="remote_port" placeholder="remote port" size="8" required>
+    <input name="local_port" placeholder="local port" size="8" required>
+    <input name="tag" placeholder="tag (optional)">
+    <input name="proxy" placeholder="proxy (optional)">
+    <input name="smoke_test" placeholder="smoke test (optional)">
+    <button>Start</button>
+    <span id="create-status"></span>
+  </form>
+</div>
+<script>
+let token = localStorage.getItem("tunnel-token") || new URLSearchParams(location.search).get("token");
+
+function saveToken() {
+  token = document.getElementById("token").value;
+  refresh();
+}
+
+async function api(method, path, body) {
+  const res = await fetch(path, {
+    method,
+    headers: {"Authorization": "Bearer " + token, "Content-Type": "application/json"},
+    body: body && JSON.stringify(body),
+  });
+  if (res.status === 401) {
+    localStorage.removeItem("tunnel-token");
+    document.getElementById("auth").hidden = false;
+    document.getElementById("app").hidden = true;
+    throw new Error("unauthorized");
+  }
+  if (res.status === 204) return null;
+  const data = await res.json();
+  if (!res.ok) throw new Error(data.error);
+  return data;
+}
+
+function cell(row, text, cls) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (cls) td.className = cls;
+  return td;
+}
+
+async function refresh() {
+  if (!token) { document.getElementById("auth").hidden = false; return; }
+  const tunnels = await api("GET", "/api/tunnels");
+  localStorage.setItem("tunnel-token", token);
+  document.getElementById("auth").hidden = true;
+  document.getElementById("app").hidden = false;
+
+  const body = document.getElementById("tunnels");
+  body.innerHTML = "";
+  for (const t of tunnels) {
+    const row = body.insertRow();
+    cell(row, t.tag);
+    cell(row, t.host);
+    const ports = [t, ...(t.forwards || [])].map(f => f.type === "socks" ? "SOCKS " + f.local_port : f.local_port + (f.type === "remote" ? " ← " : " → ") + (f.remote_host ? f.remote_host + ":" : "") + f.remote_port).join(", ");
+    cell(row, ports + (t.protocol ? " (" + t.protocol + ")" : ""));
+    const status = t.degraded ? "degraded" : t.active ? "active" : "inactive";
+    cell(row, "● " + status, status);
+    const pre = document.createElement("pre");
+    pre.textContent = t.logs.slice(-10).join("\n");
+    cell(row, "").appendChild(pre);
+    const del = document.createElement("button");
+    del.textContent = "delete";
+    del.onclick = () => confirm("Delete " + t.tag + "?") && api("DELETE", "/api/tunnels/" + t.id).then(refresh);
+    cell(row, "").appendChild(del);
+  }
+}
+
+// A SOCKS proxy has no remote port; only a local forward has a destination
+function typeChanged(form) {
+  form.remote_port.hidden = form.remote_port.disabled = form.type.value === "socks";
+  form.remote_host.hidden = form.remote_host.disabled = form.type.value !== "";
+}
+
+async function createTunnel(event) {
+  event.preventDefault();
+  const status = document.getElementById("create-status");
+  const spec = {};
+  for (const [k, v] of new FormData(event.target)) if (v) spec[k] = v;
+  status.textContent = "connecting...";
+  status.className = "";
+  try {
+    await api("POST", "/api/tunnels", spec);
+    status.textContent = "started";
+    event.target.reset();
+    typeChanged(event.target);
+  } catch (e) {
+    status.textContent = e.message;
+    status.className = "error";
+  }
+  refresh();
+}
+
+refresh();
+setInterval(() => token && refresh().catch(() => {}), 2000);
+</script>
+</body>
+</html>
+`))